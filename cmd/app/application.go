@@ -3,15 +3,33 @@ package app
 import (
 	"context"
 	"errors"
+	"expvar"
 	"fmt"
+	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"time"
 	"wallet_controller/config"
+	"wallet_controller/internal/audit"
+	"wallet_controller/internal/cache"
+	"wallet_controller/internal/grpcserver"
+	"wallet_controller/internal/notify"
+	"wallet_controller/internal/outbox"
+	"wallet_controller/internal/queue"
+	"wallet_controller/internal/repository"
 	"wallet_controller/internal/router"
+	"wallet_controller/internal/schedule"
+	"wallet_controller/internal/service"
+	"wallet_controller/internal/snapshot"
 	"wallet_controller/internal/storage"
+	"wallet_controller/internal/webhook"
+
+	"google.golang.org/grpc"
 )
 
+const shutdownTimeout = 10 * time.Second
+
 func StartApplication(ctx context.Context) error {
 	cfg := config.GetConfig()
 
@@ -20,7 +38,100 @@ func StartApplication(ctx context.Context) error {
 	cfg.Client = storage.NewConnection(ctx, cfg)
 	defer cfg.Client.Close()
 
-	r := router.SetupRouter(ctx, cfg)
+	if err := storage.DataInsert(cfg.Client); err != nil {
+		return fmt.Errorf("failed to insert demo data: %w", err)
+	}
+
+	var reads *storage.ReadRouter
+	if cfg.Replica = storage.NewReplicaConnection(ctx, cfg); cfg.Replica != nil {
+		defer cfg.Replica.Close()
+
+		reads = storage.NewReadRouter(cfg.Client, cfg.Replica, storage.ReadRouterConfig{
+			MaxLag:        cfg.Env.DbReplicaMaxLag,
+			CheckInterval: cfg.Env.DbReplicaCheckInterval,
+			Window:        cfg.Env.ReadYourWritesWindow,
+		})
+		go reads.Run(ctx)
+		expvar.Publish("replica", expvar.Func(func() any { return reads.Stats() }))
+	}
+
+	publisher, err := outbox.NewPublisher(cfg.Env.OutboxPublisher, cfg.Env.OutboxWebhookURL, cfg.Env.OutboxFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to create outbox publisher: %w", err)
+	}
+	if closer, ok := publisher.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	webhookRepo := repository.NewWebhookRepository(cfg.Client)
+	publishers := outbox.MultiPublisher{webhook.NewDispatcher(webhookRepo)}
+	if publisher != nil {
+		publishers = append(publishers, publisher)
+	}
+
+	relay := outbox.NewRelay(
+		repository.NewOutboxRepository(cfg.Client),
+		publishers,
+		cfg.Env.OutboxPollInterval,
+		cfg.Env.OutboxBatchSize,
+	)
+	go relay.Run(ctx)
+
+	webhookWorker := webhook.NewWorker(webhookRepo, webhook.WorkerConfig{
+		Interval:    cfg.Env.WebhookPollInterval,
+		BatchSize:   cfg.Env.WebhookBatchSize,
+		MaxAttempts: cfg.Env.WebhookMaxAttempts,
+		RetryBase:   cfg.Env.WebhookRetryBase,
+		RetryMax:    cfg.Env.WebhookRetryMax,
+		Timeout:     cfg.Env.WebhookTimeout,
+	})
+	go webhookWorker.Run(ctx)
+
+	snapshotWorker := snapshot.NewWorker(
+		repository.NewSnapshotRepository(cfg.Client),
+		cfg.Env.SnapshotInterval,
+		cfg.Env.SnapshotMinOperations,
+	)
+	go snapshotWorker.Run(ctx)
+
+	var walletCache cache.WalletCache
+	if cfg.Env.WalletCacheSize > 0 {
+		walletCache = cache.NewLRU(cfg.Env.WalletCacheSize, cfg.Env.WalletCacheTTL)
+		// an invalidation is remembered for the TTL, a replica read older than that could
+		// put a changed wallet back in the cache
+		if staleness := reads.MaxStaleness(); staleness >= cfg.Env.WalletCacheTTL {
+			slog.Warn("wallet cache TTL is shorter than the replica staleness, cached wallets may be stale",
+				"ttl", cfg.Env.WalletCacheTTL, "staleness", staleness)
+		}
+		expvar.Publish("wallet_cache", expvar.Func(func() any { return walletCache.Stats() }))
+	}
+
+	// one service for HTTP, gRPC and the workers, so they share the cache and the read routing
+	walletService := service.NewWalletService(repository.NewCachedWalletRepository(repository.NewReplicatedWalletRepository(cfg.Client, reads), walletCache, reads))
+
+	auditChainer := audit.NewChainer(repository.NewAuditRepository(cfg.Client), cfg.Env.AuditChainInterval, cfg.Env.AuditChainBatchSize)
+	go auditChainer.Run(ctx)
+
+	scheduleWorker := schedule.NewWorker(repository.NewScheduleRepository(cfg.Client), walletService, schedule.WorkerConfig{
+		Interval:    cfg.Env.SchedulePollInterval,
+		BatchSize:   cfg.Env.ScheduleBatchSize,
+		MaxAttempts: cfg.Env.ScheduleMaxAttempts,
+		RetryBase:   cfg.Env.ScheduleRetryBase,
+		RetryMax:    cfg.Env.ScheduleRetryMax,
+	})
+	go scheduleWorker.Run(audit.WithOrigin(ctx, audit.Origin{Principal: "scheduler"}))
+
+	queueWorker := queue.NewWorker(repository.NewOperationQueueRepository(cfg.Client), queue.WorkerConfig{
+		Interval:  cfg.Env.QueuePollInterval,
+		Wallets:   cfg.Env.QueueWallets,
+		BatchSize: cfg.Env.QueueBatchSize,
+	})
+	go queueWorker.Run(ctx)
+
+	broker := notify.NewBroker()
+	go notify.Listen(ctx, cfg.Client, broker, walletCache)
+
+	r := router.SetupRouter(ctx, cfg, walletService, broker, reads)
 
 	addr := fmt.Sprintf("%s:%d", cfg.Env.IpAddress, cfg.Env.ApiPort)
 
@@ -36,16 +147,78 @@ func StartApplication(ctx context.Context) error {
 		slog.Info("Starting http server on", "address", addr)
 
 		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			slog.Error("failed to start server", err.Error(), nil)
+			slog.Error("failed to start server", "error", err.Error())
+			panic(err)
+		}
+	}()
+
+	// expvar metrics are for operators only, so they are not served on the public port
+	var adminServer *http.Server
+	if cfg.Env.AdminAddress != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/debug/vars", expvar.Handler())
+
+		adminServer = &http.Server{
+			Addr:         cfg.Env.AdminAddress,
+			Handler:      mux,
+			WriteTimeout: time.Second * 30,
+			ReadTimeout:  time.Second * 30,
+		}
+
+		go func() {
+			slog.Info("Starting admin server on", "address", cfg.Env.AdminAddress)
+
+			if err := adminServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("failed to start admin server", "error", err.Error())
+				panic(err)
+			}
+		}()
+	}
+
+	grpcAddr := fmt.Sprintf("%s:%d", cfg.Env.IpAddress, cfg.Env.GrpcPort)
+	listener, err := net.Listen("tcp", grpcAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", grpcAddr, err)
+	}
+
+	grpcServer := grpcserver.NewServer(grpcserver.NewWalletServer(walletService, broker, ctx.Done()))
+
+	go func() {
+		slog.Info("Starting grpc server on", "address", grpcAddr)
+
+		if err := grpcServer.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			slog.Error("failed to start grpc server", "error", err.Error())
 			panic(err)
 		}
 	}()
 
 	<-ctx.Done()
 	slog.Info("Shutting down application")
-	if err := server.Shutdown(ctx); err != nil {
-		slog.Error("failed to shutdown server", err.Error(), nil)
-		panic(err)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("failed to shutdown server", "error", err.Error())
+	}
+	if adminServer != nil {
+		if err := adminServer.Shutdown(shutdownCtx); err != nil {
+			slog.Error("failed to shutdown admin server", "error", err.Error())
+		}
 	}
+
+	select {
+	case <-stopped:
+	case <-shutdownCtx.Done():
+		slog.Warn("grpc server did not stop in time, closing connections")
+		grpcServer.Stop()
+	}
+
 	return nil
 }
@@ -0,0 +1,508 @@
+// Package cli implements the admin commands of the service. They go through
+// WalletService, so the same business rules apply as in the API, and are audited
+// as made by the operating system user.
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"wallet_controller/internal/entity"
+	"wallet_controller/internal/service"
+	"wallet_controller/internal/statement"
+
+	"github.com/google/uuid"
+)
+
+const Usage = `Usage: wallet_controller <command> [flags] [arguments]
+
+Commands:
+  serve                                          run the HTTP and gRPC servers (default)
+  migrate                                        apply the database schema
+  wallet create [flags]                          open a wallet
+  wallet show <wallet id>                        print a wallet
+  wallet list [flags]                            list wallets
+  wallet freeze -reason <code> [flags] <id>      freeze a wallet or hold money on it
+  wallet unfreeze <wallet id>                    lift the freeze of a wallet
+  wallet freezes <wallet id>                     print the freeze history of a wallet
+  wallet shards -count <n> <wallet id>           spread deposits over n balance shards
+  op deposit [flags] <wallet id> <amount>        deposit rubles to a wallet
+  op withdraw [flags] <wallet id> <amount>       withdraw rubles from a wallet
+  op reverse [-description text] <operation id>  cancel an operation
+  reconcile                                      check balances against operations
+  export -wallet <id> -from <time> -to <time>    write a statement of a wallet
+  audit verify                                   check the audit log hash chain
+  loadgen [flags]                                benchmark a running service over HTTP
+
+Run "<command> -h" for the flags of a command.
+`
+
+// ErrUsage is returned for unknown commands and invalid arguments.
+var ErrUsage = errors.New("invalid usage")
+
+// ErrDiscrepancies is returned by reconcile when balances disagree with operations.
+var ErrDiscrepancies = errors.New("balances disagree with operations")
+
+// Known tells whether name is a command handled by CLI.Run.
+func Known(name string) bool {
+	switch name {
+	case "wallet", "op", "reconcile", "export", "audit":
+		return true
+	default:
+		return false
+	}
+}
+
+type CLI struct {
+	walletService service.WalletServiceInterface
+	auditService  service.AuditServiceInterface
+	stdout        io.Writer
+	stderr        io.Writer
+}
+
+func New(walletService service.WalletServiceInterface, auditService service.AuditServiceInterface, stdout, stderr io.Writer) *CLI {
+	return &CLI{
+		walletService: walletService,
+		auditService:  auditService,
+		stdout:        stdout,
+		stderr:        stderr,
+	}
+}
+
+// Run executes the admin command in args, args[0] is the command name.
+func (c *CLI) Run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return c.usage()
+	}
+
+	switch args[0] {
+	case "wallet":
+		if len(args) < 2 {
+			return c.usage()
+		}
+		switch args[1] {
+		case "create":
+			return c.walletCreate(ctx, args[2:])
+		case "show":
+			return c.walletShow(ctx, args[2:])
+		case "list":
+			return c.walletList(ctx, args[2:])
+		case "freeze":
+			return c.walletFreeze(ctx, args[2:])
+		case "unfreeze":
+			return c.walletUnfreeze(ctx, args[2:])
+		case "freezes":
+			return c.walletFreezes(ctx, args[2:])
+		case "shards":
+			return c.walletShards(ctx, args[2:])
+		}
+	case "op":
+		if len(args) < 2 {
+			return c.usage()
+		}
+		switch args[1] {
+		case "deposit":
+			return c.opAdd(ctx, "DEPOSIT", args[2:])
+		case "withdraw":
+			return c.opAdd(ctx, "WITHDRAW", args[2:])
+		case "reverse":
+			return c.opReverse(ctx, args[2:])
+		}
+	case "reconcile":
+		return c.reconcile(ctx, args[1:])
+	case "export":
+		return c.export(ctx, args[1:])
+	case "audit":
+		if len(args) >= 2 && args[1] == "verify" {
+			return c.auditVerify(ctx, args[2:])
+		}
+	}
+
+	return c.usage()
+}
+
+func (c *CLI) walletCreate(ctx context.Context, args []string) error {
+	var create entity.WalletCreate
+	labels := labelsFlag{}
+
+	flags := c.newFlagSet("wallet create")
+	walletID := flags.String("id", "", "wallet `ID`, generated when empty")
+	flags.StringVar(&create.OwnerID, "owner", "", "owner ID")
+	flags.StringVar(&create.DisplayName, "name", "", "display name")
+	flags.Var(labels, "label", "`key:value` label, may be repeated")
+	flags.StringVar(&create.ExternalReference, "external-reference", "", "wallet ID in an external system")
+	flags.IntVar(&create.CreditLimit, "credit-limit", 0, "credit limit in kopecks")
+	flags.IntVar(&create.MinBalance, "min-balance", 0, "minimum balance in kopecks")
+	if err := c.parse(flags, args, 0); err != nil {
+		return err
+	}
+
+	if *walletID != "" {
+		id, err := uuid.Parse(*walletID)
+		if err != nil {
+			return fmt.Errorf("%w: invalid wallet id %q", ErrUsage, *walletID)
+		}
+		create.ID = id
+	}
+	if create.CreditLimit < 0 || create.MinBalance < 0 {
+		return fmt.Errorf("%w: credit limit and minimum balance must not be negative", ErrUsage)
+	}
+	create.Labels = labels
+
+	wallet, err := c.walletService.CreateWallet(ctx, create)
+	if err != nil {
+		return err
+	}
+
+	return c.print(wallet)
+}
+
+func (c *CLI) walletShow(ctx context.Context, args []string) error {
+	flags := c.newFlagSet("wallet show")
+	if err := c.parse(flags, args, 1); err != nil {
+		return err
+	}
+
+	walletID, err := parseID("wallet", flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	wallet, err := c.walletService.GetWallet(ctx, walletID)
+	if err != nil {
+		return err
+	}
+
+	return c.print(wallet)
+}
+
+func (c *CLI) walletList(ctx context.Context, args []string) error {
+	filter := entity.WalletFilter{Labels: labelsFlag{}}
+
+	flags := c.newFlagSet("wallet list")
+	flags.StringVar(&filter.OwnerID, "owner", "", "only wallets of this owner")
+	flags.Var(labelsFlag(filter.Labels), "label", "`key:value` label the wallets must have, may be repeated")
+	after := flags.String("after", "", "list wallets with IDs after this `ID`")
+	flags.IntVar(&filter.Limit, "limit", 100, "maximum number of wallets")
+	if err := c.parse(flags, args, 0); err != nil {
+		return err
+	}
+
+	if *after != "" {
+		afterID, err := parseID("after", *after)
+		if err != nil {
+			return err
+		}
+		filter.After = afterID
+	}
+	if filter.Limit <= 0 {
+		return fmt.Errorf("%w: limit must be positive", ErrUsage)
+	}
+
+	wallets, err := c.walletService.SearchWallets(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	return c.print(wallets)
+}
+
+func (c *CLI) walletFreeze(ctx context.Context, args []string) error {
+	var freeze entity.Freeze
+
+	flags := c.newFlagSet("wallet freeze")
+	flags.StringVar(&freeze.Mode, "mode", entity.FreezeFull, "FULL, DEPOSIT_ONLY or empty to only hold money")
+	flags.StringVar(&freeze.Reason, "reason", "", "reason `code`: FRAUD, AML, SANCTIONS, COURT_ORDER, CUSTOMER_REQUEST or OTHER")
+	until := flags.String("until", "", "end of the block, RFC 3339, no end when empty")
+	flags.IntVar(&freeze.HoldAmount, "hold", 0, "amount in kopecks that can not be withdrawn")
+	if err := c.parse(flags, args, 1); err != nil {
+		return err
+	}
+
+	walletID, err := parseID("wallet", flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if freeze.Reason == "" {
+		return fmt.Errorf("%w: reason is required", ErrUsage)
+	}
+	if *until != "" {
+		untilTime, err := time.Parse(time.RFC3339, *until)
+		if err != nil {
+			return fmt.Errorf("%w: until must be an RFC 3339 timestamp", ErrUsage)
+		}
+		freeze.Until = &untilTime
+	}
+
+	wallet, err := c.walletService.FreezeWallet(ctx, walletID, freeze)
+	if err != nil {
+		return err
+	}
+
+	return c.print(wallet)
+}
+
+func (c *CLI) walletUnfreeze(ctx context.Context, args []string) error {
+	flags := c.newFlagSet("wallet unfreeze")
+	if err := c.parse(flags, args, 1); err != nil {
+		return err
+	}
+
+	walletID, err := parseID("wallet", flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	wallet, err := c.walletService.UnfreezeWallet(ctx, walletID)
+	if err != nil {
+		return err
+	}
+
+	return c.print(wallet)
+}
+
+func (c *CLI) walletFreezes(ctx context.Context, args []string) error {
+	flags := c.newFlagSet("wallet freezes")
+	if err := c.parse(flags, args, 1); err != nil {
+		return err
+	}
+
+	walletID, err := parseID("wallet", flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	events, err := c.walletService.GetFreezeHistory(ctx, walletID)
+	if err != nil {
+		return err
+	}
+
+	return c.print(events)
+}
+
+func (c *CLI) walletShards(ctx context.Context, args []string) error {
+	flags := c.newFlagSet("wallet shards")
+	count := flags.Int("count", -1, "number of balance shards, 0 turns them off")
+	if err := c.parse(flags, args, 1); err != nil {
+		return err
+	}
+
+	walletID, err := parseID("wallet", flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *count < 0 || *count > service.MaxBalanceShards {
+		return fmt.Errorf("%w: count must be between 0 and %d", ErrUsage, service.MaxBalanceShards)
+	}
+
+	wallet, err := c.walletService.SetBalanceShards(ctx, walletID, *count)
+	if err != nil {
+		return err
+	}
+
+	return c.print(wallet)
+}
+
+func (c *CLI) opAdd(ctx context.Context, operationType string, args []string) error {
+	var details entity.OperationDetails
+
+	flags := c.newFlagSet("op " + strings.ToLower(operationType))
+	flags.StringVar(&details.Description, "description", "", "operation description")
+	flags.StringVar(&details.ExternalReference, "reference", "", "ID of the operation in the upstream system")
+	if err := c.parse(flags, args, 2); err != nil {
+		return err
+	}
+
+	walletID, err := parseID("wallet", flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	amount, err := strconv.Atoi(flags.Arg(1))
+	if err != nil || amount <= 0 {
+		return fmt.Errorf("%w: amount must be a positive number of rubles", ErrUsage)
+	}
+
+	result, err := c.walletService.AddOperation(ctx, &entity.OperationRequest{
+		WalletID:         walletID,
+		OperationType:    operationType,
+		Amount:           amount,
+		OperationDetails: details,
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.print(result)
+}
+
+func (c *CLI) opReverse(ctx context.Context, args []string) error {
+	var details entity.OperationDetails
+
+	flags := c.newFlagSet("op reverse")
+	flags.StringVar(&details.Description, "description", "", "reversal description")
+	if err := c.parse(flags, args, 1); err != nil {
+		return err
+	}
+
+	operationID, err := parseID("operation", flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	result, err := c.walletService.ReverseOperation(ctx, operationID, details)
+	if err != nil {
+		return err
+	}
+
+	return c.print(result)
+}
+
+func (c *CLI) reconcile(ctx context.Context, args []string) error {
+	flags := c.newFlagSet("reconcile")
+	if err := c.parse(flags, args, 0); err != nil {
+		return err
+	}
+
+	discrepancies, err := c.walletService.Reconcile(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err = c.print(discrepancies); err != nil {
+		return err
+	}
+	if len(discrepancies) > 0 {
+		return fmt.Errorf("%w: %d discrepancies", ErrDiscrepancies, len(discrepancies))
+	}
+
+	return nil
+}
+
+func (c *CLI) export(ctx context.Context, args []string) error {
+	flags := c.newFlagSet("export")
+	walletIDStr := flags.String("wallet", "", "wallet `ID`")
+	fromStr := flags.String("from", "", "start of the period, RFC 3339")
+	toStr := flags.String("to", "", "end of the period, RFC 3339, now when empty")
+	format := flags.String("format", statement.FormatCSV, "csv, jsonl or pdf")
+	out := flags.String("out", "", "output `file`, standard output when empty")
+	if err := c.parse(flags, args, 0); err != nil {
+		return err
+	}
+
+	walletID, err := parseID("wallet", *walletIDStr)
+	if err != nil {
+		return err
+	}
+	from, err := time.Parse(time.RFC3339, *fromStr)
+	if err != nil {
+		return fmt.Errorf("%w: from must be an RFC 3339 timestamp", ErrUsage)
+	}
+	to := time.Now()
+	if *toStr != "" {
+		if to, err = time.Parse(time.RFC3339, *toStr); err != nil {
+			return fmt.Errorf("%w: to must be an RFC 3339 timestamp", ErrUsage)
+		}
+	}
+	if !to.After(from) {
+		return fmt.Errorf("%w: to must be after from", ErrUsage)
+	}
+
+	w := c.stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	writer, err := statement.NewWriter(*format, w)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrUsage, err.Error())
+	}
+
+	return c.walletService.WriteStatement(ctx, walletID, from, to, writer)
+}
+
+// auditVerify recomputes the audit log chain. The printed head is worth keeping outside
+// the database: a log cut off together with its head can only be told by it.
+func (c *CLI) auditVerify(ctx context.Context, args []string) error {
+	flags := c.newFlagSet("audit verify")
+	if err := c.parse(flags, args, 0); err != nil {
+		return err
+	}
+
+	report, err := c.auditService.Verify(ctx)
+	if err != nil {
+		return err
+	}
+
+	return c.print(report)
+}
+
+func (c *CLI) newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	return flags
+}
+
+// parse parses flags and checks that exactly argsCount positional arguments follow them.
+func (c *CLI) parse(flags *flag.FlagSet, args []string, argsCount int) error {
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("%w: %s", ErrUsage, err.Error())
+	}
+	if flags.NArg() != argsCount {
+		flags.Usage()
+		return fmt.Errorf("%w: %s takes %d arguments, got %d", ErrUsage, flags.Name(), argsCount, flags.NArg())
+	}
+
+	return nil
+}
+
+func (c *CLI) usage() error {
+	fmt.Fprint(c.stderr, Usage)
+	return ErrUsage
+}
+
+func (c *CLI) print(value any) error {
+	encoder := json.NewEncoder(c.stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+func parseID(name, value string) (uuid.UUID, error) {
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%w: invalid %s id %q", ErrUsage, name, value)
+	}
+
+	return id, nil
+}
+
+// labelsFlag collects repeated key:value flags.
+type labelsFlag map[string]string
+
+func (l labelsFlag) String() string {
+	pairs := make([]string, 0, len(l))
+	for key, value := range l {
+		pairs = append(pairs, key+":"+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (l labelsFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, ":")
+	if !ok || key == "" {
+		return errors.New("label must be in key:value form")
+	}
+	l[key] = val
+	return nil
+}
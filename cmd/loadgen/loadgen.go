@@ -0,0 +1,421 @@
+// Package loadgen drives a mix of reads and operations at a running service over
+// HTTP and reports throughput, latency percentiles and errors.
+package loadgen
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"wallet_controller/cmd/cli"
+	"wallet_controller/internal/entity"
+
+	"github.com/google/uuid"
+)
+
+// Request kinds of the mix.
+const (
+	KindRead     = "read"
+	KindDeposit  = "deposit"
+	KindWithdraw = "withdraw"
+	KindTransfer = "transfer"
+)
+
+// statusError is the status of requests that got no HTTP response.
+const statusError = "error"
+
+// Mix holds the relative weights of the request kinds.
+type Mix struct {
+	Read     int
+	Deposit  int
+	Withdraw int
+	Transfer int
+}
+
+// ParseMix parses weights like "read=20,deposit=40,withdraw=30,transfer=10",
+// kinds that are left out get no requests.
+func ParseMix(value string) (Mix, error) {
+	var mix Mix
+	for _, part := range strings.Split(value, ",") {
+		kind, weightStr, ok := strings.Cut(strings.TrimSpace(part), "=")
+		weight, err := strconv.Atoi(weightStr)
+		if !ok || err != nil || weight < 0 {
+			return Mix{}, fmt.Errorf("invalid mix entry %q, want kind=weight", part)
+		}
+
+		switch kind {
+		case KindRead:
+			mix.Read = weight
+		case KindDeposit:
+			mix.Deposit = weight
+		case KindWithdraw:
+			mix.Withdraw = weight
+		case KindTransfer:
+			mix.Transfer = weight
+		default:
+			return Mix{}, fmt.Errorf("unknown request kind %q", kind)
+		}
+	}
+
+	if mix.total() == 0 {
+		return Mix{}, errors.New("mix must have a positive weight")
+	}
+
+	return mix, nil
+}
+
+func (m Mix) total() int {
+	return m.Read + m.Deposit + m.Withdraw + m.Transfer
+}
+
+func (m Mix) pick(random *rand.Rand) string {
+	n := random.Intn(m.total())
+	switch {
+	case n < m.Read:
+		return KindRead
+	case n < m.Read+m.Deposit:
+		return KindDeposit
+	case n < m.Read+m.Deposit+m.Withdraw:
+		return KindWithdraw
+	default:
+		return KindTransfer
+	}
+}
+
+type Config struct {
+	URL         string
+	RPS         int
+	Duration    time.Duration
+	Concurrency int
+	Timeout     time.Duration
+	Mix         Mix
+	// Wallets are used as they are, NewWallets are created and funded when it is empty.
+	Wallets    []uuid.UUID
+	NewWallets int
+	Fund       int
+	// HotShare of the requests go to the first HotWallets wallets.
+	HotWallets int
+	HotShare   float64
+	MaxAmount  int
+	Seed       int64
+	JSON       bool
+}
+
+const Usage = `Usage: wallet_controller loadgen [flags]
+
+Sends requests to a running service at a fixed rate and prints a report.
+Wallets given with -wallet are reused, otherwise -wallets new ones are created
+in the configured database and funded through the API before the run.
+
+Flags:
+`
+
+// ParseFlags reads the loadgen command line, errors wrap cli.ErrUsage.
+func ParseFlags(args []string, stderr io.Writer) (Config, error) {
+	cfg := Config{}
+	wallets := walletsFlag{wallets: &cfg.Wallets}
+
+	flags := flag.NewFlagSet("loadgen", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, Usage)
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&cfg.URL, "url", "http://localhost:8080", "base `URL` of the service")
+	flags.IntVar(&cfg.RPS, "rps", 100, "target requests per second")
+	flags.DurationVar(&cfg.Duration, "duration", 30*time.Second, "length of the run")
+	flags.IntVar(&cfg.Concurrency, "concurrency", 64, "maximum requests in flight")
+	flags.DurationVar(&cfg.Timeout, "timeout", 5*time.Second, "timeout of a single request")
+	mix := flags.String("mix", "read=20,deposit=35,withdraw=35,transfer=10", "relative weights of the request kinds")
+	flags.Var(wallets, "wallet", "existing wallet `ID` to use, may be repeated")
+	flags.IntVar(&cfg.NewWallets, "wallets", 10, "number of wallets to create when no -wallet is given")
+	flags.IntVar(&cfg.Fund, "fund", 100000, "rubles deposited to each created wallet")
+	flags.IntVar(&cfg.HotWallets, "hot-wallets", 1, "number of hot wallets")
+	flags.Float64Var(&cfg.HotShare, "hot-share", 0.5, "share of the requests going to the hot wallets")
+	flags.IntVar(&cfg.MaxAmount, "max-amount", 100, "maximum amount of an operation in rubles")
+	flags.Int64Var(&cfg.Seed, "seed", time.Now().UnixNano(), "seed of the random choices")
+	flags.BoolVar(&cfg.JSON, "json", false, "print the report as JSON")
+
+	if err := flags.Parse(args); err != nil {
+		return Config{}, fmt.Errorf("%w: %s", cli.ErrUsage, err.Error())
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return Config{}, fmt.Errorf("%w: loadgen takes no arguments", cli.ErrUsage)
+	}
+
+	var err error
+	if cfg.Mix, err = ParseMix(*mix); err != nil {
+		return Config{}, fmt.Errorf("%w: %s", cli.ErrUsage, err.Error())
+	}
+	if err = cfg.validate(); err != nil {
+		return Config{}, fmt.Errorf("%w: %s", cli.ErrUsage, err.Error())
+	}
+
+	return cfg, nil
+}
+
+func (c Config) validate() error {
+	walletsCount := len(c.Wallets)
+	if walletsCount == 0 {
+		walletsCount = c.NewWallets
+	}
+
+	switch {
+	case c.RPS <= 0 || c.Duration <= 0 || c.Concurrency <= 0 || c.Timeout <= 0:
+		return errors.New("rps, duration, concurrency and timeout must be positive")
+	case c.Mix.total() <= 0:
+		return errors.New("mix must have a positive weight")
+	case walletsCount <= 0:
+		return errors.New("at least one wallet is needed")
+	case c.HotWallets < 0 || c.HotWallets > walletsCount:
+		return fmt.Errorf("hot wallets must be between 0 and %d", walletsCount)
+	case c.HotShare < 0 || c.HotShare > 1:
+		return errors.New("hot share must be between 0 and 1")
+	case c.MaxAmount <= 0 || c.Fund < 0:
+		return errors.New("max amount must be positive and fund must not be negative")
+	}
+
+	return nil
+}
+
+// WalletCreator opens the wallets of a run when none are given.
+type WalletCreator interface {
+	CreateWallet(ctx context.Context, create entity.WalletCreate) (*entity.Wallet, error)
+}
+
+type Generator struct {
+	cfg     Config
+	client  *http.Client
+	creator WalletCreator
+}
+
+// New returns a generator, creator may be nil when cfg.Wallets is set.
+func New(cfg Config, creator WalletCreator) *Generator {
+	return &Generator{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		creator: creator,
+	}
+}
+
+// Run drives the load until the duration passes or ctx is cancelled.
+func (g *Generator) Run(ctx context.Context) (*Report, error) {
+	if err := g.cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	wallets, err := g.wallets(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	collector := newCollector()
+	jobs := make(chan time.Time, g.cfg.Concurrency)
+
+	var wg sync.WaitGroup
+	for i := 0; i < g.cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func(random *rand.Rand) {
+			defer wg.Done()
+			for scheduled := range jobs {
+				collector.add(g.request(ctx, random, wallets, scheduled))
+			}
+		}(rand.New(rand.NewSource(g.cfg.Seed + int64(i))))
+	}
+
+	// Requests are sent on a fixed schedule and timed from the moment they were due,
+	// so a slow service shows up in the latencies instead of lowering the rate.
+	interval := time.Second / time.Duration(g.cfg.RPS)
+	start := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+schedule:
+	for i := 0; ; i++ {
+		scheduled := start.Add(time.Duration(i) * interval)
+		if scheduled.Sub(start) >= g.cfg.Duration {
+			break
+		}
+
+		timer.Reset(time.Until(scheduled))
+		select {
+		case <-ctx.Done():
+			break schedule
+		case <-timer.C:
+		}
+
+		select {
+		case jobs <- scheduled:
+		default:
+			collector.drop()
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return collector.report(time.Since(start)), nil
+}
+
+// wallets returns the wallets of the run, creating and funding them when none are configured.
+func (g *Generator) wallets(ctx context.Context) ([]uuid.UUID, error) {
+	if len(g.cfg.Wallets) > 0 {
+		return g.cfg.Wallets, nil
+	}
+	if g.creator == nil {
+		return nil, errors.New("no wallets given and no way to create them")
+	}
+
+	wallets := make([]uuid.UUID, 0, g.cfg.NewWallets)
+	for i := 0; i < g.cfg.NewWallets; i++ {
+		wallet, err := g.creator.CreateWallet(ctx, entity.WalletCreate{
+			DisplayName: "loadgen",
+			Labels:      map[string]string{"source": "loadgen"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("create wallet: %w", err)
+		}
+
+		if g.cfg.Fund > 0 {
+			status, err := g.operation(ctx, wallet.ID, "DEPOSIT", g.cfg.Fund)
+			if err != nil {
+				return nil, fmt.Errorf("fund wallet %s: %w", wallet.ID, err)
+			}
+			if status != http.StatusOK {
+				return nil, fmt.Errorf("fund wallet %s: status %d", wallet.ID, status)
+			}
+		}
+
+		wallets = append(wallets, wallet.ID)
+	}
+
+	return wallets, nil
+}
+
+// pickWallet sends HotShare of the picks to the hot wallets and spreads the rest over the others.
+func (g *Generator) pickWallet(random *rand.Rand, wallets []uuid.UUID) uuid.UUID {
+	hot := g.cfg.HotWallets
+	if hot > 0 && (hot == len(wallets) || random.Float64() < g.cfg.HotShare) {
+		return wallets[random.Intn(hot)]
+	}
+	return wallets[hot+random.Intn(len(wallets)-hot)]
+}
+
+func (g *Generator) request(ctx context.Context, random *rand.Rand, wallets []uuid.UUID, scheduled time.Time) result {
+	kind := g.cfg.Mix.pick(random)
+	walletID := g.pickWallet(random, wallets)
+	amount := 1 + random.Intn(g.cfg.MaxAmount)
+
+	res := result{kind: kind}
+	var status int
+	var err error
+
+	switch kind {
+	case KindRead:
+		status, err = g.read(ctx, walletID)
+	case KindDeposit:
+		status, err = g.operation(ctx, walletID, "DEPOSIT", amount)
+	case KindWithdraw:
+		status, err = g.operation(ctx, walletID, "WITHDRAW", amount)
+	case KindTransfer:
+		// there is no transfer endpoint, so it is a withdrawal followed by a deposit
+		status, err = g.operation(ctx, walletID, "WITHDRAW", amount)
+		if err == nil && status == http.StatusOK {
+			status, err = g.operation(ctx, g.pickWallet(random, wallets), "DEPOSIT", amount)
+		}
+	}
+
+	res.latency = time.Since(scheduled)
+	switch {
+	case errors.Is(err, errWalletLocked):
+		res.status = strconv.Itoa(http.StatusServiceUnavailable)
+		res.locked = true
+	case err != nil:
+		res.status = statusError
+	default:
+		res.status = strconv.Itoa(status)
+	}
+
+	return res
+}
+
+// errWalletLocked marks a 503 caused by a concurrent operation on the wallet.
+var errWalletLocked = errors.New("wallet locked")
+
+func (g *Generator) read(ctx context.Context, walletID uuid.UUID) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, g.cfg.URL+"/api/v1/wallets/"+walletID.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	return g.do(req)
+}
+
+func (g *Generator) operation(ctx context.Context, walletID uuid.UUID, operationType string, amount int) (int, error) {
+	body, err := json.Marshal(entity.OperationRequest{
+		WalletID:      walletID,
+		OperationType: operationType,
+		Amount:        amount,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.cfg.URL+"/api/v1/wallet", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return g.do(req)
+}
+
+func (g *Generator) do(req *http.Request) (int, error) {
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode == http.StatusServiceUnavailable {
+		return resp.StatusCode, errWalletLocked
+	}
+
+	return resp.StatusCode, nil
+}
+
+// walletsFlag collects repeated wallet IDs.
+type walletsFlag struct {
+	wallets *[]uuid.UUID
+}
+
+func (f walletsFlag) String() string {
+	if f.wallets == nil {
+		return ""
+	}
+	ids := make([]string, 0, len(*f.wallets))
+	for _, id := range *f.wallets {
+		ids = append(ids, id.String())
+	}
+	return strings.Join(ids, ",")
+}
+
+func (f walletsFlag) Set(value string) error {
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return fmt.Errorf("invalid wallet id %q", value)
+	}
+	*f.wallets = append(*f.wallets, id)
+	return nil
+}
@@ -0,0 +1,179 @@
+package loadgen
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+type result struct {
+	kind    string
+	status  string
+	latency time.Duration
+	locked  bool
+}
+
+// Latency percentiles in milliseconds.
+type Latency struct {
+	P50 float64 `json:"p50_ms"`
+	P90 float64 `json:"p90_ms"`
+	P99 float64 `json:"p99_ms"`
+	Max float64 `json:"max_ms"`
+}
+
+type KindReport struct {
+	Requests int            `json:"requests"`
+	Statuses map[string]int `json:"statuses"`
+	Latency  Latency        `json:"latency"`
+}
+
+type Report struct {
+	DurationSeconds float64 `json:"duration_seconds"`
+	Requests        int     `json:"requests"`
+	// Dropped requests were due while all workers were busy and were never sent.
+	Dropped    int                    `json:"dropped"`
+	Throughput float64                `json:"throughput_rps"`
+	Statuses   map[string]int         `json:"statuses"`
+	Latency    Latency                `json:"latency"`
+	Kinds      map[string]*KindReport `json:"kinds"`
+	// LockContention is the share of writes rejected because another operation held the wallet.
+	LockContention float64 `json:"lock_contention"`
+}
+
+// collector gathers the results of the workers.
+type collector struct {
+	mu      sync.Mutex
+	results []result
+	dropped int
+}
+
+func newCollector() *collector {
+	return &collector{}
+}
+
+func (c *collector) add(res result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.results = append(c.results, res)
+}
+
+func (c *collector) drop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dropped++
+}
+
+func (c *collector) report(elapsed time.Duration) *Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	report := &Report{
+		DurationSeconds: elapsed.Seconds(),
+		Requests:        len(c.results),
+		Dropped:         c.dropped,
+		Statuses:        make(map[string]int),
+		Kinds:           make(map[string]*KindReport),
+	}
+	if elapsed > 0 {
+		report.Throughput = float64(len(c.results)) / elapsed.Seconds()
+	}
+
+	all := make([]time.Duration, 0, len(c.results))
+	byKind := make(map[string][]time.Duration)
+	writes, locked := 0, 0
+	for _, res := range c.results {
+		report.Statuses[res.status]++
+		all = append(all, res.latency)
+		byKind[res.kind] = append(byKind[res.kind], res.latency)
+
+		kind, ok := report.Kinds[res.kind]
+		if !ok {
+			kind = &KindReport{Statuses: make(map[string]int)}
+			report.Kinds[res.kind] = kind
+		}
+		kind.Requests++
+		kind.Statuses[res.status]++
+
+		if res.kind != KindRead {
+			writes++
+			if res.locked {
+				locked++
+			}
+		}
+	}
+
+	report.Latency = percentiles(all)
+	for name, latencies := range byKind {
+		report.Kinds[name].Latency = percentiles(latencies)
+	}
+	if writes > 0 {
+		report.LockContention = float64(locked) / float64(writes)
+	}
+
+	return report
+}
+
+func percentiles(latencies []time.Duration) Latency {
+	if len(latencies) == 0 {
+		return Latency{}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	at := func(p float64) float64 {
+		index := int(p * float64(len(latencies)-1))
+		return milliseconds(latencies[index])
+	}
+
+	return Latency{
+		P50: at(0.50),
+		P90: at(0.90),
+		P99: at(0.99),
+		Max: milliseconds(latencies[len(latencies)-1]),
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// WriteText prints the report as a table.
+func (r *Report) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "duration    %.1fs\n", r.DurationSeconds)
+	fmt.Fprintf(w, "requests    %d (%.1f rps), %d dropped\n", r.Requests, r.Throughput, r.Dropped)
+	fmt.Fprintf(w, "contention  %.2f%% of writes hit a locked wallet\n", r.LockContention*100)
+	fmt.Fprintf(w, "statuses    %s\n\n", formatStatuses(r.Statuses))
+
+	fmt.Fprintf(w, "%-10s %9s %9s %9s %9s %9s  %s\n", "kind", "requests", "p50 ms", "p90 ms", "p99 ms", "max ms", "statuses")
+	for _, name := range []string{KindRead, KindDeposit, KindWithdraw, KindTransfer} {
+		kind, ok := r.Kinds[name]
+		if !ok {
+			continue
+		}
+		writeRow(w, name, kind.Requests, kind.Latency, kind.Statuses)
+	}
+	writeRow(w, "total", r.Requests, r.Latency, r.Statuses)
+}
+
+func writeRow(w io.Writer, name string, requests int, latency Latency, statuses map[string]int) {
+	fmt.Fprintf(w, "%-10s %9d %9.2f %9.2f %9.2f %9.2f  %s\n",
+		name, requests, latency.P50, latency.P90, latency.P99, latency.Max, formatStatuses(statuses))
+}
+
+func formatStatuses(statuses map[string]int) string {
+	codes := make([]string, 0, len(statuses))
+	for code := range statuses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	line := ""
+	for i, code := range codes {
+		if i > 0 {
+			line += " "
+		}
+		line += fmt.Sprintf("%s:%d", code, statuses[code])
+	}
+	return line
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
 	"log/slog"
+	"time"
 )
 
 type Env struct {
@@ -15,13 +16,60 @@ type Env struct {
 	DbHost     string `env:"DB_HOST"`
 	IpAddress  string `env:"IP_ADDRESS"`
 	ApiPort    int    `env:"API_PORT"`
+	GrpcPort   int    `env:"GRPC_PORT" envDefault:"9090"`
+	// AdminAddress serves /debug/vars apart from the public API, empty turns it off.
+	AdminAddress string `env:"ADMIN_ADDRESS" envDefault:"127.0.0.1:6060"`
+
+	// DbReplicaDSN is an optional read replica, wallet reads, history and statements go
+	// to it while it lags behind the primary by at most DbReplicaMaxLag.
+	DbReplicaDSN           string        `env:"DB_REPLICA_DSN"`
+	DbReplicaMaxLag        time.Duration `env:"DB_REPLICA_MAX_LAG" envDefault:"1s"`
+	DbReplicaCheckInterval time.Duration `env:"DB_REPLICA_CHECK_INTERVAL" envDefault:"1s"`
+	// ReadYourWritesWindow is how long reads of a client go to the primary after its write.
+	ReadYourWritesWindow time.Duration `env:"READ_YOUR_WRITES_WINDOW" envDefault:"5s"`
 
 	Environment string `env:"ENVIRONMENT"`
+
+	OutboxPublisher    string        `env:"OUTBOX_PUBLISHER" envDefault:"stdout"`
+	OutboxWebhookURL   string        `env:"OUTBOX_WEBHOOK_URL"`
+	OutboxFilePath     string        `env:"OUTBOX_FILE_PATH" envDefault:"outbox.jsonl"`
+	OutboxPollInterval time.Duration `env:"OUTBOX_POLL_INTERVAL" envDefault:"1s"`
+	OutboxBatchSize    int           `env:"OUTBOX_BATCH_SIZE" envDefault:"100"`
+
+	SnapshotInterval      time.Duration `env:"SNAPSHOT_INTERVAL" envDefault:"1m"`
+	SnapshotMinOperations int           `env:"SNAPSHOT_MIN_OPERATIONS" envDefault:"1000"`
+
+	WebhookPollInterval time.Duration `env:"WEBHOOK_POLL_INTERVAL" envDefault:"1s"`
+	WebhookBatchSize    int           `env:"WEBHOOK_BATCH_SIZE" envDefault:"50"`
+	WebhookMaxAttempts  int           `env:"WEBHOOK_MAX_ATTEMPTS" envDefault:"8"`
+	WebhookRetryBase    time.Duration `env:"WEBHOOK_RETRY_BASE" envDefault:"5s"`
+	WebhookRetryMax     time.Duration `env:"WEBHOOK_RETRY_MAX" envDefault:"1h"`
+	WebhookTimeout      time.Duration `env:"WEBHOOK_TIMEOUT" envDefault:"10s"`
+
+	SchedulePollInterval time.Duration `env:"SCHEDULE_POLL_INTERVAL" envDefault:"5s"`
+	ScheduleBatchSize    int           `env:"SCHEDULE_BATCH_SIZE" envDefault:"50"`
+	ScheduleMaxAttempts  int           `env:"SCHEDULE_MAX_ATTEMPTS" envDefault:"5"`
+	ScheduleRetryBase    time.Duration `env:"SCHEDULE_RETRY_BASE" envDefault:"10s"`
+	ScheduleRetryMax     time.Duration `env:"SCHEDULE_RETRY_MAX" envDefault:"10m"`
+
+	QueuePollInterval time.Duration `env:"QUEUE_POLL_INTERVAL" envDefault:"200ms"`
+	QueueWallets      int           `env:"QUEUE_WALLETS" envDefault:"50"`
+	QueueBatchSize    int           `env:"QUEUE_BATCH_SIZE" envDefault:"500"`
+
+	// AuditChainInterval is how often entries written with the changes are linked into the audit chain.
+	AuditChainInterval  time.Duration `env:"AUDIT_CHAIN_INTERVAL" envDefault:"1s"`
+	AuditChainBatchSize int           `env:"AUDIT_CHAIN_BATCH_SIZE" envDefault:"500"`
+
+	// WalletCacheSize of 0 turns the wallet cache off.
+	WalletCacheSize int           `env:"WALLET_CACHE_SIZE" envDefault:"10000"`
+	WalletCacheTTL  time.Duration `env:"WALLET_CACHE_TTL" envDefault:"5s"`
 }
 
 type Config struct {
 	Env    Env
 	Client *pgxpool.Pool
+	// Replica is nil when no read replica is configured.
+	Replica *pgxpool.Pool
 }
 
 var config Config
@@ -35,13 +83,13 @@ func GetConfig() *Config {
 func GetEnv() *Env {
 	err := godotenv.Load("config.env")
 	if err != nil {
-		slog.Warn("Error loading .env file", err.Error())
+		slog.Warn("Error loading .env file", "error", err.Error())
 	}
 
 	var cfg Env
 	err = env.Parse(&cfg)
 	if err != nil {
-		slog.Error("Error parsing .env file:", err.Error())
+		slog.Error("Error parsing .env file", "error", err.Error())
 		panic(err)
 	}
 
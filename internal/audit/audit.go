@@ -0,0 +1,95 @@
+// Package audit describes who makes a change and chains the audit log entries.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+	"wallet_controller/internal/entity"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// SystemPrincipal makes the changes that come with no origin in their context.
+	SystemPrincipal = "system"
+	// AnonymousPrincipal makes the changes that come through the API: the service has
+	// no authentication of its own, so it does not know who the caller is.
+	AnonymousPrincipal = "anonymous"
+)
+
+// GenesisHash is the PrevHash of the first entry.
+var GenesisHash = strings.Repeat("0", sha256.Size*2)
+
+// Origin tells who made a change and where it came from. Principal is who the service
+// itself knows made the change. ClaimedActor is who the caller says it acts for; it is
+// taken from the request as is and nothing checks it.
+type Origin struct {
+	Principal    string
+	ClaimedActor string
+	RequestID    string
+	ClientIP     string
+}
+
+type originKey struct{}
+
+func WithOrigin(ctx context.Context, origin Origin) context.Context {
+	return context.WithValue(ctx, originKey{}, origin)
+}
+
+// OriginFrom returns the origin of ctx, changes without one are made by SystemPrincipal.
+func OriginFrom(ctx context.Context) Origin {
+	origin, _ := ctx.Value(originKey{}).(Origin)
+	if origin.Principal == "" {
+		origin.Principal = SystemPrincipal
+	}
+	return origin
+}
+
+// hashed is what Hash covers, the field order is part of the chain and must not change.
+type hashed struct {
+	Seq           int64           `json:"seq"`
+	PrevHash      string          `json:"prev_hash"`
+	Principal     string          `json:"principal"`
+	ClaimedActor  string          `json:"claimed_actor"`
+	RequestID     string          `json:"request_id"`
+	ClientIP      string          `json:"client_ip"`
+	Action        string          `json:"action"`
+	WalletID      uuid.UUID       `json:"wallet_id"`
+	OperationID   *uuid.UUID      `json:"operation_id"`
+	BalanceBefore *int            `json:"balance_before"`
+	BalanceAfter  *int            `json:"balance_after"`
+	Details       json.RawMessage `json:"details"`
+	CreatedAt     string          `json:"created_at"`
+}
+
+// Hash computes the hash of the entry from all of its fields but Hash. CreatedAt is
+// taken in microseconds, the precision it is stored with.
+func Hash(entry entity.AuditEntry) string {
+	details := entry.Details
+	if len(details) == 0 {
+		details = json.RawMessage("null")
+	}
+
+	payload, _ := json.Marshal(hashed{
+		Seq:           entry.Seq,
+		PrevHash:      entry.PrevHash,
+		Principal:     entry.Principal,
+		ClaimedActor:  entry.ClaimedActor,
+		RequestID:     entry.RequestID,
+		ClientIP:      entry.ClientIP,
+		Action:        entry.Action,
+		WalletID:      entry.WalletID,
+		OperationID:   entry.OperationID,
+		BalanceBefore: entry.BalanceBefore,
+		BalanceAfter:  entry.BalanceAfter,
+		Details:       details,
+		CreatedAt:     entry.CreatedAt.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano),
+	})
+
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,68 @@
+package audit
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Log is the part of the audit repository the chainer needs.
+type Log interface {
+	Chain(ctx context.Context, limit int) (int, error)
+}
+
+// Chainer links the entries written together with the changes into the hash chain. Every
+// instance runs one, they take turns on the head of the log.
+type Chainer struct {
+	log       Log
+	interval  time.Duration
+	batchSize int
+}
+
+func NewChainer(log Log, interval time.Duration, batchSize int) *Chainer {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	return &Chainer{
+		log:       log,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+// Run chains the appended entries every interval until ctx is cancelled.
+func (c *Chainer) Run(ctx context.Context) {
+	slog.Info("Starting audit chainer", "interval", c.interval, "batch_size", c.batchSize)
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Stopping audit chainer")
+			return
+		case <-ticker.C:
+			if err := c.ChainAll(ctx); err != nil {
+				slog.Error("failed to chain audit entries", "error", err.Error())
+			}
+		}
+	}
+}
+
+// ChainAll chains batches until none are left. A failed batch is left as it was.
+func (c *Chainer) ChainAll(ctx context.Context) error {
+	for {
+		n, err := c.log.Chain(ctx, c.batchSize)
+		if err != nil {
+			return err
+		}
+		if n < c.batchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// Package cache keeps recently read wallets in front of the database.
+package cache
+
+import (
+	"context"
+	"time"
+	"wallet_controller/internal/entity"
+
+	"github.com/google/uuid"
+)
+
+// WalletCache is a best-effort cache of wallets read from the database. Implementations
+// backed by a remote store log their own errors and report them as misses, a failing
+// cache never fails the read.
+type WalletCache interface {
+	Get(ctx context.Context, walletID uuid.UUID) (*entity.Wallet, bool)
+	// Set stores a wallet read from the database at readAt. It is dropped when the wallet
+	// was invalidated after readAt, as the read may predate the change.
+	Set(ctx context.Context, wallet *entity.Wallet, readAt time.Time)
+	Invalidate(ctx context.Context, walletID uuid.UUID)
+	// Purge invalidates every wallet, for when invalidations may have been missed.
+	Purge(ctx context.Context)
+	Stats() Stats
+}
+
+type Stats struct {
+	Hits          int64 `json:"hits"`
+	Misses        int64 `json:"misses"`
+	Evictions     int64 `json:"evictions"`
+	Invalidations int64 `json:"invalidations"`
+	Size          int   `json:"size"`
+}
+
+type outcomeKey struct{}
+
+// Outcome tells how a wallet read was served.
+type Outcome struct {
+	// Cached is false when no cache is in front of the repository.
+	Cached bool
+	Hit    bool
+}
+
+// WithOutcome returns a context that records whether the wallet read made with it was
+// served from the cache.
+func WithOutcome(ctx context.Context) (context.Context, *Outcome) {
+	outcome := &Outcome{}
+	return context.WithValue(ctx, outcomeKey{}, outcome), outcome
+}
+
+// Observe records the outcome of a read in the context, if it asked for it.
+func Observe(ctx context.Context, hit bool) {
+	if outcome, ok := ctx.Value(outcomeKey{}).(*Outcome); ok {
+		outcome.Cached = true
+		outcome.Hit = hit
+	}
+}
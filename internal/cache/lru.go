@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"maps"
+	"sync"
+	"time"
+	"wallet_controller/internal/entity"
+
+	"github.com/google/uuid"
+)
+
+type entry struct {
+	walletID uuid.UUID
+	// wallet is nil for an invalidated wallet, the entry then remembers when it was
+	// invalidated so that reads started before are not stored.
+	wallet        *entity.Wallet
+	invalidatedAt time.Time
+	expiresAt     time.Time
+}
+
+// LRU is an in-process WalletCache holding up to size wallets for at most ttl each.
+type LRU struct {
+	mu       sync.Mutex
+	size     int
+	ttl      time.Duration
+	entries  map[uuid.UUID]*list.Element
+	order    *list.List
+	purgedAt time.Time
+	stats    Stats
+	now      func() time.Time
+}
+
+func NewLRU(size int, ttl time.Duration) *LRU {
+	if size <= 0 {
+		size = 10000
+	}
+	if ttl <= 0 {
+		ttl = 5 * time.Second
+	}
+
+	return &LRU{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[uuid.UUID]*list.Element),
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+func (c *LRU) Get(_ context.Context, walletID uuid.UUID) (*entity.Wallet, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[walletID]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+
+	e := element.Value.(*entry)
+	if c.now().After(e.expiresAt) {
+		c.remove(element)
+		c.stats.Misses++
+		return nil, false
+	}
+	if e.wallet == nil {
+		c.stats.Misses++
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	c.stats.Hits++
+	return copyWallet(e.wallet), true
+}
+
+func (c *LRU) Set(_ context.Context, wallet *entity.Wallet, readAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if readAt.Before(c.purgedAt) {
+		return
+	}
+
+	e := &entry{walletID: wallet.ID, wallet: copyWallet(wallet), expiresAt: c.now().Add(c.ttl)}
+	if element, ok := c.entries[wallet.ID]; ok {
+		if current := element.Value.(*entry); readAt.Before(current.invalidatedAt) {
+			return
+		}
+		element.Value = e
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.insert(e)
+}
+
+func (c *LRU) Invalidate(_ context.Context, walletID uuid.UUID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	c.stats.Invalidations++
+
+	e := &entry{walletID: walletID, invalidatedAt: now, expiresAt: now.Add(c.ttl)}
+	if element, ok := c.entries[walletID]; ok {
+		element.Value = e
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.insert(e)
+}
+
+func (c *LRU) Purge(_ context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.purgedAt = c.now()
+	c.stats.Invalidations += int64(len(c.entries))
+	clear(c.entries)
+	c.order.Init()
+}
+
+func (c *LRU) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Size = len(c.entries)
+	return stats
+}
+
+func (c *LRU) insert(e *entry) {
+	c.entries[e.walletID] = c.order.PushFront(e)
+
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *LRU) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*entry).walletID)
+}
+
+// copyWallet keeps callers from changing the cached wallet.
+func copyWallet(wallet *entity.Wallet) *entity.Wallet {
+	copied := *wallet
+	copied.Labels = maps.Clone(wallet.Labels)
+	if wallet.Freeze != nil {
+		freeze := *wallet.Freeze
+		copied.Freeze = &freeze
+	}
+	return &copied
+}
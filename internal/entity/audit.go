@@ -0,0 +1,59 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Audited actions, one per mutating method of WalletService. A fee gets two entries of
+// its own next to the operation it is charged for, one per wallet it moves money on.
+const (
+	AuditWalletCreated     = "WALLET_CREATED"
+	AuditWalletUpdated     = "WALLET_UPDATED"
+	AuditWalletFrozen      = "WALLET_FROZEN"
+	AuditWalletUnfrozen    = "WALLET_UNFROZEN"
+	AuditBalanceShardsSet  = "BALANCE_SHARDS_SET"
+	AuditOperationAdded    = "OPERATION_ADDED"
+	AuditOperationReversed = "OPERATION_REVERSED"
+	AuditFeeCharged        = "FEE_CHARGED"
+	AuditFeeCredited       = "FEE_CREDITED"
+)
+
+// AuditEntry records a committed change. Entries form a chain: Hash covers every other
+// field including PrevHash, the Hash of the entry before it, so changing or removing
+// an entry breaks the chain from there on. Principal is who the service knows made the
+// change, ClaimedActor is who the caller said it acts for, unverified.
+type AuditEntry struct {
+	Seq          int64      `json:"seq"`
+	Principal    string     `json:"principal"`
+	ClaimedActor string     `json:"claimed_actor,omitempty"`
+	RequestID    string     `json:"request_id,omitempty"`
+	ClientIP     string     `json:"client_ip,omitempty"`
+	Action       string     `json:"action"`
+	WalletID     uuid.UUID  `json:"wallet_id"`
+	OperationID  *uuid.UUID `json:"operation_id,omitempty"`
+	// BalanceBefore and BalanceAfter are nil when the balance is not known, as for
+	// deposits to balance shards.
+	BalanceBefore *int            `json:"balance_before,omitempty"`
+	BalanceAfter  *int            `json:"balance_after,omitempty"`
+	Details       json.RawMessage `json:"details,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+	PrevHash      string          `json:"prev_hash"`
+	Hash          string          `json:"hash"`
+}
+
+// AuditHead is the last entry of the audit log.
+type AuditHead struct {
+	Seq  int64  `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+// AuditReport is the outcome of a successful verification, Head is the last verified entry.
+// Unchained entries are written but not linked to the chain yet, so they are not verified.
+type AuditReport struct {
+	Entries   int64     `json:"entries"`
+	Head      AuditHead `json:"head"`
+	Unchained int64     `json:"unchained"`
+}
@@ -0,0 +1,48 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	EventOperationCreated = "OperationCreated"
+	EventBalanceChanged   = "BalanceChanged"
+)
+
+type Event struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	WalletID  uuid.UUID       `json:"wallet_id"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type OperationCreatedPayload struct {
+	OperationID   uuid.UUID `json:"operation_id"`
+	WalletID      uuid.UUID `json:"wallet_id"`
+	OperationType string    `json:"operation_type"`
+	Amount        int       `json:"amount"`
+	OperationDetails
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type BalanceChangedPayload struct {
+	WalletID      uuid.UUID `json:"wallet_id"`
+	OperationID   uuid.UUID `json:"operation_id"`
+	BalanceBefore int       `json:"balance_before"`
+	BalanceAfter  int       `json:"balance_after"`
+}
+
+// BalanceEvent is a live balance change of a single wallet, ordered by Seq within the wallet.
+type BalanceEvent struct {
+	Seq           int64     `json:"seq"`
+	WalletID      uuid.UUID `json:"wallet_id"`
+	OperationID   uuid.UUID `json:"operation_id"`
+	OperationType string    `json:"operation_type"`
+	Amount        int       `json:"amount"`
+	Balance       int       `json:"balance"`
+	CreatedAt     time.Time `json:"created_at"`
+}
@@ -0,0 +1,68 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	FeeFlat       = "FLAT"
+	FeePercentage = "PERCENTAGE"
+	FeeTiered     = "TIERED"
+)
+
+// FeeTier applies to operations of FromAmount kopecks and more, up to the next tier.
+type FeeTier struct {
+	FromAmount  int `json:"from_amount"`
+	FlatAmount  int `json:"flat_amount"`
+	BasisPoints int `json:"basis_points"`
+}
+
+// FeeRule charges a fee on operations of OperationType made by wallets with the
+// "tier" label equal to WalletTier, an empty WalletTier matches wallets of any tier.
+// Amounts are in kopecks and a basis point is a hundredth of a percent.
+//
+// FLAT and PERCENTAGE rules charge FlatAmount plus BasisPoints of the amount, TIERED
+// rules take both from the tier the amount falls into. The result is then kept
+// between MinFee and MaxFee and credited to FeeWalletID.
+type FeeRule struct {
+	ID            uuid.UUID `json:"id"`
+	OperationType string    `json:"operation_type"`
+	WalletTier    string    `json:"wallet_tier,omitempty"`
+	Kind          string    `json:"kind"`
+	FlatAmount    int       `json:"flat_amount"`
+	BasisPoints   int       `json:"basis_points"`
+	Tiers         []FeeTier `json:"tiers"`
+	MinFee        *int      `json:"min_fee,omitempty"`
+	MaxFee        *int      `json:"max_fee,omitempty"`
+	FeeWalletID   uuid.UUID `json:"fee_wallet_id"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type FeeRuleRequest struct {
+	OperationType string    `json:"operation_type"`
+	WalletTier    string    `json:"wallet_tier"`
+	Kind          string    `json:"kind"`
+	FlatAmount    int       `json:"flat_amount"`
+	BasisPoints   int       `json:"basis_points"`
+	Tiers         []FeeTier `json:"tiers"`
+	MinFee        *int      `json:"min_fee"`
+	MaxFee        *int      `json:"max_fee"`
+	FeeWalletID   uuid.UUID `json:"fee_wallet_id"`
+}
+
+// Fee is the breakdown of the fee charged for an operation. Flat and Percentage are
+// the parts computed by the rule and Amount is their sum after the caps. OperationID
+// is the withdrawal from the charged wallet and FeeWalletOperationID the matching
+// deposit to the fee wallet, both linked to the operation the fee was charged for.
+type Fee struct {
+	RuleID               uuid.UUID `json:"rule_id"`
+	Kind                 string    `json:"kind"`
+	Flat                 int       `json:"flat"`
+	Percentage           int       `json:"percentage"`
+	Amount               int       `json:"amount"`
+	FeeWalletID          uuid.UUID `json:"fee_wallet_id"`
+	OperationID          uuid.UUID `json:"operation_id"`
+	FeeWalletOperationID uuid.UUID `json:"fee_wallet_operation_id"`
+}
@@ -1,9 +1,71 @@
 package entity
 
-import "github.com/google/uuid"
+import (
+	"time"
 
+	"github.com/google/uuid"
+)
+
+// OperationDetails tell what an operation was made for. ExternalReference is the ID
+// of the operation in the upstream system and is unique within a wallet.
+type OperationDetails struct {
+	Description       string         `json:"description,omitempty"`
+	ExternalReference string         `json:"external_reference,omitempty"`
+	Metadata          map[string]any `json:"metadata,omitempty"`
+}
+
+// OperationRequest is a deposit or withdrawal. A non-zero ExpectedVersion makes the
+// operation fail unless the wallet still has that version, it comes from If-Match.
 type OperationRequest struct {
 	WalletID      uuid.UUID `json:"wallet_id"`
 	OperationType string    `json:"operation_type"`
 	Amount        int       `json:"amount"`
+	OperationDetails
+	ExpectedVersion int64 `json:"-"`
+}
+
+type Operation struct {
+	ID            uuid.UUID `json:"id"`
+	WalletID      uuid.UUID `json:"wallet_id"`
+	Seq           int64     `json:"seq"`
+	OperationType string    `json:"operation_type"`
+	Amount        int       `json:"amount"`
+	// BalanceBefore and BalanceAfter are nil for deposits to balance shards, the total
+	// balance is only known to operations that lock the wallet.
+	BalanceBefore *int `json:"balance_before,omitempty"`
+	BalanceAfter  *int `json:"balance_after,omitempty"`
+	// ParentOperationID links a fee to the operation it was charged for and a reversal
+	// to the operation it cancels.
+	ParentOperationID *uuid.UUID `json:"parent_operation_id,omitempty"`
+	OperationDetails
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OperationResult is the outcome of a committed operation. Fee is nil when
+// no fee was charged.
+type OperationResult struct {
+	Wallet    Wallet    `json:"wallet"`
+	Operation Operation `json:"operation"`
+	Fee       *Fee      `json:"fee,omitempty"`
+}
+
+// OperationFilter selects operations of a wallet older than BeforeSeq, newest first.
+// Empty fields do not filter, Description matches a case-insensitive substring
+// and every Metadata entry has to be equal to the value stored under its key.
+type OperationFilter struct {
+	WalletID          uuid.UUID
+	BeforeSeq         int64
+	Limit             int
+	OperationType     string
+	ExternalReference string
+	Description       string
+	Metadata          map[string]string
+}
+
+// SignedAmount is the effect of the operation on the wallet balance.
+func (o Operation) SignedAmount() int {
+	if o.OperationType == "WITHDRAW" {
+		return -o.Amount
+	}
+	return o.Amount
 }
@@ -0,0 +1,34 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	QueuedPending = "PENDING"
+	QueuedApplied = "APPLIED"
+	QueuedFailed  = "FAILED"
+)
+
+// QueuedOperation is an operation accepted for asynchronous processing. Once APPLIED
+// the operation with the same ID is in the history of the wallet, a FAILED one has the
+// reason in Error. Amount is in kopecks, as in Operation.
+type QueuedOperation struct {
+	ID            uuid.UUID `json:"id"`
+	WalletID      uuid.UUID `json:"wallet_id"`
+	OperationType string    `json:"operation_type"`
+	Amount        int       `json:"amount"`
+	OperationDetails
+	Status      string     `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ProcessedAt *time.Time `json:"processed_at,omitempty"`
+}
+
+// QueueBatch is the outcome of applying queued operations of one wallet.
+type QueueBatch struct {
+	Applied int
+	Failed  int
+}
@@ -0,0 +1,60 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ScheduleActive    = "ACTIVE"
+	ScheduleCompleted = "COMPLETED"
+	ScheduleFailed    = "FAILED"
+	ScheduleCancelled = "CANCELLED"
+
+	RunSucceeded = "SUCCEEDED"
+	RunFailed    = "FAILED"
+)
+
+// ScheduledOperation is an operation made by the scheduler at NextRunAt. Recurring
+// operations have a Cron expression that gives the following runs, one-off operations
+// become COMPLETED or FAILED after their only run. Amount is in rubles, as in
+// OperationRequest.
+type ScheduledOperation struct {
+	ID            uuid.UUID `json:"id"`
+	WalletID      uuid.UUID `json:"wallet_id"`
+	OperationType string    `json:"operation_type"`
+	Amount        int       `json:"amount"`
+	OperationDetails
+	Cron      string    `json:"cron,omitempty"`
+	NextRunAt time.Time `json:"next_run_at"`
+	Status    string    `json:"status"`
+	// Attempts counts failed attempts of the current run.
+	Attempts  int       `json:"attempts"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ScheduledOperationRequest creates or replaces a scheduled operation. The first run is
+// at RunAt, or at the first time matching Cron when RunAt is not set.
+type ScheduledOperationRequest struct {
+	WalletID      uuid.UUID      `json:"wallet_id"`
+	OperationType string         `json:"operation_type"`
+	Amount        int            `json:"amount"`
+	Description   string         `json:"description"`
+	Metadata      map[string]any `json:"metadata"`
+	RunAt         *time.Time     `json:"run_at"`
+	Cron          string         `json:"cron"`
+}
+
+// ScheduledRun is the outcome of one attempt to run a scheduled operation.
+type ScheduledRun struct {
+	ID           uuid.UUID  `json:"id"`
+	ScheduleID   uuid.UUID  `json:"schedule_id"`
+	ScheduledFor time.Time  `json:"scheduled_for"`
+	Attempt      int        `json:"attempt"`
+	Status       string     `json:"status"`
+	OperationID  *uuid.UUID `json:"operation_id,omitempty"`
+	Error        string     `json:"error,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
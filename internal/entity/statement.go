@@ -0,0 +1,21 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// StatementPeriod describes a statement for operations with From <= created_at < To.
+type StatementPeriod struct {
+	WalletID       uuid.UUID `json:"wallet_id"`
+	From           time.Time `json:"from"`
+	To             time.Time `json:"to"`
+	OpeningBalance int       `json:"opening_balance"`
+}
+
+type StatementRow struct {
+	Operation Operation
+	// Balance is the running balance after the operation.
+	Balance int
+}
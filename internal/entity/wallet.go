@@ -1,8 +1,152 @@
 package entity
 
-import "github.com/google/uuid"
+import (
+	"time"
 
+	"github.com/google/uuid"
+)
+
+// Wallet is the current state of a wallet. Version grows with every change
+// and is used for optimistic concurrency.
+//
+// Withdrawals may take Balance down to MinBalance - CreditLimit, so a wallet with a
+// credit line can have a negative Balance. Overdraft is the part of the credit line
+// in use and Available is what can still be withdrawn. Freeze restricts operations
+// and holds money on the wallet, Frozen tells whether its mode is in effect.
+//
+// A wallet with BalanceShards spreads deposits over that many sub-balances so they do
+// not wait for each other, Balance is always the total of all of them.
 type Wallet struct {
-	ID      uuid.UUID `json:"id"`
-	Balance int       `json:"balance"`
+	ID                uuid.UUID         `json:"id"`
+	Balance           int               `json:"balance"`
+	CreditLimit       int               `json:"credit_limit"`
+	MinBalance        int               `json:"min_balance"`
+	Available         int               `json:"available"`
+	Overdraft         int               `json:"overdraft"`
+	Version           int64             `json:"version"`
+	Frozen            bool              `json:"frozen"`
+	Freeze            *Freeze           `json:"freeze,omitempty"`
+	BalanceShards     int               `json:"balance_shards,omitempty"`
+	OwnerID           string            `json:"owner_id,omitempty"`
+	DisplayName       string            `json:"display_name,omitempty"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	ExternalReference string            `json:"external_reference,omitempty"`
+}
+
+type WalletBalance struct {
+	WalletID uuid.UUID `json:"wallet_id"`
+	Balance  int       `json:"balance"`
+	At       time.Time `json:"at"`
+}
+
+// WalletCreate opens a wallet with a zero balance, the ID is generated when it is nil.
+type WalletCreate struct {
+	ID                uuid.UUID
+	OwnerID           string
+	DisplayName       string
+	Labels            map[string]string
+	ExternalReference string
+	CreditLimit       int
+	MinBalance        int
+}
+
+// WalletUpdate is a partial update of wallet metadata and limits: nil fields are left
+// unchanged, an empty string clears the field and Labels replaces the whole set of labels.
+type WalletUpdate struct {
+	OwnerID           *string            `json:"owner_id"`
+	DisplayName       *string            `json:"display_name"`
+	Labels            *map[string]string `json:"labels"`
+	ExternalReference *string            `json:"external_reference"`
+	CreditLimit       *int               `json:"credit_limit"`
+	MinBalance        *int               `json:"min_balance"`
+}
+
+// WalletFilter selects wallets by owner and labels, every label has to match.
+// Results are ordered by ID and start after After.
+type WalletFilter struct {
+	OwnerID string
+	Labels  map[string]string
+	After   uuid.UUID
+	Limit   int
+}
+
+// Floor is the lowest balance a withdrawal may leave on the wallet. Money on hold stays
+// on top of MinBalance, the credit line can not be used to withdraw it.
+func (w Wallet) Floor() int {
+	if hold := w.Freeze.Held(); hold > 0 {
+		return w.MinBalance + hold
+	}
+	return w.MinBalance - w.CreditLimit
+}
+
+// Freeze modes: a DEPOSIT_ONLY wallet takes deposits only, a FULL one takes no operations.
+const (
+	FreezeDepositOnly = "DEPOSIT_ONLY"
+	FreezeFull        = "FULL"
+)
+
+// Freeze reason codes.
+const (
+	FreezeReasonFraud           = "FRAUD"
+	FreezeReasonAML             = "AML"
+	FreezeReasonSanctions       = "SANCTIONS"
+	FreezeReasonCourtOrder      = "COURT_ORDER"
+	FreezeReasonCustomerRequest = "CUSTOMER_REQUEST"
+	FreezeReasonOther           = "OTHER"
+)
+
+// Freeze restricts a wallet until it is lifted. Mode blocks operations up to Until, or
+// without end when Until is nil, an empty Mode blocks nothing. HoldAmount kopecks can
+// not be withdrawn while the freeze stays, regardless of Until.
+type Freeze struct {
+	Mode       string     `json:"mode,omitempty"`
+	Reason     string     `json:"reason"`
+	Until      *time.Time `json:"until,omitempty"`
+	HoldAmount int        `json:"hold_amount,omitempty"`
+}
+
+// Blocks tells whether the mode of the freeze is in effect at now.
+func (f *Freeze) Blocks(now time.Time) bool {
+	return f != nil && f.Mode != "" && (f.Until == nil || now.Before(*f.Until))
+}
+
+// Rejects tells whether an operation of operationType is blocked at now.
+func (f *Freeze) Rejects(operationType string, now time.Time) bool {
+	return f.Blocks(now) && (f.Mode == FreezeFull || operationType == "WITHDRAW")
+}
+
+// Held is the amount on hold, 0 for a wallet without a freeze.
+func (f *Freeze) Held() int {
+	if f == nil {
+		return 0
+	}
+	return f.HoldAmount
+}
+
+const (
+	FreezeActionFreeze   = "FREEZE"
+	FreezeActionUnfreeze = "UNFREEZE"
+)
+
+// FreezeEvent is a freeze or unfreeze of a wallet, Freeze is the freeze set by it and
+// nil for an unfreeze. Principal and ClaimedActor are as in AuditEntry.
+type FreezeEvent struct {
+	ID           int64     `json:"id"`
+	WalletID     uuid.UUID `json:"wallet_id"`
+	Action       string    `json:"action"`
+	Freeze       *Freeze   `json:"freeze,omitempty"`
+	Principal    string    `json:"principal"`
+	ClaimedActor string    `json:"claimed_actor,omitempty"`
+	RequestID    string    `json:"request_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Discrepancy is a wallet whose stored balances disagree with its operations.
+// OperationID is the operation where the history breaks, nil when the balance of
+// the wallet differs from the balance after its last operation.
+type Discrepancy struct {
+	WalletID    uuid.UUID  `json:"wallet_id"`
+	OperationID *uuid.UUID `json:"operation_id,omitempty"`
+	Expected    int        `json:"expected"`
+	Actual      int        `json:"actual"`
 }
@@ -0,0 +1,55 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DeliveryPending   = "PENDING"
+	DeliverySucceeded = "SUCCEEDED"
+	DeliveryDead      = "DEAD"
+)
+
+type WebhookSubscription struct {
+	ID         uuid.UUID  `json:"id"`
+	URL        string     `json:"url"`
+	Secret     string     `json:"secret,omitempty"`
+	EventTypes []string   `json:"event_types"`
+	WalletID   *uuid.UUID `json:"wallet_id,omitempty"`
+	Active     bool       `json:"active"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+type WebhookSubscriptionRequest struct {
+	URL        string     `json:"url"`
+	Secret     string     `json:"secret"`
+	EventTypes []string   `json:"event_types"`
+	WalletID   *uuid.UUID `json:"wallet_id"`
+	Active     *bool      `json:"active"`
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID       `json:"id"`
+	SubscriptionID uuid.UUID       `json:"subscription_id"`
+	EventID        int64           `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastStatusCode *int            `json:"last_status_code,omitempty"`
+	LastError      *string         `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+// WebhookDeliveryTask is a claimed delivery together with the target it has to be sent to.
+type WebhookDeliveryTask struct {
+	Delivery WebhookDelivery
+	URL      string
+	Secret   string
+}
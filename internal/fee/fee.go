@@ -0,0 +1,53 @@
+// Package fee computes the fees charged on wallet operations.
+package fee
+
+import (
+	"wallet_controller/internal/entity"
+)
+
+// basisPointsPerUnit is the number of basis points in 100%.
+const basisPointsPerUnit = 10000
+
+// Calculate returns the fee the rule charges on an operation of amount kopecks.
+// Percentages are rounded half up to whole kopecks.
+func Calculate(rule entity.FeeRule, amount int) entity.Fee {
+	flat, basisPoints := rule.FlatAmount, rule.BasisPoints
+	if rule.Kind == entity.FeeTiered {
+		tier, ok := Tier(rule.Tiers, amount)
+		if !ok {
+			flat, basisPoints = 0, 0
+		} else {
+			flat, basisPoints = tier.FlatAmount, tier.BasisPoints
+		}
+	}
+
+	percentage := int((int64(amount)*int64(basisPoints) + basisPointsPerUnit/2) / basisPointsPerUnit)
+
+	total := flat + percentage
+	if rule.MinFee != nil && total < *rule.MinFee {
+		total = *rule.MinFee
+	}
+	if rule.MaxFee != nil && total > *rule.MaxFee {
+		total = *rule.MaxFee
+	}
+
+	return entity.Fee{
+		RuleID:      rule.ID,
+		Kind:        rule.Kind,
+		Flat:        flat,
+		Percentage:  percentage,
+		Amount:      total,
+		FeeWalletID: rule.FeeWalletID,
+	}
+}
+
+// Tier returns the tier with the highest FromAmount not above amount.
+// ok is false when amount is below every tier.
+func Tier(tiers []entity.FeeTier, amount int) (tier entity.FeeTier, ok bool) {
+	for _, candidate := range tiers {
+		if candidate.FromAmount <= amount && (!ok || candidate.FromAmount > tier.FromAmount) {
+			tier, ok = candidate, true
+		}
+	}
+	return tier, ok
+}
@@ -0,0 +1,33 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"wallet_controller/internal/repository"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// toStatus maps domain errors to gRPC status codes. Unknown errors are logged
+// and reported as Internal without leaking their details to the client.
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrWalletNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, repository.ErrInsufficientFunds), errors.Is(err, repository.ErrWalletFrozen):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, repository.ErrDuplicateOperation):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, repository.ErrWalletLocked), errors.Is(err, repository.ErrVersionMismatch):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	default:
+		slog.Error("grpc request failed", "error", err.Error())
+		return status.Error(codes.Internal, "internal error")
+	}
+}
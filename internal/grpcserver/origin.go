@@ -0,0 +1,48 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"wallet_controller/internal/audit"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// The metadata keys match the X-Actor and X-Request-ID headers of the HTTP API.
+const (
+	actorKey     = "x-actor"
+	requestIDKey = "x-request-id"
+)
+
+// auditOrigin puts the claimed actor, request ID and peer address of the call into its
+// context for the audit log. Like the HTTP API, the principal is anonymous and x-actor
+// is recorded unverified.
+func auditOrigin(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	origin := audit.Origin{
+		Principal:    audit.AnonymousPrincipal,
+		ClaimedActor: first(md.Get(actorKey)),
+		RequestID:    first(md.Get(requestIDKey)),
+	}
+	if origin.RequestID == "" {
+		origin.RequestID = uuid.NewString()
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		origin.ClientIP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(origin.ClientIP); err == nil {
+			origin.ClientIP = host
+		}
+	}
+
+	return handler(audit.WithOrigin(ctx, origin), req)
+}
+
+func first(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
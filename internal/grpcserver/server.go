@@ -0,0 +1,341 @@
+package grpcserver
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	walletv1 "wallet_controller/api/wallet/v1"
+	"wallet_controller/internal/entity"
+	"wallet_controller/internal/notify"
+	"wallet_controller/internal/service"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+	replayBatchSize = 500
+)
+
+type WalletServer struct {
+	walletv1.UnimplementedWalletServiceServer
+
+	walletService service.WalletServiceInterface
+	broker        *notify.Broker
+	// done is closed on application shutdown so that open WatchWallet
+	// streams end and GracefulStop does not wait for them forever.
+	done <-chan struct{}
+}
+
+func NewWalletServer(walletService service.WalletServiceInterface, broker *notify.Broker, done <-chan struct{}) *WalletServer {
+	return &WalletServer{
+		walletService: walletService,
+		broker:        broker,
+		done:          done,
+	}
+}
+
+// NewServer builds a gRPC server exposing the wallet service with reflection enabled.
+func NewServer(walletServer *WalletServer) *grpc.Server {
+	server := grpc.NewServer(grpc.UnaryInterceptor(auditOrigin))
+	walletv1.RegisterWalletServiceServer(server, walletServer)
+	reflection.Register(server)
+
+	return server
+}
+
+func (s *WalletServer) GetWallet(ctx context.Context, req *walletv1.GetWalletRequest) (*walletv1.GetWalletResponse, error) {
+	walletID, err := parseWalletID(req.GetWalletId())
+	if err != nil {
+		return nil, err
+	}
+
+	wallet, err := s.walletService.GetWallet(ctx, walletID)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &walletv1.GetWalletResponse{Wallet: toProtoWallet(*wallet)}, nil
+}
+
+func (s *WalletServer) AddOperation(ctx context.Context, req *walletv1.AddOperationRequest) (*walletv1.AddOperationResponse, error) {
+	walletID, err := parseWalletID(req.GetWalletId())
+	if err != nil {
+		return nil, err
+	}
+
+	operationType, ok := operationTypeNames[req.GetOperationType()]
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "operation_type must be DEPOSIT or WITHDRAW")
+	}
+	if req.GetAmount() <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "amount must be positive")
+	}
+	if req.GetExpectedVersion() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "expected_version must not be negative")
+	}
+
+	result, err := s.walletService.AddOperation(ctx, &entity.OperationRequest{
+		WalletID:      walletID,
+		OperationType: operationType,
+		Amount:        int(req.GetAmount()),
+		OperationDetails: entity.OperationDetails{
+			Description:       req.GetDescription(),
+			ExternalReference: req.GetExternalReference(),
+			Metadata:          req.GetMetadata().AsMap(),
+		},
+		ExpectedVersion: req.GetExpectedVersion(),
+	})
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &walletv1.AddOperationResponse{
+		Wallet:    toProtoWallet(result.Wallet),
+		Operation: toProtoOperation(result.Operation),
+		Fee:       toProtoFee(result.Fee),
+	}, nil
+}
+
+func (s *WalletServer) ListOperations(ctx context.Context, req *walletv1.ListOperationsRequest) (*walletv1.ListOperationsResponse, error) {
+	walletID, err := parseWalletID(req.GetWalletId())
+	if err != nil {
+		return nil, err
+	}
+
+	pageSize := int(req.GetPageSize())
+	if pageSize < 0 || pageSize > maxPageSize {
+		return nil, status.Errorf(codes.InvalidArgument, "page_size must be between 0 and %d", maxPageSize)
+	}
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	}
+
+	var beforeSeq int64
+	if token := req.GetPageToken(); token != "" {
+		beforeSeq, err = strconv.ParseInt(token, 10, 64)
+		if err != nil || beforeSeq <= 0 {
+			return nil, status.Error(codes.InvalidArgument, "invalid page_token")
+		}
+	}
+
+	filter := entity.OperationFilter{
+		WalletID:          walletID,
+		BeforeSeq:         beforeSeq,
+		Limit:             pageSize,
+		ExternalReference: req.GetExternalReference(),
+		Description:       req.GetDescription(),
+		Metadata:          req.GetMetadata(),
+	}
+	if req.GetOperationType() != walletv1.OperationType_OPERATION_TYPE_UNSPECIFIED {
+		operationType, ok := operationTypeNames[req.GetOperationType()]
+		if !ok {
+			return nil, status.Error(codes.InvalidArgument, "unknown operation_type")
+		}
+		filter.OperationType = operationType
+	}
+
+	operations, err := s.walletService.ListOperations(ctx, filter)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &walletv1.ListOperationsResponse{
+		Operations: make([]*walletv1.Operation, 0, len(operations)),
+	}
+	for _, operation := range operations {
+		resp.Operations = append(resp.Operations, toProtoOperation(operation))
+	}
+	if len(operations) == pageSize {
+		resp.NextPageToken = strconv.FormatInt(operations[len(operations)-1].Seq, 10)
+	}
+
+	return resp, nil
+}
+
+func (s *WalletServer) WatchWallet(req *walletv1.WatchWalletRequest, stream grpc.ServerStreamingServer[walletv1.BalanceEvent]) error {
+	walletID, err := parseWalletID(req.GetWalletId())
+	if err != nil {
+		return err
+	}
+	if req.GetAfterSeq() < 0 {
+		return status.Error(codes.InvalidArgument, "after_seq must not be negative")
+	}
+
+	ctx := stream.Context()
+	if _, err = s.walletService.GetWallet(ctx, walletID); err != nil {
+		return toStatus(err)
+	}
+
+	// Subscribe before replaying history so nothing committed in between is lost.
+	events, cancel := s.broker.Subscribe(walletID)
+	defer cancel()
+
+	lastSeq := req.GetAfterSeq()
+	if lastSeq > 0 {
+		for {
+			history, err := s.walletService.GetBalanceEvents(ctx, walletID, lastSeq, replayBatchSize)
+			if err != nil {
+				return toStatus(err)
+			}
+			for _, event := range history {
+				if err = stream.Send(toProtoBalanceEvent(event)); err != nil {
+					return err
+				}
+				lastSeq = event.Seq
+			}
+			if len(history) < replayBatchSize {
+				break
+			}
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return toStatus(ctx.Err())
+		case <-s.done:
+			return status.Error(codes.Unavailable, "server is shutting down")
+		case event, ok := <-events:
+			if !ok {
+				return status.Error(codes.Aborted, "client is too slow, resume with after_seq")
+			}
+			if event.Seq <= lastSeq {
+				continue
+			}
+			if err = stream.Send(toProtoBalanceEvent(event)); err != nil {
+				slog.Warn("failed to send balance event", "wallet_id", walletID, "error", err.Error())
+				return err
+			}
+			lastSeq = event.Seq
+		}
+	}
+}
+
+func parseWalletID(value string) (uuid.UUID, error) {
+	if value == "" {
+		return uuid.Nil, status.Error(codes.InvalidArgument, "wallet_id is required")
+	}
+
+	walletID, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.Nil, status.Error(codes.InvalidArgument, "invalid wallet_id format")
+	}
+
+	return walletID, nil
+}
+
+var operationTypeNames = map[walletv1.OperationType]string{
+	walletv1.OperationType_OPERATION_TYPE_DEPOSIT:  "DEPOSIT",
+	walletv1.OperationType_OPERATION_TYPE_WITHDRAW: "WITHDRAW",
+}
+
+func toProtoOperationType(operationType string) walletv1.OperationType {
+	for protoType, name := range operationTypeNames {
+		if name == operationType {
+			return protoType
+		}
+	}
+	return walletv1.OperationType_OPERATION_TYPE_UNSPECIFIED
+}
+
+func toProtoWallet(wallet entity.Wallet) *walletv1.Wallet {
+	return &walletv1.Wallet{
+		Id:                wallet.ID.String(),
+		Balance:           int64(wallet.Balance),
+		Version:           wallet.Version,
+		CreditLimit:       int64(wallet.CreditLimit),
+		MinBalance:        int64(wallet.MinBalance),
+		Available:         int64(wallet.Available),
+		Overdraft:         int64(wallet.Overdraft),
+		Frozen:            wallet.Frozen,
+		BalanceShards:     int32(wallet.BalanceShards),
+		OwnerId:           wallet.OwnerID,
+		DisplayName:       wallet.DisplayName,
+		Labels:            wallet.Labels,
+		ExternalReference: wallet.ExternalReference,
+		Freeze:            toProtoFreeze(wallet.Freeze),
+	}
+}
+
+func toProtoFreeze(freeze *entity.Freeze) *walletv1.WalletFreeze {
+	if freeze == nil {
+		return nil
+	}
+
+	result := &walletv1.WalletFreeze{
+		Mode:       freeze.Mode,
+		Reason:     freeze.Reason,
+		HoldAmount: int64(freeze.HoldAmount),
+	}
+	if freeze.Until != nil {
+		result.Until = timestamppb.New(*freeze.Until)
+	}
+	return result
+}
+
+func toProtoOperation(operation entity.Operation) *walletv1.Operation {
+	result := &walletv1.Operation{
+		Id:                operation.ID.String(),
+		WalletId:          operation.WalletID.String(),
+		Seq:               operation.Seq,
+		OperationType:     toProtoOperationType(operation.OperationType),
+		Amount:            int64(operation.Amount),
+		CreatedAt:         timestamppb.New(operation.CreatedAt),
+		Description:       operation.Description,
+		ExternalReference: operation.ExternalReference,
+	}
+	if operation.BalanceBefore != nil {
+		balance := int64(*operation.BalanceBefore)
+		result.BalanceBefore = &balance
+	}
+	if operation.BalanceAfter != nil {
+		balance := int64(*operation.BalanceAfter)
+		result.BalanceAfter = &balance
+	}
+	if operation.ParentOperationID != nil {
+		result.ParentOperationId = operation.ParentOperationID.String()
+	}
+	if len(operation.Metadata) > 0 {
+		// Metadata comes from JSON, so it always converts.
+		result.Metadata, _ = structpb.NewStruct(operation.Metadata)
+	}
+
+	return result
+}
+
+func toProtoFee(fee *entity.Fee) *walletv1.Fee {
+	if fee == nil {
+		return nil
+	}
+
+	return &walletv1.Fee{
+		RuleId:               fee.RuleID.String(),
+		Kind:                 fee.Kind,
+		Flat:                 int64(fee.Flat),
+		Percentage:           int64(fee.Percentage),
+		Amount:               int64(fee.Amount),
+		FeeWalletId:          fee.FeeWalletID.String(),
+		OperationId:          fee.OperationID.String(),
+		FeeWalletOperationId: fee.FeeWalletOperationID.String(),
+	}
+}
+
+func toProtoBalanceEvent(event entity.BalanceEvent) *walletv1.BalanceEvent {
+	return &walletv1.BalanceEvent{
+		Seq:           event.Seq,
+		WalletId:      event.WalletID.String(),
+		OperationId:   event.OperationID.String(),
+		OperationType: toProtoOperationType(event.OperationType),
+		Amount:        int64(event.Amount),
+		Balance:       int64(event.Balance),
+		CreatedAt:     timestamppb.New(event.CreatedAt),
+	}
+}
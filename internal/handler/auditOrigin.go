@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"wallet_controller/internal/audit"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// actorHeader names who the caller says it acts for. The service has no authentication
+	// of its own and can not check it, so it is recorded as a claim of the caller.
+	actorHeader     = "X-Actor"
+	requestIDHeader = "X-Request-ID"
+)
+
+// AuditOrigin puts the claimed actor, request ID and client address of the request into
+// its context for the audit log, the principal is anonymous. A request without an ID
+// gets a new one, the ID is returned in the response.
+func AuditOrigin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		origin := audit.Origin{
+			Principal:    audit.AnonymousPrincipal,
+			ClaimedActor: c.GetHeader(actorHeader),
+			RequestID:    c.GetHeader(requestIDHeader),
+			ClientIP:     c.ClientIP(),
+		}
+		if origin.RequestID == "" {
+			origin.RequestID = uuid.NewString()
+		}
+
+		c.Header(requestIDHeader, origin.RequestID)
+		c.Request = c.Request.WithContext(audit.WithOrigin(c.Request.Context(), origin))
+
+		c.Next()
+	}
+}
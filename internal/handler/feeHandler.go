@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"wallet_controller/internal/entity"
+	"wallet_controller/internal/repository"
+	"wallet_controller/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type FeeHandler struct {
+	feeService service.FeeServiceInterface
+}
+
+func NewFeeHandler(feeService service.FeeServiceInterface) *FeeHandler {
+	return &FeeHandler{
+		feeService: feeService,
+	}
+}
+
+func (h *FeeHandler) CreateRule(c *gin.Context) {
+	var req entity.FeeRuleRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Warn("Invalid request body", "error", err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// Field types and ranges are checked against the OpenAPI document
+	// by openapi.Validator before the request gets here.
+
+	rule, err := h.feeService.CreateRule(c.Request.Context(), &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidFeeRule), errors.Is(err, repository.ErrFeeWalletMissing):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, repository.ErrDuplicateFeeRule):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			slog.Error("Create fee rule error", "error", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create fee rule"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+func (h *FeeHandler) ListRules(c *gin.Context) {
+	rules, err := h.feeService.ListRules(c.Request.Context())
+	if err != nil {
+		slog.Error("List fee rules error", "error", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list fee rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+func (h *FeeHandler) GetRule(c *gin.Context) {
+	ruleID, ok := parseFeeRuleID(c)
+	if !ok {
+		return
+	}
+
+	rule, err := h.feeService.GetRule(c.Request.Context(), ruleID)
+	if err != nil {
+		respondFeeRuleError(c, err, "failed to get fee rule")
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+func (h *FeeHandler) DeleteRule(c *gin.Context) {
+	ruleID, ok := parseFeeRuleID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.feeService.DeleteRule(c.Request.Context(), ruleID); err != nil {
+		respondFeeRuleError(c, err, "failed to delete fee rule")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func parseFeeRuleID(c *gin.Context) (uuid.UUID, bool) {
+	ruleID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid fee rule id format"})
+		return uuid.Nil, false
+	}
+
+	return ruleID, true
+}
+
+func respondFeeRuleError(c *gin.Context, err error, message string) {
+	if errors.Is(err, repository.ErrFeeRuleNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "fee rule not found"})
+		return
+	}
+
+	slog.Error("Fee rule error", "error", err.Error())
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
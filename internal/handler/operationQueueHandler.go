@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"wallet_controller/internal/entity"
+	"wallet_controller/internal/repository"
+	"wallet_controller/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// respondAsync is the preference of RFC 7240 that asks for the operation to be queued.
+const respondAsync = "respond-async"
+
+// OperationQueueHandler serves operations that may be queued instead of made right away.
+// Requests without "Prefer: respond-async" are passed to WalletHandler.
+type OperationQueueHandler struct {
+	queueService  service.OperationQueueServiceInterface
+	walletHandler *WalletHandler
+}
+
+func NewOperationQueueHandler(queueService service.OperationQueueServiceInterface, walletHandler *WalletHandler) *OperationQueueHandler {
+	return &OperationQueueHandler{
+		queueService:  queueService,
+		walletHandler: walletHandler,
+	}
+}
+
+// AddOperation queues the operation and answers 202 with its ID when the client prefers
+// an asynchronous response. An If-Match precondition can only be checked when the
+// operation is made, so such requests are always synchronous.
+func (h *OperationQueueHandler) AddOperation(c *gin.Context) {
+	if !prefersAsync(c.GetHeader("Prefer")) || c.GetHeader("If-Match") != "" {
+		h.walletHandler.AddOperation(c)
+		return
+	}
+
+	var req entity.OperationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Warn("Invalid request body", "error", err.Error())
+		c.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	queued, err := h.queueService.Enqueue(c.Request.Context(), &req)
+	if err != nil {
+		slog.Error("Enqueue operation error", "error", err.Error())
+
+		if errors.Is(err, repository.ErrWalletNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "wallet not found"})
+			return
+		}
+
+		if errors.Is(err, repository.ErrDuplicateOperation) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Preference-Applied", respondAsync)
+	c.Header("Location", "/api/v1/operations/"+queued.ID.String())
+	c.JSON(http.StatusAccepted, queued)
+}
+
+// GetOperation answers 202 with the queued operation while it is pending and 200 with it
+// once it failed. Applied and synchronous operations are served by WalletHandler.
+func (h *OperationQueueHandler) GetOperation(c *gin.Context) {
+	operationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid operation id format"})
+		return
+	}
+
+	queued, err := h.queueService.GetQueued(c.Request.Context(), operationID)
+	if err != nil && !errors.Is(err, repository.ErrQueuedOperationNotFound) {
+		slog.Error("Get queued operation error", "error", err.Error(), "operation_id", operationID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get operation"})
+		return
+	}
+
+	switch {
+	case queued == nil || queued.Status == entity.QueuedApplied:
+		h.walletHandler.GetOperation(c)
+	case queued.Status == entity.QueuedPending:
+		c.JSON(http.StatusAccepted, queued)
+	default:
+		c.JSON(http.StatusOK, queued)
+	}
+}
+
+// prefersAsync tells whether a Prefer header contains respond-async.
+func prefersAsync(header string) bool {
+	for _, preference := range strings.Split(header, ",") {
+		token, _, _ := strings.Cut(preference, ";")
+		if strings.EqualFold(strings.TrimSpace(token), respondAsync) {
+			return true
+		}
+	}
+
+	return false
+}
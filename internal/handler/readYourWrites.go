@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"net/http"
+	"wallet_controller/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// clientHeader tells clients apart for read-your-writes, the address is used without it.
+const clientHeader = "X-Client-ID"
+
+// ReadYourWrites sends the reads of a client to the primary for a while after its
+// successful write, so it sees the write before the replica has replayed it.
+func ReadYourWrites(reads *storage.ReadRouter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client := c.GetHeader(clientHeader)
+		if client == "" {
+			client = c.ClientIP()
+		}
+
+		if reads.WroteRecently(client) {
+			c.Request = c.Request.WithContext(storage.WithPrimary(c.Request.Context()))
+		}
+
+		c.Next()
+
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead && c.Writer.Status() < http.StatusBadRequest {
+			reads.RecordWrite(client)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"wallet_controller/internal/entity"
+	"wallet_controller/internal/repository"
+	"wallet_controller/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultRunsLimit = 50
+	maxRunsLimit     = 500
+)
+
+type ScheduleHandler struct {
+	scheduleService service.ScheduleServiceInterface
+}
+
+func NewScheduleHandler(scheduleService service.ScheduleServiceInterface) *ScheduleHandler {
+	return &ScheduleHandler{
+		scheduleService: scheduleService,
+	}
+}
+
+func (h *ScheduleHandler) CreateSchedule(c *gin.Context) {
+	req, ok := bindScheduleRequest(c)
+	if !ok {
+		return
+	}
+
+	scheduled, err := h.scheduleService.CreateSchedule(c.Request.Context(), req)
+	if err != nil {
+		respondScheduleError(c, err, "failed to create scheduled operation")
+		return
+	}
+
+	c.JSON(http.StatusCreated, scheduled)
+}
+
+func (h *ScheduleHandler) ListSchedules(c *gin.Context) {
+	var walletID *uuid.UUID
+	if walletIDStr := c.Query("wallet_id"); walletIDStr != "" {
+		parsed, err := uuid.Parse(walletIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid wallet id format"})
+			return
+		}
+		walletID = &parsed
+	}
+
+	schedules, err := h.scheduleService.ListSchedules(c.Request.Context(), walletID)
+	if err != nil {
+		slog.Error("List scheduled operations error", "error", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list scheduled operations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"scheduled_operations": schedules})
+}
+
+func (h *ScheduleHandler) GetSchedule(c *gin.Context) {
+	scheduleID, ok := parseScheduleID(c)
+	if !ok {
+		return
+	}
+
+	scheduled, err := h.scheduleService.GetSchedule(c.Request.Context(), scheduleID)
+	if err != nil {
+		respondScheduleError(c, err, "failed to get scheduled operation")
+		return
+	}
+
+	c.JSON(http.StatusOK, scheduled)
+}
+
+func (h *ScheduleHandler) UpdateSchedule(c *gin.Context) {
+	scheduleID, ok := parseScheduleID(c)
+	if !ok {
+		return
+	}
+
+	req, ok := bindScheduleRequest(c)
+	if !ok {
+		return
+	}
+
+	scheduled, err := h.scheduleService.UpdateSchedule(c.Request.Context(), scheduleID, req)
+	if err != nil {
+		respondScheduleError(c, err, "failed to update scheduled operation")
+		return
+	}
+
+	c.JSON(http.StatusOK, scheduled)
+}
+
+func (h *ScheduleHandler) CancelSchedule(c *gin.Context) {
+	scheduleID, ok := parseScheduleID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.scheduleService.CancelSchedule(c.Request.Context(), scheduleID); err != nil {
+		respondScheduleError(c, err, "failed to cancel scheduled operation")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *ScheduleHandler) ListRuns(c *gin.Context) {
+	scheduleID, ok := parseScheduleID(c)
+	if !ok {
+		return
+	}
+
+	limit := defaultRunsLimit
+	if limitStr := c.Query("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 || parsed > maxRunsLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+			return
+		}
+		limit = parsed
+	}
+
+	runs, err := h.scheduleService.ListRuns(c.Request.Context(), scheduleID, limit)
+	if err != nil {
+		respondScheduleError(c, err, "failed to list scheduled operation runs")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"runs": runs})
+}
+
+func parseScheduleID(c *gin.Context) (uuid.UUID, bool) {
+	scheduleID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid scheduled operation id format"})
+		return uuid.Nil, false
+	}
+
+	return scheduleID, true
+}
+
+func bindScheduleRequest(c *gin.Context) (*entity.ScheduledOperationRequest, bool) {
+	var req entity.ScheduledOperationRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Warn("Invalid request body", "error", err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	// Operation type and amount are checked against the OpenAPI document
+	// by openapi.Validator before the request gets here.
+
+	return &req, true
+}
+
+func respondScheduleError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, service.ErrInvalidSchedule):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, repository.ErrWalletNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "wallet not found"})
+	case errors.Is(err, repository.ErrScheduleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "scheduled operation not found"})
+	default:
+		slog.Error("Scheduled operation error", "error", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
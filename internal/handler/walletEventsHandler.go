@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+	"wallet_controller/internal/entity"
+	"wallet_controller/internal/notify"
+	"wallet_controller/internal/repository"
+	"wallet_controller/internal/service"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	balanceEventName  = "balance"
+	replayBatchSize   = 500
+	heartbeatInterval = 15 * time.Second
+)
+
+type WalletEventsHandler struct {
+	walletService service.WalletServiceInterface
+	broker        *notify.Broker
+}
+
+func NewWalletEventsHandler(walletService service.WalletServiceInterface, broker *notify.Broker) *WalletEventsHandler {
+	return &WalletEventsHandler{
+		walletService: walletService,
+		broker:        broker,
+	}
+}
+
+// StreamEvents streams balance changes of a wallet as Server-Sent Events.
+// Each event ID is the operation sequence number, so a reconnecting client that sends
+// Last-Event-ID first receives everything it missed from wallet_operations.
+func (h *WalletEventsHandler) StreamEvents(c *gin.Context) {
+	walletID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid wallet_id format"})
+		return
+	}
+
+	var lastSeq int64
+	resume := false
+	if lastEventID := c.GetHeader("Last-Event-ID"); lastEventID != "" {
+		lastSeq, err = strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || lastSeq < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid Last-Event-ID"})
+			return
+		}
+		resume = true
+	}
+
+	ctx := c.Request.Context()
+	if _, err = h.walletService.GetWallet(ctx, walletID); err != nil {
+		if errors.Is(err, repository.ErrWalletNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "wallet not found"})
+			return
+		}
+		slog.Error("Get wallet error", "error", err.Error(), "wallet_id", walletID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get wallet"})
+		return
+	}
+
+	// Subscribe before replaying history so nothing committed in between is lost.
+	events, cancel := h.broker.Subscribe(walletID)
+	defer cancel()
+
+	// The stream outlives the server write timeout.
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	if resume {
+		for {
+			history, err := h.walletService.GetBalanceEvents(ctx, walletID, lastSeq, replayBatchSize)
+			if err != nil {
+				slog.Error("Replay balance events error", "error", err.Error(), "wallet_id", walletID)
+				return
+			}
+			for _, event := range history {
+				writeBalanceEvent(c, event)
+				lastSeq = event.Seq
+			}
+			if len(history) < replayBatchSize {
+				break
+			}
+		}
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				// The subscriber fell behind; the client reconnects with Last-Event-ID.
+				return
+			}
+			if event.Seq <= lastSeq {
+				continue
+			}
+			writeBalanceEvent(c, event)
+			lastSeq = event.Seq
+		case <-heartbeat.C:
+			_, _ = c.Writer.WriteString(": ping\n\n")
+			c.Writer.Flush()
+		}
+	}
+}
+
+func writeBalanceEvent(c *gin.Context, event entity.BalanceEvent) {
+	c.Render(-1, sse.Event{
+		Id:    strconv.FormatInt(event.Seq, 10),
+		Event: balanceEventName,
+		Data:  event,
+	})
+	c.Writer.Flush()
+}
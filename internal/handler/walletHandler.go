@@ -1,12 +1,31 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"wallet_controller/internal/cache"
 	"wallet_controller/internal/entity"
+	"wallet_controller/internal/repository"
 	"wallet_controller/internal/service"
+	"wallet_controller/internal/statement"
+)
+
+const (
+	defaultWalletsLimit = 100
+	maxWalletsLimit     = 500
+
+	defaultOperationsLimit = 50
+	maxOperationsLimit     = 500
+
+	// lockedRetryAfter is the Retry-After, in seconds, sent when another operation holds the wallet.
+	lockedRetryAfter = "1"
 )
 
 type WalletHandler struct {
@@ -32,7 +51,8 @@ func (h *WalletHandler) GetWallet(c *gin.Context) {
 		return
 	}
 
-	wallet, err := h.walletService.GetWallet(c.Request.Context(), walletID)
+	ctx, outcome := cache.WithOutcome(c.Request.Context())
+	wallet, err := h.walletService.GetWallet(ctx, walletID)
 	if err != nil {
 		slog.Error("Get wallet error", "error", err.Error(), "wallet_id", walletID)
 
@@ -45,9 +65,247 @@ func (h *WalletHandler) GetWallet(c *gin.Context) {
 		return
 	}
 
+	// The balance changes with every operation, clients have to revalidate with the ETag.
+	c.Header("Cache-Control", "private, no-cache")
+	if outcome.Cached {
+		c.Header("X-Cache", cacheStatus(outcome.Hit))
+	}
+	c.Header("ETag", walletETag(wallet.Version))
+	c.JSON(http.StatusOK, wallet)
+}
+
+func cacheStatus(hit bool) string {
+	if hit {
+		return "HIT"
+	}
+	return "MISS"
+}
+
+func (h *WalletHandler) UpdateWallet(c *gin.Context) {
+	walletID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid wallet_id format"})
+		return
+	}
+
+	var update entity.WalletUpdate
+	if err := c.ShouldBindJSON(&update); err != nil {
+		slog.Warn("Invalid request body", "error", err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	wallet, err := h.walletService.UpdateWallet(c.Request.Context(), walletID, update)
+	if err != nil {
+		slog.Error("Update wallet error", "error", err.Error(), "wallet_id", walletID)
+
+		if errors.Is(err, repository.ErrWalletNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "wallet not found"})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update wallet"})
+		return
+	}
+
+	c.Header("ETag", walletETag(wallet.Version))
 	c.JSON(http.StatusOK, wallet)
 }
 
+func (h *WalletHandler) SearchWallets(c *gin.Context) {
+	filter := entity.WalletFilter{
+		OwnerID: c.Query("owner_id"),
+		Labels:  make(map[string]string),
+		Limit:   defaultWalletsLimit,
+	}
+
+	for _, label := range c.QueryArray("label") {
+		key, value, ok := strings.Cut(label, ":")
+		if !ok || key == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "label must be in key:value form"})
+			return
+		}
+		filter.Labels[key] = value
+	}
+
+	if after := c.Query("after"); after != "" {
+		afterID, err := uuid.Parse(after)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid after format"})
+			return
+		}
+		filter.After = afterID
+	}
+
+	if limitStr := c.Query("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > maxWalletsLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+			return
+		}
+		filter.Limit = limit
+	}
+
+	wallets, err := h.walletService.SearchWallets(c.Request.Context(), filter)
+	if err != nil {
+		slog.Error("Search wallets error", "error", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to search wallets"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"wallets": wallets})
+}
+
+func (h *WalletHandler) GetBalanceAt(c *gin.Context) {
+	walletID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid wallet_id format"})
+		return
+	}
+
+	at := time.Now()
+	if atStr := c.Query("at"); atStr != "" {
+		at, err = time.Parse(time.RFC3339, atStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "at must be an RFC 3339 timestamp"})
+			return
+		}
+	}
+
+	balance, err := h.walletService.GetBalanceAt(c.Request.Context(), walletID, at)
+	if err != nil {
+		slog.Error("Get balance error", "error", err.Error(), "wallet_id", walletID)
+
+		if errors.Is(err, repository.ErrWalletNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "wallet not found"})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get balance"})
+		return
+	}
+
+	c.JSON(http.StatusOK, balance)
+}
+
+func (h *WalletHandler) ListOperations(c *gin.Context) {
+	walletID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid wallet_id format"})
+		return
+	}
+
+	filter := entity.OperationFilter{
+		WalletID:          walletID,
+		Limit:             defaultOperationsLimit,
+		OperationType:     c.Query("operation_type"),
+		ExternalReference: c.Query("external_reference"),
+		Description:       c.Query("description"),
+		Metadata:          make(map[string]string),
+	}
+
+	for _, entry := range c.QueryArray("metadata") {
+		key, value, ok := strings.Cut(entry, ":")
+		if !ok || key == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "metadata must be in key:value form"})
+			return
+		}
+		filter.Metadata[key] = value
+	}
+
+	if beforeStr := c.Query("before_seq"); beforeStr != "" {
+		filter.BeforeSeq, err = strconv.ParseInt(beforeStr, 10, 64)
+		if err != nil || filter.BeforeSeq <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "before_seq must be a positive integer"})
+			return
+		}
+	}
+
+	if limitStr := c.Query("limit"); limitStr != "" {
+		filter.Limit, err = strconv.Atoi(limitStr)
+		if err != nil || filter.Limit <= 0 || filter.Limit > maxOperationsLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+			return
+		}
+	}
+
+	operations, err := h.walletService.ListOperations(c.Request.Context(), filter)
+	if err != nil {
+		slog.Error("List operations error", "error", err.Error(), "wallet_id", walletID)
+
+		if errors.Is(err, repository.ErrWalletNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "wallet not found"})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list operations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"operations": operations})
+}
+
+func (h *WalletHandler) GetStatement(c *gin.Context) {
+	walletID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid wallet_id format"})
+		return
+	}
+
+	from, err := time.Parse(time.RFC3339, c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be an RFC 3339 timestamp"})
+		return
+	}
+	to, err := time.Parse(time.RFC3339, c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must be an RFC 3339 timestamp"})
+		return
+	}
+	if !to.After(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must be after from"})
+		return
+	}
+
+	format := c.DefaultQuery("format", statement.FormatCSV)
+	writer, err := statement.NewWriter(format, c.Writer)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be 'csv', 'jsonl' or 'pdf'"})
+		return
+	}
+
+	// Long periods take longer to stream than the server write timeout.
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	c.Header("Content-Type", statement.ContentType(format))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="statement-%s-%s.%s"`,
+		walletID, from.UTC().Format("20060102"), format))
+
+	err = h.walletService.WriteStatement(c.Request.Context(), walletID, from, to, writer)
+	if err == nil {
+		return
+	}
+
+	slog.Error("Write statement error", "error", err.Error(), "wallet_id", walletID)
+
+	// Once the statement has started the status is already sent,
+	// so the only thing left is to cut the response short.
+	if c.Writer.Written() {
+		c.Abort()
+		return
+	}
+
+	c.Writer.Header().Del("Content-Type")
+	c.Writer.Header().Del("Content-Disposition")
+
+	if errors.Is(err, repository.ErrWalletNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "wallet not found"})
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to build statement"})
+}
+
 func (h *WalletHandler) AddOperation(c *gin.Context) {
 	var req entity.OperationRequest
 
@@ -56,27 +314,108 @@ func (h *WalletHandler) AddOperation(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, err.Error())
 		return
 	}
-	if req.WalletID == uuid.Nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "wallet_id is required"})
+	// wallet_id, operation_type and amount are checked against the OpenAPI
+	// document by openapi.Validator before the request gets here.
+
+	version, ok := parseIfMatch(c.GetHeader("If-Match"))
+	if !ok {
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": repository.ErrVersionMismatch.Error()})
 		return
 	}
-	if req.OperationType != "DEPOSIT" && req.OperationType != "WITHDRAW" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error": "operation_type must be 'DEPOSIT' or 'WITHDRAW'",
-		})
+	req.ExpectedVersion = version
+
+	result, err := h.walletService.AddOperation(c.Request.Context(), &req)
+	if err != nil {
+		slog.Error("Add operation error", "error", err.Error())
+
+		// the wallet row is locked first, so an unknown wallet is reported before any check
+		if errors.Is(err, repository.ErrWalletNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "wallet not found"})
+			return
+		}
+
+		// the balance would drop below min_balance - credit_limit, or below min_balance + hold_amount
+		if errors.Is(err, repository.ErrInsufficientFunds) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+
+		// a FULL freeze, or a withdrawal from a DEPOSIT_ONLY wallet
+		if errors.Is(err, repository.ErrWalletFrozen) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+
+		if errors.Is(err, repository.ErrDuplicateOperation) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+
+		// the request is fine, the wallet is busy, so it is worth retrying as is
+		if errors.Is(err, repository.ErrWalletLocked) {
+			c.Header("Retry-After", lockedRetryAfter)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+
+		if errors.Is(err, repository.ErrVersionMismatch) {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	if req.Amount <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be positive"})
+
+	c.Header("ETag", walletETag(result.Wallet.Version))
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *WalletHandler) GetOperation(c *gin.Context) {
+	operationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid operation id format"})
 		return
 	}
 
-	wallet, err := h.walletService.AddOperation(c.Request.Context(), &req)
+	operation, err := h.walletService.GetOperation(c.Request.Context(), operationID)
 	if err != nil {
-		slog.Error("Add operation err", err.Error(), nil)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		slog.Error("Get operation error", "error", err.Error(), "operation_id", operationID)
+
+		if errors.Is(err, repository.ErrOperationNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "operation not found"})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get operation"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"wallet": wallet})
+	c.JSON(http.StatusOK, operation)
+}
+
+// walletETag is the strong entity tag of a wallet version.
+func walletETag(version int64) string {
+	return strconv.Quote(strconv.FormatInt(version, 10))
+}
+
+// parseIfMatch returns the wallet version an If-Match header asks for, 0 when the header
+// is absent or "*". ok is false when the header can not match any wallet ETag.
+func parseIfMatch(header string) (version int64, ok bool) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return 0, true
+	}
+
+	tag, err := strconv.Unquote(header)
+	if err != nil || !strings.HasPrefix(header, `"`) {
+		return 0, false
+	}
+
+	version, err = strconv.ParseInt(tag, 10, 64)
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+
+	return version, true
 }
@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"wallet_controller/internal/entity"
+	"wallet_controller/internal/repository"
+	"wallet_controller/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultDeliveriesLimit = 50
+	maxDeliveriesLimit     = 500
+)
+
+var webhookEventTypes = map[string]bool{
+	entity.EventOperationCreated: true,
+	entity.EventBalanceChanged:   true,
+}
+
+type WebhookHandler struct {
+	webhookService service.WebhookServiceInterface
+}
+
+func NewWebhookHandler(webhookService service.WebhookServiceInterface) *WebhookHandler {
+	return &WebhookHandler{
+		webhookService: webhookService,
+	}
+}
+
+func (h *WebhookHandler) CreateSubscription(c *gin.Context) {
+	req, ok := bindSubscriptionRequest(c)
+	if !ok {
+		return
+	}
+
+	subscription, err := h.webhookService.CreateSubscription(c.Request.Context(), req)
+	if err != nil {
+		respondSubscriptionError(c, err, "failed to create webhook subscription")
+		return
+	}
+
+	c.JSON(http.StatusCreated, subscription)
+}
+
+func (h *WebhookHandler) ListSubscriptions(c *gin.Context) {
+	subscriptions, err := h.webhookService.ListSubscriptions(c.Request.Context())
+	if err != nil {
+		slog.Error("List webhook subscriptions error", "error", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list webhook subscriptions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"subscriptions": subscriptions})
+}
+
+func (h *WebhookHandler) GetSubscription(c *gin.Context) {
+	subscriptionID, ok := parseSubscriptionID(c)
+	if !ok {
+		return
+	}
+
+	subscription, err := h.webhookService.GetSubscription(c.Request.Context(), subscriptionID)
+	if err != nil {
+		respondSubscriptionError(c, err, "failed to get webhook subscription")
+		return
+	}
+
+	c.JSON(http.StatusOK, subscription)
+}
+
+func (h *WebhookHandler) UpdateSubscription(c *gin.Context) {
+	subscriptionID, ok := parseSubscriptionID(c)
+	if !ok {
+		return
+	}
+
+	req, ok := bindSubscriptionRequest(c)
+	if !ok {
+		return
+	}
+
+	subscription, err := h.webhookService.UpdateSubscription(c.Request.Context(), subscriptionID, req)
+	if err != nil {
+		respondSubscriptionError(c, err, "failed to update webhook subscription")
+		return
+	}
+
+	c.JSON(http.StatusOK, subscription)
+}
+
+func (h *WebhookHandler) DeleteSubscription(c *gin.Context) {
+	subscriptionID, ok := parseSubscriptionID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.webhookService.DeleteSubscription(c.Request.Context(), subscriptionID); err != nil {
+		respondSubscriptionError(c, err, "failed to delete webhook subscription")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	subscriptionID, ok := parseSubscriptionID(c)
+	if !ok {
+		return
+	}
+
+	limit := defaultDeliveriesLimit
+	if limitStr := c.Query("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 || parsed > maxDeliveriesLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+			return
+		}
+		limit = parsed
+	}
+
+	deliveries, err := h.webhookService.ListDeliveries(c.Request.Context(), subscriptionID, limit)
+	if err != nil {
+		respondSubscriptionError(c, err, "failed to list webhook deliveries")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
+
+func parseSubscriptionID(c *gin.Context) (uuid.UUID, bool) {
+	subscriptionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid subscription id format"})
+		return uuid.Nil, false
+	}
+
+	return subscriptionID, true
+}
+
+func bindSubscriptionRequest(c *gin.Context) (*entity.WebhookSubscriptionRequest, bool) {
+	var req entity.WebhookSubscriptionRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		slog.Warn("Invalid request body", "error", err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	target, err := url.Parse(req.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url must be an absolute http(s) URL"})
+		return nil, false
+	}
+	for _, eventType := range req.EventTypes {
+		if !webhookEventTypes[eventType] {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "event_types may contain only 'OperationCreated' and 'BalanceChanged'",
+			})
+			return nil, false
+		}
+	}
+	if req.WalletID != nil && *req.WalletID == uuid.Nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wallet_id must not be empty"})
+		return nil, false
+	}
+
+	return &req, true
+}
+
+func respondSubscriptionError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, repository.ErrSubscriptionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "webhook subscription not found"})
+	case errors.Is(err, repository.ErrWalletNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "wallet not found"})
+	default:
+		slog.Error("Webhook subscription error", "error", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
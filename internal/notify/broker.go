@@ -0,0 +1,71 @@
+package notify
+
+import (
+	"sync"
+	"wallet_controller/internal/entity"
+
+	"github.com/google/uuid"
+)
+
+const subscriberBuffer = 64
+
+// Broker fans balance events out to in-process subscribers of a wallet.
+type Broker struct {
+	mu          sync.Mutex
+	subscribers map[uuid.UUID]map[chan entity.BalanceEvent]struct{}
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		subscribers: make(map[uuid.UUID]map[chan entity.BalanceEvent]struct{}),
+	}
+}
+
+// Subscribe registers a subscriber for the wallet. The returned channel is closed
+// by the cancel function, or by the broker when the subscriber falls too far behind;
+// in that case the subscriber is expected to resume from the last seen event.
+func (b *Broker) Subscribe(walletID uuid.UUID) (<-chan entity.BalanceEvent, func()) {
+	ch := make(chan entity.BalanceEvent, subscriberBuffer)
+
+	b.mu.Lock()
+	if b.subscribers[walletID] == nil {
+		b.subscribers[walletID] = make(map[chan entity.BalanceEvent]struct{})
+	}
+	b.subscribers[walletID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.remove(walletID, ch)
+	}
+}
+
+func (b *Broker) Publish(event entity.BalanceEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers[event.WalletID] {
+		select {
+		case ch <- event:
+		default:
+			b.remove(event.WalletID, ch)
+		}
+	}
+}
+
+func (b *Broker) remove(walletID uuid.UUID, ch chan entity.BalanceEvent) {
+	subscribers, ok := b.subscribers[walletID]
+	if !ok {
+		return
+	}
+	if _, ok = subscribers[ch]; !ok {
+		return
+	}
+
+	delete(subscribers, ch)
+	close(ch)
+	if len(subscribers) == 0 {
+		delete(b.subscribers, walletID)
+	}
+}
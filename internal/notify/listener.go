@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+	"wallet_controller/internal/cache"
+	"wallet_controller/internal/entity"
+	"wallet_controller/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const reconnectDelay = time.Second
+
+// Listen forwards balance notifications committed by any application instance
+// to the broker until ctx is cancelled, reconnecting when the connection drops.
+// Wallets changed by any instance are dropped from walletCache, which may be nil.
+func Listen(ctx context.Context, db *pgxpool.Pool, broker *Broker, walletCache cache.WalletCache) {
+	slog.Info("Starting balance listener", "channel", repository.BalanceChannel)
+
+	for ctx.Err() == nil {
+		if err := listen(ctx, db, broker, walletCache); err != nil && ctx.Err() == nil {
+			slog.Error("balance listener failed", "error", err.Error())
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(reconnectDelay):
+			}
+		}
+	}
+
+	slog.Info("Stopping balance listener")
+}
+
+func listen(ctx context.Context, db *pgxpool.Pool, broker *Broker, walletCache cache.WalletCache) error {
+	pooled, err := db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// The connection keeps LISTEN state, so it is taken out of the pool for good.
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	for _, channel := range []string{repository.BalanceChannel, repository.WalletChannel} {
+		if _, err = conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			return err
+		}
+	}
+
+	// Changes committed while the listener was not connected were not seen.
+	if walletCache != nil {
+		walletCache.Purge(ctx)
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		if notification.Channel == repository.WalletChannel {
+			walletID, err := uuid.Parse(notification.Payload)
+			if err != nil {
+				slog.Warn("invalid wallet notification", "error", err.Error())
+				continue
+			}
+			if walletCache != nil {
+				walletCache.Invalidate(ctx, walletID)
+			}
+			continue
+		}
+
+		var event entity.BalanceEvent
+		if err = json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+			slog.Warn("invalid balance notification", "error", err.Error())
+			continue
+		}
+
+		if walletCache != nil {
+			walletCache.Invalidate(ctx, event.WalletID)
+		}
+		broker.Publish(event)
+	}
+}
@@ -0,0 +1,251 @@
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+//go:embed openapi.json
+var specJSON []byte
+
+// Spec returns the OpenAPI document describing the HTTP API.
+func Spec() []byte {
+	return specJSON
+}
+
+// Document is the subset of an OpenAPI 3.1 document needed to validate requests.
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+type Components struct {
+	Schemas    map[string]*Schema    `json:"schemas"`
+	Parameters map[string]*Parameter `json:"parameters"`
+}
+
+type PathItem struct {
+	Parameters []*Parameter `json:"parameters"`
+	Get        *Operation   `json:"get"`
+	Post       *Operation   `json:"post"`
+	Put        *Operation   `json:"put"`
+	Patch      *Operation   `json:"patch"`
+	Delete     *Operation   `json:"delete"`
+}
+
+type Operation struct {
+	OperationID string       `json:"operationId"`
+	Parameters  []*Parameter `json:"parameters"`
+	RequestBody *RequestBody `json:"requestBody"`
+}
+
+type Parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema is the subset of JSON Schema 2020-12 supported by the validator.
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 Types              `json:"type"`
+	Format               string             `json:"format"`
+	Enum                 []any              `json:"enum"`
+	Const                any                `json:"const"`
+	Pattern              string             `json:"pattern"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	ExclusiveMinimum     *float64           `json:"exclusiveMinimum"`
+	ExclusiveMaximum     *float64           `json:"exclusiveMaximum"`
+	Items                *Schema            `json:"items"`
+	MinItems             *int               `json:"minItems"`
+	MaxItems             *int               `json:"maxItems"`
+	Required             []string           `json:"required"`
+	Properties           map[string]*Schema `json:"properties"`
+	AdditionalProperties *Additional        `json:"additionalProperties"`
+
+	pattern *regexp.Regexp
+}
+
+// Types is the "type" keyword, which OpenAPI 3.1 allows to be a single type or a list.
+type Types []string
+
+func (t *Types) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = Types{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("type must be a string or an array of strings: %w", err)
+	}
+	*t = list
+	return nil
+}
+
+// Additional is the "additionalProperties" keyword, either a boolean or a schema
+// every property not listed in "properties" has to match.
+type Additional struct {
+	Allowed bool
+	Schema  *Schema
+}
+
+func (a *Additional) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &a.Allowed); err == nil {
+		return nil
+	}
+
+	a.Allowed = true
+	return json.Unmarshal(data, &a.Schema)
+}
+
+// Parse reads an OpenAPI document and prepares it for validation.
+func Parse(data []byte) (*Document, error) {
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI document: %w", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.1") {
+		return nil, fmt.Errorf("unsupported OpenAPI version %q", doc.OpenAPI)
+	}
+
+	for path, item := range doc.Paths {
+		for i, param := range item.Parameters {
+			resolved, err := doc.parameter(param)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			item.Parameters[i] = resolved
+		}
+
+		for _, operation := range item.operations() {
+			for i, param := range operation.Parameters {
+				resolved, err := doc.parameter(param)
+				if err != nil {
+					return nil, fmt.Errorf("%s %s: %w", path, operation.OperationID, err)
+				}
+				operation.Parameters[i] = resolved
+			}
+		}
+	}
+
+	for name, schema := range doc.Components.Schemas {
+		if err := doc.prepare(schema); err != nil {
+			return nil, fmt.Errorf("schema %s: %w", name, err)
+		}
+	}
+	for path, item := range doc.Paths {
+		for _, param := range item.Parameters {
+			if err := doc.prepare(param.Schema); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+		for _, operation := range item.operations() {
+			for _, param := range operation.Parameters {
+				if err := doc.prepare(param.Schema); err != nil {
+					return nil, fmt.Errorf("%s %s: %w", path, operation.OperationID, err)
+				}
+			}
+			if operation.RequestBody == nil {
+				continue
+			}
+			for _, media := range operation.RequestBody.Content {
+				if err := doc.prepare(media.Schema); err != nil {
+					return nil, fmt.Errorf("%s %s: %w", path, operation.OperationID, err)
+				}
+			}
+		}
+	}
+
+	return &doc, nil
+}
+
+func (p *PathItem) operations() map[string]*Operation {
+	operations := make(map[string]*Operation)
+	for method, operation := range map[string]*Operation{
+		"GET":    p.Get,
+		"POST":   p.Post,
+		"PUT":    p.Put,
+		"PATCH":  p.Patch,
+		"DELETE": p.Delete,
+	} {
+		if operation != nil {
+			operations[method] = operation
+		}
+	}
+	return operations
+}
+
+func (d *Document) parameter(param *Parameter) (*Parameter, error) {
+	if param.Ref == "" {
+		return param, nil
+	}
+
+	name, ok := strings.CutPrefix(param.Ref, "#/components/parameters/")
+	if !ok || d.Components.Parameters[name] == nil {
+		return nil, fmt.Errorf("unresolved reference %q", param.Ref)
+	}
+	return d.Components.Parameters[name], nil
+}
+
+// resolve follows $ref until it reaches a schema with its own keywords.
+func (d *Document) resolve(schema *Schema) *Schema {
+	for schema != nil && schema.Ref != "" {
+		name := strings.TrimPrefix(schema.Ref, "#/components/schemas/")
+		schema = d.Components.Schemas[name]
+	}
+	return schema
+}
+
+// prepare checks references and compiles patterns of a schema and its subschemas.
+func (d *Document) prepare(schema *Schema) error {
+	if schema == nil {
+		return nil
+	}
+	if schema.Ref != "" {
+		if d.resolve(schema) == nil {
+			return fmt.Errorf("unresolved reference %q", schema.Ref)
+		}
+		return nil
+	}
+
+	if schema.Pattern != "" && schema.pattern == nil {
+		pattern, err := regexp.Compile(schema.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", schema.Pattern, err)
+		}
+		schema.pattern = pattern
+	}
+
+	if err := d.prepare(schema.Items); err != nil {
+		return err
+	}
+	for _, property := range schema.Properties {
+		if err := d.prepare(property); err != nil {
+			return err
+		}
+	}
+	if schema.AdditionalProperties != nil {
+		return d.prepare(schema.AdditionalProperties.Schema)
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// validate appends a message to errs for every constraint of schema the value breaks.
+// The value is a decoded JSON document with numbers kept as json.Number.
+func (d *Document) validate(schema *Schema, value any, name string, errs *[]string) {
+	schema = d.resolve(schema)
+	if schema == nil {
+		return
+	}
+
+	if value == nil {
+		if len(schema.Type) > 0 && !slices.Contains(schema.Type, "null") {
+			*errs = append(*errs, fmt.Sprintf("%s must not be null", name))
+		}
+		return
+	}
+
+	if len(schema.Type) > 0 && !matchesType(schema.Type, value) {
+		*errs = append(*errs, fmt.Sprintf("%s must be %s", name, describeTypes(schema.Type)))
+		return
+	}
+
+	if schema.Const != nil && !sameValue(schema.Const, value) {
+		*errs = append(*errs, fmt.Sprintf("%s must be %s", name, quote(schema.Const)))
+		return
+	}
+	if len(schema.Enum) > 0 && !slices.ContainsFunc(schema.Enum, func(allowed any) bool {
+		return sameValue(allowed, value)
+	}) {
+		*errs = append(*errs, fmt.Sprintf("%s must be one of %s", name, describeEnum(schema.Enum)))
+		return
+	}
+
+	switch v := value.(type) {
+	case string:
+		d.validateString(schema, v, name, errs)
+	case json.Number:
+		d.validateNumber(schema, v, name, errs)
+	case []any:
+		d.validateArray(schema, v, name, errs)
+	case map[string]any:
+		d.validateObject(schema, v, name, errs)
+	}
+}
+
+func (d *Document) validateString(schema *Schema, value string, name string, errs *[]string) {
+	if schema.MinLength != nil && len([]rune(value)) < *schema.MinLength {
+		*errs = append(*errs, fmt.Sprintf("%s must be at least %d characters long", name, *schema.MinLength))
+	}
+	if schema.MaxLength != nil && len([]rune(value)) > *schema.MaxLength {
+		*errs = append(*errs, fmt.Sprintf("%s must be at most %d characters long", name, *schema.MaxLength))
+	}
+	if schema.pattern != nil && !schema.pattern.MatchString(value) {
+		*errs = append(*errs, fmt.Sprintf("%s must match %s", name, schema.Pattern))
+	}
+
+	switch schema.Format {
+	case "uuid":
+		if _, err := uuid.Parse(value); err != nil {
+			*errs = append(*errs, fmt.Sprintf("%s must be a UUID", name))
+		}
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339, value); err != nil {
+			*errs = append(*errs, fmt.Sprintf("%s must be an RFC 3339 timestamp", name))
+		}
+	case "uri":
+		if target, err := url.Parse(value); err != nil || target.Scheme == "" || target.Host == "" {
+			*errs = append(*errs, fmt.Sprintf("%s must be an absolute URL", name))
+		}
+	}
+}
+
+func (d *Document) validateNumber(schema *Schema, value json.Number, name string, errs *[]string) {
+	number, err := value.Float64()
+	if err != nil {
+		*errs = append(*errs, fmt.Sprintf("%s must be a number", name))
+		return
+	}
+
+	if schema.Minimum != nil && number < *schema.Minimum {
+		*errs = append(*errs, fmt.Sprintf("%s must be at least %s", name, formatNumber(*schema.Minimum)))
+	}
+	if schema.Maximum != nil && number > *schema.Maximum {
+		*errs = append(*errs, fmt.Sprintf("%s must be at most %s", name, formatNumber(*schema.Maximum)))
+	}
+	if schema.ExclusiveMinimum != nil && number <= *schema.ExclusiveMinimum {
+		*errs = append(*errs, fmt.Sprintf("%s must be greater than %s", name, formatNumber(*schema.ExclusiveMinimum)))
+	}
+	if schema.ExclusiveMaximum != nil && number >= *schema.ExclusiveMaximum {
+		*errs = append(*errs, fmt.Sprintf("%s must be less than %s", name, formatNumber(*schema.ExclusiveMaximum)))
+	}
+}
+
+func (d *Document) validateArray(schema *Schema, value []any, name string, errs *[]string) {
+	if schema.MinItems != nil && len(value) < *schema.MinItems {
+		*errs = append(*errs, fmt.Sprintf("%s must contain at least %d items", name, *schema.MinItems))
+	}
+	if schema.MaxItems != nil && len(value) > *schema.MaxItems {
+		*errs = append(*errs, fmt.Sprintf("%s must contain at most %d items", name, *schema.MaxItems))
+	}
+	if schema.Items == nil {
+		return
+	}
+
+	for i, item := range value {
+		d.validate(schema.Items, item, fmt.Sprintf("%s[%d]", name, i), errs)
+	}
+}
+
+func (d *Document) validateObject(schema *Schema, value map[string]any, name string, errs *[]string) {
+	for _, property := range schema.Required {
+		if _, ok := value[property]; ok {
+			continue
+		}
+
+		message := fmt.Sprintf("%s is required", join(name, property))
+		// Spell out the allowed values, a missing enum is usually a misspelt field name.
+		if propertySchema := d.resolve(schema.Properties[property]); propertySchema != nil && len(propertySchema.Enum) > 0 {
+			message += " and must be one of " + describeEnum(propertySchema.Enum)
+		}
+		*errs = append(*errs, message)
+	}
+
+	properties := make([]string, 0, len(value))
+	for property := range value {
+		properties = append(properties, property)
+	}
+	sort.Strings(properties)
+
+	for _, property := range properties {
+		propertySchema, ok := schema.Properties[property]
+		if !ok && schema.AdditionalProperties != nil {
+			if !schema.AdditionalProperties.Allowed {
+				*errs = append(*errs, fmt.Sprintf("%s is not allowed", join(name, property)))
+				continue
+			}
+			propertySchema = schema.AdditionalProperties.Schema
+		}
+		if propertySchema == nil {
+			continue
+		}
+		d.validate(propertySchema, value[property], join(name, property), errs)
+	}
+}
+
+// parseParameter converts a path, query or header value to the JSON type of its schema.
+func (d *Document) parseParameter(schema *Schema, raw string) (any, bool) {
+	schema = d.resolve(schema)
+	if schema == nil || len(schema.Type) == 0 {
+		return raw, true
+	}
+
+	switch schema.Type[0] {
+	case "integer":
+		if _, err := strconv.ParseInt(raw, 10, 64); err != nil {
+			return nil, false
+		}
+		return json.Number(raw), true
+	case "number":
+		if _, err := strconv.ParseFloat(raw, 64); err != nil {
+			return nil, false
+		}
+		return json.Number(raw), true
+	case "boolean":
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, false
+		}
+		return parsed, true
+	default:
+		return raw, true
+	}
+}
+
+func matchesType(types Types, value any) bool {
+	for _, t := range types {
+		switch v := value.(type) {
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case json.Number:
+			if t == "number" || (t == "integer" && isInteger(v)) {
+				return true
+			}
+		case []any:
+			if t == "array" {
+				return true
+			}
+		case map[string]any:
+			if t == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isInteger(value json.Number) bool {
+	if _, err := value.Int64(); err == nil {
+		return true
+	}
+	number, err := value.Float64()
+	return err == nil && number == float64(int64(number))
+}
+
+func sameValue(expected any, value any) bool {
+	switch e := expected.(type) {
+	case float64:
+		number, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		parsed, err := number.Float64()
+		return err == nil && parsed == e
+	default:
+		return expected == value
+	}
+}
+
+func describeTypes(types Types) string {
+	names := make([]string, 0, len(types))
+	for _, t := range types {
+		switch t {
+		case "integer", "array", "object":
+			names = append(names, "an "+t)
+		case "null":
+			names = append(names, "null")
+		default:
+			names = append(names, "a "+t)
+		}
+	}
+	return strings.Join(names, " or ")
+}
+
+func describeEnum(values []any) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = quote(value)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func quote(value any) string {
+	if s, ok := value.(string); ok {
+		return "'" + s + "'"
+	}
+	if f, ok := value.(float64); ok {
+		return formatNumber(f)
+	}
+	return fmt.Sprint(value)
+}
+
+func formatNumber(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func join(parent, property string) string {
+	if parent == "" {
+		return property
+	}
+	return parent + "." + property
+}
@@ -0,0 +1,193 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Validator checks incoming requests against the operations of an OpenAPI document.
+type Validator struct {
+	doc    *Document
+	routes map[string]*route
+}
+
+type route struct {
+	operation  *Operation
+	parameters []*Parameter
+}
+
+// NewValidator builds a validator for the embedded API document.
+// The document is part of the binary, so an invalid one is a programming error.
+func NewValidator() *Validator {
+	doc, err := Parse(specJSON)
+	if err != nil {
+		panic(err)
+	}
+
+	return NewDocumentValidator(doc)
+}
+
+func NewDocumentValidator(doc *Document) *Validator {
+	v := &Validator{
+		doc:    doc,
+		routes: make(map[string]*route),
+	}
+
+	for path, item := range doc.Paths {
+		for method, operation := range item.operations() {
+			v.routes[routeKey(method, ginPath(path))] = &route{
+				operation:  operation,
+				parameters: mergeParameters(item.Parameters, operation.Parameters),
+			}
+		}
+	}
+
+	return v
+}
+
+// HasRoute reports whether the document describes a gin route.
+func (v *Validator) HasRoute(method, path string) bool {
+	_, ok := v.routes[routeKey(method, path)]
+	return ok
+}
+
+// Middleware rejects requests that do not match the document with 400 before they
+// reach the handler. Routes the document does not describe are passed through.
+func (v *Validator) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r, ok := v.routes[routeKey(c.Request.Method, c.FullPath())]
+		if !ok {
+			c.Next()
+			return
+		}
+
+		if errs := v.validateRequest(c, r); len(errs) > 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": strings.Join(errs, "; ")})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func (v *Validator) validateRequest(c *gin.Context, r *route) []string {
+	var errs []string
+
+	for _, param := range r.parameters {
+		var values []string
+		switch param.In {
+		case "path":
+			if raw := c.Param(param.Name); raw != "" {
+				values = []string{raw}
+			}
+		case "query":
+			// A repeated query parameter has to match the schema every time.
+			values = c.QueryArray(param.Name)
+		case "header":
+			if raw := c.GetHeader(param.Name); raw != "" {
+				values = []string{raw}
+			}
+		default:
+			continue
+		}
+
+		if len(values) == 0 {
+			if param.Required {
+				errs = append(errs, param.Name+" is required")
+			}
+			continue
+		}
+
+		for _, raw := range values {
+			value, ok := v.doc.parseParameter(param.Schema, raw)
+			if !ok {
+				errs = append(errs, param.Name+" must be "+describeTypes(v.doc.resolve(param.Schema).Type))
+				continue
+			}
+			v.doc.validate(param.Schema, value, param.Name, &errs)
+		}
+	}
+
+	if body := r.operation.RequestBody; body != nil {
+		errs = append(errs, v.validateBody(c, body)...)
+	}
+
+	return errs
+}
+
+func (v *Validator) validateBody(c *gin.Context, body *RequestBody) []string {
+	media := body.Content["application/json"]
+	if media == nil {
+		return nil
+	}
+
+	data, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return []string{"failed to read request body"}
+	}
+	// The handler binds the same body again.
+	c.Request.Body = io.NopCloser(bytes.NewReader(data))
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		if body.Required {
+			return []string{"request body is required"}
+		}
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return []string{"request body must be valid JSON"}
+	}
+
+	if schema := v.doc.resolve(media.Schema); schema != nil && len(schema.Type) > 0 && !matchesType(schema.Type, value) {
+		return []string{"request body must be " + describeTypes(schema.Type)}
+	}
+
+	var errs []string
+	v.doc.validate(media.Schema, value, "", &errs)
+
+	return errs
+}
+
+// mergeParameters combines path-level and operation-level parameters,
+// the latter overriding the former as the specification requires.
+func mergeParameters(pathParams, operationParams []*Parameter) []*Parameter {
+	merged := make([]*Parameter, 0, len(pathParams)+len(operationParams))
+	for _, param := range pathParams {
+		overridden := false
+		for _, override := range operationParams {
+			if override.Name == param.Name && override.In == param.In {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			merged = append(merged, param)
+		}
+	}
+	return append(merged, operationParams...)
+}
+
+func routeKey(method, path string) string {
+	return method + " " + path
+}
+
+// ginPath turns an OpenAPI path template like /wallets/{id} into gin's /wallets/:id.
+func ginPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			segments[i] = ":" + segment[1:len(segment)-1]
+		}
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,72 @@
+package outbox
+
+import (
+	"context"
+	"log/slog"
+	"time"
+	"wallet_controller/internal/entity"
+	"wallet_controller/internal/repository"
+)
+
+type Relay struct {
+	repo      repository.OutboxRepositoryInterface
+	publisher Publisher
+	interval  time.Duration
+	batchSize int
+}
+
+func NewRelay(repo repository.OutboxRepositoryInterface, publisher Publisher, interval time.Duration, batchSize int) *Relay {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	return &Relay{
+		repo:      repo,
+		publisher: publisher,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+// Run polls the outbox until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) {
+	slog.Info("Starting outbox relay", "interval", r.interval)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.Drain(ctx)
+
+		select {
+		case <-ctx.Done():
+			slog.Info("Stopping outbox relay")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Drain publishes pending events batch by batch until the outbox is empty
+// or a batch could not be fully published.
+func (r *Relay) Drain(ctx context.Context) int {
+	total := 0
+	for ctx.Err() == nil {
+		n, err := r.repo.ProcessPending(ctx, r.batchSize, func(event entity.Event) error {
+			return r.publisher.Publish(ctx, event)
+		})
+		total += n
+		if err != nil {
+			slog.Error("outbox relay failed", "error", err.Error())
+			return total
+		}
+		if n < r.batchSize {
+			return total
+		}
+	}
+
+	return total
+}
@@ -0,0 +1,95 @@
+// Package queue applies operations accepted for asynchronous processing.
+package queue
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+	"wallet_controller/internal/repository"
+)
+
+type WorkerConfig struct {
+	Interval time.Duration
+	// Wallets is how many wallets with pending operations are taken per poll.
+	Wallets int
+	// BatchSize is how many operations of one wallet are applied in one transaction.
+	BatchSize int
+}
+
+// Worker drains the operation queue wallet by wallet, coalescing the pending operations
+// of a wallet into one balance update.
+type Worker struct {
+	repo repository.OperationQueueRepositoryInterface
+	cfg  WorkerConfig
+}
+
+func NewWorker(repo repository.OperationQueueRepositoryInterface, cfg WorkerConfig) *Worker {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 200 * time.Millisecond
+	}
+	if cfg.Wallets <= 0 {
+		cfg.Wallets = 50
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+
+	return &Worker{
+		repo: repo,
+		cfg:  cfg,
+	}
+}
+
+// Run polls the queue until ctx is cancelled. While there is a backlog it polls again
+// right away instead of waiting for the next tick.
+func (w *Worker) Run(ctx context.Context) {
+	slog.Info("Starting operation queue worker", "interval", w.cfg.Interval, "batch_size", w.cfg.BatchSize)
+
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if w.ProcessPending(ctx) > 0 && ctx.Err() == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			slog.Info("Stopping operation queue worker")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessPending applies one batch for each of the wallets with pending operations and
+// returns how many operations were applied or failed. Wallets locked by another
+// operation are left for the next poll.
+func (w *Worker) ProcessPending(ctx context.Context) int {
+	wallets, err := w.repo.PendingWallets(ctx, w.cfg.Wallets)
+	if err != nil {
+		slog.Error("failed to get wallets with pending operations", "error", err.Error())
+		return 0
+	}
+
+	processed := 0
+	for _, walletID := range wallets {
+		batch, err := w.repo.ApplyPending(ctx, walletID, w.cfg.BatchSize)
+		if err != nil {
+			if errors.Is(err, repository.ErrWalletLocked) {
+				slog.Debug("wallet with pending operations is locked", "wallet_id", walletID)
+				continue
+			}
+			slog.Error("failed to apply queued operations", "wallet_id", walletID, "error", err.Error())
+			continue
+		}
+
+		if batch.Failed > 0 {
+			slog.Warn("queued operations failed", "wallet_id", walletID, "failed", batch.Failed)
+		}
+		processed += batch.Applied + batch.Failed
+	}
+
+	return processed
+}
@@ -0,0 +1,284 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+	"wallet_controller/internal/audit"
+	"wallet_controller/internal/entity"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type AuditRepositoryInterface interface {
+	// Append writes the entry in tx, the transaction of the change it describes, so the
+	// change is not committed without it. Principal, ClaimedActor, RequestID and ClientIP
+	// are taken from the origin of ctx and CreatedAt is set here. The entry joins the
+	// chain on Chain.
+	Append(ctx context.Context, tx pgx.Tx, entry entity.AuditEntry) error
+	// Chain links up to limit appended entries to the log in the order they were appended,
+	// setting Seq, PrevHash and Hash, and returns how many it linked.
+	Chain(ctx context.Context, limit int) (int, error)
+	ListEntries(ctx context.Context, afterSeq int64, limit int) ([]entity.AuditEntry, error)
+	GetHead(ctx context.Context) (entity.AuditHead, error)
+	// CountPending returns how many appended entries are not chained yet.
+	CountPending(ctx context.Context) (int64, error)
+}
+
+type AuditRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewAuditRepository(db *pgxpool.Pool) AuditRepositoryInterface {
+	return &AuditRepository{db: db}
+}
+
+const auditColumns = `seq, principal, COALESCE(claimed_actor, ''), COALESCE(request_id, ''), COALESCE(client_ip, ''),
+	action, id_wallet, id_operation, balance_before, balance_after, details, created_at, prev_hash, hash`
+
+// pendingAuditColumns are the columns of an entry that is not chained yet.
+const pendingAuditColumns = `principal, COALESCE(claimed_actor, '') AS claimed_actor, COALESCE(request_id, '') AS request_id,
+	COALESCE(client_ip, '') AS client_ip, action, id_wallet, id_operation, balance_before, balance_after, details, created_at`
+
+func scanAuditEntry(row pgx.Row) (entity.AuditEntry, error) {
+	var entry entity.AuditEntry
+	err := row.Scan(
+		&entry.Seq,
+		&entry.Principal,
+		&entry.ClaimedActor,
+		&entry.RequestID,
+		&entry.ClientIP,
+		&entry.Action,
+		&entry.WalletID,
+		&entry.OperationID,
+		&entry.BalanceBefore,
+		&entry.BalanceAfter,
+		&entry.Details,
+		&entry.CreatedAt,
+		&entry.PrevHash,
+		&entry.Hash,
+	)
+	return entry, err
+}
+
+func (r *AuditRepository) Append(ctx context.Context, tx pgx.Tx, entry entity.AuditEntry) error {
+	return appendAudit(ctx, tx, entry)
+}
+
+// appendAudit is Append for the repositories that make the audited changes. Appending
+// only inserts a row, so changes of different wallets do not wait for each other here.
+func appendAudit(ctx context.Context, tx pgx.Tx, entry entity.AuditEntry) error {
+	origin := audit.OriginFrom(ctx)
+
+	var details any
+	if len(entry.Details) > 0 {
+		details = string(entry.Details)
+	}
+
+	_, err := tx.Exec(ctx,
+		`INSERT INTO audit_pending (principal, claimed_actor, request_id, client_ip, action, id_wallet, id_operation,
+			balance_before, balance_after, details, created_at)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), NULLIF($4, ''), $5, $6, $7, $8, $9, $10::JSON, $11)`,
+		origin.Principal,
+		origin.ClaimedActor,
+		origin.RequestID,
+		origin.ClientIP,
+		entry.Action,
+		entry.WalletID,
+		entry.OperationID,
+		entry.BalanceBefore,
+		entry.BalanceAfter,
+		details,
+		time.Now().UTC().Truncate(time.Microsecond),
+	)
+	if err != nil {
+		slog.Error("failed to append audit entry", "action", entry.Action, "wallet_id", entry.WalletID, "error", err.Error())
+		return fmt.Errorf("failed to append audit entry: %w", err)
+	}
+
+	return nil
+}
+
+// Chain moves appended entries to audit_log. The head row lock makes chaining runs of
+// several instances wait for each other, so every entry links to the one chained right
+// before it; changes never take that lock.
+func (r *AuditRepository) Chain(ctx context.Context, limit int) (int, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var head entity.AuditHead
+	err = tx.QueryRow(ctx, `SELECT seq, hash FROM audit_head FOR UPDATE`).Scan(&head.Seq, &head.Hash)
+	if err != nil {
+		return 0, fmt.Errorf("failed to lock audit head: %w", err)
+	}
+
+	// only the chainer role may remove appended entries, see the audit_pending trigger
+	if _, err = tx.Exec(ctx, `SET LOCAL ROLE wallet_audit_chainer`); err != nil {
+		return 0, fmt.Errorf("failed to take audit chainer role: %w", err)
+	}
+	rows, err := tx.Query(ctx,
+		`WITH chained AS (
+			DELETE FROM audit_pending
+			WHERE id IN (SELECT id FROM audit_pending ORDER BY id LIMIT $1)
+			RETURNING id, `+pendingAuditColumns+`
+		)
+		SELECT principal, claimed_actor, request_id, client_ip, action, id_wallet, id_operation, balance_before, balance_after, details, created_at
+		FROM chained ORDER BY id`,
+		limit,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to take audit entries: %w", err)
+	}
+	entries, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (entity.AuditEntry, error) {
+		var entry entity.AuditEntry
+		err := row.Scan(
+			&entry.Principal,
+			&entry.ClaimedActor,
+			&entry.RequestID,
+			&entry.ClientIP,
+			&entry.Action,
+			&entry.WalletID,
+			&entry.OperationID,
+			&entry.BalanceBefore,
+			&entry.BalanceAfter,
+			&entry.Details,
+			&entry.CreatedAt,
+		)
+		return entry, err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to scan audit entries: %w", err)
+	}
+	if _, err = tx.Exec(ctx, `RESET ROLE`); err != nil {
+		return 0, fmt.Errorf("failed to drop audit chainer role: %w", err)
+	}
+	if len(entries) == 0 {
+		return 0, nil
+	}
+
+	batch := &pgx.Batch{}
+	for _, entry := range entries {
+		entry.Seq = head.Seq + 1
+		entry.PrevHash = head.Hash
+		entry.Hash = audit.Hash(entry)
+		head = entity.AuditHead{Seq: entry.Seq, Hash: entry.Hash}
+
+		var details any
+		if len(entry.Details) > 0 {
+			details = string(entry.Details)
+		}
+
+		batch.Queue(
+			`INSERT INTO audit_log (seq, principal, claimed_actor, request_id, client_ip, action, id_wallet, id_operation,
+				balance_before, balance_after, details, created_at, prev_hash, hash)
+			VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, ''), $6, $7, $8, $9, $10, $11::JSON, $12, $13, $14)`,
+			entry.Seq,
+			entry.Principal,
+			entry.ClaimedActor,
+			entry.RequestID,
+			entry.ClientIP,
+			entry.Action,
+			entry.WalletID,
+			entry.OperationID,
+			entry.BalanceBefore,
+			entry.BalanceAfter,
+			details,
+			entry.CreatedAt,
+			entry.PrevHash,
+			entry.Hash,
+		)
+	}
+	batch.Queue(`UPDATE audit_head SET seq = $1, hash = $2`, head.Seq, head.Hash)
+
+	if err = tx.SendBatch(ctx, batch).Close(); err != nil {
+		return 0, fmt.Errorf("failed to chain audit entries: %w", err)
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit audit entries: %w", err)
+	}
+
+	return len(entries), nil
+}
+
+// walletAuditEntry describes a change that leaves the balance as it is.
+func walletAuditEntry(action string, wallet *entity.Wallet, details any) entity.AuditEntry {
+	return entity.AuditEntry{
+		Action:        action,
+		WalletID:      wallet.ID,
+		BalanceBefore: &wallet.Balance,
+		BalanceAfter:  &wallet.Balance,
+		Details:       auditDetails(details),
+	}
+}
+
+func operationAuditEntry(action string, operation entity.Operation) entity.AuditEntry {
+	return entity.AuditEntry{
+		Action:        action,
+		WalletID:      operation.WalletID,
+		OperationID:   &operation.ID,
+		BalanceBefore: operation.BalanceBefore,
+		BalanceAfter:  operation.BalanceAfter,
+		Details: auditDetails(map[string]any{
+			"operation_type": operation.OperationType,
+			"amount":         operation.Amount,
+		}),
+	}
+}
+
+func auditDetails(details any) json.RawMessage {
+	if details == nil {
+		return nil
+	}
+
+	encoded, err := json.Marshal(details)
+	if err != nil {
+		return nil
+	}
+	return encoded
+}
+
+func (r *AuditRepository) ListEntries(ctx context.Context, afterSeq int64, limit int) ([]entity.AuditEntry, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT `+auditColumns+` FROM audit_log WHERE seq > $1 ORDER BY seq LIMIT $2`,
+		afterSeq,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+
+	entries, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (entity.AuditEntry, error) {
+		return scanAuditEntry(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan audit entries: %w", err)
+	}
+
+	return entries, nil
+}
+
+func (r *AuditRepository) GetHead(ctx context.Context) (entity.AuditHead, error) {
+	var head entity.AuditHead
+	err := r.db.QueryRow(ctx, `SELECT seq, hash FROM audit_head`).Scan(&head.Seq, &head.Hash)
+	if err != nil {
+		return entity.AuditHead{}, fmt.Errorf("failed to get audit head: %w", err)
+	}
+
+	return head, nil
+}
+
+func (r *AuditRepository) CountPending(ctx context.Context) (int64, error) {
+	var count int64
+	err := r.db.QueryRow(ctx, `SELECT COUNT(*) FROM audit_pending`).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count pending audit entries: %w", err)
+	}
+
+	return count, nil
+}
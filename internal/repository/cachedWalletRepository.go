@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"wallet_controller/internal/cache"
+	"wallet_controller/internal/entity"
+	"wallet_controller/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+// CachedWalletRepository serves GetByID from a cache and invalidates the wallet once a
+// change made through it is committed. Changes made elsewhere, by other instances or
+// the CLI, reach the cache through notify.Listen.
+type CachedWalletRepository struct {
+	WalletRepositoryInterface
+	cache cache.WalletCache
+	reads *storage.ReadRouter
+}
+
+// NewCachedWalletRepository puts walletCache in front of repo, a nil cache returns repo as is.
+// reads is the router repo reads through, nil when it only reads the primary.
+func NewCachedWalletRepository(repo WalletRepositoryInterface, walletCache cache.WalletCache, reads *storage.ReadRouter) WalletRepositoryInterface {
+	if walletCache == nil {
+		return repo
+	}
+
+	return &CachedWalletRepository{
+		WalletRepositoryInterface: repo,
+		cache:                     walletCache,
+		reads:                     reads,
+	}
+}
+
+func (r *CachedWalletRepository) GetByID(ctx context.Context, walletID uuid.UUID) (*entity.Wallet, error) {
+	if wallet, ok := r.cache.Get(ctx, walletID); ok {
+		cache.Observe(ctx, true)
+		return wallet, nil
+	}
+
+	// Misses go through the read router like any other read, so they may come from a
+	// replica that is behind. The read is dated back by the most it can lag, so the
+	// cache drops it when the wallet changed in that time.
+	readAt := time.Now().Add(-r.reads.MaxStaleness())
+	wallet, err := r.WalletRepositoryInterface.GetByID(ctx, walletID)
+	if err != nil {
+		return nil, err
+	}
+
+	r.cache.Set(ctx, wallet, readAt)
+	cache.Observe(ctx, false)
+	return wallet, nil
+}
+
+func (r *CachedWalletRepository) UpdateWallet(ctx context.Context, walletID uuid.UUID, update entity.WalletUpdate) (*entity.Wallet, error) {
+	wallet, err := r.WalletRepositoryInterface.UpdateWallet(ctx, walletID, update)
+	if err == nil {
+		r.cache.Invalidate(ctx, walletID)
+	}
+	return wallet, err
+}
+
+func (r *CachedWalletRepository) SetFreeze(ctx context.Context, walletID uuid.UUID, freeze *entity.Freeze) (*entity.Wallet, error) {
+	wallet, err := r.WalletRepositoryInterface.SetFreeze(ctx, walletID, freeze)
+	if err == nil {
+		r.cache.Invalidate(ctx, walletID)
+	}
+	return wallet, err
+}
+
+func (r *CachedWalletRepository) SetBalanceShards(ctx context.Context, walletID uuid.UUID, shards int) (*entity.Wallet, error) {
+	wallet, err := r.WalletRepositoryInterface.SetBalanceShards(ctx, walletID, shards)
+	if err == nil {
+		r.cache.Invalidate(ctx, walletID)
+	}
+	return wallet, err
+}
+
+func (r *CachedWalletRepository) AddOperation(ctx context.Context, walletID uuid.UUID, operationType string, amount int, details entity.OperationDetails, expectedVersion int64) (entity.OperationResult, error) {
+	result, err := r.WalletRepositoryInterface.AddOperation(ctx, walletID, operationType, amount, details, expectedVersion)
+	if err == nil {
+		r.invalidateResult(ctx, result)
+	}
+	return result, err
+}
+
+func (r *CachedWalletRepository) ReverseOperation(ctx context.Context, operationID uuid.UUID, details entity.OperationDetails) (entity.OperationResult, error) {
+	result, err := r.WalletRepositoryInterface.ReverseOperation(ctx, operationID, details)
+	if err == nil {
+		r.invalidateResult(ctx, result)
+	}
+	return result, err
+}
+
+// invalidateResult drops the wallet of the operation and the fee wallet credited for it.
+func (r *CachedWalletRepository) invalidateResult(ctx context.Context, result entity.OperationResult) {
+	r.cache.Invalidate(ctx, result.Wallet.ID)
+	if result.Fee != nil {
+		r.cache.Invalidate(ctx, result.Fee.FeeWalletID)
+	}
+}
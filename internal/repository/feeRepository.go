@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"wallet_controller/internal/entity"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// feeRuleScopeIndex allows one fee rule per operation type and wallet tier.
+const feeRuleScopeIndex = "idx_fee_rules_operation_type_wallet_tier"
+
+var (
+	ErrFeeRuleNotFound  = errors.New("fee rule not found")
+	ErrDuplicateFeeRule = errors.New("fee rule for this operation type and wallet tier already exists")
+	ErrFeeWalletMissing = errors.New("fee wallet does not exist")
+)
+
+type FeeRepositoryInterface interface {
+	CreateRule(ctx context.Context, rule *entity.FeeRule) error
+	GetRule(ctx context.Context, ruleID uuid.UUID) (*entity.FeeRule, error)
+	ListRules(ctx context.Context) ([]entity.FeeRule, error)
+	DeleteRule(ctx context.Context, ruleID uuid.UUID) error
+}
+
+type FeeRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewFeeRepository(db *pgxpool.Pool) FeeRepositoryInterface {
+	return &FeeRepository{db: db}
+}
+
+const feeRuleColumns = `id_rule, operation_type, COALESCE(wallet_tier, ''), kind, flat_amount, basis_points, tiers,
+	min_fee, max_fee, id_fee_wallet, created_at`
+
+func scanFeeRule(row pgx.Row) (entity.FeeRule, error) {
+	var rule entity.FeeRule
+	err := row.Scan(
+		&rule.ID,
+		&rule.OperationType,
+		&rule.WalletTier,
+		&rule.Kind,
+		&rule.FlatAmount,
+		&rule.BasisPoints,
+		&rule.Tiers,
+		&rule.MinFee,
+		&rule.MaxFee,
+		&rule.FeeWalletID,
+		&rule.CreatedAt,
+	)
+	return rule, err
+}
+
+func (r *FeeRepository) CreateRule(ctx context.Context, rule *entity.FeeRule) error {
+	tiers := rule.Tiers
+	if tiers == nil {
+		tiers = []entity.FeeTier{}
+	}
+
+	created, err := scanFeeRule(r.db.QueryRow(ctx,
+		`INSERT INTO fee_rules (operation_type, wallet_tier, kind, flat_amount, basis_points, tiers, min_fee, max_fee, id_fee_wallet)
+		VALUES ($1, NULLIF($2::TEXT, ''), $3, $4, $5, $6, $7, $8, $9)
+		RETURNING `+feeRuleColumns,
+		rule.OperationType,
+		rule.WalletTier,
+		rule.Kind,
+		rule.FlatAmount,
+		rule.BasisPoints,
+		tiers,
+		rule.MinFee,
+		rule.MaxFee,
+		rule.FeeWalletID,
+	))
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			switch {
+			case pgErr.Code == uniqueViolationCode && pgErr.ConstraintName == feeRuleScopeIndex:
+				return ErrDuplicateFeeRule
+			case pgErr.Code == foreignKeyViolationCode:
+				return ErrFeeWalletMissing
+			}
+		}
+		return fmt.Errorf("failed to create fee rule: %w", err)
+	}
+
+	*rule = created
+	return nil
+}
+
+func (r *FeeRepository) GetRule(ctx context.Context, ruleID uuid.UUID) (*entity.FeeRule, error) {
+	rule, err := scanFeeRule(r.db.QueryRow(ctx,
+		`SELECT `+feeRuleColumns+` FROM fee_rules WHERE id_rule = $1`,
+		ruleID,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrFeeRuleNotFound
+		}
+		return nil, fmt.Errorf("failed to get fee rule: %w", err)
+	}
+
+	return &rule, nil
+}
+
+func (r *FeeRepository) ListRules(ctx context.Context) ([]entity.FeeRule, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT `+feeRuleColumns+` FROM fee_rules ORDER BY operation_type, wallet_tier NULLS LAST`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list fee rules: %w", err)
+	}
+
+	rules, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (entity.FeeRule, error) {
+		return scanFeeRule(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan fee rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+func (r *FeeRepository) DeleteRule(ctx context.Context, ruleID uuid.UUID) error {
+	tag, err := r.db.Exec(ctx, `DELETE FROM fee_rules WHERE id_rule = $1`, ruleID)
+	if err != nil {
+		return fmt.Errorf("failed to delete fee rule: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrFeeRuleNotFound
+	}
+
+	return nil
+}
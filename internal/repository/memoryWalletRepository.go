@@ -0,0 +1,694 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"wallet_controller/internal/audit"
+	"wallet_controller/internal/entity"
+
+	"github.com/google/uuid"
+)
+
+var _ WalletRepositoryInterface = (*MemoryWalletRepository)(nil)
+
+// MemoryWalletRepository keeps wallets and operations in memory with the same semantics
+// as WalletRepository, for tests and demos that run without Postgres. There are no fee
+// rules, outbox events, balance snapshots or audit log, so no fees are charged, nothing
+// is published and no audit entries are written.
+//
+// All methods are safe for concurrent use. Operations are serialized by one mutex, so
+// they never contend for a wallet unless SetLockHold makes them hold it; LockWallet
+// holds a wallet the way a concurrent transaction does, to reproduce ErrWalletLocked. Balance shards only change what is
+// recorded: deposits to a sharded wallet get their balances when the next operation or
+// SetBalanceShards moves the shards, and they are not held back by LockWallet.
+type MemoryWalletRepository struct {
+	mu         sync.RWMutex
+	wallets    map[uuid.UUID]*memoryWallet
+	operations map[uuid.UUID]*entity.Operation
+	seq        int64
+	freezeSeq  int64
+	hold       time.Duration
+	now        func() time.Time
+}
+
+type memoryWallet struct {
+	wallet     entity.Wallet
+	locks      int
+	operations []*entity.Operation
+	// unswept are the deposits to shards waiting for their balances.
+	unswept    []*entity.Operation
+	references map[string]bool
+	freezes    []entity.FreezeEvent
+}
+
+func NewMemoryWalletRepository() *MemoryWalletRepository {
+	return &MemoryWalletRepository{
+		wallets:    make(map[uuid.UUID]*memoryWallet),
+		operations: make(map[uuid.UUID]*entity.Operation),
+		now: func() time.Time {
+			// Postgres keeps timestamps with microsecond precision.
+			return time.Now().UTC().Truncate(time.Microsecond)
+		},
+	}
+}
+
+// LockWallet makes operations on the wallet fail with ErrWalletLocked until unlock is called.
+func (r *MemoryWalletRepository) LockWallet(walletID uuid.UUID) (unlock func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.wallets[walletID]
+	if !ok {
+		return func() {}
+	}
+	stored.locks++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			stored.locks--
+		})
+	}
+}
+
+// SetLockHold makes every operation hold its wallet for d before it is made, with the
+// other wallets free, as a transaction holds the row it locked. Operations reaching a
+// held wallet fail with ErrWalletLocked like NOWAIT does in Postgres, so concurrent
+// clients run into real contention. Zero turns it off.
+func (r *MemoryWalletRepository) SetLockHold(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hold = d
+}
+
+func (r *MemoryWalletRepository) CreateWallet(ctx context.Context, create entity.WalletCreate) (*entity.Wallet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if create.ID == uuid.Nil {
+		create.ID = uuid.New()
+	}
+	// Postgres checks the row before the unique key.
+	if create.CreditLimit < 0 || create.MinBalance < 0 {
+		return nil, ErrInvalidLimits
+	}
+	if _, ok := r.wallets[create.ID]; ok {
+		return nil, ErrWalletExists
+	}
+
+	stored := &memoryWallet{
+		wallet: entity.Wallet{
+			ID:                create.ID,
+			CreditLimit:       create.CreditLimit,
+			MinBalance:        create.MinBalance,
+			Version:           1,
+			OwnerID:           create.OwnerID,
+			DisplayName:       create.DisplayName,
+			Labels:            copyLabels(create.Labels),
+			ExternalReference: create.ExternalReference,
+		},
+		references: make(map[string]bool),
+	}
+	r.wallets[create.ID] = stored
+
+	return stored.snapshot(), nil
+}
+
+func (r *MemoryWalletRepository) GetByID(ctx context.Context, walletID uuid.UUID) (*entity.Wallet, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stored, ok := r.wallets[walletID]
+	if !ok {
+		return nil, ErrWalletNotFound
+	}
+
+	return stored.snapshot(), nil
+}
+
+func (r *MemoryWalletRepository) UpdateWallet(ctx context.Context, walletID uuid.UUID, update entity.WalletUpdate) (*entity.Wallet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.wallets[walletID]
+	if !ok {
+		return nil, ErrWalletNotFound
+	}
+	if (update.CreditLimit != nil && *update.CreditLimit < 0) || (update.MinBalance != nil && *update.MinBalance < 0) {
+		return nil, ErrInvalidLimits
+	}
+
+	wallet := &stored.wallet
+	if update.OwnerID != nil {
+		wallet.OwnerID = *update.OwnerID
+	}
+	if update.DisplayName != nil {
+		wallet.DisplayName = *update.DisplayName
+	}
+	if update.Labels != nil {
+		wallet.Labels = copyLabels(*update.Labels)
+	}
+	if update.ExternalReference != nil {
+		wallet.ExternalReference = *update.ExternalReference
+	}
+	if update.CreditLimit != nil {
+		wallet.CreditLimit = *update.CreditLimit
+	}
+	if update.MinBalance != nil {
+		wallet.MinBalance = *update.MinBalance
+	}
+	wallet.Version++
+
+	return stored.snapshot(), nil
+}
+
+func (r *MemoryWalletRepository) SetFreeze(ctx context.Context, walletID uuid.UUID, freeze *entity.Freeze) (*entity.Wallet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.wallets[walletID]
+	if !ok {
+		return nil, ErrWalletNotFound
+	}
+
+	origin := audit.OriginFrom(ctx)
+	r.freezeSeq++
+	event := entity.FreezeEvent{
+		ID:           r.freezeSeq,
+		WalletID:     walletID,
+		Action:       entity.FreezeActionUnfreeze,
+		Principal:    origin.Principal,
+		ClaimedActor: origin.ClaimedActor,
+		RequestID:    origin.RequestID,
+		CreatedAt:    r.now(),
+	}
+
+	stored.wallet.Freeze = nil
+	if freeze != nil {
+		event.Action = entity.FreezeActionFreeze
+		event.Freeze = copyFreeze(freeze)
+		stored.wallet.Freeze = copyFreeze(freeze)
+	}
+	stored.freezes = append(stored.freezes, event)
+	stored.wallet.Version++
+
+	return stored.snapshot(), nil
+}
+
+func (r *MemoryWalletRepository) ListFreezeHistory(ctx context.Context, walletID uuid.UUID) ([]entity.FreezeEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stored, ok := r.wallets[walletID]
+	if !ok {
+		return nil, ErrWalletNotFound
+	}
+
+	events := make([]entity.FreezeEvent, 0, len(stored.freezes))
+	for _, event := range stored.freezes {
+		event.Freeze = copyFreeze(event.Freeze)
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func (r *MemoryWalletRepository) SearchWallets(ctx context.Context, filter entity.WalletFilter) ([]entity.Wallet, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	wallets := make([]entity.Wallet, 0)
+	for _, stored := range r.wallets {
+		wallet := stored.wallet
+		if filter.OwnerID != "" && wallet.OwnerID != filter.OwnerID {
+			continue
+		}
+		if bytes.Compare(wallet.ID[:], filter.After[:]) <= 0 {
+			continue
+		}
+		if !hasLabels(wallet.Labels, filter.Labels) {
+			continue
+		}
+		wallets = append(wallets, *stored.snapshot())
+	}
+
+	slices.SortFunc(wallets, func(a, b entity.Wallet) int {
+		return bytes.Compare(a.ID[:], b.ID[:])
+	})
+	if len(wallets) > filter.Limit {
+		wallets = wallets[:filter.Limit]
+	}
+
+	return wallets, nil
+}
+
+func (r *MemoryWalletRepository) AddOperation(ctx context.Context, walletID uuid.UUID, operationType string, amount int, details entity.OperationDetails, expectedVersion int64) (entity.OperationResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if stored, ok := r.wallets[walletID]; ok && stored.wallet.BalanceShards > 0 && operationType == "DEPOSIT" && expectedVersion == 0 {
+		if stored.wallet.Freeze.Rejects(operationType, r.now()) {
+			return entity.OperationResult{}, ErrWalletFrozen
+		}
+
+		operation, err := r.record(stored, operationType, amount, details, nil, true)
+		if err != nil {
+			return entity.OperationResult{}, err
+		}
+
+		return entity.OperationResult{
+			Wallet:    *stored.snapshot(),
+			Operation: operation,
+		}, nil
+	}
+
+	stored, err := r.lockedWallet(walletID, operationType)
+	if err != nil {
+		return entity.OperationResult{}, err
+	}
+
+	if expectedVersion != 0 && stored.wallet.Version != expectedVersion {
+		return entity.OperationResult{}, ErrVersionMismatch
+	}
+
+	operation, err := r.record(stored, operationType, amount, details, nil, false)
+	if err != nil {
+		return entity.OperationResult{}, err
+	}
+
+	return entity.OperationResult{
+		Wallet:    *stored.snapshot(),
+		Operation: operation,
+	}, nil
+}
+
+func (r *MemoryWalletRepository) ReverseOperation(ctx context.Context, operationID uuid.UUID, details entity.OperationDetails) (entity.OperationResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	original, ok := r.operations[operationID]
+	if !ok {
+		return entity.OperationResult{}, ErrOperationNotFound
+	}
+	if original.ParentOperationID != nil {
+		return entity.OperationResult{}, ErrNotReversible
+	}
+	reference := "reversal:" + operationID.String()
+
+	reversalType := "DEPOSIT"
+	if original.OperationType == "DEPOSIT" {
+		reversalType = "WITHDRAW"
+	}
+
+	stored, err := r.lockedWallet(original.WalletID, reversalType)
+	if err != nil {
+		return entity.OperationResult{}, err
+	}
+	if stored.references[reference] {
+		return entity.OperationResult{}, ErrAlreadyReversed
+	}
+	if details.Description == "" {
+		details.Description = "Reversal"
+	}
+	details.ExternalReference = reference
+
+	operation, err := r.record(stored, reversalType, original.Amount, details, &original.ID, false)
+	if err != nil {
+		if errors.Is(err, ErrDuplicateOperation) {
+			return entity.OperationResult{}, ErrAlreadyReversed
+		}
+		return entity.OperationResult{}, err
+	}
+
+	return entity.OperationResult{
+		Wallet:    *stored.snapshot(),
+		Operation: operation,
+	}, nil
+}
+
+// lockedWallet returns the wallet an operation of operationType may be made on, it has
+// to be held by r.mu. With a lock hold r.mu is released while the wallet is held.
+func (r *MemoryWalletRepository) lockedWallet(walletID uuid.UUID, operationType string) (*memoryWallet, error) {
+	stored, ok := r.wallets[walletID]
+	switch {
+	case !ok:
+		return nil, ErrWalletNotFound
+	case stored.locks > 0:
+		return nil, ErrWalletLocked
+	}
+
+	// The freeze is checked once the wallet is held, as after locking the row.
+	if r.hold > 0 {
+		stored.locks++
+		r.mu.Unlock()
+		time.Sleep(r.hold)
+		r.mu.Lock()
+		stored.locks--
+	}
+	if stored.wallet.Freeze.Rejects(operationType, r.now()) {
+		return nil, ErrWalletFrozen
+	}
+
+	return stored, nil
+}
+
+// record checks the floor of the wallet and appends the operation, it has to be held by r.mu.
+// Sharded deposits are recorded without balances, other operations sweep them first.
+func (r *MemoryWalletRepository) record(stored *memoryWallet, operationType string, amount int, details entity.OperationDetails, parentID *uuid.UUID, sharded bool) (entity.Operation, error) {
+	balanceBefore := stored.wallet.Balance
+	operation := entity.Operation{
+		ID:                uuid.New(),
+		WalletID:          stored.wallet.ID,
+		OperationType:     operationType,
+		Amount:            amount,
+		ParentOperationID: parentID,
+		OperationDetails:  details,
+		CreatedAt:         r.now(),
+	}
+
+	balance := balanceBefore + operation.SignedAmount()
+	if balance < stored.wallet.Floor() && balance < balanceBefore {
+		return entity.Operation{}, ErrInsufficientFunds
+	}
+	if details.ExternalReference != "" && stored.references[details.ExternalReference] {
+		return entity.Operation{}, ErrDuplicateOperation
+	}
+
+	r.seq++
+	operation.Seq = r.seq
+	if !sharded {
+		stored.sweep()
+		operation.BalanceBefore = &balanceBefore
+		operation.BalanceAfter = &balance
+	}
+
+	saved := copyOperation(operation)
+	if saved.Metadata == nil {
+		saved.Metadata = map[string]any{}
+	}
+	r.operations[operation.ID] = &saved
+	stored.operations = append(stored.operations, &saved)
+	if details.ExternalReference != "" {
+		stored.references[details.ExternalReference] = true
+	}
+	if sharded {
+		stored.unswept = append(stored.unswept, &saved)
+	}
+
+	stored.wallet.Balance = balance
+	stored.wallet.Version++
+
+	return operation, nil
+}
+
+func (r *MemoryWalletRepository) SetBalanceShards(ctx context.Context, walletID uuid.UUID, shards int) (*entity.Wallet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.wallets[walletID]
+	switch {
+	case !ok:
+		return nil, ErrWalletNotFound
+	case stored.locks > 0:
+		return nil, ErrWalletLocked
+	}
+
+	stored.sweep()
+	stored.wallet.BalanceShards = shards
+	stored.wallet.Version++
+
+	return stored.snapshot(), nil
+}
+
+func (r *MemoryWalletRepository) GetOperation(ctx context.Context, operationID uuid.UUID) (*entity.Operation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	operation, ok := r.operations[operationID]
+	if !ok {
+		return nil, ErrOperationNotFound
+	}
+
+	found := copyOperation(*operation)
+	return &found, nil
+}
+
+func (r *MemoryWalletRepository) GetBalanceEvents(ctx context.Context, walletID uuid.UUID, afterSeq int64, limit int) ([]entity.BalanceEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	events := make([]entity.BalanceEvent, 0)
+	stored, ok := r.wallets[walletID]
+	if !ok {
+		return events, nil
+	}
+
+	for _, operation := range stored.operations {
+		if len(events) == limit {
+			break
+		}
+		if operation.Seq <= afterSeq || operation.BalanceAfter == nil {
+			continue
+		}
+		events = append(events, entity.BalanceEvent{
+			Seq:           operation.Seq,
+			WalletID:      operation.WalletID,
+			OperationID:   operation.ID,
+			OperationType: operation.OperationType,
+			Amount:        operation.Amount,
+			Balance:       *operation.BalanceAfter,
+			CreatedAt:     operation.CreatedAt,
+		})
+	}
+
+	return events, nil
+}
+
+func (r *MemoryWalletRepository) ListOperations(ctx context.Context, filter entity.OperationFilter) ([]entity.Operation, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	operations := make([]entity.Operation, 0)
+	stored, ok := r.wallets[filter.WalletID]
+	if !ok {
+		return operations, nil
+	}
+
+	for i := len(stored.operations) - 1; i >= 0 && len(operations) < filter.Limit; i-- {
+		operation := stored.operations[i]
+		if filter.BeforeSeq > 0 && operation.Seq >= filter.BeforeSeq {
+			continue
+		}
+		if filter.OperationType != "" && operation.OperationType != filter.OperationType {
+			continue
+		}
+		if filter.ExternalReference != "" && operation.ExternalReference != filter.ExternalReference {
+			continue
+		}
+		if filter.Description != "" && !strings.Contains(strings.ToLower(operation.Description), strings.ToLower(filter.Description)) {
+			continue
+		}
+		if !hasMetadata(operation.Metadata, filter.Metadata) {
+			continue
+		}
+		operations = append(operations, copyOperation(*operation))
+	}
+
+	return operations, nil
+}
+
+func (r *MemoryWalletRepository) GetBalanceAt(ctx context.Context, walletID uuid.UUID, at time.Time) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stored, ok := r.wallets[walletID]
+	if !ok {
+		return 0, ErrWalletNotFound
+	}
+
+	balance := stored.wallet.Balance
+	for _, operation := range stored.operations {
+		if operation.CreatedAt.After(at) {
+			balance -= operation.SignedAmount()
+		}
+	}
+
+	return balance, nil
+}
+
+// StreamOperations calls fn outside of the lock, on the operations made before it was called.
+func (r *MemoryWalletRepository) StreamOperations(ctx context.Context, walletID uuid.UUID, from, to time.Time, fn func(operation entity.Operation) error) error {
+	r.mu.RLock()
+	var operations []entity.Operation
+	if stored, ok := r.wallets[walletID]; ok {
+		for _, operation := range stored.operations {
+			if !operation.CreatedAt.Before(from) && operation.CreatedAt.Before(to) {
+				operations = append(operations, copyOperation(*operation))
+			}
+		}
+	}
+	r.mu.RUnlock()
+
+	for _, operation := range operations {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(operation); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *MemoryWalletRepository) Reconcile(ctx context.Context) ([]entity.Discrepancy, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	discrepancies := make([]entity.Discrepancy, 0)
+	for _, stored := range r.wallets {
+		// offset is the balance after the latest operation with balances minus the
+		// total of all operations up to it, deposits to shards since move both alike
+		var offset *int
+		total := 0
+		for _, operation := range stored.operations {
+			total += operation.SignedAmount()
+			if operation.BalanceBefore == nil {
+				continue
+			}
+
+			if expected := total - operation.SignedAmount(); offset != nil && *offset+expected != *operation.BalanceBefore {
+				discrepancies = append(discrepancies, entity.Discrepancy{
+					WalletID:    stored.wallet.ID,
+					OperationID: &operation.ID,
+					Expected:    *offset + expected,
+					Actual:      *operation.BalanceBefore,
+				})
+			}
+			if expected := *operation.BalanceBefore + operation.SignedAmount(); expected != *operation.BalanceAfter {
+				discrepancies = append(discrepancies, entity.Discrepancy{
+					WalletID:    stored.wallet.ID,
+					OperationID: &operation.ID,
+					Expected:    expected,
+					Actual:      *operation.BalanceAfter,
+				})
+			}
+
+			current := *operation.BalanceAfter - total
+			offset = &current
+		}
+		if offset != nil && *offset+total != stored.wallet.Balance {
+			discrepancies = append(discrepancies, entity.Discrepancy{
+				WalletID: stored.wallet.ID,
+				Expected: *offset + total,
+				Actual:   stored.wallet.Balance,
+			})
+		}
+	}
+
+	slices.SortStableFunc(discrepancies, func(a, b entity.Discrepancy) int {
+		return bytes.Compare(a.WalletID[:], b.WalletID[:])
+	})
+
+	return discrepancies, nil
+}
+
+// sweep gives the deposits to shards their balances in the order they were made, ending
+// at the balance of the wallet, which already counts them.
+func (w *memoryWallet) sweep() {
+	balance := w.wallet.Balance
+	for _, operation := range w.unswept {
+		balance -= operation.SignedAmount()
+	}
+	for _, operation := range w.unswept {
+		before, after := balance, balance+operation.SignedAmount()
+		operation.BalanceBefore, operation.BalanceAfter = &before, &after
+		balance = after
+	}
+	w.unswept = nil
+}
+
+// snapshot returns a copy of the wallet that does not share labels with the store.
+func (w *memoryWallet) snapshot() *entity.Wallet {
+	wallet := w.wallet
+	wallet.Labels = copyLabels(w.wallet.Labels)
+	wallet.Freeze = copyFreeze(w.wallet.Freeze)
+	wallet.Frozen = wallet.Freeze.Blocks(time.Now())
+	wallet.Available = max(wallet.Balance-wallet.Floor(), 0)
+	wallet.Overdraft = max(-wallet.Balance, 0)
+	return &wallet
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	copied := make(map[string]string, len(labels))
+	for key, value := range labels {
+		copied[key] = value
+	}
+	return copied
+}
+
+func copyFreeze(freeze *entity.Freeze) *entity.Freeze {
+	if freeze == nil {
+		return nil
+	}
+	copied := *freeze
+	return &copied
+}
+
+func copyOperation(operation entity.Operation) entity.Operation {
+	if operation.BalanceBefore != nil {
+		balanceBefore := *operation.BalanceBefore
+		operation.BalanceBefore = &balanceBefore
+	}
+	if operation.BalanceAfter != nil {
+		balanceAfter := *operation.BalanceAfter
+		operation.BalanceAfter = &balanceAfter
+	}
+	if operation.Metadata != nil {
+		metadata := make(map[string]any, len(operation.Metadata))
+		for key, value := range operation.Metadata {
+			metadata[key] = value
+		}
+		operation.Metadata = metadata
+	}
+	return operation
+}
+
+func hasLabels(labels, required map[string]string) bool {
+	for key, value := range required {
+		if actual, ok := labels[key]; !ok || actual != value {
+			return false
+		}
+	}
+	return true
+}
+
+// hasMetadata matches metadata values the way metadata ->> key does: strings as they
+// are and other values as their JSON text.
+func hasMetadata(metadata map[string]any, required map[string]string) bool {
+	for key, value := range required {
+		actual, ok := metadata[key]
+		if !ok {
+			return false
+		}
+		text, isString := actual.(string)
+		if !isString {
+			encoded, err := json.Marshal(actual)
+			if err != nil {
+				return false
+			}
+			text = string(encoded)
+		}
+		if text != value {
+			return false
+		}
+	}
+	return true
+}
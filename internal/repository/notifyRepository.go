@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"wallet_controller/internal/entity"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// BalanceChannel is the Postgres LISTEN/NOTIFY channel carrying entity.BalanceEvent payloads.
+const BalanceChannel = "wallet_balance_changed"
+
+// WalletChannel carries the ID of a wallet whose limits, labels or state changed without
+// a balance change, for caches of other instances to drop it.
+const WalletChannel = "wallet_changed"
+
+// notifyBalanceChanged queues a notification that Postgres delivers to listeners
+// only when the caller's transaction commits.
+func notifyBalanceChanged(ctx context.Context, tx pgx.Tx, event entity.BalanceEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal balance event: %w", err)
+	}
+
+	if _, err = tx.Exec(ctx, `SELECT pg_notify($1, $2)`, BalanceChannel, string(payload)); err != nil {
+		return fmt.Errorf("failed to notify balance change: %w", err)
+	}
+
+	return nil
+}
+
+// notifyWalletChanged queues a notification of a wallet change without a balance event.
+func notifyWalletChanged(ctx context.Context, tx pgx.Tx, walletID uuid.UUID) error {
+	if _, err := tx.Exec(ctx, `SELECT pg_notify($1, $2)`, WalletChannel, walletID.String()); err != nil {
+		return fmt.Errorf("failed to notify wallet change: %w", err)
+	}
+
+	return nil
+}
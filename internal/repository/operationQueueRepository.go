@@ -0,0 +1,366 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"wallet_controller/internal/audit"
+	"wallet_controller/internal/entity"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// queueReferenceIndex keeps external references of queued operations unique within a wallet.
+const queueReferenceIndex = "idx_operation_queue_wallet_id_external_reference"
+
+var ErrQueuedOperationNotFound = errors.New("queued operation not found")
+
+type OperationQueueRepositoryInterface interface {
+	Enqueue(ctx context.Context, walletID uuid.UUID, operationType string, amount int, details entity.OperationDetails) (*entity.QueuedOperation, error)
+	GetQueued(ctx context.Context, operationID uuid.UUID) (*entity.QueuedOperation, error)
+
+	PendingWallets(ctx context.Context, limit int) ([]uuid.UUID, error)
+	ApplyPending(ctx context.Context, walletID uuid.UUID, limit int) (entity.QueueBatch, error)
+}
+
+type OperationQueueRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewOperationQueueRepository(db *pgxpool.Pool) OperationQueueRepositoryInterface {
+	return &OperationQueueRepository{db: db}
+}
+
+const queueColumns = `id_operation, id_wallet, operation_type, amount, COALESCE(description, ''),
+	COALESCE(external_reference, ''), metadata, status, COALESCE(error, ''), created_at, processed_at`
+
+func scanQueued(row pgx.Row) (entity.QueuedOperation, error) {
+	var queued entity.QueuedOperation
+	err := row.Scan(
+		&queued.ID,
+		&queued.WalletID,
+		&queued.OperationType,
+		&queued.Amount,
+		&queued.Description,
+		&queued.ExternalReference,
+		&queued.Metadata,
+		&queued.Status,
+		&queued.Error,
+		&queued.CreatedAt,
+		&queued.ProcessedAt,
+	)
+	return queued, err
+}
+
+// Enqueue stores the operation as PENDING along with the origin of ctx, which the audit
+// entry gets once the operation is applied. An external reference already used by an
+// operation of the wallet, made or queued, is rejected with ErrDuplicateOperation.
+func (r *OperationQueueRepository) Enqueue(ctx context.Context, walletID uuid.UUID, operationType string, amount int, details entity.OperationDetails) (*entity.QueuedOperation, error) {
+	origin := audit.OriginFrom(ctx)
+	queued, err := scanQueued(r.db.QueryRow(ctx,
+		`INSERT INTO operation_queue (id_wallet, operation_type, amount, description, external_reference, metadata,
+			principal, claimed_actor, request_id, client_ip)
+		SELECT $1::UUID, $2::TEXT, $3::BIGINT, NULLIF($4::TEXT, ''), NULLIF($5::TEXT, ''), COALESCE($6::JSONB, '{}'),
+			$7::TEXT, NULLIF($8::TEXT, ''), NULLIF($9::TEXT, ''), NULLIF($10::TEXT, '')
+		WHERE NOT EXISTS (
+			SELECT 1 FROM wallet_operations WHERE id_wallet = $1::UUID AND external_reference = NULLIF($5::TEXT, '')
+		)
+		RETURNING `+queueColumns,
+		walletID,
+		operationType,
+		amount,
+		details.Description,
+		details.ExternalReference,
+		details.Metadata,
+		origin.Principal,
+		origin.ClaimedActor,
+		origin.RequestID,
+		origin.ClientIP,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			slog.Warn("Duplicate operation", "wallet_id", walletID, "external_reference", details.ExternalReference)
+			return nil, ErrDuplicateOperation
+		}
+
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			switch {
+			case pgErr.Code == foreignKeyViolationCode:
+				return nil, ErrWalletNotFound
+			case pgErr.Code == uniqueViolationCode && pgErr.ConstraintName == queueReferenceIndex:
+				slog.Warn("Duplicate operation", "wallet_id", walletID, "external_reference", details.ExternalReference)
+				return nil, ErrDuplicateOperation
+			}
+		}
+		return nil, fmt.Errorf("failed to enqueue operation: %w", err)
+	}
+
+	return &queued, nil
+}
+
+func (r *OperationQueueRepository) GetQueued(ctx context.Context, operationID uuid.UUID) (*entity.QueuedOperation, error) {
+	queued, err := scanQueued(r.db.QueryRow(ctx,
+		`SELECT `+queueColumns+` FROM operation_queue WHERE id_operation = $1`,
+		operationID,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrQueuedOperationNotFound
+		}
+		return nil, fmt.Errorf("failed to get queued operation: %w", err)
+	}
+
+	return &queued, nil
+}
+
+// PendingWallets returns wallets with pending operations, the longest waiting first.
+func (r *OperationQueueRepository) PendingWallets(ctx context.Context, limit int) ([]uuid.UUID, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT id_wallet FROM operation_queue
+		WHERE status = 'PENDING'
+		GROUP BY id_wallet
+		ORDER BY MIN(seq)
+		LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wallets with pending operations: %w", err)
+	}
+
+	wallets, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan wallets with pending operations: %w", err)
+	}
+
+	return wallets, nil
+}
+
+// ApplyPending makes up to limit pending operations of the wallet in queue order in one
+// transaction, writing the balance and version of the wallet once for all of them.
+// Operations that would have been rejected if made synchronously become FAILED and do not
+// stop the rest of the batch. ErrWalletLocked means the wallet is busy, the operations
+// stay pending.
+func (r *OperationQueueRepository) ApplyPending(ctx context.Context, walletID uuid.UUID, limit int) (entity.QueueBatch, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return entity.QueueBatch{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		balance int
+		floor   int
+		freeze  entity.Freeze
+		tier    string
+		shards  int
+	)
+	err = tx.QueryRow(ctx,
+		`SELECT balance, `+walletFloor+`, `+walletFreeze+`, COALESCE(labels->>'tier', ''), balance_shards
+		FROM wallets WHERE id_wallet = $1 FOR NO KEY UPDATE NOWAIT`,
+		walletID,
+	).Scan(&balance, &floor, &freeze.Mode, &freeze.Until, &tier, &shards)
+	if err != nil {
+		return entity.QueueBatch{}, lockError(err)
+	}
+
+	// SKIP LOCKED leaves operations claimed by another instance that got the wallet first.
+	rows, err := tx.Query(ctx,
+		`SELECT `+queueColumns+`, COALESCE(principal, ''), COALESCE(claimed_actor, ''), COALESCE(request_id, ''),
+			COALESCE(client_ip, '')
+		FROM operation_queue
+		WHERE id_wallet = $1 AND status = 'PENDING'
+		ORDER BY seq
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED`,
+		walletID,
+		limit,
+	)
+	if err != nil {
+		return entity.QueueBatch{}, fmt.Errorf("failed to get pending operations: %w", err)
+	}
+	pending, err := pgx.CollectRows(rows, scanPending)
+	if err != nil {
+		return entity.QueueBatch{}, fmt.Errorf("failed to scan pending operations: %w", err)
+	}
+	if len(pending) == 0 {
+		return entity.QueueBatch{}, nil
+	}
+
+	if shards > 0 {
+		if balance, _, err = sweepShards(ctx, tx, walletID); err != nil {
+			return entity.QueueBatch{}, err
+		}
+	}
+
+	var (
+		batch    entity.QueueBatch
+		recorded int
+		ids      = make([]uuid.UUID, 0, len(pending))
+		statuses = make([]string, 0, len(pending))
+		reasons  = make([]string, 0, len(pending))
+	)
+	for _, queued := range pending {
+		after, count, err := applyQueued(audit.WithOrigin(ctx, queued.origin), tx, queued.QueuedOperation, balance, floor, freeze, tier)
+		ids = append(ids, queued.ID)
+		switch {
+		case err == nil:
+			batch.Applied++
+			balance = after
+			recorded += count
+			statuses = append(statuses, entity.QueuedApplied)
+			reasons = append(reasons, "")
+		case errors.Is(err, ErrWalletFrozen), errors.Is(err, ErrInsufficientFunds), errors.Is(err, ErrDuplicateOperation):
+			batch.Failed++
+			statuses = append(statuses, entity.QueuedFailed)
+			reasons = append(reasons, err.Error())
+		default:
+			return entity.QueueBatch{}, err
+		}
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE wallets
+			SET balance = $2, version = version + $3, updated_at = CURRENT_TIMESTAMP
+			WHERE id_wallet = $1`,
+		walletID,
+		balance,
+		recorded,
+	)
+	if err != nil {
+		slog.Error("failed to update wallet balance", "error", err.Error())
+		return entity.QueueBatch{}, err
+	}
+	if recorded > 0 {
+		// The balance events of the batch carry the balances, the version moved with them.
+		if err = notifyWalletChanged(ctx, tx, walletID); err != nil {
+			return entity.QueueBatch{}, err
+		}
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE operation_queue q
+			SET status = u.status, error = NULLIF(u.error, ''), processed_at = CURRENT_TIMESTAMP
+			FROM unnest($1::UUID[], $2::TEXT[], $3::TEXT[]) AS u(id_operation, status, error)
+			WHERE q.id_operation = u.id_operation`,
+		ids,
+		statuses,
+		reasons,
+	)
+	if err != nil {
+		return entity.QueueBatch{}, fmt.Errorf("failed to update queued operations: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		slog.Error("failed to commit queued operations", "error", err.Error())
+		return entity.QueueBatch{}, err
+	}
+
+	return batch, nil
+}
+
+// pendingOperation is a queued operation with the origin of the request that queued it.
+type pendingOperation struct {
+	entity.QueuedOperation
+	origin audit.Origin
+}
+
+func scanPending(row pgx.CollectableRow) (pendingOperation, error) {
+	var pending pendingOperation
+	err := row.Scan(
+		&pending.ID,
+		&pending.WalletID,
+		&pending.OperationType,
+		&pending.Amount,
+		&pending.Description,
+		&pending.ExternalReference,
+		&pending.Metadata,
+		&pending.Status,
+		&pending.Error,
+		&pending.CreatedAt,
+		&pending.ProcessedAt,
+		&pending.origin.Principal,
+		&pending.origin.ClaimedActor,
+		&pending.origin.RequestID,
+		&pending.origin.ClientIP,
+	)
+	return pending, err
+}
+
+// applyQueued makes a queued operation on the wallet locked by tx, starting at balance,
+// and returns the balance after it and the number of operations recorded on the wallet,
+// two when a fee was charged. Every recorded operation gets its balance event and audit
+// entry in the same savepoint, so a rejected operation leaves nothing behind.
+func applyQueued(ctx context.Context, tx pgx.Tx, queued entity.QueuedOperation, balance, floor int, freeze entity.Freeze, tier string) (int, int, error) {
+	if err := checkFreeze(queued.WalletID, freeze, queued.OperationType); err != nil {
+		return 0, 0, err
+	}
+
+	charge, err := findFee(ctx, tx, queued.WalletID, queued.OperationType, tier, queued.Amount)
+	if err != nil {
+		slog.Error("failed to find fee rule", "error", err.Error())
+		return 0, 0, err
+	}
+
+	final := balance + entity.Operation{OperationType: queued.OperationType, Amount: queued.Amount}.SignedAmount()
+	if charge != nil {
+		final -= charge.Amount
+	}
+	if final < floor && final < balance {
+		return 0, 0, ErrInsufficientFunds
+	}
+
+	// The savepoint drops the operation alone when its external reference is taken.
+	savepoint, err := tx.Begin(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer savepoint.Rollback(ctx)
+
+	operation := entity.Operation{
+		ID:               queued.ID,
+		WalletID:         queued.WalletID,
+		OperationType:    queued.OperationType,
+		Amount:           queued.Amount,
+		OperationDetails: queued.OperationDetails,
+	}
+	if err = appendOperation(ctx, savepoint, &operation, balance); err != nil {
+		return 0, 0, err
+	}
+	if err = appendAudit(ctx, savepoint, operationAuditEntry(entity.AuditOperationAdded, operation)); err != nil {
+		return 0, 0, err
+	}
+	balance, count := *operation.BalanceAfter, 1
+
+	if charge != nil {
+		details := feeOperationDetails(charge)
+		feeOperation := entity.Operation{
+			WalletID:          queued.WalletID,
+			OperationType:     "WITHDRAW",
+			Amount:            charge.Amount,
+			ParentOperationID: &operation.ID,
+			OperationDetails:  details,
+		}
+		if err = appendOperation(ctx, savepoint, &feeOperation, balance); err != nil {
+			return 0, 0, err
+		}
+		if err = appendAudit(ctx, savepoint, operationAuditEntry(entity.AuditFeeCharged, feeOperation)); err != nil {
+			return 0, 0, err
+		}
+		balance, count = *feeOperation.BalanceAfter, 2
+
+		if _, err = creditFee(ctx, savepoint, charge, details, operation.ID); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if err = savepoint.Commit(ctx); err != nil {
+		return 0, 0, err
+	}
+
+	return balance, count, nil
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"wallet_controller/internal/entity"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type OutboxRepositoryInterface interface {
+	ProcessPending(ctx context.Context, limit int, handle func(event entity.Event) error) (int, error)
+}
+
+type OutboxRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewOutboxRepository(db *pgxpool.Pool) OutboxRepositoryInterface {
+	return &OutboxRepository{db: db}
+}
+
+// ProcessPending locks up to limit unpublished events, passes them to handle in order
+// and marks the handled ones as published. Processing stops at the first failed event
+// so consumers never see events of a wallet out of order; the failed event stays in
+// the outbox and is retried on the next call.
+func (r *OutboxRepository) ProcessPending(ctx context.Context, limit int, handle func(event entity.Event) error) (int, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx,
+		`SELECT id, aggregate_id, event_type, payload, created_at
+		FROM outbox
+		WHERE published_at IS NULL
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED`,
+		limit,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch outbox events: %w", err)
+	}
+
+	events, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (entity.Event, error) {
+		var event entity.Event
+		err := row.Scan(&event.ID, &event.WalletID, &event.Type, &event.Payload, &event.CreatedAt)
+		return event, err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to scan outbox events: %w", err)
+	}
+
+	processed := 0
+	for _, event := range events {
+		if handleErr := handle(event); handleErr != nil {
+			slog.Warn("failed to publish outbox event", "id", event.ID, "error", handleErr.Error())
+
+			_, err = tx.Exec(ctx,
+				`UPDATE outbox SET attempts = attempts + 1, last_error = $1 WHERE id = $2`,
+				handleErr.Error(),
+				event.ID,
+			)
+			if err != nil {
+				return processed, fmt.Errorf("failed to record outbox failure: %w", err)
+			}
+			break
+		}
+
+		_, err = tx.Exec(ctx,
+			`UPDATE outbox SET published_at = CURRENT_TIMESTAMP, attempts = attempts + 1 WHERE id = $1`,
+			event.ID,
+		)
+		if err != nil {
+			return processed, fmt.Errorf("failed to mark outbox event published: %w", err)
+		}
+		processed++
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit outbox batch: %w", err)
+	}
+
+	return processed, nil
+}
+
+// writeEvent stores an event in the outbox as part of the caller's transaction.
+func writeEvent(ctx context.Context, tx pgx.Tx, walletID uuid.UUID, eventType string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s event: %w", eventType, err)
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO outbox (aggregate_id, event_type, payload)
+		VALUES ($1, $2, $3)`,
+		walletID,
+		eventType,
+		data,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert %s event: %w", eventType, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,328 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"wallet_controller/internal/entity"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrScheduleNotFound = errors.New("scheduled operation not found")
+
+type ScheduleRepositoryInterface interface {
+	CreateSchedule(ctx context.Context, schedule *entity.ScheduledOperation) error
+	GetSchedule(ctx context.Context, scheduleID uuid.UUID) (*entity.ScheduledOperation, error)
+	ListSchedules(ctx context.Context, walletID *uuid.UUID) ([]entity.ScheduledOperation, error)
+	UpdateSchedule(ctx context.Context, schedule *entity.ScheduledOperation) error
+	CancelSchedule(ctx context.Context, scheduleID uuid.UUID) error
+	ListRuns(ctx context.Context, scheduleID uuid.UUID, limit int) ([]entity.ScheduledRun, error)
+
+	ClaimDueSchedules(ctx context.Context, limit int, lease time.Duration) ([]entity.ScheduledOperation, error)
+	FinishRun(ctx context.Context, run entity.ScheduledRun, nextRunAt *time.Time) error
+	RetryRun(ctx context.Context, run entity.ScheduledRun, retryAfter time.Duration) error
+}
+
+type ScheduleRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewScheduleRepository(db *pgxpool.Pool) ScheduleRepositoryInterface {
+	return &ScheduleRepository{db: db}
+}
+
+const scheduleColumns = `id_schedule, id_wallet, operation_type, amount, COALESCE(description, ''), metadata,
+	COALESCE(cron, ''), next_run_at, status, attempts, created_at, updated_at`
+
+func scanSchedule(row pgx.Row) (entity.ScheduledOperation, error) {
+	var schedule entity.ScheduledOperation
+	err := row.Scan(
+		&schedule.ID,
+		&schedule.WalletID,
+		&schedule.OperationType,
+		&schedule.Amount,
+		&schedule.Description,
+		&schedule.Metadata,
+		&schedule.Cron,
+		&schedule.NextRunAt,
+		&schedule.Status,
+		&schedule.Attempts,
+		&schedule.CreatedAt,
+		&schedule.UpdatedAt,
+	)
+	return schedule, err
+}
+
+func (r *ScheduleRepository) CreateSchedule(ctx context.Context, schedule *entity.ScheduledOperation) error {
+	created, err := scanSchedule(r.db.QueryRow(ctx,
+		`INSERT INTO scheduled_operations (id_wallet, operation_type, amount, description, metadata, cron, next_run_at)
+		VALUES ($1, $2, $3, NULLIF($4::TEXT, ''), COALESCE($5::JSONB, '{}'), NULLIF($6::TEXT, ''), $7)
+		RETURNING `+scheduleColumns,
+		schedule.WalletID,
+		schedule.OperationType,
+		schedule.Amount,
+		schedule.Description,
+		schedule.Metadata,
+		schedule.Cron,
+		schedule.NextRunAt,
+	))
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolationCode {
+			return ErrWalletNotFound
+		}
+		return fmt.Errorf("failed to create scheduled operation: %w", err)
+	}
+
+	*schedule = created
+	return nil
+}
+
+func (r *ScheduleRepository) GetSchedule(ctx context.Context, scheduleID uuid.UUID) (*entity.ScheduledOperation, error) {
+	schedule, err := scanSchedule(r.db.QueryRow(ctx,
+		`SELECT `+scheduleColumns+` FROM scheduled_operations WHERE id_schedule = $1`,
+		scheduleID,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrScheduleNotFound
+		}
+		return nil, fmt.Errorf("failed to get scheduled operation: %w", err)
+	}
+
+	return &schedule, nil
+}
+
+// ListSchedules returns scheduled operations ordered by their next run,
+// only those of walletID when it is set.
+func (r *ScheduleRepository) ListSchedules(ctx context.Context, walletID *uuid.UUID) ([]entity.ScheduledOperation, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT `+scheduleColumns+`
+		FROM scheduled_operations
+		WHERE $1::UUID IS NULL OR id_wallet = $1::UUID
+		ORDER BY next_run_at`,
+		walletID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scheduled operations: %w", err)
+	}
+
+	schedules, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (entity.ScheduledOperation, error) {
+		return scanSchedule(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan scheduled operations: %w", err)
+	}
+
+	return schedules, nil
+}
+
+// UpdateSchedule replaces the operation and its timing and makes the schedule active again.
+func (r *ScheduleRepository) UpdateSchedule(ctx context.Context, schedule *entity.ScheduledOperation) error {
+	updated, err := scanSchedule(r.db.QueryRow(ctx,
+		`UPDATE scheduled_operations
+			SET id_wallet = $1, operation_type = $2, amount = $3, description = NULLIF($4::TEXT, ''),
+				metadata = COALESCE($5::JSONB, '{}'), cron = NULLIF($6::TEXT, ''), next_run_at = $7,
+				status = 'ACTIVE', attempts = 0, locked_until = NULL, updated_at = CURRENT_TIMESTAMP
+			WHERE id_schedule = $8
+			RETURNING `+scheduleColumns,
+		schedule.WalletID,
+		schedule.OperationType,
+		schedule.Amount,
+		schedule.Description,
+		schedule.Metadata,
+		schedule.Cron,
+		schedule.NextRunAt,
+		schedule.ID,
+	))
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolationCode {
+			return ErrWalletNotFound
+		}
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrScheduleNotFound
+		}
+		return fmt.Errorf("failed to update scheduled operation: %w", err)
+	}
+
+	*schedule = updated
+	return nil
+}
+
+// CancelSchedule stops further runs but keeps the schedule and its run history.
+func (r *ScheduleRepository) CancelSchedule(ctx context.Context, scheduleID uuid.UUID) error {
+	tag, err := r.db.Exec(ctx,
+		`UPDATE scheduled_operations
+			SET status = 'CANCELLED', locked_until = NULL, updated_at = CURRENT_TIMESTAMP
+			WHERE id_schedule = $1`,
+		scheduleID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to cancel scheduled operation: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrScheduleNotFound
+	}
+
+	return nil
+}
+
+func (r *ScheduleRepository) ListRuns(ctx context.Context, scheduleID uuid.UUID, limit int) ([]entity.ScheduledRun, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT id_run, id_schedule, scheduled_for, attempt, status, id_operation, COALESCE(error, ''), created_at
+		FROM scheduled_operation_runs
+		WHERE id_schedule = $1
+		ORDER BY created_at DESC
+		LIMIT $2`,
+		scheduleID,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scheduled operation runs: %w", err)
+	}
+
+	runs, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (entity.ScheduledRun, error) {
+		var run entity.ScheduledRun
+		err := row.Scan(
+			&run.ID,
+			&run.ScheduleID,
+			&run.ScheduledFor,
+			&run.Attempt,
+			&run.Status,
+			&run.OperationID,
+			&run.Error,
+			&run.CreatedAt,
+		)
+		return run, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan scheduled operation runs: %w", err)
+	}
+
+	return runs, nil
+}
+
+// ClaimDueSchedules leases active schedules whose next run is due, so concurrent
+// workers do not run the same schedule while it is in flight.
+func (r *ScheduleRepository) ClaimDueSchedules(ctx context.Context, limit int, lease time.Duration) ([]entity.ScheduledOperation, error) {
+	rows, err := r.db.Query(ctx,
+		`WITH due AS (
+			SELECT id_schedule AS due_id
+			FROM scheduled_operations
+			WHERE status = 'ACTIVE'
+				AND next_run_at <= CURRENT_TIMESTAMP
+				AND (locked_until IS NULL OR locked_until <= CURRENT_TIMESTAMP)
+			ORDER BY next_run_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE scheduled_operations s
+			SET locked_until = CURRENT_TIMESTAMP + make_interval(secs => $2)
+		FROM due
+		WHERE s.id_schedule = due.due_id
+		RETURNING `+scheduleColumns,
+		limit,
+		lease.Seconds(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim scheduled operations: %w", err)
+	}
+
+	schedules, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (entity.ScheduledOperation, error) {
+		return scanSchedule(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan scheduled operations: %w", err)
+	}
+
+	return schedules, nil
+}
+
+// FinishRun records the last attempt of a run and moves the schedule to nextRunAt.
+// Without nextRunAt the schedule is over: COMPLETED when the run succeeded, FAILED otherwise.
+func (r *ScheduleRepository) FinishRun(ctx context.Context, run entity.ScheduledRun, nextRunAt *time.Time) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err = insertRun(ctx, tx, run); err != nil {
+		return err
+	}
+
+	finalStatus := entity.ScheduleFailed
+	if run.Status == entity.RunSucceeded {
+		finalStatus = entity.ScheduleCompleted
+	}
+
+	// A schedule cancelled or replaced while the run was in flight keeps its new state.
+	_, err = tx.Exec(ctx,
+		`UPDATE scheduled_operations
+			SET next_run_at = COALESCE($2::TIMESTAMP, next_run_at),
+				status = CASE WHEN $2::TIMESTAMP IS NULL THEN $3 ELSE status END,
+				attempts = 0, locked_until = NULL, updated_at = CURRENT_TIMESTAMP
+			WHERE id_schedule = $1 AND status = 'ACTIVE' AND next_run_at = $4`,
+		run.ScheduleID,
+		nextRunAt,
+		finalStatus,
+		run.ScheduledFor,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to advance scheduled operation: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// RetryRun records a failed attempt and makes the run due again after retryAfter.
+func (r *ScheduleRepository) RetryRun(ctx context.Context, run entity.ScheduledRun, retryAfter time.Duration) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err = insertRun(ctx, tx, run); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE scheduled_operations
+			SET attempts = $2, locked_until = CURRENT_TIMESTAMP + make_interval(secs => $3), updated_at = CURRENT_TIMESTAMP
+			WHERE id_schedule = $1 AND status = 'ACTIVE' AND next_run_at = $4`,
+		run.ScheduleID,
+		run.Attempt,
+		retryAfter.Seconds(),
+		run.ScheduledFor,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to schedule retry: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+func insertRun(ctx context.Context, tx pgx.Tx, run entity.ScheduledRun) error {
+	_, err := tx.Exec(ctx,
+		`INSERT INTO scheduled_operation_runs (id_schedule, scheduled_for, attempt, status, id_operation, error)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6::TEXT, ''))`,
+		run.ScheduleID,
+		run.ScheduledFor,
+		run.Attempt,
+		run.Status,
+		run.OperationID,
+		run.Error,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record scheduled operation run: %w", err)
+	}
+
+	return nil
+}
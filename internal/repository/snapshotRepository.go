@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type SnapshotRepositoryInterface interface {
+	CreateSnapshots(ctx context.Context, minOperations int) (int, error)
+}
+
+type SnapshotRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewSnapshotRepository(db *pgxpool.Pool) SnapshotRepositoryInterface {
+	return &SnapshotRepository{db: db}
+}
+
+// CreateSnapshots stores the balance after the latest operation of every wallet that
+// got at least minOperations operations since its previous snapshot. The balance is
+// taken from wallet_operations.balance_after, so no wallet rows are locked.
+func (r *SnapshotRepository) CreateSnapshots(ctx context.Context, minOperations int) (int, error) {
+	tag, err := r.db.Exec(ctx,
+		`INSERT INTO wallet_balance_snapshots (id_wallet, seq, balance, taken_at)
+		SELECT w.id_wallet, last.seq, last.balance_after, last.created_at
+		FROM wallets w
+		CROSS JOIN LATERAL (
+			SELECT seq, balance_after, created_at
+			FROM wallet_operations o
+			WHERE o.id_wallet = w.id_wallet
+			ORDER BY seq DESC
+			LIMIT 1
+		) last
+		LEFT JOIN LATERAL (
+			SELECT seq
+			FROM wallet_balance_snapshots s
+			WHERE s.id_wallet = w.id_wallet
+			ORDER BY seq DESC
+			LIMIT 1
+		) prev ON TRUE
+		WHERE last.balance_after IS NOT NULL
+			AND (
+				SELECT COUNT(*)
+				FROM (
+					SELECT 1
+					FROM wallet_operations c
+					WHERE c.id_wallet = w.id_wallet AND c.seq > COALESCE(prev.seq, 0)
+					LIMIT $1
+				) recent
+			) >= $1
+		ON CONFLICT (id_wallet, seq) DO NOTHING`,
+		minOperations,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create balance snapshots: %w", err)
+	}
+
+	return int(tag.RowsAffected()), nil
+}
@@ -6,105 +6,1480 @@ import (
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"log/slog"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+	"wallet_controller/internal/audit"
 	"wallet_controller/internal/entity"
+	"wallet_controller/internal/fee"
+	"wallet_controller/internal/storage"
+)
+
+// lockNotAvailableCode is the SQLSTATE returned by FOR UPDATE NOWAIT when the row is locked.
+const lockNotAvailableCode = "55P03"
+
+// uniqueViolationCode is the SQLSTATE of a unique constraint violation.
+const uniqueViolationCode = "23505"
+
+// foreignKeyViolationCode is the SQLSTATE of a foreign key violation.
+const foreignKeyViolationCode = "23503"
+
+// checkViolationCode is the SQLSTATE of a CHECK constraint violation. The only checks
+// a wallet create or update can break are on credit_limit and min_balance.
+const checkViolationCode = "23514"
+
+// externalReferenceIndex keeps external references unique within a wallet.
+const externalReferenceIndex = "idx_wallet_operations_wallet_id_external_reference"
+
+// signedAmount is the effect of a wallet_operations row on the balance.
+const signedAmount = `CASE WHEN operation_type = 'WITHDRAW' THEN -amount ELSE amount END`
+
+var (
+	ErrWalletNotFound     = errors.New("wallet not found")
+	ErrInsufficientFunds  = errors.New("not enough money on wallet")
+	ErrWalletLocked       = errors.New("wallet is locked by another operation")
+	ErrDuplicateOperation = errors.New("operation with this external reference already exists")
+	ErrOperationNotFound  = errors.New("operation not found")
+	ErrVersionMismatch    = errors.New("wallet version does not match")
+	ErrWalletFrozen       = errors.New("wallet is frozen")
+	ErrWalletExists       = errors.New("wallet already exists")
+	ErrAlreadyReversed    = errors.New("operation is already reversed")
+	ErrNotReversible      = errors.New("fees and reversals can not be reversed")
+	ErrInvalidLimits      = errors.New("credit limit and minimum balance can not be negative")
 )
 
 type WalletRepositoryInterface interface {
+	CreateWallet(ctx context.Context, create entity.WalletCreate) (*entity.Wallet, error)
 	GetByID(ctx context.Context, walletID uuid.UUID) (*entity.Wallet, error)
-	AddOperation(ctx context.Context, walletID uuid.UUID, operationType string, amount int) (entity.Wallet, error)
+	UpdateWallet(ctx context.Context, walletID uuid.UUID, update entity.WalletUpdate) (*entity.Wallet, error)
+	SetFreeze(ctx context.Context, walletID uuid.UUID, freeze *entity.Freeze) (*entity.Wallet, error)
+	ListFreezeHistory(ctx context.Context, walletID uuid.UUID) ([]entity.FreezeEvent, error)
+	SearchWallets(ctx context.Context, filter entity.WalletFilter) ([]entity.Wallet, error)
+	AddOperation(ctx context.Context, walletID uuid.UUID, operationType string, amount int, details entity.OperationDetails, expectedVersion int64) (entity.OperationResult, error)
+	ReverseOperation(ctx context.Context, operationID uuid.UUID, details entity.OperationDetails) (entity.OperationResult, error)
+	GetOperation(ctx context.Context, operationID uuid.UUID) (*entity.Operation, error)
+	GetBalanceEvents(ctx context.Context, walletID uuid.UUID, afterSeq int64, limit int) ([]entity.BalanceEvent, error)
+	ListOperations(ctx context.Context, filter entity.OperationFilter) ([]entity.Operation, error)
+	GetBalanceAt(ctx context.Context, walletID uuid.UUID, at time.Time) (int, error)
+	StreamOperations(ctx context.Context, walletID uuid.UUID, from, to time.Time, fn func(operation entity.Operation) error) error
+	Reconcile(ctx context.Context) ([]entity.Discrepancy, error)
+	SetBalanceShards(ctx context.Context, walletID uuid.UUID, shards int) (*entity.Wallet, error)
 }
 
 type WalletRepository struct {
 	db *pgxpool.Pool
+	// reads routes wallet reads, history and statements to the read replica, nil sends
+	// everything to db.
+	reads *storage.ReadRouter
 }
 
 func NewWalletRepository(db *pgxpool.Pool) WalletRepositoryInterface {
 	return &WalletRepository{db: db}
 }
 
+// NewReplicatedWalletRepository reads wallets, history and statements through reads.
+// Everything that locks or changes a wallet, and reads made for it, use db.
+func NewReplicatedWalletRepository(db *pgxpool.Pool, reads *storage.ReadRouter) WalletRepositoryInterface {
+	return &WalletRepository{db: db, reads: reads}
+}
+
+func (r *WalletRepository) reader(ctx context.Context) storage.Querier {
+	if r.reads == nil {
+		return r.db
+	}
+	return r.reads.Reader(ctx)
+}
+
+func (r *WalletRepository) CreateWallet(ctx context.Context, create entity.WalletCreate) (*entity.Wallet, error) {
+	if create.ID == uuid.Nil {
+		create.ID = uuid.New()
+	}
+	if create.Labels == nil {
+		create.Labels = map[string]string{}
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	wallet, err := scanWallet(tx.QueryRow(ctx,
+		`INSERT INTO wallets (id_wallet, owner_id, display_name, labels, external_reference, credit_limit, min_balance)
+		VALUES ($1, NULLIF($2::TEXT, ''), NULLIF($3::TEXT, ''), $4, NULLIF($5::TEXT, ''), $6, $7)
+		RETURNING `+walletColumns,
+		create.ID,
+		create.OwnerID,
+		create.DisplayName,
+		create.Labels,
+		create.ExternalReference,
+		create.CreditLimit,
+		create.MinBalance,
+	))
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			switch pgErr.Code {
+			case uniqueViolationCode:
+				return nil, ErrWalletExists
+			case checkViolationCode:
+				return nil, ErrInvalidLimits
+			}
+		}
+		return nil, fmt.Errorf("failed to create wallet: %w", err)
+	}
+
+	err = appendAudit(ctx, tx, entity.AuditEntry{
+		Action:       entity.AuditWalletCreated,
+		WalletID:     wallet.ID,
+		BalanceAfter: &wallet.Balance,
+		Details:      auditDetails(create),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to create wallet: %w", err)
+	}
+
+	return wallet, nil
+}
+
 func (r *WalletRepository) GetByID(ctx context.Context, walletID uuid.UUID) (*entity.Wallet, error) {
 	query := `
-		SELECT id_wallet, balance
+		SELECT ` + walletColumns + `
 		FROM wallets
 		WHERE id_wallet = $1
 	`
 
+	wallet, err := scanWallet(r.reader(ctx).QueryRow(ctx, query, walletID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrWalletNotFound
+		}
+		return nil, fmt.Errorf("failed to get wallet: %w", err)
+	}
+
+	return wallet, err
+}
+
+func (r *WalletRepository) UpdateWallet(ctx context.Context, walletID uuid.UUID, update entity.WalletUpdate) (*entity.Wallet, error) {
+	// NULL parameters keep the current value, empty strings clear it.
+	query := `
+		UPDATE wallets SET
+			owner_id = CASE WHEN $2::TEXT IS NULL THEN owner_id ELSE NULLIF($2::TEXT, '') END,
+			display_name = CASE WHEN $3::TEXT IS NULL THEN display_name ELSE NULLIF($3::TEXT, '') END,
+			labels = COALESCE($4::JSONB, labels),
+			external_reference = CASE WHEN $5::TEXT IS NULL THEN external_reference ELSE NULLIF($5::TEXT, '') END,
+			credit_limit = COALESCE($6::BIGINT, credit_limit),
+			min_balance = COALESCE($7::BIGINT, min_balance),
+			version = version + 1,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id_wallet = $1
+		RETURNING ` + walletColumns
+
+	var labels any
+	if update.Labels != nil {
+		labels = *update.Labels
+		if *update.Labels == nil {
+			labels = map[string]string{}
+		}
+	}
+
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	wallet, err := scanWallet(tx.QueryRow(ctx, query,
+		walletID,
+		update.OwnerID,
+		update.DisplayName,
+		labels,
+		update.ExternalReference,
+		update.CreditLimit,
+		update.MinBalance,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrWalletNotFound
+		}
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == checkViolationCode {
+			return nil, ErrInvalidLimits
+		}
+		return nil, fmt.Errorf("failed to update wallet: %w", err)
+	}
+
+	if err = appendAudit(ctx, tx, walletAuditEntry(entity.AuditWalletUpdated, wallet, update)); err != nil {
+		return nil, err
+	}
+	if err = notifyWalletChanged(ctx, tx, walletID); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to update wallet: %w", err)
+	}
+
+	return wallet, nil
+}
+
+// SetFreeze replaces the freeze of the wallet, a nil freeze lifts it, and records the
+// change in the freeze history with the origin from the context. Freezing does not wait
+// for operations in flight, they finish before the wallet row is updated.
+func (r *WalletRepository) SetFreeze(ctx context.Context, walletID uuid.UUID, freeze *entity.Freeze) (*entity.Wallet, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	action, set := entity.FreezeActionUnfreeze, entity.Freeze{}
+	if freeze != nil {
+		action, set = entity.FreezeActionFreeze, *freeze
+	}
+
+	wallet, err := scanWallet(tx.QueryRow(ctx,
+		`UPDATE wallets
+			SET freeze_mode = NULLIF($2::TEXT, ''), freeze_reason = NULLIF($3::TEXT, ''), frozen_until = $4,
+				hold_amount = $5, version = version + 1, updated_at = CURRENT_TIMESTAMP
+			WHERE id_wallet = $1
+			RETURNING `+walletColumns,
+		walletID,
+		set.Mode,
+		set.Reason,
+		set.Until,
+		set.HoldAmount,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrWalletNotFound
+		}
+		return nil, fmt.Errorf("failed to freeze wallet: %w", err)
+	}
+
+	origin := audit.OriginFrom(ctx)
+	_, err = tx.Exec(ctx,
+		`INSERT INTO wallet_freeze_history (id_wallet, action, freeze_mode, freeze_reason, frozen_until, hold_amount,
+			principal, claimed_actor, request_id)
+		VALUES ($1, $2, NULLIF($3::TEXT, ''), NULLIF($4::TEXT, ''), $5, $6, $7, NULLIF($8::TEXT, ''), NULLIF($9::TEXT, ''))`,
+		walletID,
+		action,
+		set.Mode,
+		set.Reason,
+		set.Until,
+		set.HoldAmount,
+		origin.Principal,
+		origin.ClaimedActor,
+		origin.RequestID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record freeze: %w", err)
+	}
+
+	entry := walletAuditEntry(entity.AuditWalletUnfrozen, wallet, nil)
+	if freeze != nil {
+		entry = walletAuditEntry(entity.AuditWalletFrozen, wallet, freeze)
+	}
+	if err = appendAudit(ctx, tx, entry); err != nil {
+		return nil, err
+	}
+	if err = notifyWalletChanged(ctx, tx, walletID); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to freeze wallet: %w", err)
+	}
+
+	return wallet, nil
+}
+
+// ListFreezeHistory returns the freezes and unfreezes of the wallet, oldest first.
+func (r *WalletRepository) ListFreezeHistory(ctx context.Context, walletID uuid.UUID) ([]entity.FreezeEvent, error) {
+	if _, err := r.GetByID(ctx, walletID); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.reader(ctx).Query(ctx,
+		`SELECT id_event, id_wallet, action, COALESCE(freeze_mode, ''), COALESCE(freeze_reason, ''), frozen_until,
+			hold_amount, principal, COALESCE(claimed_actor, ''), COALESCE(request_id, ''), created_at
+		FROM wallet_freeze_history
+		WHERE id_wallet = $1
+		ORDER BY id_event`,
+		walletID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list freeze history: %w", err)
+	}
+
+	events, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (entity.FreezeEvent, error) {
+		var (
+			event  entity.FreezeEvent
+			freeze entity.Freeze
+		)
+		err := row.Scan(
+			&event.ID,
+			&event.WalletID,
+			&event.Action,
+			&freeze.Mode,
+			&freeze.Reason,
+			&freeze.Until,
+			&freeze.HoldAmount,
+			&event.Principal,
+			&event.ClaimedActor,
+			&event.RequestID,
+			&event.CreatedAt,
+		)
+		if event.Action == entity.FreezeActionFreeze {
+			event.Freeze = &freeze
+		}
+		return event, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan freeze history: %w", err)
+	}
+
+	return events, nil
+}
+
+func (r *WalletRepository) SearchWallets(ctx context.Context, filter entity.WalletFilter) ([]entity.Wallet, error) {
+	labels := filter.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+
+	var ownerID *string
+	if filter.OwnerID != "" {
+		ownerID = &filter.OwnerID
+	}
+
+	rows, err := r.db.Query(ctx, `
+		SELECT `+walletColumns+`
+		FROM wallets
+		WHERE ($1::TEXT IS NULL OR owner_id = $1::TEXT)
+			AND labels @> $2::JSONB
+			AND id_wallet > $3::UUID
+		ORDER BY id_wallet
+		LIMIT $4`,
+		ownerID,
+		labels,
+		filter.After,
+		filter.Limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search wallets: %w", err)
+	}
+	defer rows.Close()
+
+	wallets := make([]entity.Wallet, 0)
+	for rows.Next() {
+		wallet, err := scanWallet(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan wallet: %w", err)
+		}
+		wallets = append(wallets, *wallet)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to search wallets: %w", err)
+	}
+
+	return wallets, nil
+}
+
+// walletBalance is the total balance of a wallets row, its main balance and its shards.
+const walletBalance = `(balance + CASE WHEN balance_shards > 0
+	THEN COALESCE((SELECT SUM(s.balance) FROM wallet_balance_shards s WHERE s.id_wallet = wallets.id_wallet), 0)
+	ELSE 0 END)::BIGINT`
+
+// walletVersion is the version of a wallets row, counting the deposits to its shards
+// that were not swept yet.
+const walletVersion = `(version + CASE WHEN balance_shards > 0
+	THEN COALESCE((SELECT SUM(s.version) FROM wallet_balance_shards s WHERE s.id_wallet = wallets.id_wallet), 0)
+	ELSE 0 END)::BIGINT`
+
+const walletColumns = `id_wallet, ` + walletBalance + `, credit_limit, min_balance, ` + walletVersion + `, COALESCE(freeze_mode, ''), COALESCE(freeze_reason, ''), frozen_until, hold_amount, balance_shards, COALESCE(owner_id, ''), COALESCE(display_name, ''), labels, COALESCE(external_reference, '')`
+
+// walletFloor is the lowest balance a withdrawal may leave on a wallets row, see entity.Wallet.Floor.
+const walletFloor = `CASE WHEN hold_amount > 0 THEN min_balance + hold_amount ELSE min_balance - credit_limit END`
+
+// walletFreeze is the freeze mode of a wallets row and its expiry, read by checkFreeze.
+const walletFreeze = `COALESCE(freeze_mode, ''), frozen_until`
+
+func scanWallet(row pgx.Row) (*entity.Wallet, error) {
 	wallet := entity.Wallet{}
-	err := r.db.QueryRow(ctx, query, walletID).Scan(
+	freeze := entity.Freeze{}
+	err := row.Scan(
 		&wallet.ID,
 		&wallet.Balance,
+		&wallet.CreditLimit,
+		&wallet.MinBalance,
+		&wallet.Version,
+		&freeze.Mode,
+		&freeze.Reason,
+		&freeze.Until,
+		&freeze.HoldAmount,
+		&wallet.BalanceShards,
+		&wallet.OwnerID,
+		&wallet.DisplayName,
+		&wallet.Labels,
+		&wallet.ExternalReference,
 	)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, errors.New("wallet not found")
+		return nil, err
+	}
+
+	if freeze.Reason != "" {
+		wallet.Freeze = &freeze
+		wallet.Frozen = freeze.Blocks(time.Now())
+	}
+
+	wallet.Available = max(wallet.Balance-wallet.Floor(), 0)
+	wallet.Overdraft = max(-wallet.Balance, 0)
+
+	return &wallet, nil
+}
+
+// checkFreeze rejects an operation of operationType the freeze mode of the wallet blocks.
+func checkFreeze(walletID uuid.UUID, freeze entity.Freeze, operationType string) error {
+	if freeze.Rejects(operationType, time.Now()) {
+		slog.Warn("Operation on frozen wallet", "wallet_id", walletID, "mode", freeze.Mode, "operation_type", operationType)
+		return ErrWalletFrozen
+	}
+	return nil
+}
+
+// AddOperation records the operation and updates the balance. A non-zero expectedVersion
+// makes it fail with ErrVersionMismatch unless the wallet still has that version.
+//
+// When a fee rule matches the operation, the fee is withdrawn from the wallet and
+// deposited to the fee wallet of the rule in the same transaction, and the balance
+// has to cover the operation together with the fee.
+//
+// Deposits to a wallet with balance shards go to one of the shards without locking
+// the wallet, see addShardedDeposit. Other operations on it first move the shards
+// back to the main balance, so withdrawals are checked against the total.
+func (r *WalletRepository) AddOperation(ctx context.Context, walletID uuid.UUID, operationType string, amount int, details entity.OperationDetails, expectedVersion int64) (entity.OperationResult, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return entity.OperationResult{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	// NO KEY UPDATE lets deposits to balance shards insert operations referencing the
+	// wallet while it is held, they never wait for it. A deposit that may go to a shard
+	// does not lock a wallet with shards at all: the row is filtered out before locking.
+	const lockWallet = `SELECT balance, version, ` + walletFloor + `, ` + walletFreeze + `, COALESCE(labels->>'tier', ''), balance_shards
+		FROM wallets WHERE id_wallet = $1 AND ($2::BOOL OR balance_shards = 0) FOR NO KEY UPDATE NOWAIT`
+	var (
+		balance int
+		version int64
+		floor   int
+		freeze  entity.Freeze
+		tier    string
+		shards  int
+	)
+	shardable := operationType == "DEPOSIT" && expectedVersion == 0
+	err = tx.QueryRow(ctx, lockWallet, walletID, !shardable).Scan(&balance, &version, &floor, &freeze.Mode, &freeze.Until, &tier, &shards)
+	if shardable && errors.Is(err, pgx.ErrNoRows) {
+		result, ok, shardErr := addShardedDeposit(ctx, tx, walletID, amount, details)
+		switch {
+		case shardErr != nil:
+			return entity.OperationResult{}, shardErr
+		case ok:
+			if err = tx.Commit(ctx); err != nil {
+				slog.Error("failed to commit wallet operation", "error", err.Error())
+				return entity.OperationResult{}, err
+			}
+			return result, nil
 		}
-		return nil, fmt.Errorf("failed to get wallet: %w", err.Error())
+		err = tx.QueryRow(ctx, lockWallet, walletID, true).Scan(&balance, &version, &floor, &freeze.Mode, &freeze.Until, &tier, &shards)
 	}
+	if err != nil {
+		slog.Error("failed to get wallet balance", "error", err.Error())
+		return entity.OperationResult{}, lockError(err)
+	}
+
+	if err = checkFreeze(walletID, freeze, operationType); err != nil {
+		return entity.OperationResult{}, err
+	}
+
+	// The shards are swept before the version is compared, it counts their deposits.
+	if shards > 0 {
+		if balance, version, err = sweepShards(ctx, tx, walletID); err != nil {
+			return entity.OperationResult{}, err
+		}
+	}
+
+	if expectedVersion != 0 && version != expectedVersion {
+		slog.Warn("Wallet version mismatch", "wallet_id", walletID, "version", version, "expected_version", expectedVersion)
+		return entity.OperationResult{}, ErrVersionMismatch
+	}
+
+	charge, err := findFee(ctx, tx, walletID, operationType, tier, amount)
+	if err != nil {
+		slog.Error("failed to find fee rule", "error", err.Error())
+		return entity.OperationResult{}, err
+	}
+
+	final := balance + entity.Operation{OperationType: operationType, Amount: amount}.SignedAmount()
+	if charge != nil {
+		final -= charge.Amount
+	}
+	// An operation that leaves the balance below the floor is only allowed
+	// when it does not lower the balance.
+	if final < floor && final < balance {
+		slog.Warn("Not enough money on wallet", "wallet_id", walletID)
+		return entity.OperationResult{}, ErrInsufficientFunds
+	}
+
+	operation, wallet, err := recordOperation(ctx, tx, walletID, operationType, amount, balance, details, nil)
+	if err != nil {
+		return entity.OperationResult{}, err
+	}
+	if err = appendAudit(ctx, tx, operationAuditEntry(entity.AuditOperationAdded, operation)); err != nil {
+		return entity.OperationResult{}, err
+	}
+
+	if charge != nil {
+		feeDetails := feeOperationDetails(charge)
+
+		feeOperation, charged, err := recordOperation(ctx, tx, walletID, "WITHDRAW", charge.Amount, wallet.Balance, feeDetails, &operation.ID)
+		if err != nil {
+			return entity.OperationResult{}, err
+		}
+		if err = appendAudit(ctx, tx, operationAuditEntry(entity.AuditFeeCharged, feeOperation)); err != nil {
+			return entity.OperationResult{}, err
+		}
+		wallet = charged
+
+		creditOperation, err := creditFee(ctx, tx, charge, feeDetails, operation.ID)
+		if err != nil {
+			return entity.OperationResult{}, err
+		}
 
-	return &wallet, err
+		charge.OperationID = feeOperation.ID
+		charge.FeeWalletOperationID = creditOperation.ID
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		slog.Error("failed to commit wallet operation", "error", err.Error())
+		return entity.OperationResult{}, err
+	}
+
+	return entity.OperationResult{
+		Wallet:    *wallet,
+		Operation: operation,
+		Fee:       charge,
+	}, nil
 }
 
-func (r *WalletRepository) AddOperation(ctx context.Context, walletID uuid.UUID, operationType string, amount int) (entity.Wallet, error) {
+// ReverseOperation cancels an operation with the opposite operation of the same amount
+// on the same wallet, linked to it by parent_operation_id. The reversal has the external
+// reference "reversal:<operation id>", so an operation is reversed at most once. Fees
+// charged for the operation are not refunded and no fee is charged for the reversal.
+//
+// Only operations made on their own can be reversed: fees and reversals, which have a
+// parent operation, are rejected with ErrNotReversible.
+func (r *WalletRepository) ReverseOperation(ctx context.Context, operationID uuid.UUID, details entity.OperationDetails) (entity.OperationResult, error) {
+	original, err := r.GetOperation(ctx, operationID)
+	if err != nil {
+		return entity.OperationResult{}, err
+	}
+	if original.ParentOperationID != nil {
+		return entity.OperationResult{}, ErrNotReversible
+	}
+	reference := "reversal:" + operationID.String()
+
 	tx, err := r.db.Begin(ctx)
 	if err != nil {
-		return entity.Wallet{}, err
+		return entity.OperationResult{}, err
 	}
 	defer tx.Rollback(ctx)
 
-	balance := 0
+	var (
+		balance int
+		floor   int
+		freeze  entity.Freeze
+		shards  int
+	)
 	err = tx.QueryRow(ctx,
-		`SELECT balance FROM wallets WHERE id_wallet = $1 FOR UPDATE NOWAIT`,
+		`SELECT balance, `+walletFloor+`, `+walletFreeze+`, balance_shards
+		FROM wallets WHERE id_wallet = $1 FOR NO KEY UPDATE NOWAIT`,
+		original.WalletID,
+	).Scan(&balance, &floor, &freeze.Mode, &freeze.Until, &shards)
+	if err != nil {
+		slog.Error("failed to get wallet balance", "error", err.Error())
+		return entity.OperationResult{}, lockError(err)
+	}
+
+	// Checked before the balance, so a second reversal is reported as such even when the
+	// wallet could not afford it.
+	var reversed bool
+	err = tx.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM wallet_operations WHERE id_wallet = $1 AND external_reference = $2)`,
+		original.WalletID,
+		reference,
+	).Scan(&reversed)
+	if err != nil {
+		return entity.OperationResult{}, fmt.Errorf("failed to check reversal: %w", err)
+	}
+	if reversed {
+		return entity.OperationResult{}, ErrAlreadyReversed
+	}
+
+	reversal := entity.Operation{OperationType: "DEPOSIT", Amount: original.Amount}
+	if original.OperationType == "DEPOSIT" {
+		reversal.OperationType = "WITHDRAW"
+	}
+
+	if err = checkFreeze(original.WalletID, freeze, reversal.OperationType); err != nil {
+		return entity.OperationResult{}, err
+	}
+
+	if shards > 0 {
+		if balance, _, err = sweepShards(ctx, tx, original.WalletID); err != nil {
+			return entity.OperationResult{}, err
+		}
+	}
+
+	final := balance + reversal.SignedAmount()
+	if final < floor && final < balance {
+		slog.Warn("Not enough money on wallet", "wallet_id", original.WalletID)
+		return entity.OperationResult{}, ErrInsufficientFunds
+	}
+
+	if details.Description == "" {
+		details.Description = "Reversal"
+	}
+	details.ExternalReference = reference
+
+	operation, wallet, err := recordOperation(ctx, tx, original.WalletID, reversal.OperationType, reversal.Amount, balance, details, &operationID)
+	if err != nil {
+		if errors.Is(err, ErrDuplicateOperation) {
+			return entity.OperationResult{}, ErrAlreadyReversed
+		}
+		return entity.OperationResult{}, err
+	}
+	if err = appendAudit(ctx, tx, operationAuditEntry(entity.AuditOperationReversed, operation)); err != nil {
+		return entity.OperationResult{}, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		slog.Error("failed to commit reversal", "error", err.Error())
+		return entity.OperationResult{}, err
+	}
+
+	return entity.OperationResult{
+		Wallet:    *wallet,
+		Operation: operation,
+	}, nil
+}
+
+// findFee returns the fee charged on the operation, nil when no rule matches or the
+// fee comes to zero. Rules for the tier of the wallet win over rules for any tier.
+func findFee(ctx context.Context, tx pgx.Tx, walletID uuid.UUID, operationType, tier string, amount int) (*entity.Fee, error) {
+	rule, err := scanFeeRule(tx.QueryRow(ctx,
+		`SELECT `+feeRuleColumns+`
+		FROM fee_rules
+		WHERE operation_type = $1 AND (wallet_tier = $2 OR wallet_tier IS NULL)
+		ORDER BY wallet_tier IS NULL
+		LIMIT 1`,
+		operationType,
+		tier,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// The fee wallet does not pay fees to itself.
+	if rule.FeeWalletID == walletID {
+		return nil, nil
+	}
+
+	charge := fee.Calculate(rule, amount)
+	if charge.Amount <= 0 {
+		return nil, nil
+	}
+
+	return &charge, nil
+}
+
+// feeOperationDetails describes the operations that charge and credit a fee.
+func feeOperationDetails(charge *entity.Fee) entity.OperationDetails {
+	return entity.OperationDetails{
+		Description: "Fee",
+		Metadata:    map[string]any{"fee_rule_id": charge.RuleID.String()},
+	}
+}
+
+// creditFee deposits the fee charged for the operation parentID to the fee wallet and
+// records the credit in the audit log.
+func creditFee(ctx context.Context, tx pgx.Tx, charge *entity.Fee, details entity.OperationDetails, parentID uuid.UUID) (entity.Operation, error) {
+	// NOWAIT as for the paying wallet: a busy fee wallet fails the operation with
+	// ErrWalletLocked instead of holding the paying wallet while waiting for it.
+	var balance, shards int
+	err := tx.QueryRow(ctx,
+		`SELECT balance, balance_shards FROM wallets WHERE id_wallet = $1 FOR NO KEY UPDATE NOWAIT`,
+		charge.FeeWalletID,
+	).Scan(&balance, &shards)
+	if err != nil {
+		slog.Error("failed to lock fee wallet", "error", err.Error())
+		if errors.Is(lockError(err), ErrWalletLocked) {
+			return entity.Operation{}, ErrWalletLocked
+		}
+		return entity.Operation{}, fmt.Errorf("failed to lock fee wallet: %w", err)
+	}
+	if shards > 0 {
+		if balance, _, err = sweepShards(ctx, tx, charge.FeeWalletID); err != nil {
+			return entity.Operation{}, err
+		}
+	}
+
+	operation, _, err := recordOperation(ctx, tx, charge.FeeWalletID, "DEPOSIT", charge.Amount, balance, details, &parentID)
+	if err != nil {
+		return entity.Operation{}, err
+	}
+	if err = appendAudit(ctx, tx, operationAuditEntry(entity.AuditFeeCredited, operation)); err != nil {
+		return entity.Operation{}, err
+	}
+
+	return operation, nil
+}
+
+// recordOperation inserts an operation made on a wallet locked by tx, moves its balance
+// from balanceBefore and publishes the change. parentID links fee operations and
+// reversals to the operation they were made for.
+func recordOperation(ctx context.Context, tx pgx.Tx, walletID uuid.UUID, operationType string, amount, balanceBefore int, details entity.OperationDetails, parentID *uuid.UUID) (entity.Operation, *entity.Wallet, error) {
+	operation := entity.Operation{
+		WalletID:          walletID,
+		OperationType:     operationType,
+		Amount:            amount,
+		ParentOperationID: parentID,
+		OperationDetails:  details,
+	}
+	if err := appendOperation(ctx, tx, &operation, balanceBefore); err != nil {
+		return entity.Operation{}, nil, err
+	}
+
+	wallet, err := scanWallet(tx.QueryRow(ctx,
+		`UPDATE wallets
+			SET balance = $1, version = version + 1, updated_at = CURRENT_TIMESTAMP
+			WHERE id_wallet = $2
+			RETURNING `+walletColumns,
+		*operation.BalanceAfter,
 		walletID,
-	).Scan(&balance)
+	))
 	if err != nil {
-		slog.Error("failed to get wallet balance", err.Error())
-		return entity.Wallet{}, err
+		slog.Error("failed to update wallet operation", "error", err.Error())
+		return entity.Operation{}, nil, err
 	}
 
-	if operationType == "WITHDRAW" && balance-amount < 0 {
-		slog.Warn("Not enough money on wallet:", walletID)
-		return entity.Wallet{}, errors.New("not enough money on wallet")
-	} else if operationType == "WITHDRAW" {
-		balance -= amount
-	} else {
-		balance += amount
+	return operation, wallet, nil
+}
+
+// appendOperation inserts an operation made on a wallet locked by tx with the balance
+// moving from balanceBefore and publishes the change, but leaves the wallet row to the
+// caller, which may batch several operations into one update.
+func appendOperation(ctx context.Context, tx pgx.Tx, operation *entity.Operation, balanceBefore int) error {
+	balance := balanceBefore + operation.SignedAmount()
+	operation.BalanceBefore = &balanceBefore
+	operation.BalanceAfter = &balance
+
+	if err := insertOperation(ctx, tx, operation); err != nil {
+		return err
 	}
 
-	_, err = tx.Exec(ctx,
-		`INSERT INTO wallet_operations (id_wallet, operation_type, amount)
-		VALUES ($1, $2, $3)`,
+	if err := writeOperationCreated(ctx, tx, *operation); err != nil {
+		return err
+	}
+
+	return publishBalanceChanged(ctx, tx, *operation)
+}
+
+// publishBalanceChanged writes the balance_changed event of an operation with balances
+// and notifies the listeners of the new balance.
+func publishBalanceChanged(ctx context.Context, tx pgx.Tx, operation entity.Operation) error {
+	err := writeEvent(ctx, tx, operation.WalletID, entity.EventBalanceChanged, entity.BalanceChangedPayload{
+		WalletID:      operation.WalletID,
+		OperationID:   operation.ID,
+		BalanceBefore: *operation.BalanceBefore,
+		BalanceAfter:  *operation.BalanceAfter,
+	})
+	if err != nil {
+		slog.Error("failed to write outbox event", "error", err.Error())
+		return err
+	}
+
+	err = notifyBalanceChanged(ctx, tx, entity.BalanceEvent{
+		Seq:           operation.Seq,
+		WalletID:      operation.WalletID,
+		OperationID:   operation.ID,
+		OperationType: operation.OperationType,
+		Amount:        operation.Amount,
+		Balance:       *operation.BalanceAfter,
+		CreatedAt:     operation.CreatedAt,
+	})
+	if err != nil {
+		slog.Error("failed to notify balance change", "error", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// insertOperation stores the operation and fills in its sequence number and time, and
+// its ID unless it was assigned in advance. The time is taken at insert rather than at
+// the start of the transaction, so it follows seq on a locked wallet.
+func insertOperation(ctx context.Context, tx pgx.Tx, operation *entity.Operation) error {
+	var id *uuid.UUID
+	if operation.ID != uuid.Nil {
+		id = &operation.ID
+	}
+
+	err := tx.QueryRow(ctx,
+		`INSERT INTO wallet_operations (id_operation, id_wallet, operation_type, amount, balance_before, balance_after, description, external_reference, metadata, parent_operation_id, created_at)
+		VALUES (COALESCE($1::UUID, uuid_generate_v4()), $2, $3, $4, $5, $6, NULLIF($7::TEXT, ''), NULLIF($8::TEXT, ''), COALESCE($9::JSONB, '{}'), $10, clock_timestamp())
+		RETURNING id_operation, seq, created_at`,
+		id,
+		operation.WalletID,
+		operation.OperationType,
+		operation.Amount,
+		operation.BalanceBefore,
+		operation.BalanceAfter,
+		operation.Description,
+		operation.ExternalReference,
+		operation.Metadata,
+		operation.ParentOperationID,
+	).Scan(&operation.ID, &operation.Seq, &operation.CreatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode && pgErr.ConstraintName == externalReferenceIndex {
+			slog.Warn("Duplicate operation", "wallet_id", operation.WalletID, "external_reference", operation.ExternalReference)
+			return ErrDuplicateOperation
+		}
+		slog.Error("failed to insert wallet operation", "error", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+func writeOperationCreated(ctx context.Context, tx pgx.Tx, operation entity.Operation) error {
+	err := writeEvent(ctx, tx, operation.WalletID, entity.EventOperationCreated, entity.OperationCreatedPayload{
+		OperationID:      operation.ID,
+		WalletID:         operation.WalletID,
+		OperationType:    operation.OperationType,
+		Amount:           operation.Amount,
+		OperationDetails: operation.OperationDetails,
+		CreatedAt:        operation.CreatedAt,
+	})
+	if err != nil {
+		slog.Error("failed to write outbox event", "error", err.Error())
+	}
+
+	return err
+}
+
+// addShardedDeposit adds the deposit to a random balance shard of the wallet in tx. Only
+// the shard row is locked, so deposits to different shards run in parallel, and it is
+// waited for instead of NOWAIT: withdrawals hold the shards only while moving them
+// to the main balance. The deposit counts towards the version of the wallet through
+// its shard. It gets its balance before and after and its balance_changed event when
+// the shards are swept, see sweepShards.
+//
+// It reports false when the wallet has no shards or a fee applies to the deposit,
+// the deposit then locks the wallet like any other operation.
+func addShardedDeposit(ctx context.Context, tx pgx.Tx, walletID uuid.UUID, amount int, details entity.OperationDetails) (entity.OperationResult, bool, error) {
+	var (
+		shards int
+		freeze entity.Freeze
+		tier   string
+	)
+	err := tx.QueryRow(ctx,
+		`SELECT balance_shards, `+walletFreeze+`, COALESCE(labels->>'tier', '') FROM wallets WHERE id_wallet = $1`,
 		walletID,
-		operationType,
+	).Scan(&shards, &freeze.Mode, &freeze.Until, &tier)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return entity.OperationResult{}, false, ErrWalletNotFound
+		}
+		return entity.OperationResult{}, false, fmt.Errorf("failed to get wallet: %w", err)
+	}
+	if shards == 0 {
+		return entity.OperationResult{}, false, nil
+	}
+	if err = checkFreeze(walletID, freeze, "DEPOSIT"); err != nil {
+		return entity.OperationResult{}, false, err
+	}
+
+	charge, err := findFee(ctx, tx, walletID, "DEPOSIT", tier, amount)
+	if err != nil {
+		slog.Error("failed to find fee rule", "error", err.Error())
+		return entity.OperationResult{}, false, err
+	}
+	if charge != nil {
+		return entity.OperationResult{}, false, nil
+	}
+
+	tag, err := tx.Exec(ctx,
+		`UPDATE wallet_balance_shards SET balance = balance + $3, version = version + 1 WHERE id_wallet = $1 AND shard = $2`,
+		walletID,
+		rand.Intn(shards),
 		amount,
 	)
 	if err != nil {
-		slog.Error("failed to insert wallet operation:", err.Error())
-		return entity.Wallet{}, err
+		slog.Error("failed to update balance shard", "error", err.Error())
+		return entity.OperationResult{}, false, err
+	}
+	if tag.RowsAffected() == 0 {
+		// the shards were changed after the wallet was read
+		return entity.OperationResult{}, false, nil
+	}
+
+	operation := entity.Operation{
+		WalletID:         walletID,
+		OperationType:    "DEPOSIT",
+		Amount:           amount,
+		OperationDetails: details,
+	}
+	if err = insertOperation(ctx, tx, &operation); err != nil {
+		return entity.OperationResult{}, false, err
+	}
+	if err = writeOperationCreated(ctx, tx, operation); err != nil {
+		return entity.OperationResult{}, false, err
+	}
+	if err = appendAudit(ctx, tx, operationAuditEntry(entity.AuditOperationAdded, operation)); err != nil {
+		return entity.OperationResult{}, false, err
+	}
+	// There is no balance to publish yet, other instances only drop the wallet from their caches.
+	if err = notifyWalletChanged(ctx, tx, walletID); err != nil {
+		return entity.OperationResult{}, false, err
+	}
+
+	wallet, err := scanWallet(tx.QueryRow(ctx, `SELECT `+walletColumns+` FROM wallets WHERE id_wallet = $1`, walletID))
+	if err != nil {
+		return entity.OperationResult{}, false, fmt.Errorf("failed to get wallet: %w", err)
+	}
+
+	return entity.OperationResult{
+		Wallet:    *wallet,
+		Operation: operation,
+	}, true, nil
+}
+
+// sweepShards moves the balance shards of a wallet locked by tx to its main balance and
+// returns the balance and version of the wallet after it. It waits for deposits in flight.
+//
+// The deposits made to the shards since the last sweep come after every operation with
+// balances, so they get theirs here in seq order, starting from the main balance, and
+// their balance_changed events are published.
+func sweepShards(ctx context.Context, tx pgx.Tx, walletID uuid.UUID) (int, int64, error) {
+	var (
+		swept    int
+		deposits int64
+		balance  int
+		version  int64
+	)
+	err := tx.QueryRow(ctx,
+		`WITH locked AS (
+			SELECT shard, balance, version FROM wallet_balance_shards WHERE id_wallet = $1 ORDER BY shard FOR UPDATE
+		)
+		SELECT COALESCE(SUM(balance), 0)::BIGINT, COALESCE(SUM(version), 0)::BIGINT FROM locked`,
+		walletID,
+	).Scan(&swept, &deposits)
+	if err != nil {
+		slog.Error("failed to lock balance shards", "error", err.Error())
+		return 0, 0, fmt.Errorf("failed to lock balance shards: %w", err)
+	}
+
+	if swept == 0 && deposits == 0 {
+		err = tx.QueryRow(ctx, `SELECT balance, version FROM wallets WHERE id_wallet = $1`, walletID).Scan(&balance, &version)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to get wallet: %w", err)
+		}
+		return balance, version, nil
 	}
 
 	_, err = tx.Exec(ctx,
+		`UPDATE wallet_balance_shards SET balance = 0, version = 0
+		WHERE id_wallet = $1 AND (balance <> 0 OR version <> 0)`,
+		walletID,
+	)
+	if err != nil {
+		slog.Error("failed to sweep balance shards", "error", err.Error())
+		return 0, 0, fmt.Errorf("failed to sweep balance shards: %w", err)
+	}
+
+	err = tx.QueryRow(ctx,
+		`UPDATE wallets SET balance = balance + $2, version = version + $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id_wallet = $1
+		RETURNING balance, version`,
+		walletID,
+		swept,
+		deposits,
+	).Scan(&balance, &version)
+	if err != nil {
+		slog.Error("failed to sweep balance shards", "error", err.Error())
+		return 0, 0, fmt.Errorf("failed to sweep balance shards: %w", err)
+	}
+
+	// All of them are deposits.
+	rows, err := tx.Query(ctx,
+		`WITH swept AS (
+			SELECT id_operation AS swept_id, $2::BIGINT + SUM(amount) OVER (ORDER BY seq) AS swept_after
+			FROM wallet_operations
+			WHERE id_wallet = $1 AND balance_before IS NULL
+		)
+		UPDATE wallet_operations
+			SET balance_before = swept_after - amount, balance_after = swept_after
+			FROM swept
+			WHERE id_operation = swept_id
+			RETURNING `+operationColumns,
+		walletID,
+		balance-swept,
+	)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to record swept deposits: %w", err)
+	}
+	operations, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (entity.Operation, error) {
+		return scanOperation(row)
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to record swept deposits: %w", err)
+	}
+
+	sort.Slice(operations, func(i, j int) bool {
+		return operations[i].Seq < operations[j].Seq
+	})
+	for _, operation := range operations {
+		if err = publishBalanceChanged(ctx, tx, operation); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return balance, version, nil
+}
+
+// SetBalanceShards changes the number of balance shards of the wallet, 0 turns them off.
+// The current shards are moved to the main balance first.
+func (r *WalletRepository) SetBalanceShards(ctx context.Context, walletID uuid.UUID, shards int) (*entity.Wallet, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var current int
+	err = tx.QueryRow(ctx,
+		`SELECT balance_shards FROM wallets WHERE id_wallet = $1 FOR NO KEY UPDATE NOWAIT`,
+		walletID,
+	).Scan(&current)
+	if err != nil {
+		return nil, lockError(err)
+	}
+
+	if current > 0 {
+		if _, _, err = sweepShards(ctx, tx, walletID); err != nil {
+			return nil, err
+		}
+		if _, err = tx.Exec(ctx, `DELETE FROM wallet_balance_shards WHERE id_wallet = $1`, walletID); err != nil {
+			return nil, fmt.Errorf("failed to delete balance shards: %w", err)
+		}
+	}
+
+	if shards > 0 {
+		_, err = tx.Exec(ctx,
+			`INSERT INTO wallet_balance_shards (id_wallet, shard)
+			SELECT $1::UUID, generate_series(0, $2::INT - 1)`,
+			walletID,
+			shards,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create balance shards: %w", err)
+		}
+	}
+
+	wallet, err := scanWallet(tx.QueryRow(ctx,
 		`UPDATE wallets
-			SET balance = $1, updated_at = CURRENT_TIMESTAMP
-			WHERE id_wallet = $2`,
-		balance,
+			SET balance_shards = $2, version = version + 1, updated_at = CURRENT_TIMESTAMP
+			WHERE id_wallet = $1
+			RETURNING `+walletColumns,
+		walletID,
+		shards,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update wallet: %w", err)
+	}
+
+	err = appendAudit(ctx, tx, walletAuditEntry(entity.AuditBalanceShardsSet, wallet, map[string]int{"balance_shards": shards}))
+	if err != nil {
+		return nil, err
+	}
+	if err = notifyWalletChanged(ctx, tx, walletID); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return wallet, nil
+}
+
+func (r *WalletRepository) GetOperation(ctx context.Context, operationID uuid.UUID) (*entity.Operation, error) {
+	operation, err := scanOperation(r.db.QueryRow(ctx,
+		`SELECT `+operationColumns+`
+		FROM wallet_operations
+		WHERE id_operation = $1`,
+		operationID,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrOperationNotFound
+		}
+		return nil, fmt.Errorf("failed to get operation: %w", err)
+	}
+
+	return &operation, nil
+}
+
+// GetBalanceEvents returns balance changes of the wallet that happened after the given sequence number.
+func (r *WalletRepository) GetBalanceEvents(ctx context.Context, walletID uuid.UUID, afterSeq int64, limit int) ([]entity.BalanceEvent, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT seq, id_wallet, id_operation, operation_type, amount, balance_after, created_at
+		FROM wallet_operations
+		WHERE id_wallet = $1 AND seq > $2 AND balance_after IS NOT NULL
+		ORDER BY seq
+		LIMIT $3`,
 		walletID,
+		afterSeq,
+		limit,
 	)
 	if err != nil {
-		slog.Error("failed to update wallet operation:", err.Error())
-		return entity.Wallet{}, err
+		return nil, fmt.Errorf("failed to get balance events: %w", err)
 	}
-	err = tx.Commit(ctx)
+
+	events, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (entity.BalanceEvent, error) {
+		var event entity.BalanceEvent
+		err := row.Scan(
+			&event.Seq,
+			&event.WalletID,
+			&event.OperationID,
+			&event.OperationType,
+			&event.Amount,
+			&event.Balance,
+			&event.CreatedAt,
+		)
+		return event, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan balance events: %w", err)
+	}
+
+	return events, nil
+}
+
+// ListOperations returns operations of the wallet matching the filter, newest first.
+// A non-positive BeforeSeq starts from the latest operation.
+func (r *WalletRepository) ListOperations(ctx context.Context, filter entity.OperationFilter) ([]entity.Operation, error) {
+	conditions := []string{"id_wallet = $1"}
+	args := []any{filter.WalletID}
+	where := func(condition string, values ...any) {
+		placeholders := make([]any, len(values))
+		for i, value := range values {
+			args = append(args, value)
+			placeholders[i] = len(args)
+		}
+		conditions = append(conditions, fmt.Sprintf(condition, placeholders...))
+	}
+
+	if filter.BeforeSeq > 0 {
+		where("seq < $%d::BIGINT", filter.BeforeSeq)
+	}
+	if filter.OperationType != "" {
+		where("operation_type = $%d::TEXT", filter.OperationType)
+	}
+	if filter.ExternalReference != "" {
+		where("external_reference = $%d::TEXT", filter.ExternalReference)
+	}
+	if filter.Description != "" {
+		where(`description ILIKE '%%' || $%d::TEXT || '%%'`, escapeLike(filter.Description))
+	}
+
+	keys := make([]string, 0, len(filter.Metadata))
+	for key := range filter.Metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		where("metadata ->> $%d::TEXT = $%d::TEXT", key, filter.Metadata[key])
+	}
+
+	args = append(args, filter.Limit)
+	query := fmt.Sprintf(`SELECT %s
+		FROM wallet_operations
+		WHERE %s
+		ORDER BY seq DESC
+		LIMIT $%d`, operationColumns, strings.Join(conditions, " AND "), len(args))
+
+	rows, err := r.reader(ctx).Query(ctx, query, args...)
 	if err != nil {
-		slog.Error("failed to commit wallet operation:", err.Error())
-		return entity.Wallet{}, err
+		return nil, fmt.Errorf("failed to list operations: %w", err)
+	}
+
+	operations, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (entity.Operation, error) {
+		return scanOperation(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan operations: %w", err)
+	}
+
+	return operations, nil
+}
+
+// StreamOperations calls fn for every operation with from <= created_at < to in order,
+// reading rows from the database one by one instead of loading the whole period.
+func (r *WalletRepository) StreamOperations(ctx context.Context, walletID uuid.UUID, from, to time.Time, fn func(operation entity.Operation) error) error {
+	rows, err := r.reader(ctx).Query(ctx,
+		`SELECT `+operationColumns+`
+		FROM wallet_operations
+		WHERE id_wallet = $1 AND created_at >= $2::TIMESTAMPTZ AND created_at < $3::TIMESTAMPTZ
+		ORDER BY seq`,
+		walletID,
+		from,
+		to,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to stream operations: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		operation, err := scanOperation(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan operation: %w", err)
+		}
+		if err = fn(operation); err != nil {
+			return err
+		}
 	}
 
-	return entity.Wallet{
-			ID:      walletID,
-			Balance: balance,
-		},
-		nil
+	return rows.Err()
+}
+
+const operationColumns = `id_operation, id_wallet, seq, operation_type, amount, balance_before, balance_after,
+	parent_operation_id, COALESCE(description, ''), COALESCE(external_reference, ''), metadata, created_at`
+
+func scanOperation(row pgx.Row) (entity.Operation, error) {
+	var operation entity.Operation
+	err := row.Scan(
+		&operation.ID,
+		&operation.WalletID,
+		&operation.Seq,
+		&operation.OperationType,
+		&operation.Amount,
+		&operation.BalanceBefore,
+		&operation.BalanceAfter,
+		&operation.ParentOperationID,
+		&operation.Description,
+		&operation.ExternalReference,
+		&operation.Metadata,
+		&operation.CreatedAt,
+	)
+	return operation, err
+}
+
+// escapeLike makes user input match literally inside a LIKE pattern.
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// GetBalanceAt returns the balance the wallet had at the given moment: the balance after
+// the last operation recorded at or before it. The moment is turned into that operation's
+// seq, and both the snapshot and the operations summed up are chosen by seq.
+//
+// Operations are recorded while the wallet is locked and take created_at at insert, so
+// for a wallet seq and created_at grow together and an operation committed later can not
+// land before one already reported.
+func (r *WalletRepository) GetBalanceAt(ctx context.Context, walletID uuid.UUID, at time.Time) (int, error) {
+	tx, err := r.reader(ctx).BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	current := 0
+	err = tx.QueryRow(ctx,
+		`SELECT `+walletBalance+` FROM wallets WHERE id_wallet = $1`,
+		walletID,
+	).Scan(&current)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrWalletNotFound
+		}
+		return 0, fmt.Errorf("failed to get wallet: %w", err)
+	}
+
+	// 0 when the wallet had no operations yet.
+	var cutoff int64
+	err = tx.QueryRow(ctx,
+		`SELECT COALESCE((
+			SELECT seq FROM wallet_operations
+			WHERE id_wallet = $1 AND created_at <= $2::TIMESTAMPTZ
+			ORDER BY created_at DESC, seq DESC
+			LIMIT 1
+		), 0)`,
+		walletID,
+		at,
+	).Scan(&cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find last operation: %w", err)
+	}
+
+	var (
+		snapshotSeq     int64
+		snapshotBalance int
+	)
+
+	// Roll forward from the latest snapshot up to the cutoff.
+	err = tx.QueryRow(ctx,
+		`SELECT seq, balance
+		FROM wallet_balance_snapshots
+		WHERE id_wallet = $1 AND seq <= $2
+		ORDER BY seq DESC
+		LIMIT 1`,
+		walletID,
+		cutoff,
+	).Scan(&snapshotSeq, &snapshotBalance)
+	if err == nil {
+		delta := 0
+		err = tx.QueryRow(ctx,
+			`SELECT COALESCE(SUM(`+signedAmount+`), 0)::BIGINT
+			FROM wallet_operations
+			WHERE id_wallet = $1 AND seq > $2 AND seq <= $3`,
+			walletID,
+			snapshotSeq,
+			cutoff,
+		).Scan(&delta)
+		if err != nil {
+			return 0, fmt.Errorf("failed to sum operations: %w", err)
+		}
+		return snapshotBalance + delta, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("failed to get balance snapshot: %w", err)
+	}
+
+	// Otherwise roll back from the earliest snapshot after the cutoff,
+	// or from the current balance when there is none.
+	upperSeq := int64(0)
+	upperBalance := current
+	err = tx.QueryRow(ctx,
+		`SELECT seq, balance
+		FROM wallet_balance_snapshots
+		WHERE id_wallet = $1 AND seq > $2
+		ORDER BY seq
+		LIMIT 1`,
+		walletID,
+		cutoff,
+	).Scan(&upperSeq, &upperBalance)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("failed to get balance snapshot: %w", err)
+	}
+
+	delta := 0
+	err = tx.QueryRow(ctx,
+		`SELECT COALESCE(SUM(`+signedAmount+`), 0)::BIGINT
+		FROM wallet_operations
+		WHERE id_wallet = $1 AND seq > $2 AND ($3::BIGINT = 0 OR seq <= $3::BIGINT)`,
+		walletID,
+		cutoff,
+		upperSeq,
+	).Scan(&delta)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum operations: %w", err)
+	}
+
+	return upperBalance - delta, nil
+}
+
+// Reconcile checks every wallet against its operations: each operation has to start
+// from the balance the previous one ended with and move it by its amount, and the
+// balance of the wallet has to be the balance after its last operation. Operations
+// recorded before balances were kept with them are skipped.
+//
+// Deposits to balance shards have no balances, so they are added to the balance the
+// previous operation ended with: an operation with balances has to start from it
+// moved by the deposits since, and so does the total balance of the wallet.
+func (r *WalletRepository) Reconcile(ctx context.Context) ([]entity.Discrepancy, error) {
+	rows, err := r.db.Query(ctx,
+		`WITH running AS (
+			SELECT id_wallet, id_operation, seq, balance_before, balance_after,
+				`+signedAmount+` AS change,
+				SUM(`+signedAmount+`) OVER (PARTITION BY id_wallet ORDER BY seq) AS total
+			FROM wallet_operations
+		),
+		history AS (
+			SELECT id_wallet, id_operation, balance_before, balance_after, total,
+				balance_before + change AS expected_after,
+				LAG(balance_after - total) OVER (PARTITION BY id_wallet ORDER BY seq) + total - change AS previous_after,
+				ROW_NUMBER() OVER (PARTITION BY id_wallet ORDER BY seq DESC) AS from_last
+			FROM running
+			WHERE balance_before IS NOT NULL
+		),
+		totals AS (
+			SELECT id_wallet, SUM(change) AS total FROM running GROUP BY id_wallet
+		)
+		SELECT id_wallet, id_operation, previous_after::BIGINT, balance_before
+		FROM history
+		WHERE previous_after IS NOT NULL AND previous_after <> balance_before
+		UNION ALL
+		SELECT id_wallet, id_operation, expected_after, balance_after
+		FROM history
+		WHERE expected_after <> balance_after
+		UNION ALL
+		SELECT h.id_wallet, NULL, (h.balance_after - h.total + t.total)::BIGINT, `+walletBalance+`
+		FROM history h
+		JOIN totals t ON t.id_wallet = h.id_wallet
+		JOIN wallets ON wallets.id_wallet = h.id_wallet
+		WHERE h.from_last = 1 AND h.balance_after - h.total + t.total <> `+walletBalance+`
+		ORDER BY 1`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reconcile wallets: %w", err)
+	}
+
+	discrepancies, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (entity.Discrepancy, error) {
+		var discrepancy entity.Discrepancy
+		err := row.Scan(&discrepancy.WalletID, &discrepancy.OperationID, &discrepancy.Expected, &discrepancy.Actual)
+		return discrepancy, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan discrepancies: %w", err)
+	}
+
+	return discrepancies, nil
+}
+
+// lockError translates errors of the wallet row lock into domain errors.
+func lockError(err error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrWalletNotFound
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == lockNotAvailableCode {
+		return ErrWalletLocked
+	}
 
+	return err
 }
@@ -0,0 +1,333 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+	"wallet_controller/internal/entity"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrSubscriptionNotFound = errors.New("webhook subscription not found")
+
+type WebhookRepositoryInterface interface {
+	CreateSubscription(ctx context.Context, subscription *entity.WebhookSubscription) error
+	GetSubscription(ctx context.Context, subscriptionID uuid.UUID) (*entity.WebhookSubscription, error)
+	ListSubscriptions(ctx context.Context) ([]entity.WebhookSubscription, error)
+	UpdateSubscription(ctx context.Context, subscription *entity.WebhookSubscription) error
+	DeleteSubscription(ctx context.Context, subscriptionID uuid.UUID) error
+	ListDeliveries(ctx context.Context, subscriptionID uuid.UUID, limit int) ([]entity.WebhookDelivery, error)
+
+	EnqueueDeliveries(ctx context.Context, event entity.Event) (int, error)
+	ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]entity.WebhookDeliveryTask, error)
+	MarkDelivered(ctx context.Context, deliveryID uuid.UUID, statusCode int) error
+	MarkFailed(ctx context.Context, deliveryID uuid.UUID, statusCode int, reason string, retryAfter time.Duration) error
+	MarkDead(ctx context.Context, deliveryID uuid.UUID, statusCode int, reason string) error
+}
+
+type WebhookRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewWebhookRepository(db *pgxpool.Pool) WebhookRepositoryInterface {
+	return &WebhookRepository{db: db}
+}
+
+const subscriptionColumns = `id_subscription, url, secret, event_types, id_wallet, active, created_at, updated_at`
+
+func scanSubscription(row pgx.Row) (entity.WebhookSubscription, error) {
+	var subscription entity.WebhookSubscription
+	err := row.Scan(
+		&subscription.ID,
+		&subscription.URL,
+		&subscription.Secret,
+		&subscription.EventTypes,
+		&subscription.WalletID,
+		&subscription.Active,
+		&subscription.CreatedAt,
+		&subscription.UpdatedAt,
+	)
+	return subscription, err
+}
+
+func (r *WebhookRepository) CreateSubscription(ctx context.Context, subscription *entity.WebhookSubscription) error {
+	created, err := scanSubscription(r.db.QueryRow(ctx,
+		`INSERT INTO webhook_subscriptions (url, secret, event_types, id_wallet, active)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+subscriptionColumns,
+		subscription.URL,
+		subscription.Secret,
+		subscription.EventTypes,
+		subscription.WalletID,
+		subscription.Active,
+	))
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return ErrWalletNotFound
+		}
+		return fmt.Errorf("failed to create webhook subscription: %w", err)
+	}
+
+	*subscription = created
+	return nil
+}
+
+// isForeignKeyViolation tells whether the subscription names a wallet that does not exist.
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolationCode
+}
+
+func (r *WebhookRepository) GetSubscription(ctx context.Context, subscriptionID uuid.UUID) (*entity.WebhookSubscription, error) {
+	subscription, err := scanSubscription(r.db.QueryRow(ctx,
+		`SELECT `+subscriptionColumns+` FROM webhook_subscriptions WHERE id_subscription = $1`,
+		subscriptionID,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrSubscriptionNotFound
+		}
+		return nil, fmt.Errorf("failed to get webhook subscription: %w", err)
+	}
+
+	return &subscription, nil
+}
+
+func (r *WebhookRepository) ListSubscriptions(ctx context.Context) ([]entity.WebhookSubscription, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT `+subscriptionColumns+` FROM webhook_subscriptions ORDER BY created_at`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook subscriptions: %w", err)
+	}
+
+	subscriptions, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (entity.WebhookSubscription, error) {
+		return scanSubscription(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan webhook subscriptions: %w", err)
+	}
+
+	return subscriptions, nil
+}
+
+func (r *WebhookRepository) UpdateSubscription(ctx context.Context, subscription *entity.WebhookSubscription) error {
+	updated, err := scanSubscription(r.db.QueryRow(ctx,
+		`UPDATE webhook_subscriptions
+			SET url = $1, secret = $2, event_types = $3, id_wallet = $4, active = $5, updated_at = CURRENT_TIMESTAMP
+			WHERE id_subscription = $6
+			RETURNING `+subscriptionColumns,
+		subscription.URL,
+		subscription.Secret,
+		subscription.EventTypes,
+		subscription.WalletID,
+		subscription.Active,
+		subscription.ID,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrSubscriptionNotFound
+		}
+		if isForeignKeyViolation(err) {
+			return ErrWalletNotFound
+		}
+		return fmt.Errorf("failed to update webhook subscription: %w", err)
+	}
+
+	*subscription = updated
+	return nil
+}
+
+func (r *WebhookRepository) DeleteSubscription(ctx context.Context, subscriptionID uuid.UUID) error {
+	tag, err := r.db.Exec(ctx,
+		`DELETE FROM webhook_subscriptions WHERE id_subscription = $1`,
+		subscriptionID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook subscription: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSubscriptionNotFound
+	}
+
+	return nil
+}
+
+func (r *WebhookRepository) ListDeliveries(ctx context.Context, subscriptionID uuid.UUID, limit int) ([]entity.WebhookDelivery, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT id_delivery, id_subscription, event_id, event_type, payload, status, attempts,
+			next_attempt_at, last_status_code, last_error, created_at, updated_at
+		FROM webhook_deliveries
+		WHERE id_subscription = $1
+		ORDER BY created_at DESC
+		LIMIT $2`,
+		subscriptionID,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+
+	deliveries, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (entity.WebhookDelivery, error) {
+		var delivery entity.WebhookDelivery
+		err := row.Scan(
+			&delivery.ID,
+			&delivery.SubscriptionID,
+			&delivery.EventID,
+			&delivery.EventType,
+			&delivery.Payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.NextAttemptAt,
+			&delivery.LastStatusCode,
+			&delivery.LastError,
+			&delivery.CreatedAt,
+			&delivery.UpdatedAt,
+		)
+		return delivery, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan webhook deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// EnqueueDeliveries creates one pending delivery per active subscription matching the event.
+// Re-publishing the same outbox event is a no-op, which keeps the fan-out idempotent.
+func (r *WebhookRepository) EnqueueDeliveries(ctx context.Context, event entity.Event) (int, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	tag, err := r.db.Exec(ctx,
+		`INSERT INTO webhook_deliveries (id_subscription, event_id, event_type, payload)
+		SELECT id_subscription, $1::BIGINT, $2::TEXT, $3::JSONB
+		FROM webhook_subscriptions
+		WHERE active
+			AND (cardinality(event_types) = 0 OR $2::TEXT = ANY(event_types))
+			AND (id_wallet IS NULL OR id_wallet = $4::UUID)
+		ON CONFLICT (id_subscription, event_id) DO NOTHING`,
+		event.ID,
+		event.Type,
+		payload,
+		event.WalletID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to enqueue webhook deliveries: %w", err)
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+// ClaimDueDeliveries leases due deliveries by pushing their next attempt lease into the future,
+// so concurrent workers do not send the same delivery while it is in flight.
+func (r *WebhookRepository) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]entity.WebhookDeliveryTask, error) {
+	rows, err := r.db.Query(ctx,
+		`WITH due AS (
+			SELECT id_delivery
+			FROM webhook_deliveries
+			WHERE status = 'PENDING' AND next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE webhook_deliveries d
+			SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $2), updated_at = CURRENT_TIMESTAMP
+		FROM due, webhook_subscriptions s
+		WHERE d.id_delivery = due.id_delivery AND s.id_subscription = d.id_subscription
+		RETURNING d.id_delivery, d.id_subscription, d.event_id, d.event_type, d.payload, d.attempts, s.url, s.secret`,
+		limit,
+		lease.Seconds(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+
+	tasks, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (entity.WebhookDeliveryTask, error) {
+		var task entity.WebhookDeliveryTask
+		err := row.Scan(
+			&task.Delivery.ID,
+			&task.Delivery.SubscriptionID,
+			&task.Delivery.EventID,
+			&task.Delivery.EventType,
+			&task.Delivery.Payload,
+			&task.Delivery.Attempts,
+			&task.URL,
+			&task.Secret,
+		)
+		return task, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan webhook deliveries: %w", err)
+	}
+
+	return tasks, nil
+}
+
+func (r *WebhookRepository) MarkDelivered(ctx context.Context, deliveryID uuid.UUID, statusCode int) error {
+	_, err := r.db.Exec(ctx,
+		`UPDATE webhook_deliveries
+			SET status = 'SUCCEEDED', attempts = attempts + 1, last_status_code = $1, last_error = NULL,
+				updated_at = CURRENT_TIMESTAMP
+			WHERE id_delivery = $2`,
+		statusCode,
+		deliveryID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark webhook delivery as delivered: %w", err)
+	}
+
+	return nil
+}
+
+// MarkFailed records a failed attempt and schedules the next one after retryAfter.
+func (r *WebhookRepository) MarkFailed(ctx context.Context, deliveryID uuid.UUID, statusCode int, reason string, retryAfter time.Duration) error {
+	_, err := r.db.Exec(ctx,
+		`UPDATE webhook_deliveries
+			SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $1),
+				attempts = attempts + 1, last_status_code = $2, last_error = $3, updated_at = CURRENT_TIMESTAMP
+			WHERE id_delivery = $4`,
+		retryAfter.Seconds(),
+		nullableStatusCode(statusCode),
+		reason,
+		deliveryID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark webhook delivery as failed: %w", err)
+	}
+
+	return nil
+}
+
+// MarkDead records the last failed attempt and moves the delivery to the dead-letter state.
+func (r *WebhookRepository) MarkDead(ctx context.Context, deliveryID uuid.UUID, statusCode int, reason string) error {
+	_, err := r.db.Exec(ctx,
+		`UPDATE webhook_deliveries
+			SET status = 'DEAD', attempts = attempts + 1, last_status_code = $1, last_error = $2,
+				updated_at = CURRENT_TIMESTAMP
+			WHERE id_delivery = $3`,
+		nullableStatusCode(statusCode),
+		reason,
+		deliveryID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark webhook delivery as dead: %w", err)
+	}
+
+	return nil
+}
+
+func nullableStatusCode(statusCode int) *int {
+	if statusCode == 0 {
+		return nil
+	}
+	return &statusCode
+}
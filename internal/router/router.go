@@ -5,30 +5,86 @@ import (
 	"github.com/gin-gonic/gin"
 	"wallet_controller/config"
 	"wallet_controller/internal/handler"
+	"wallet_controller/internal/notify"
+	"wallet_controller/internal/openapi"
 	"wallet_controller/internal/repository"
 	"wallet_controller/internal/service"
+	"wallet_controller/internal/storage"
 )
 
-func SetupRouter(ctx context.Context, cfg *config.Config) *gin.Engine {
+// SetupRouter builds the HTTP API on walletService, the instance gRPC and the workers
+// share. Requests keep reading their own writes from the primary unless reads is nil.
+func SetupRouter(ctx context.Context, cfg *config.Config, walletService service.WalletServiceInterface, broker *notify.Broker, reads *storage.ReadRouter) *gin.Engine {
 
-	walletRepo := repository.NewWalletRepository(cfg.Client)
-	walletService := service.NewWalletService(walletRepo)
 	walletHandler := handler.NewWalletHandler(walletService)
+	walletEventsHandler := handler.NewWalletEventsHandler(walletService, broker)
+
+	queueRepo := repository.NewOperationQueueRepository(cfg.Client)
+	queueService := service.NewOperationQueueService(queueRepo)
+	queueHandler := handler.NewOperationQueueHandler(queueService, walletHandler)
+
+	webhookRepo := repository.NewWebhookRepository(cfg.Client)
+	webhookService := service.NewWebhookService(webhookRepo)
+	webhookHandler := handler.NewWebhookHandler(webhookService)
+
+	feeRepo := repository.NewFeeRepository(cfg.Client)
+	feeService := service.NewFeeService(feeRepo)
+	feeHandler := handler.NewFeeHandler(feeService)
+
+	scheduleRepo := repository.NewScheduleRepository(cfg.Client)
+	scheduleService := service.NewScheduleService(scheduleRepo)
+	scheduleHandler := handler.NewScheduleHandler(scheduleService)
+
+	openAPIHandler := handler.NewOpenAPIHandler(openapi.Spec())
 
 	if cfg.Env.Environment == "production" {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
 	r := gin.Default()
+	r.Use(handler.AuditOrigin())
+	r.Use(openapi.NewValidator().Middleware())
+	if reads != nil {
+		r.Use(handler.ReadYourWrites(reads))
+	}
 
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
 
+	r.GET("/openapi.json", openAPIHandler.GetSpec)
+	r.GET("/docs", openAPIHandler.GetDocs)
+
 	api := r.Group("/api/v1")
 
+	api.GET("/wallets", walletHandler.SearchWallets)
 	api.GET("/wallets/:id", walletHandler.GetWallet)
-	api.POST("/wallet", walletHandler.AddOperation)
+	api.PATCH("/wallets/:id", walletHandler.UpdateWallet)
+	api.GET("/wallets/:id/balance", walletHandler.GetBalanceAt)
+	api.GET("/wallets/:id/operations", walletHandler.ListOperations)
+	api.GET("/wallets/:id/statement", walletHandler.GetStatement)
+	api.GET("/wallets/:id/events", walletEventsHandler.StreamEvents)
+	api.POST("/wallet", queueHandler.AddOperation)
+	api.GET("/operations/:id", queueHandler.GetOperation)
+
+	api.POST("/webhooks", webhookHandler.CreateSubscription)
+	api.GET("/webhooks", webhookHandler.ListSubscriptions)
+	api.GET("/webhooks/:id", webhookHandler.GetSubscription)
+	api.PUT("/webhooks/:id", webhookHandler.UpdateSubscription)
+	api.DELETE("/webhooks/:id", webhookHandler.DeleteSubscription)
+	api.GET("/webhooks/:id/deliveries", webhookHandler.ListDeliveries)
+
+	api.POST("/fee-rules", feeHandler.CreateRule)
+	api.GET("/fee-rules", feeHandler.ListRules)
+	api.GET("/fee-rules/:id", feeHandler.GetRule)
+	api.DELETE("/fee-rules/:id", feeHandler.DeleteRule)
+
+	api.POST("/scheduled-operations", scheduleHandler.CreateSchedule)
+	api.GET("/scheduled-operations", scheduleHandler.ListSchedules)
+	api.GET("/scheduled-operations/:id", scheduleHandler.GetSchedule)
+	api.PUT("/scheduled-operations/:id", scheduleHandler.UpdateSchedule)
+	api.DELETE("/scheduled-operations/:id", scheduleHandler.CancelSchedule)
+	api.GET("/scheduled-operations/:id/runs", scheduleHandler.ListRuns)
 
 	return r
 }
@@ -0,0 +1,208 @@
+// Package schedule runs scheduled and recurring wallet operations.
+package schedule
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+	"wallet_controller/internal/cron"
+	"wallet_controller/internal/entity"
+	"wallet_controller/internal/repository"
+	"wallet_controller/internal/service"
+)
+
+const maxErrorLength = 512
+
+type WorkerConfig struct {
+	Interval    time.Duration
+	BatchSize   int
+	MaxAttempts int
+	RetryBase   time.Duration
+	RetryMax    time.Duration
+	Lease       time.Duration
+}
+
+// Worker makes the operations of due schedules through WalletService.AddOperation.
+type Worker struct {
+	repo          repository.ScheduleRepositoryInterface
+	walletService service.WalletServiceInterface
+	cfg           WorkerConfig
+	now           func() time.Time
+}
+
+func NewWorker(repo repository.ScheduleRepositoryInterface, walletService service.WalletServiceInterface, cfg WorkerConfig) *Worker {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 5 * time.Second
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 50
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.RetryBase <= 0 {
+		cfg.RetryBase = 10 * time.Second
+	}
+	if cfg.RetryMax <= 0 {
+		cfg.RetryMax = 10 * time.Minute
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = time.Minute
+	}
+
+	return &Worker{
+		repo:          repo,
+		walletService: walletService,
+		cfg:           cfg,
+		now:           time.Now,
+	}
+}
+
+// Backoff returns the delay before the next attempt after the given number of failed attempts.
+func (w *Worker) Backoff(attempts int) time.Duration {
+	delay := w.cfg.RetryBase
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= w.cfg.RetryMax {
+			return w.cfg.RetryMax
+		}
+	}
+
+	return delay
+}
+
+func (w *Worker) Run(ctx context.Context) {
+	slog.Info("Starting scheduled operations worker", "interval", w.cfg.Interval)
+
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		w.ProcessDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			slog.Info("Stopping scheduled operations worker")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessDue runs one batch of due schedules and returns how many runs succeeded.
+func (w *Worker) ProcessDue(ctx context.Context) int {
+	schedules, err := w.repo.ClaimDueSchedules(ctx, w.cfg.BatchSize, w.cfg.Lease)
+	if err != nil {
+		slog.Error("failed to claim scheduled operations", "error", err.Error())
+		return 0
+	}
+
+	succeeded := 0
+	for _, scheduled := range schedules {
+		if w.execute(ctx, scheduled) {
+			succeeded++
+		}
+	}
+
+	return succeeded
+}
+
+func (w *Worker) execute(ctx context.Context, scheduled entity.ScheduledOperation) bool {
+	run := entity.ScheduledRun{
+		ScheduleID:   scheduled.ID,
+		ScheduledFor: scheduled.NextRunAt,
+		Attempt:      scheduled.Attempts + 1,
+	}
+
+	result, err := w.walletService.AddOperation(ctx, &entity.OperationRequest{
+		WalletID:      scheduled.WalletID,
+		OperationType: scheduled.OperationType,
+		Amount:        scheduled.Amount,
+		OperationDetails: entity.OperationDetails{
+			Description: scheduled.Description,
+			// The reference makes a run that is retried after a crash fail as a duplicate
+			// instead of being made twice.
+			ExternalReference: RunReference(scheduled),
+			Metadata:          scheduled.Metadata,
+		},
+	})
+	switch {
+	case err == nil:
+		run.Status = entity.RunSucceeded
+		run.OperationID = &result.Operation.ID
+	case errors.Is(err, repository.ErrDuplicateOperation):
+		slog.Warn("scheduled operation run was already made", "schedule_id", scheduled.ID, "scheduled_for", scheduled.NextRunAt)
+		run.Status = entity.RunSucceeded
+	default:
+		run.Status = entity.RunFailed
+		run.Error = err.Error()
+		if len(run.Error) > maxErrorLength {
+			run.Error = run.Error[:maxErrorLength]
+		}
+	}
+
+	if run.Status == entity.RunFailed && IsTransient(err) && run.Attempt < w.cfg.MaxAttempts {
+		slog.Warn("scheduled operation failed, retrying", "schedule_id", scheduled.ID, "attempt", run.Attempt, "error", run.Error)
+		if err = w.repo.RetryRun(ctx, run, w.Backoff(run.Attempt)); err != nil {
+			slog.Error("failed to record scheduled operation run", "schedule_id", scheduled.ID, "error", err.Error())
+		}
+		return false
+	}
+
+	if run.Status == entity.RunFailed {
+		slog.Warn("scheduled operation failed", "schedule_id", scheduled.ID, "attempt", run.Attempt, "error", run.Error)
+	}
+
+	if err = w.repo.FinishRun(ctx, run, w.nextRun(scheduled)); err != nil {
+		slog.Error("failed to record scheduled operation run", "schedule_id", scheduled.ID, "error", err.Error())
+	}
+
+	return run.Status == entity.RunSucceeded
+}
+
+// nextRun returns the run after the current one, nil for one-off schedules. Runs
+// missed while the service was down are collapsed into the current one.
+func (w *Worker) nextRun(scheduled entity.ScheduledOperation) *time.Time {
+	if scheduled.Cron == "" {
+		return nil
+	}
+
+	expr, err := cron.Parse(scheduled.Cron)
+	if err != nil {
+		slog.Error("invalid cron expression of scheduled operation", "schedule_id", scheduled.ID, "error", err.Error())
+		return nil
+	}
+
+	from := scheduled.NextRunAt
+	if now := w.now().UTC(); now.After(from) {
+		from = now
+	}
+
+	next, ok := expr.Next(from)
+	if !ok {
+		return nil
+	}
+
+	return &next
+}
+
+// RunReference is the external reference of the operation made by a run of the schedule.
+func RunReference(scheduled entity.ScheduledOperation) string {
+	return fmt.Sprintf("schedule:%s:%d", scheduled.ID, scheduled.NextRunAt.Unix())
+}
+
+// IsTransient tells whether a failed run may succeed when retried as is. Business
+// errors like insufficient funds are final for the run.
+func IsTransient(err error) bool {
+	switch {
+	case errors.Is(err, repository.ErrInsufficientFunds),
+		errors.Is(err, repository.ErrWalletNotFound),
+		errors.Is(err, repository.ErrWalletFrozen),
+		errors.Is(err, repository.ErrVersionMismatch):
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"wallet_controller/internal/audit"
+	"wallet_controller/internal/entity"
+	"wallet_controller/internal/repository"
+)
+
+// ErrAuditChainBroken means an audit entry was changed, removed or inserted.
+var ErrAuditChainBroken = errors.New("audit chain is broken")
+
+const auditVerifyBatchSize = 1000
+
+type AuditServiceInterface interface {
+	Verify(ctx context.Context) (entity.AuditReport, error)
+}
+
+type AuditService struct {
+	auditRepo repository.AuditRepositoryInterface
+}
+
+func NewAuditService(auditRepo repository.AuditRepositoryInterface) AuditServiceInterface {
+	return &AuditService{
+		auditRepo: auditRepo,
+	}
+}
+
+// Verify recomputes the chain from the first entry up to the head taken when it starts,
+// entries appended meanwhile are left for the next run. It only reads: entries that are
+// written but not chained yet are counted in the report and left to the chainer.
+func (s *AuditService) Verify(ctx context.Context) (entity.AuditReport, error) {
+	head, err := s.auditRepo.GetHead(ctx)
+	if err != nil {
+		return entity.AuditReport{}, err
+	}
+	unchained, err := s.auditRepo.CountPending(ctx)
+	if err != nil {
+		return entity.AuditReport{}, err
+	}
+
+	last := entity.AuditHead{Hash: audit.GenesisHash}
+	for last.Seq < head.Seq {
+		entries, err := s.auditRepo.ListEntries(ctx, last.Seq, auditVerifyBatchSize)
+		if err != nil {
+			return entity.AuditReport{}, err
+		}
+		if len(entries) == 0 {
+			return entity.AuditReport{}, fmt.Errorf("%w: the log ends at entry %d, the head is entry %d", ErrAuditChainBroken, last.Seq, head.Seq)
+		}
+
+		for _, entry := range entries {
+			if entry.Seq != last.Seq+1 {
+				return entity.AuditReport{}, fmt.Errorf("%w: entry %d follows entry %d", ErrAuditChainBroken, entry.Seq, last.Seq)
+			}
+			if entry.Seq > head.Seq {
+				break
+			}
+			if entry.PrevHash != last.Hash {
+				return entity.AuditReport{}, fmt.Errorf("%w: entry %d does not link to entry %d", ErrAuditChainBroken, entry.Seq, last.Seq)
+			}
+			if audit.Hash(entry) != entry.Hash {
+				return entity.AuditReport{}, fmt.Errorf("%w: entry %d was changed", ErrAuditChainBroken, entry.Seq)
+			}
+
+			last = entity.AuditHead{Seq: entry.Seq, Hash: entry.Hash}
+		}
+	}
+
+	if last.Hash != head.Hash {
+		return entity.AuditReport{}, fmt.Errorf("%w: the head does not match entry %d", ErrAuditChainBroken, head.Seq)
+	}
+
+	return entity.AuditReport{Entries: last.Seq, Head: last, Unchained: unchained}, nil
+}
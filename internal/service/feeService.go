@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"wallet_controller/internal/entity"
+	"wallet_controller/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidFeeRule is returned for rules whose fields contradict each other.
+var ErrInvalidFeeRule = errors.New("invalid fee rule")
+
+type FeeServiceInterface interface {
+	CreateRule(ctx context.Context, req *entity.FeeRuleRequest) (*entity.FeeRule, error)
+	GetRule(ctx context.Context, ruleID uuid.UUID) (*entity.FeeRule, error)
+	ListRules(ctx context.Context) ([]entity.FeeRule, error)
+	DeleteRule(ctx context.Context, ruleID uuid.UUID) error
+}
+
+type FeeService struct {
+	feeRepo repository.FeeRepositoryInterface
+}
+
+func NewFeeService(feeRepo repository.FeeRepositoryInterface) FeeServiceInterface {
+	return &FeeService{
+		feeRepo: feeRepo,
+	}
+}
+
+// CreateRule stores a new fee rule. Field types and ranges are checked against the
+// OpenAPI document, here only the combination of fields is.
+func (s *FeeService) CreateRule(ctx context.Context, req *entity.FeeRuleRequest) (*entity.FeeRule, error) {
+	if err := validateFeeRule(req); err != nil {
+		return nil, err
+	}
+
+	rule := &entity.FeeRule{
+		OperationType: req.OperationType,
+		WalletTier:    req.WalletTier,
+		Kind:          req.Kind,
+		FlatAmount:    req.FlatAmount,
+		BasisPoints:   req.BasisPoints,
+		Tiers:         req.Tiers,
+		MinFee:        req.MinFee,
+		MaxFee:        req.MaxFee,
+		FeeWalletID:   req.FeeWalletID,
+	}
+	if err := s.feeRepo.CreateRule(ctx, rule); err != nil {
+		return nil, err
+	}
+
+	return rule, nil
+}
+
+func (s *FeeService) GetRule(ctx context.Context, ruleID uuid.UUID) (*entity.FeeRule, error) {
+	return s.feeRepo.GetRule(ctx, ruleID)
+}
+
+func (s *FeeService) ListRules(ctx context.Context) ([]entity.FeeRule, error) {
+	return s.feeRepo.ListRules(ctx)
+}
+
+func (s *FeeService) DeleteRule(ctx context.Context, ruleID uuid.UUID) error {
+	return s.feeRepo.DeleteRule(ctx, ruleID)
+}
+
+func validateFeeRule(req *entity.FeeRuleRequest) error {
+	switch req.Kind {
+	case entity.FeeFlat:
+		if req.BasisPoints != 0 || len(req.Tiers) != 0 {
+			return fmt.Errorf("%w: FLAT rules take only flat_amount", ErrInvalidFeeRule)
+		}
+	case entity.FeePercentage:
+		if req.BasisPoints == 0 || len(req.Tiers) != 0 {
+			return fmt.Errorf("%w: PERCENTAGE rules need basis_points and no tiers", ErrInvalidFeeRule)
+		}
+	case entity.FeeTiered:
+		if len(req.Tiers) == 0 || req.FlatAmount != 0 || req.BasisPoints != 0 {
+			return fmt.Errorf("%w: TIERED rules take flat_amount and basis_points from tiers", ErrInvalidFeeRule)
+		}
+		seen := make(map[int]bool, len(req.Tiers))
+		for _, tier := range req.Tiers {
+			if seen[tier.FromAmount] {
+				return fmt.Errorf("%w: two tiers start at %d", ErrInvalidFeeRule, tier.FromAmount)
+			}
+			seen[tier.FromAmount] = true
+		}
+	}
+
+	if req.MinFee != nil && req.MaxFee != nil && *req.MinFee > *req.MaxFee {
+		return fmt.Errorf("%w: min_fee is greater than max_fee", ErrInvalidFeeRule)
+	}
+
+	return nil
+}
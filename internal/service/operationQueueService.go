@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"wallet_controller/internal/entity"
+	"wallet_controller/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+type OperationQueueServiceInterface interface {
+	Enqueue(ctx context.Context, operation *entity.OperationRequest) (*entity.QueuedOperation, error)
+	GetQueued(ctx context.Context, operationID uuid.UUID) (*entity.QueuedOperation, error)
+}
+
+type OperationQueueService struct {
+	queueRepo repository.OperationQueueRepositoryInterface
+}
+
+func NewOperationQueueService(queueRepo repository.OperationQueueRepositoryInterface) OperationQueueServiceInterface {
+	return &OperationQueueService{queueRepo: queueRepo}
+}
+
+// Enqueue accepts the operation for asynchronous processing. The amount is in rubles,
+// as for AddOperation.
+func (s *OperationQueueService) Enqueue(ctx context.Context, operation *entity.OperationRequest) (*entity.QueuedOperation, error) {
+	queued, err := s.queueRepo.Enqueue(ctx, operation.WalletID, operation.OperationType, operation.Amount*100, operation.OperationDetails)
+	if err != nil {
+		slog.Error("OperationQueueService Enqueue", "error", err.Error())
+		return nil, err
+	}
+
+	return queued, nil
+}
+
+func (s *OperationQueueService) GetQueued(ctx context.Context, operationID uuid.UUID) (*entity.QueuedOperation, error) {
+	return s.queueRepo.GetQueued(ctx, operationID)
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"wallet_controller/internal/cron"
+	"wallet_controller/internal/entity"
+	"wallet_controller/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidSchedule is returned for a cron expression that does not parse or never
+// matches, and for requests with neither run_at nor cron.
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
+type ScheduleServiceInterface interface {
+	CreateSchedule(ctx context.Context, req *entity.ScheduledOperationRequest) (*entity.ScheduledOperation, error)
+	GetSchedule(ctx context.Context, scheduleID uuid.UUID) (*entity.ScheduledOperation, error)
+	ListSchedules(ctx context.Context, walletID *uuid.UUID) ([]entity.ScheduledOperation, error)
+	UpdateSchedule(ctx context.Context, scheduleID uuid.UUID, req *entity.ScheduledOperationRequest) (*entity.ScheduledOperation, error)
+	CancelSchedule(ctx context.Context, scheduleID uuid.UUID) error
+	ListRuns(ctx context.Context, scheduleID uuid.UUID, limit int) ([]entity.ScheduledRun, error)
+}
+
+type ScheduleService struct {
+	scheduleRepo repository.ScheduleRepositoryInterface
+	now          func() time.Time
+}
+
+func NewScheduleService(scheduleRepo repository.ScheduleRepositoryInterface) ScheduleServiceInterface {
+	return &ScheduleService{
+		scheduleRepo: scheduleRepo,
+		now:          time.Now,
+	}
+}
+
+func (s *ScheduleService) CreateSchedule(ctx context.Context, req *entity.ScheduledOperationRequest) (*entity.ScheduledOperation, error) {
+	scheduled, err := s.newSchedule(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.scheduleRepo.CreateSchedule(ctx, scheduled); err != nil {
+		return nil, err
+	}
+
+	return scheduled, nil
+}
+
+func (s *ScheduleService) GetSchedule(ctx context.Context, scheduleID uuid.UUID) (*entity.ScheduledOperation, error) {
+	return s.scheduleRepo.GetSchedule(ctx, scheduleID)
+}
+
+func (s *ScheduleService) ListSchedules(ctx context.Context, walletID *uuid.UUID) ([]entity.ScheduledOperation, error) {
+	return s.scheduleRepo.ListSchedules(ctx, walletID)
+}
+
+// UpdateSchedule replaces the operation and its timing. A completed, failed or
+// cancelled schedule becomes active again.
+func (s *ScheduleService) UpdateSchedule(ctx context.Context, scheduleID uuid.UUID, req *entity.ScheduledOperationRequest) (*entity.ScheduledOperation, error) {
+	scheduled, err := s.newSchedule(req)
+	if err != nil {
+		return nil, err
+	}
+	scheduled.ID = scheduleID
+
+	if err = s.scheduleRepo.UpdateSchedule(ctx, scheduled); err != nil {
+		return nil, err
+	}
+
+	return scheduled, nil
+}
+
+func (s *ScheduleService) CancelSchedule(ctx context.Context, scheduleID uuid.UUID) error {
+	return s.scheduleRepo.CancelSchedule(ctx, scheduleID)
+}
+
+func (s *ScheduleService) ListRuns(ctx context.Context, scheduleID uuid.UUID, limit int) ([]entity.ScheduledRun, error) {
+	if _, err := s.scheduleRepo.GetSchedule(ctx, scheduleID); err != nil {
+		return nil, err
+	}
+
+	return s.scheduleRepo.ListRuns(ctx, scheduleID, limit)
+}
+
+// newSchedule builds a schedule from the request. The first run is at run_at,
+// or at the first time after now matching the cron expression.
+func (s *ScheduleService) newSchedule(req *entity.ScheduledOperationRequest) (*entity.ScheduledOperation, error) {
+	scheduled := &entity.ScheduledOperation{
+		WalletID:      req.WalletID,
+		OperationType: req.OperationType,
+		Amount:        req.Amount,
+		OperationDetails: entity.OperationDetails{
+			Description: req.Description,
+			Metadata:    req.Metadata,
+		},
+		Cron:   req.Cron,
+		Status: entity.ScheduleActive,
+	}
+
+	switch {
+	case req.Cron != "":
+		expr, err := cron.Parse(req.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidSchedule, err.Error())
+		}
+		next, ok := expr.Next(s.now().UTC())
+		if !ok {
+			return nil, fmt.Errorf("%w: cron expression never matches", ErrInvalidSchedule)
+		}
+		scheduled.NextRunAt = next
+	case req.RunAt == nil:
+		return nil, fmt.Errorf("%w: run_at or cron is required", ErrInvalidSchedule)
+	}
+
+	if req.RunAt != nil {
+		scheduled.NextRunAt = req.RunAt.UTC()
+	}
+
+	return scheduled, nil
+}
@@ -2,15 +2,50 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/google/uuid"
 	"log/slog"
+	"time"
 	"wallet_controller/internal/entity"
 	"wallet_controller/internal/repository"
+	"wallet_controller/internal/statement"
+	"wallet_controller/internal/storage"
 )
 
 type WalletServiceInterface interface {
+	CreateWallet(ctx context.Context, create entity.WalletCreate) (*entity.Wallet, error)
 	GetWallet(ctx context.Context, walletID uuid.UUID) (*entity.Wallet, error)
-	AddOperation(ctx context.Context, operation *entity.OperationRequest) (entity.Wallet, error)
+	UpdateWallet(ctx context.Context, walletID uuid.UUID, update entity.WalletUpdate) (*entity.Wallet, error)
+	FreezeWallet(ctx context.Context, walletID uuid.UUID, freeze entity.Freeze) (*entity.Wallet, error)
+	UnfreezeWallet(ctx context.Context, walletID uuid.UUID) (*entity.Wallet, error)
+	GetFreezeHistory(ctx context.Context, walletID uuid.UUID) ([]entity.FreezeEvent, error)
+	SearchWallets(ctx context.Context, filter entity.WalletFilter) ([]entity.Wallet, error)
+	AddOperation(ctx context.Context, operation *entity.OperationRequest) (entity.OperationResult, error)
+	ReverseOperation(ctx context.Context, operationID uuid.UUID, details entity.OperationDetails) (entity.OperationResult, error)
+	GetOperation(ctx context.Context, operationID uuid.UUID) (*entity.Operation, error)
+	GetBalanceEvents(ctx context.Context, walletID uuid.UUID, afterSeq int64, limit int) ([]entity.BalanceEvent, error)
+	ListOperations(ctx context.Context, filter entity.OperationFilter) ([]entity.Operation, error)
+	GetBalanceAt(ctx context.Context, walletID uuid.UUID, at time.Time) (*entity.WalletBalance, error)
+	WriteStatement(ctx context.Context, walletID uuid.UUID, from, to time.Time, w statement.Writer) error
+	Reconcile(ctx context.Context) ([]entity.Discrepancy, error)
+	SetBalanceShards(ctx context.Context, walletID uuid.UUID, shards int) (*entity.Wallet, error)
+}
+
+// MaxBalanceShards limits the sub-balances of one wallet, every withdrawal locks all of them.
+const MaxBalanceShards = 64
+
+var ErrInvalidBalanceShards = errors.New("balance shards must be between 0 and 64")
+
+var ErrInvalidFreeze = errors.New("invalid freeze")
+
+var freezeReasons = map[string]bool{
+	entity.FreezeReasonFraud:           true,
+	entity.FreezeReasonAML:             true,
+	entity.FreezeReasonSanctions:       true,
+	entity.FreezeReasonCourtOrder:      true,
+	entity.FreezeReasonCustomerRequest: true,
+	entity.FreezeReasonOther:           true,
 }
 
 type WalletService struct {
@@ -23,6 +58,10 @@ func NewWalletService(walletRepo repository.WalletRepositoryInterface) WalletSer
 	}
 }
 
+func (s *WalletService) CreateWallet(ctx context.Context, create entity.WalletCreate) (*entity.Wallet, error) {
+	return s.walletRepo.CreateWallet(ctx, create)
+}
+
 func (s *WalletService) GetWallet(ctx context.Context, walletID uuid.UUID) (*entity.Wallet, error) {
 	wallet, err := s.walletRepo.GetByID(ctx, walletID)
 	if err != nil {
@@ -32,12 +71,158 @@ func (s *WalletService) GetWallet(ctx context.Context, walletID uuid.UUID) (*ent
 	return wallet, nil
 }
 
-func (s *WalletService) AddOperation(ctx context.Context, operation *entity.OperationRequest) (entity.Wallet, error) {
-	Wallet, err := s.walletRepo.AddOperation(ctx, operation.WalletID, operation.OperationType, operation.Amount*100)
+func (s *WalletService) UpdateWallet(ctx context.Context, walletID uuid.UUID, update entity.WalletUpdate) (*entity.Wallet, error) {
+	return s.walletRepo.UpdateWallet(ctx, walletID, update)
+}
+
+// FreezeWallet replaces the freeze of the wallet. A freeze needs a reason and either
+// a mode or an amount to hold, Until has to be in the future.
+func (s *WalletService) FreezeWallet(ctx context.Context, walletID uuid.UUID, freeze entity.Freeze) (*entity.Wallet, error) {
+	switch {
+	case freeze.Mode != "" && freeze.Mode != entity.FreezeDepositOnly && freeze.Mode != entity.FreezeFull:
+		return nil, fmt.Errorf("%w: unknown mode %q", ErrInvalidFreeze, freeze.Mode)
+	case !freezeReasons[freeze.Reason]:
+		return nil, fmt.Errorf("%w: unknown reason %q", ErrInvalidFreeze, freeze.Reason)
+	case freeze.HoldAmount < 0:
+		return nil, fmt.Errorf("%w: hold amount must not be negative", ErrInvalidFreeze)
+	case freeze.Mode == "" && freeze.HoldAmount == 0:
+		return nil, fmt.Errorf("%w: neither a mode nor a hold amount is set", ErrInvalidFreeze)
+	case freeze.Until != nil && !freeze.Until.After(time.Now()):
+		return nil, fmt.Errorf("%w: until must be in the future", ErrInvalidFreeze)
+	}
+
+	if freeze.Until != nil {
+		until := freeze.Until.UTC()
+		freeze.Until = &until
+	}
+
+	wallet, err := s.walletRepo.SetFreeze(ctx, walletID, &freeze)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Wallet frozen", "wallet_id", walletID, "mode", freeze.Mode, "reason", freeze.Reason, "hold_amount", freeze.HoldAmount)
+	return wallet, nil
+}
+
+func (s *WalletService) UnfreezeWallet(ctx context.Context, walletID uuid.UUID) (*entity.Wallet, error) {
+	wallet, err := s.walletRepo.SetFreeze(ctx, walletID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Wallet unfrozen", "wallet_id", walletID)
+	return wallet, nil
+}
+
+func (s *WalletService) GetFreezeHistory(ctx context.Context, walletID uuid.UUID) ([]entity.FreezeEvent, error) {
+	return s.walletRepo.ListFreezeHistory(ctx, walletID)
+}
+
+// SetBalanceShards spreads deposits to the wallet over shards sub-balances, 0 turns it off.
+func (s *WalletService) SetBalanceShards(ctx context.Context, walletID uuid.UUID, shards int) (*entity.Wallet, error) {
+	if shards < 0 || shards > MaxBalanceShards {
+		return nil, ErrInvalidBalanceShards
+	}
+
+	wallet, err := s.walletRepo.SetBalanceShards(ctx, walletID, shards)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Wallet balance shards changed", "wallet_id", walletID, "shards", shards)
+	return wallet, nil
+}
+
+func (s *WalletService) SearchWallets(ctx context.Context, filter entity.WalletFilter) ([]entity.Wallet, error) {
+	return s.walletRepo.SearchWallets(ctx, filter)
+}
+
+func (s *WalletService) AddOperation(ctx context.Context, operation *entity.OperationRequest) (entity.OperationResult, error) {
+	result, err := s.walletRepo.AddOperation(ctx, operation.WalletID, operation.OperationType, operation.Amount*100, operation.OperationDetails, operation.ExpectedVersion)
+	if err != nil {
+		slog.Error("WalletService AddOperation", "error", err.Error())
+		return entity.OperationResult{}, err
+	}
+
+	return result, nil
+}
+
+func (s *WalletService) ReverseOperation(ctx context.Context, operationID uuid.UUID, details entity.OperationDetails) (entity.OperationResult, error) {
+	result, err := s.walletRepo.ReverseOperation(ctx, operationID, details)
 	if err != nil {
-		slog.Error("WalletService", "AddOperation", "err", err.Error(), nil)
-		return entity.Wallet{}, err
+		slog.Error("WalletService ReverseOperation", "error", err.Error())
+		return entity.OperationResult{}, err
 	}
 
-	return Wallet, nil
+	return result, nil
+}
+
+func (s *WalletService) GetOperation(ctx context.Context, operationID uuid.UUID) (*entity.Operation, error) {
+	return s.walletRepo.GetOperation(ctx, operationID)
+}
+
+func (s *WalletService) GetBalanceEvents(ctx context.Context, walletID uuid.UUID, afterSeq int64, limit int) ([]entity.BalanceEvent, error) {
+	return s.walletRepo.GetBalanceEvents(ctx, walletID, afterSeq, limit)
+}
+
+func (s *WalletService) ListOperations(ctx context.Context, filter entity.OperationFilter) ([]entity.Operation, error) {
+	if _, err := s.walletRepo.GetByID(ctx, filter.WalletID); err != nil {
+		return nil, err
+	}
+
+	return s.walletRepo.ListOperations(ctx, filter)
+}
+
+func (s *WalletService) GetBalanceAt(ctx context.Context, walletID uuid.UUID, at time.Time) (*entity.WalletBalance, error) {
+	balance, err := s.walletRepo.GetBalanceAt(ctx, walletID, at)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entity.WalletBalance{
+		WalletID: walletID,
+		Balance:  balance,
+		At:       at,
+	}, nil
+}
+
+// WriteStatement renders operations with from <= created_at < to together with the
+// opening balance, a running balance per row and the closing balance.
+func (s *WalletService) WriteStatement(ctx context.Context, walletID uuid.UUID, from, to time.Time, w statement.Writer) error {
+	// The opening balance and the rows have to come from the same database, a replica
+	// that is behind the primary would not add up to the balance of the other.
+	ctx = storage.WithSingleReader(ctx)
+
+	// Timestamps are stored with microsecond precision, so this excludes
+	// operations made exactly at from from the opening balance.
+	opening, err := s.walletRepo.GetBalanceAt(ctx, walletID, from.Add(-time.Microsecond))
+	if err != nil {
+		return err
+	}
+
+	err = w.Begin(entity.StatementPeriod{
+		WalletID:       walletID,
+		From:           from,
+		To:             to,
+		OpeningBalance: opening,
+	})
+	if err != nil {
+		return err
+	}
+
+	balance := opening
+	err = s.walletRepo.StreamOperations(ctx, walletID, from, to, func(operation entity.Operation) error {
+		balance += operation.SignedAmount()
+		return w.Row(entity.StatementRow{Operation: operation, Balance: balance})
+	})
+	if err != nil {
+		return err
+	}
+
+	return w.End(balance)
+}
+
+func (s *WalletService) Reconcile(ctx context.Context) ([]entity.Discrepancy, error) {
+	return s.walletRepo.Reconcile(ctx)
 }
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"wallet_controller/internal/entity"
+	"wallet_controller/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+type WebhookServiceInterface interface {
+	CreateSubscription(ctx context.Context, req *entity.WebhookSubscriptionRequest) (*entity.WebhookSubscription, error)
+	GetSubscription(ctx context.Context, subscriptionID uuid.UUID) (*entity.WebhookSubscription, error)
+	ListSubscriptions(ctx context.Context) ([]entity.WebhookSubscription, error)
+	UpdateSubscription(ctx context.Context, subscriptionID uuid.UUID, req *entity.WebhookSubscriptionRequest) (*entity.WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, subscriptionID uuid.UUID) error
+	ListDeliveries(ctx context.Context, subscriptionID uuid.UUID, limit int) ([]entity.WebhookDelivery, error)
+}
+
+type WebhookService struct {
+	webhookRepo repository.WebhookRepositoryInterface
+}
+
+func NewWebhookService(webhookRepo repository.WebhookRepositoryInterface) WebhookServiceInterface {
+	return &WebhookService{
+		webhookRepo: webhookRepo,
+	}
+}
+
+// CreateSubscription stores a new subscription. The secret is generated when not provided
+// and is returned only from this call.
+func (s *WebhookService) CreateSubscription(ctx context.Context, req *entity.WebhookSubscriptionRequest) (*entity.WebhookSubscription, error) {
+	secret := req.Secret
+	if secret == "" {
+		generated, err := generateSecret()
+		if err != nil {
+			return nil, err
+		}
+		secret = generated
+	}
+
+	subscription := &entity.WebhookSubscription{
+		URL:        req.URL,
+		Secret:     secret,
+		EventTypes: normalizeEventTypes(req.EventTypes),
+		WalletID:   req.WalletID,
+		Active:     req.Active == nil || *req.Active,
+	}
+	if err := s.webhookRepo.CreateSubscription(ctx, subscription); err != nil {
+		return nil, err
+	}
+
+	return subscription, nil
+}
+
+func (s *WebhookService) GetSubscription(ctx context.Context, subscriptionID uuid.UUID) (*entity.WebhookSubscription, error) {
+	subscription, err := s.webhookRepo.GetSubscription(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	subscription.Secret = ""
+	return subscription, nil
+}
+
+func (s *WebhookService) ListSubscriptions(ctx context.Context) ([]entity.WebhookSubscription, error) {
+	subscriptions, err := s.webhookRepo.ListSubscriptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range subscriptions {
+		subscriptions[i].Secret = ""
+	}
+	return subscriptions, nil
+}
+
+// UpdateSubscription replaces the subscription target and filters.
+// The secret is rotated only when a new one is provided.
+func (s *WebhookService) UpdateSubscription(ctx context.Context, subscriptionID uuid.UUID, req *entity.WebhookSubscriptionRequest) (*entity.WebhookSubscription, error) {
+	subscription, err := s.webhookRepo.GetSubscription(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	subscription.URL = req.URL
+	subscription.EventTypes = normalizeEventTypes(req.EventTypes)
+	subscription.WalletID = req.WalletID
+	if req.Secret != "" {
+		subscription.Secret = req.Secret
+	}
+	if req.Active != nil {
+		subscription.Active = *req.Active
+	}
+
+	if err = s.webhookRepo.UpdateSubscription(ctx, subscription); err != nil {
+		return nil, err
+	}
+
+	subscription.Secret = ""
+	return subscription, nil
+}
+
+func (s *WebhookService) DeleteSubscription(ctx context.Context, subscriptionID uuid.UUID) error {
+	return s.webhookRepo.DeleteSubscription(ctx, subscriptionID)
+}
+
+func (s *WebhookService) ListDeliveries(ctx context.Context, subscriptionID uuid.UUID, limit int) ([]entity.WebhookDelivery, error) {
+	if _, err := s.webhookRepo.GetSubscription(ctx, subscriptionID); err != nil {
+		return nil, err
+	}
+
+	return s.webhookRepo.ListDeliveries(ctx, subscriptionID, limit)
+}
+
+func normalizeEventTypes(eventTypes []string) []string {
+	if eventTypes == nil {
+		return []string{}
+	}
+	return eventTypes
+}
+
+func generateSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,54 @@
+package snapshot
+
+import (
+	"context"
+	"log/slog"
+	"time"
+	"wallet_controller/internal/repository"
+)
+
+type Worker struct {
+	repo          repository.SnapshotRepositoryInterface
+	interval      time.Duration
+	minOperations int
+}
+
+func NewWorker(repo repository.SnapshotRepositoryInterface, interval time.Duration, minOperations int) *Worker {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	if minOperations <= 0 {
+		minOperations = 1
+	}
+
+	return &Worker{
+		repo:          repo,
+		interval:      interval,
+		minOperations: minOperations,
+	}
+}
+
+// Run periodically snapshots balances of busy wallets until ctx is cancelled.
+func (w *Worker) Run(ctx context.Context) {
+	slog.Info("Starting balance snapshot worker", "interval", w.interval, "min_operations", w.minOperations)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Stopping balance snapshot worker")
+			return
+		case <-ticker.C:
+			n, err := w.repo.CreateSnapshots(ctx, w.minOperations)
+			if err != nil {
+				slog.Error("failed to create balance snapshots", "error", err.Error())
+				continue
+			}
+			if n > 0 {
+				slog.Info("Created balance snapshots", "count", n)
+			}
+		}
+	}
+}
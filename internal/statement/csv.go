@@ -0,0 +1,59 @@
+package statement
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+	"wallet_controller/internal/entity"
+)
+
+type csvWriter struct {
+	w      *csv.Writer
+	period entity.StatementPeriod
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) Begin(period entity.StatementPeriod) error {
+	c.period = period
+
+	if err := c.w.Write([]string{"date", "operation_id", "operation_type", "amount", "balance", "description", "external_reference"}); err != nil {
+		return err
+	}
+	return c.w.Write([]string{
+		period.From.Format(time.RFC3339), "", "OPENING_BALANCE", "", strconv.Itoa(period.OpeningBalance), "", "",
+	})
+}
+
+func (c *csvWriter) Row(row entity.StatementRow) error {
+	err := c.w.Write([]string{
+		row.Operation.CreatedAt.Format(time.RFC3339Nano),
+		row.Operation.ID.String(),
+		row.Operation.OperationType,
+		strconv.Itoa(row.Operation.Amount),
+		strconv.Itoa(row.Balance),
+		row.Operation.Description,
+		row.Operation.ExternalReference,
+	})
+	if err != nil {
+		return err
+	}
+
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) End(closingBalance int) error {
+	err := c.w.Write([]string{
+		c.period.To.Format(time.RFC3339), "", "CLOSING_BALANCE", "", strconv.Itoa(closingBalance), "", "",
+	})
+	if err != nil {
+		return err
+	}
+
+	c.w.Flush()
+	return c.w.Error()
+}
@@ -0,0 +1,60 @@
+package statement
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+	"wallet_controller/internal/entity"
+
+	"github.com/google/uuid"
+)
+
+type jsonlBalance struct {
+	Type     string    `json:"type"`
+	WalletID uuid.UUID `json:"wallet_id"`
+	At       time.Time `json:"at"`
+	Balance  int       `json:"balance"`
+}
+
+type jsonlOperation struct {
+	Type string `json:"type"`
+	entity.Operation
+	Balance int `json:"balance"`
+}
+
+type jsonlWriter struct {
+	enc    *json.Encoder
+	period entity.StatementPeriod
+}
+
+func newJSONLWriter(w io.Writer) *jsonlWriter {
+	return &jsonlWriter{enc: json.NewEncoder(w)}
+}
+
+func (j *jsonlWriter) Begin(period entity.StatementPeriod) error {
+	j.period = period
+
+	return j.enc.Encode(jsonlBalance{
+		Type:     "opening_balance",
+		WalletID: period.WalletID,
+		At:       period.From,
+		Balance:  period.OpeningBalance,
+	})
+}
+
+func (j *jsonlWriter) Row(row entity.StatementRow) error {
+	return j.enc.Encode(jsonlOperation{
+		Type:      "operation",
+		Operation: row.Operation,
+		Balance:   row.Balance,
+	})
+}
+
+func (j *jsonlWriter) End(closingBalance int) error {
+	return j.enc.Encode(jsonlBalance{
+		Type:     "closing_balance",
+		WalletID: j.period.WalletID,
+		At:       j.period.To,
+		Balance:  closingBalance,
+	})
+}
@@ -0,0 +1,219 @@
+package statement
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"wallet_controller/internal/entity"
+)
+
+// The PDF is written incrementally: every page is flushed as soon as it is full,
+// and only object offsets and page references are kept until the cross-reference
+// table is written at the end.
+
+const (
+	pdfCatalogID = 1
+	pdfPagesID   = 2
+	pdfFontID    = 3
+
+	pdfPageWidth  = 595
+	pdfPageHeight = 842
+	pdfMargin     = 40
+	pdfFontSize   = 8
+	pdfLeading    = 11
+	pdfPageLines  = 64
+
+	pdfTimeLayout = "2006-01-02 15:04:05"
+)
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type pdfWriter struct {
+	out     *countingWriter
+	offsets map[int]int64
+	nextID  int
+	pageIDs []int
+
+	page      bytes.Buffer
+	pageLines int
+
+	period entity.StatementPeriod
+}
+
+func newPDFWriter(w io.Writer) *pdfWriter {
+	return &pdfWriter{
+		out:     &countingWriter{w: w},
+		offsets: make(map[int]int64),
+		nextID:  pdfFontID + 1,
+	}
+}
+
+func (p *pdfWriter) Begin(period entity.StatementPeriod) error {
+	p.period = period
+
+	if _, err := io.WriteString(p.out, "%PDF-1.4\n%\xE2\xE3\xCF\xD3\n"); err != nil {
+		return err
+	}
+	if err := p.writeObject(pdfCatalogID, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pdfPagesID)); err != nil {
+		return err
+	}
+	err := p.writeObject(pdfFontID, "<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	if err != nil {
+		return err
+	}
+
+	p.startPage()
+	p.line("ACCOUNT STATEMENT")
+	p.line("")
+	p.line("Wallet:          " + period.WalletID.String())
+	p.line(fmt.Sprintf("Period:          %s - %s UTC",
+		period.From.UTC().Format(pdfTimeLayout), period.To.UTC().Format(pdfTimeLayout)))
+	p.line("Opening balance: " + formatAmount(period.OpeningBalance))
+	p.line("")
+	p.columnHeader()
+
+	return nil
+}
+
+func (p *pdfWriter) Row(row entity.StatementRow) error {
+	if p.pageLines >= pdfPageLines {
+		if err := p.flushPage(); err != nil {
+			return err
+		}
+		p.startPage()
+		p.columnHeader()
+	}
+
+	p.line(fmt.Sprintf("%-19s  %-10s  %14s  %14s  %s",
+		row.Operation.CreatedAt.UTC().Format(pdfTimeLayout),
+		row.Operation.OperationType,
+		formatAmount(row.Operation.SignedAmount()),
+		formatAmount(row.Balance),
+		row.Operation.ID.String(),
+	))
+
+	return nil
+}
+
+func (p *pdfWriter) End(closingBalance int) error {
+	if p.pageLines+2 > pdfPageLines {
+		if err := p.flushPage(); err != nil {
+			return err
+		}
+		p.startPage()
+	}
+
+	p.line("")
+	p.line("Closing balance: " + formatAmount(closingBalance))
+
+	if err := p.flushPage(); err != nil {
+		return err
+	}
+
+	kids := make([]string, len(p.pageIDs))
+	for i, id := range p.pageIDs {
+		kids[i] = fmt.Sprintf("%d 0 R", id)
+	}
+	err := p.writeObject(pdfPagesID, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>",
+		strings.Join(kids, " "), len(p.pageIDs)))
+	if err != nil {
+		return err
+	}
+
+	return p.writeTrailer()
+}
+
+func (p *pdfWriter) columnHeader() {
+	p.line(fmt.Sprintf("%-19s  %-10s  %14s  %14s  %s", "Date", "Type", "Amount", "Balance", "Operation"))
+	p.line(strings.Repeat("-", 97))
+}
+
+func (p *pdfWriter) startPage() {
+	p.page.Reset()
+	p.pageLines = 0
+
+	fmt.Fprintf(&p.page, "BT\n/F1 %d Tf\n%d TL\n%d %d Td\n",
+		pdfFontSize, pdfLeading, pdfMargin, pdfPageHeight-pdfMargin)
+}
+
+func (p *pdfWriter) line(text string) {
+	fmt.Fprintf(&p.page, "(%s) Tj T*\n", escapePDFText(text))
+	p.pageLines++
+}
+
+func (p *pdfWriter) flushPage() error {
+	fmt.Fprintf(&p.page, "ET\nBT\n/F1 %d Tf\n%d %d Td\n(Page %d) Tj\nET\n",
+		pdfFontSize, pdfPageWidth-pdfMargin-40, pdfMargin/2, len(p.pageIDs)+1)
+
+	contentID := p.allocate()
+	err := p.writeObject(contentID, fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", p.page.Len(), p.page.String()))
+	if err != nil {
+		return err
+	}
+
+	pageID := p.allocate()
+	err = p.writeObject(pageID, fmt.Sprintf(
+		"<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 %d 0 R >> >> /Contents %d 0 R >>",
+		pdfPagesID, pdfPageWidth, pdfPageHeight, pdfFontID, contentID))
+	if err != nil {
+		return err
+	}
+
+	p.pageIDs = append(p.pageIDs, pageID)
+	return nil
+}
+
+func (p *pdfWriter) allocate() int {
+	id := p.nextID
+	p.nextID++
+	return id
+}
+
+func (p *pdfWriter) writeObject(id int, body string) error {
+	p.offsets[id] = p.out.n
+	_, err := fmt.Fprintf(p.out, "%d 0 obj\n%s\nendobj\n", id, body)
+	return err
+}
+
+func (p *pdfWriter) writeTrailer() error {
+	xrefOffset := p.out.n
+	size := p.nextID
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", size)
+	for id := 1; id < size; id++ {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", p.offsets[id])
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", size, pdfCatalogID, xrefOffset)
+
+	_, err := p.out.Write(buf.Bytes())
+	return err
+}
+
+// escapePDFText makes a string safe for a PDF literal string in the
+// standard Courier font, which only covers Latin characters.
+func escapePDFText(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 32 || r > 126:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -16,4 +16,364 @@ CREATE TABLE IF NOT EXISTS wallet_operations (
 );
 
 CREATE INDEX IF NOT EXISTS idx_wallet_operations_wallet_id_created_at
-    ON wallet_operations (id_wallet, created_at);
\ No newline at end of file
+    ON wallet_operations (id_wallet, created_at);
+
+CREATE TABLE IF NOT EXISTS outbox (
+    id BIGSERIAL PRIMARY KEY,
+    aggregate_id UUID NOT NULL,
+    event_type VARCHAR(64) NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    published_at TIMESTAMP,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_unpublished
+    ON outbox (id) WHERE published_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id_subscription UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    url TEXT NOT NULL,
+    secret VARCHAR(128) NOT NULL,
+    event_types TEXT[] NOT NULL DEFAULT '{}', -- пустой массив = все события
+    id_wallet UUID REFERENCES wallets(id_wallet) ON DELETE CASCADE,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id_delivery UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    id_subscription UUID NOT NULL REFERENCES webhook_subscriptions(id_subscription) ON DELETE CASCADE,
+    event_id BIGINT NOT NULL,
+    event_type VARCHAR(64) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'PENDING' CHECK (status IN ('PENDING', 'SUCCEEDED', 'DEAD')),
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_status_code INT,
+    last_error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (id_subscription, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due
+    ON webhook_deliveries (next_attempt_at) WHERE status = 'PENDING';
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_subscription_created_at
+    ON webhook_deliveries (id_subscription, created_at);
+
+CREATE SEQUENCE IF NOT EXISTS wallet_operations_seq;
+
+ALTER TABLE wallet_operations
+    ADD COLUMN IF NOT EXISTS seq BIGINT NOT NULL DEFAULT nextval('wallet_operations_seq'),
+    ADD COLUMN IF NOT EXISTS balance_after BIGINT;
+
+ALTER SEQUENCE wallet_operations_seq OWNED BY wallet_operations.seq;
+
+CREATE INDEX IF NOT EXISTS idx_wallet_operations_wallet_id_seq
+    ON wallet_operations (id_wallet, seq);
+
+CREATE TABLE IF NOT EXISTS wallet_balance_snapshots (
+    id_wallet UUID NOT NULL REFERENCES wallets(id_wallet) ON DELETE CASCADE,
+    seq BIGINT NOT NULL, -- последняя учтённая операция
+    balance BIGINT NOT NULL,
+    taken_at TIMESTAMP NOT NULL, -- время этой операции
+    PRIMARY KEY (id_wallet, seq)
+);
+
+CREATE INDEX IF NOT EXISTS idx_wallet_balance_snapshots_wallet_id_taken_at
+    ON wallet_balance_snapshots (id_wallet, taken_at);
+
+ALTER TABLE wallets
+    ADD COLUMN IF NOT EXISTS owner_id TEXT,
+    ADD COLUMN IF NOT EXISTS display_name TEXT,
+    ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS external_reference TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_wallets_owner_id
+    ON wallets (owner_id);
+
+CREATE INDEX IF NOT EXISTS idx_wallets_labels
+    ON wallets USING GIN (labels jsonb_path_ops);
+
+ALTER TABLE wallet_operations
+    ADD COLUMN IF NOT EXISTS description TEXT,
+    ADD COLUMN IF NOT EXISTS external_reference TEXT,
+    ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}';
+
+-- повторная операция из внешней системы с той же ссылкой отклоняется
+CREATE UNIQUE INDEX IF NOT EXISTS idx_wallet_operations_wallet_id_external_reference
+    ON wallet_operations (id_wallet, external_reference) WHERE external_reference IS NOT NULL;
+
+ALTER TABLE wallet_operations
+    ADD COLUMN IF NOT EXISTS balance_before BIGINT;
+
+-- версия кошелька растёт при каждом изменении, отдаётся клиентам как ETag
+ALTER TABLE wallets
+    ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+
+-- списание может опустить баланс до min_balance - credit_limit
+ALTER TABLE wallets
+    ADD COLUMN IF NOT EXISTS credit_limit BIGINT NOT NULL DEFAULT 0 CHECK (credit_limit >= 0), -- в копейках
+    ADD COLUMN IF NOT EXISTS min_balance BIGINT NOT NULL DEFAULT 0 CHECK (min_balance >= 0); -- в копейках
+
+CREATE TABLE IF NOT EXISTS fee_rules (
+    id_rule UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    operation_type VARCHAR(16) NOT NULL CHECK (operation_type IN ('DEPOSIT', 'WITHDRAW')),
+    wallet_tier TEXT, -- метка tier кошелька, NULL = любой уровень
+    kind VARCHAR(16) NOT NULL CHECK (kind IN ('FLAT', 'PERCENTAGE', 'TIERED')),
+    flat_amount BIGINT NOT NULL DEFAULT 0 CHECK (flat_amount >= 0), -- в копейках
+    basis_points INT NOT NULL DEFAULT 0 CHECK (basis_points >= 0), -- сотые доли процента
+    tiers JSONB NOT NULL DEFAULT '[]', -- для TIERED: [{from_amount, flat_amount, basis_points}]
+    min_fee BIGINT CHECK (min_fee >= 0),
+    max_fee BIGINT CHECK (max_fee >= 0),
+    id_fee_wallet UUID NOT NULL REFERENCES wallets(id_wallet), -- кошелёк, куда зачисляется комиссия
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- одно правило на тип операции и уровень кошелька
+CREATE UNIQUE INDEX IF NOT EXISTS idx_fee_rules_operation_type_wallet_tier
+    ON fee_rules (operation_type, COALESCE(wallet_tier, ''));
+
+-- комиссия ссылается на операцию, за которую она взята
+ALTER TABLE wallet_operations
+    ADD COLUMN IF NOT EXISTS parent_operation_id UUID REFERENCES wallet_operations(id_operation);
+
+CREATE TABLE IF NOT EXISTS scheduled_operations (
+    id_schedule UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    id_wallet UUID NOT NULL REFERENCES wallets(id_wallet) ON DELETE CASCADE,
+    operation_type VARCHAR(16) NOT NULL CHECK (operation_type IN ('DEPOSIT', 'WITHDRAW')),
+    amount BIGINT NOT NULL CHECK (amount > 0), -- в рублях, как в запросе операции
+    description TEXT,
+    metadata JSONB NOT NULL DEFAULT '{}',
+    cron TEXT, -- NULL = разовая операция
+    next_run_at TIMESTAMP NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'ACTIVE' CHECK (status IN ('ACTIVE', 'COMPLETED', 'FAILED', 'CANCELLED')),
+    attempts INT NOT NULL DEFAULT 0, -- неудачные попытки текущего запуска
+    locked_until TIMESTAMP, -- запуск выполняется воркером или ждёт повтора
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_scheduled_operations_due
+    ON scheduled_operations (next_run_at) WHERE status = 'ACTIVE';
+
+CREATE INDEX IF NOT EXISTS idx_scheduled_operations_wallet_id
+    ON scheduled_operations (id_wallet);
+
+CREATE TABLE IF NOT EXISTS scheduled_operation_runs (
+    id_run UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    id_schedule UUID NOT NULL REFERENCES scheduled_operations(id_schedule) ON DELETE CASCADE,
+    scheduled_for TIMESTAMP NOT NULL,
+    attempt INT NOT NULL,
+    status VARCHAR(16) NOT NULL CHECK (status IN ('SUCCEEDED', 'FAILED')),
+    id_operation UUID REFERENCES wallet_operations(id_operation) ON DELETE SET NULL,
+    error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_scheduled_operation_runs_schedule_created_at
+    ON scheduled_operation_runs (id_schedule, created_at);
+
+-- шардированный баланс: пополнения горячего кошелька распределяются по balance_shards строкам
+-- wallet_balance_shards, полный баланс — wallets.balance плюс сумма шардов
+ALTER TABLE wallets
+    ADD COLUMN IF NOT EXISTS balance_shards INT NOT NULL DEFAULT 0 CHECK (balance_shards >= 0);
+
+CREATE TABLE IF NOT EXISTS wallet_balance_shards (
+    id_wallet UUID NOT NULL REFERENCES wallets(id_wallet) ON DELETE CASCADE,
+    shard INT NOT NULL,
+    balance BIGINT NOT NULL DEFAULT 0, -- в копейках
+    PRIMARY KEY (id_wallet, shard)
+);
+
+-- пополнения шарда с последнего переноса в основной баланс, входят в version кошелька
+ALTER TABLE wallet_balance_shards
+    ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 0;
+
+-- пополнения в шарды получают balance_before/balance_after при переносе шардов
+CREATE INDEX IF NOT EXISTS idx_wallet_operations_unswept
+    ON wallet_operations (id_wallet, seq) WHERE balance_before IS NULL;
+
+-- асинхронные операции: принимаются в очередь и применяются воркером пачками, по одному
+-- обновлению баланса на кошелёк; id_operation становится id операции в wallet_operations
+CREATE TABLE IF NOT EXISTS operation_queue (
+    id_operation UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    seq BIGSERIAL NOT NULL,
+    id_wallet UUID NOT NULL REFERENCES wallets(id_wallet) ON DELETE CASCADE,
+    operation_type VARCHAR(16) NOT NULL CHECK (operation_type IN ('DEPOSIT', 'WITHDRAW')),
+    amount BIGINT NOT NULL CHECK (amount > 0), -- в копейках
+    description TEXT,
+    external_reference TEXT,
+    metadata JSONB NOT NULL DEFAULT '{}',
+    status VARCHAR(16) NOT NULL DEFAULT 'PENDING' CHECK (status IN ('PENDING', 'APPLIED', 'FAILED')),
+    error TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    processed_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_operation_queue_pending
+    ON operation_queue (id_wallet, seq) WHERE status = 'PENDING';
+
+-- кто поставил операцию в очередь: с этим источником она попадает в журнал аудита
+ALTER TABLE operation_queue
+    ADD COLUMN IF NOT EXISTS principal TEXT,
+    ADD COLUMN IF NOT EXISTS claimed_actor TEXT,
+    ADD COLUMN IF NOT EXISTS request_id TEXT,
+    ADD COLUMN IF NOT EXISTS client_ip TEXT;
+
+-- повтор с тем же external_reference отклоняется ещё при постановке в очередь
+CREATE UNIQUE INDEX IF NOT EXISTS idx_operation_queue_wallet_id_external_reference
+    ON operation_queue (id_wallet, external_reference)
+    WHERE external_reference IS NOT NULL AND status <> 'FAILED';
+
+-- журнал аудита: каждое изменение кошельков и их балансов, записи связаны в цепочку хэшей
+-- (hash покрывает все поля записи и prev_hash), изменять и удалять записи нельзя
+CREATE TABLE IF NOT EXISTS audit_log (
+    seq BIGINT PRIMARY KEY,
+    principal TEXT NOT NULL, -- кого знает сам сервис: cli:<пользователь>, scheduler, anonymous для API
+    claimed_actor TEXT, -- со слов клиента (X-Actor), не проверяется
+    request_id TEXT,
+    client_ip TEXT,
+    action VARCHAR(32) NOT NULL,
+    id_wallet UUID NOT NULL, -- без внешнего ключа: запись переживает кошелёк
+    id_operation UUID,
+    balance_before BIGINT, -- в копейках
+    balance_after BIGINT, -- в копейках
+    details JSON, -- JSON, а не JSONB: текст хранится как есть и хэш сходится
+    created_at TIMESTAMP NOT NULL,
+    prev_hash CHAR(64) NOT NULL,
+    hash CHAR(64) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_wallet_id
+    ON audit_log (id_wallet, seq);
+
+-- последняя запись журнала; блокировка строки упорядочивает связывание записей в цепочку
+CREATE TABLE IF NOT EXISTS audit_head (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    seq BIGINT NOT NULL,
+    hash CHAR(64) NOT NULL
+);
+
+INSERT INTO audit_head (id, seq, hash)
+VALUES (TRUE, 0, repeat('0', 64))
+ON CONFLICT (id) DO NOTHING;
+
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+DROP TRIGGER IF EXISTS audit_log_no_truncate ON audit_log;
+CREATE TRIGGER audit_log_no_truncate
+    BEFORE TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
+
+-- записи аудита пишутся сюда в транзакции самого изменения, без блокировки audit_head, чтобы
+-- изменения разных кошельков не ждали друг друга; фоновая задача по порядку id переносит их
+-- в audit_log и связывает в цепочку
+CREATE TABLE IF NOT EXISTS audit_pending (
+    id BIGSERIAL PRIMARY KEY,
+    principal TEXT NOT NULL,
+    claimed_actor TEXT,
+    request_id TEXT,
+    client_ip TEXT,
+    action VARCHAR(32) NOT NULL,
+    id_wallet UUID NOT NULL,
+    id_operation UUID,
+    balance_before BIGINT, -- в копейках
+    balance_after BIGINT, -- в копейках
+    details JSON,
+    created_at TIMESTAMP NOT NULL
+);
+
+-- до связывания записи в audit_pending тоже нельзя менять; удаляет их только связывание,
+-- которое переключается на роль wallet_audit_chainer. Роль общая для кластера, сервис
+-- становится её членом
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'wallet_audit_chainer') THEN
+        CREATE ROLE wallet_audit_chainer NOLOGIN;
+    END IF;
+EXCEPTION
+    WHEN duplicate_object OR unique_violation THEN NULL;
+END;
+$$;
+
+DO $$
+BEGIN
+    IF NOT pg_has_role(current_user, 'wallet_audit_chainer', 'MEMBER') THEN
+        EXECUTE format('GRANT wallet_audit_chainer TO %I', current_user);
+    END IF;
+    EXECUTE format('GRANT USAGE ON SCHEMA %I TO wallet_audit_chainer', current_schema());
+END;
+$$;
+
+GRANT SELECT, DELETE ON audit_pending TO wallet_audit_chainer;
+
+CREATE OR REPLACE FUNCTION audit_pending_protect() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' AND current_user = 'wallet_audit_chainer' THEN
+        RETURN OLD;
+    END IF;
+    RAISE EXCEPTION 'audit_pending entries can only be removed by chaining them';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_pending_protect ON audit_pending;
+CREATE TRIGGER audit_pending_protect
+    BEFORE UPDATE OR DELETE ON audit_pending
+    FOR EACH ROW EXECUTE FUNCTION audit_pending_protect();
+
+DROP TRIGGER IF EXISTS audit_pending_no_truncate ON audit_pending;
+CREATE TRIGGER audit_pending_no_truncate
+    BEFORE TRUNCATE ON audit_pending
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_pending_protect();
+
+-- заморозка с причиной: freeze_mode DEPOSIT_ONLY пропускает только пополнения, FULL — никаких
+-- операций, после frozen_until режим не действует; hold_amount нельзя вывести, пока заморозка
+-- не снята. Заморозка есть, пока задан freeze_reason
+ALTER TABLE wallets
+    ADD COLUMN IF NOT EXISTS freeze_mode VARCHAR(16) CHECK (freeze_mode IN ('DEPOSIT_ONLY', 'FULL')),
+    ADD COLUMN IF NOT EXISTS freeze_reason VARCHAR(32),
+    ADD COLUMN IF NOT EXISTS frozen_until TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS hold_amount BIGINT NOT NULL DEFAULT 0 CHECK (hold_amount >= 0); -- в копейках
+
+-- прежний флаг frozen (он больше не создаётся) становится полной заморозкой без срока
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'wallets' AND column_name = 'frozen'
+    ) THEN
+        UPDATE wallets SET freeze_mode = 'FULL', freeze_reason = 'OTHER' WHERE frozen;
+        ALTER TABLE wallets DROP COLUMN frozen;
+    END IF;
+END $$;
+
+CREATE TABLE IF NOT EXISTS wallet_freeze_history (
+    id_event BIGSERIAL PRIMARY KEY,
+    id_wallet UUID NOT NULL REFERENCES wallets(id_wallet) ON DELETE CASCADE,
+    action VARCHAR(16) NOT NULL CHECK (action IN ('FREEZE', 'UNFREEZE')),
+    freeze_mode VARCHAR(16),
+    freeze_reason VARCHAR(32),
+    frozen_until TIMESTAMP,
+    hold_amount BIGINT NOT NULL DEFAULT 0, -- в копейках
+    principal TEXT NOT NULL, -- кто изменил, как в audit_log
+    claimed_actor TEXT,
+    request_id TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_wallet_freeze_history_wallet_id
+    ON wallet_freeze_history (id_wallet, id_event);
@@ -0,0 +1,244 @@
+package storage
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Querier is the part of a connection pool needed for reads.
+type Querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+}
+
+// replicaLag is the time the replica is behind the primary in seconds, 0 when it has
+// replayed everything it received and NULL when that is unknown. A replica without a
+// streaming WAL receiver has replayed everything it received but is not catching up,
+// so its lag is unknown too.
+const replicaLag = `SELECT CASE
+	WHEN NOT pg_is_in_recovery() THEN 0
+	WHEN NOT EXISTS (SELECT 1 FROM pg_stat_wal_receiver WHERE status = 'streaming') THEN NULL
+	WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())
+END::FLOAT8`
+
+// staleChecks is how many lag checks may be missed before the replica stops being used.
+const staleChecks = 3
+
+type primaryKey struct{}
+
+// WithPrimary returns a context whose reads go to the primary.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+type singleReaderKey struct{}
+
+// singleReader remembers the pool chosen for the first read made with a context.
+type singleReader struct {
+	mu     sync.Mutex
+	reader Querier
+}
+
+// WithSingleReader returns a context whose reads all go to the pool chosen for the first
+// of them, so reads that have to agree with each other do not mix the replica and the primary.
+func WithSingleReader(ctx context.Context) context.Context {
+	return context.WithValue(ctx, singleReaderKey{}, &singleReader{})
+}
+
+type ReadRouterConfig struct {
+	MaxLag        time.Duration
+	CheckInterval time.Duration
+	// Window is how long reads of a client go to the primary after its write.
+	Window time.Duration
+}
+
+// ReadStats describe where reads go.
+type ReadStats struct {
+	LagSeconds   float64 `json:"lag_seconds"`
+	Healthy      bool    `json:"healthy"`
+	ReplicaReads int64   `json:"replica_reads"`
+	PrimaryReads int64   `json:"primary_reads"`
+}
+
+// ReadRouter sends reads to the replica while its lag, checked every CheckInterval, is
+// within MaxLag, and to the primary otherwise, when the context asks for it or for a
+// while after a write of the same client.
+type ReadRouter struct {
+	primary Querier
+	replica Querier
+	cfg     ReadRouterConfig
+
+	lag       atomic.Int64
+	checkedAt atomic.Int64
+	healthy   atomic.Bool
+
+	replicaReads atomic.Int64
+	primaryReads atomic.Int64
+
+	mu     sync.Mutex
+	writes map[string]time.Time
+}
+
+func NewReadRouter(primary, replica Querier, cfg ReadRouterConfig) *ReadRouter {
+	if cfg.MaxLag <= 0 {
+		cfg.MaxLag = time.Second
+	}
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = time.Second
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = 5 * time.Second
+	}
+
+	return &ReadRouter{
+		primary: primary,
+		replica: replica,
+		cfg:     cfg,
+		writes:  make(map[string]time.Time),
+	}
+}
+
+// Reader returns the pool the read should go to.
+func (r *ReadRouter) Reader(ctx context.Context) Querier {
+	single, _ := ctx.Value(singleReaderKey{}).(*singleReader)
+	if single == nil {
+		return r.choose(ctx)
+	}
+
+	single.mu.Lock()
+	defer single.mu.Unlock()
+	switch {
+	case single.reader == nil:
+		single.reader = r.choose(ctx)
+	case single.reader == r.replica:
+		r.replicaReads.Add(1)
+	default:
+		r.primaryReads.Add(1)
+	}
+	return single.reader
+}
+
+func (r *ReadRouter) choose(ctx context.Context) Querier {
+	if primary, _ := ctx.Value(primaryKey{}).(bool); primary || !r.replicaUsable() {
+		r.primaryReads.Add(1)
+		return r.primary
+	}
+
+	r.replicaReads.Add(1)
+	return r.replica
+}
+
+// replicaUsable is false until the first lag check and when the checks stopped coming,
+// as the replica may have fallen behind since.
+func (r *ReadRouter) replicaUsable() bool {
+	if r.replica == nil || !r.healthy.Load() {
+		return false
+	}
+
+	checkedAt := time.Unix(0, r.checkedAt.Load())
+	return time.Since(checkedAt) <= staleChecks*r.cfg.CheckInterval
+}
+
+// MaxStaleness bounds how far behind the primary a read sent to the replica can be: it
+// lagged at most MaxLag at the last check, and that check is at most staleChecks
+// intervals old. A nil router reads the primary only, so its reads are never stale.
+func (r *ReadRouter) MaxStaleness() time.Duration {
+	if r == nil {
+		return 0
+	}
+	return r.cfg.MaxLag + staleChecks*r.cfg.CheckInterval
+}
+
+// Run checks the replica lag until ctx is cancelled.
+func (r *ReadRouter) Run(ctx context.Context) {
+	if r.replica == nil {
+		return
+	}
+	slog.Info("Starting replica lag checks", "interval", r.cfg.CheckInterval, "max_lag", r.cfg.MaxLag)
+
+	ticker := time.NewTicker(r.cfg.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		r.CheckLag(ctx)
+		r.forgetWrites()
+
+		select {
+		case <-ctx.Done():
+			slog.Info("Stopping replica lag checks")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckLag measures the replica lag, reads stay on the primary while it exceeds MaxLag
+// or can not be measured.
+func (r *ReadRouter) CheckLag(ctx context.Context) {
+	var seconds *float64
+	err := r.replica.QueryRow(ctx, replicaLag).Scan(&seconds)
+
+	healthy := false
+	switch {
+	case err != nil:
+		slog.Warn("failed to check replica lag", "error", err.Error())
+	case seconds == nil:
+		slog.Warn("replica lag is unknown or its WAL receiver is not streaming")
+	default:
+		lag := time.Duration(*seconds * float64(time.Second))
+		r.lag.Store(int64(lag))
+		healthy = lag <= r.cfg.MaxLag
+		if !healthy {
+			slog.Warn("replica lags behind, reading from primary", "lag", lag, "max_lag", r.cfg.MaxLag)
+		}
+	}
+
+	if healthy && !r.healthy.Load() {
+		slog.Info("reading from replica")
+	}
+	r.healthy.Store(healthy)
+	r.checkedAt.Store(time.Now().UnixNano())
+}
+
+// RecordWrite sends the reads of the client to the primary for Window.
+func (r *ReadRouter) RecordWrite(client string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writes[client] = time.Now().Add(r.cfg.Window)
+}
+
+// WroteRecently tells whether the client wrote less than Window ago.
+func (r *ReadRouter) WroteRecently(client string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	until, ok := r.writes[client]
+	return ok && time.Now().Before(until)
+}
+
+func (r *ReadRouter) forgetWrites() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for client, until := range r.writes {
+		if now.After(until) {
+			delete(r.writes, client)
+		}
+	}
+}
+
+func (r *ReadRouter) Stats() ReadStats {
+	return ReadStats{
+		LagSeconds:   time.Duration(r.lag.Load()).Seconds(),
+		Healthy:      r.replicaUsable(),
+		ReplicaReads: r.replicaReads.Load(),
+		PrimaryReads: r.primaryReads.Load(),
+	}
+}
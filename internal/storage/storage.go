@@ -10,6 +10,8 @@ import (
 	"wallet_controller/config"
 )
 
+// NewConnection connects to the primary and applies the schema. The demo data is not
+// inserted here, the server seeds it with DataInsert, so admin commands write nothing.
 func NewConnection(ctx context.Context, cfg *config.Config) *pgxpool.Pool {
 	env := cfg.Env
 
@@ -21,6 +23,32 @@ func NewConnection(ctx context.Context, cfg *config.Config) *pgxpool.Pool {
 		env.DbName,
 	)
 
+	conn := newPool(dsn)
+
+	if err := Migrate(conn); err != nil {
+		slog.Error("Unable to migrate database:", err.Error(), nil)
+		panic(err)
+	}
+	slog.Info("Connected to database")
+
+	return conn
+}
+
+// NewReplicaConnection connects to the read replica, nil when DB_REPLICA_DSN is not set.
+// The replica gets its schema from the primary, so nothing is migrated.
+func NewReplicaConnection(ctx context.Context, cfg *config.Config) *pgxpool.Pool {
+	if cfg.Env.DbReplicaDSN == "" {
+		return nil
+	}
+
+	conn := newPool(cfg.Env.DbReplicaDSN)
+
+	slog.Info("Connected to read replica")
+
+	return conn
+}
+
+func newPool(dsn string) *pgxpool.Pool {
 	conConfig, err := pgxpool.ParseConfig(dsn)
 	if err != nil {
 		slog.Error("Unable to parse connection string")
@@ -38,16 +66,5 @@ func NewConnection(ctx context.Context, cfg *config.Config) *pgxpool.Pool {
 		panic(err)
 	}
 
-	if err = Migrate(conn); err != nil {
-		slog.Error("Unable to migrate database:", err.Error(), nil)
-		panic(err)
-	}
-	if err = DataInsert(conn); err != nil {
-		slog.Error("Unable to migrate data:", err.Error(), nil)
-		panic(err)
-	}
-
-	slog.Info("Connected to database")
-
 	return conn
 }
@@ -0,0 +1,22 @@
+package webhook
+
+import (
+	"context"
+	"wallet_controller/internal/entity"
+	"wallet_controller/internal/repository"
+)
+
+// Dispatcher is an outbox publisher that fans every event out into
+// pending deliveries for the matching webhook subscriptions.
+type Dispatcher struct {
+	repo repository.WebhookRepositoryInterface
+}
+
+func NewDispatcher(repo repository.WebhookRepositoryInterface) *Dispatcher {
+	return &Dispatcher{repo: repo}
+}
+
+func (d *Dispatcher) Publish(ctx context.Context, event entity.Event) error {
+	_, err := d.repo.EnqueueDeliveries(ctx, event)
+	return err
+}
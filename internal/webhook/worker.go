@@ -0,0 +1,169 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+	"wallet_controller/internal/entity"
+	"wallet_controller/internal/repository"
+)
+
+const maxErrorLength = 512
+
+type WorkerConfig struct {
+	Interval    time.Duration
+	BatchSize   int
+	MaxAttempts int
+	RetryBase   time.Duration
+	RetryMax    time.Duration
+	Timeout     time.Duration
+}
+
+type Worker struct {
+	repo   repository.WebhookRepositoryInterface
+	client *http.Client
+	cfg    WorkerConfig
+	now    func() time.Time
+}
+
+func NewWorker(repo repository.WebhookRepositoryInterface, cfg WorkerConfig) *Worker {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 50
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 8
+	}
+	if cfg.RetryBase <= 0 {
+		cfg.RetryBase = 5 * time.Second
+	}
+	if cfg.RetryMax <= 0 {
+		cfg.RetryMax = time.Hour
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	return &Worker{
+		repo:   repo,
+		client: &http.Client{Timeout: cfg.Timeout},
+		cfg:    cfg,
+		now:    time.Now,
+	}
+}
+
+// Backoff returns the delay before the next attempt after the given number of failed attempts.
+func (w *Worker) Backoff(attempts int) time.Duration {
+	delay := w.cfg.RetryBase
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= w.cfg.RetryMax {
+			return w.cfg.RetryMax
+		}
+	}
+
+	return delay
+}
+
+func (w *Worker) Run(ctx context.Context) {
+	slog.Info("Starting webhook worker", "interval", w.cfg.Interval)
+
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		w.ProcessDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			slog.Info("Stopping webhook worker")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProcessDue sends one batch of due deliveries and returns how many succeeded.
+func (w *Worker) ProcessDue(ctx context.Context) int {
+	// The batch is sent one delivery after another, so the lease covers the HTTP timeout
+	// of every delivery in it and one more as a margin, and no delivery is claimed twice.
+	tasks, err := w.repo.ClaimDueDeliveries(ctx, w.cfg.BatchSize, time.Duration(w.cfg.BatchSize+1)*w.cfg.Timeout)
+	if err != nil {
+		slog.Error("failed to claim webhook deliveries", "error", err.Error())
+		return 0
+	}
+
+	delivered := 0
+	for _, task := range tasks {
+		if w.deliver(ctx, task) {
+			delivered++
+		}
+	}
+
+	return delivered
+}
+
+func (w *Worker) deliver(ctx context.Context, task entity.WebhookDeliveryTask) bool {
+	delivery := task.Delivery
+
+	statusCode, err := w.send(ctx, task)
+	if err == nil {
+		if markErr := w.repo.MarkDelivered(ctx, delivery.ID, statusCode); markErr != nil {
+			slog.Error("failed to record webhook delivery", "id", delivery.ID, "error", markErr.Error())
+		}
+		return true
+	}
+
+	reason := err.Error()
+	if len(reason) > maxErrorLength {
+		reason = reason[:maxErrorLength]
+	}
+
+	attempts := delivery.Attempts + 1
+	if attempts >= w.cfg.MaxAttempts {
+		slog.Warn("webhook delivery moved to dead letter", "id", delivery.ID, "attempts", attempts, "error", reason)
+		err = w.repo.MarkDead(ctx, delivery.ID, statusCode, reason)
+	} else {
+		err = w.repo.MarkFailed(ctx, delivery.ID, statusCode, reason, w.Backoff(attempts))
+	}
+	if err != nil {
+		slog.Error("failed to record webhook failure", "id", delivery.ID, "error", err.Error())
+	}
+
+	return false
+}
+
+func (w *Worker) send(ctx context.Context, task entity.WebhookDeliveryTask) (int, error) {
+	body := []byte(task.Delivery.Payload)
+	timestamp := w.now().Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, task.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderDeliveryID, task.Delivery.ID.String())
+	req.Header.Set(HeaderEventType, task.Delivery.EventType)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(task.Secret, timestamp, body))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded with status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
@@ -2,18 +2,48 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"os"
 	"os/signal"
+	"os/user"
 	"syscall"
 	"wallet_controller/cmd/app"
+	"wallet_controller/cmd/cli"
+	"wallet_controller/cmd/loadgen"
+	"wallet_controller/config"
+	"wallet_controller/internal/audit"
+	"wallet_controller/internal/repository"
+	"wallet_controller/internal/service"
+	"wallet_controller/internal/storage"
+
+	"github.com/google/uuid"
 )
 
 func main() {
-	slog.Info("Starting main")
-
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	args := os.Args[1:]
+	if len(args) == 0 || args[0] == "serve" {
+		serve(ctx)
+		return
+	}
+
+	if err := runCommand(ctx, args); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err.Error())
+		if errors.Is(err, cli.ErrUsage) {
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+func serve(ctx context.Context) {
+	slog.Info("Starting main")
+
 	errChan := make(chan error)
 
 	go func() {
@@ -27,6 +57,10 @@ func main() {
 	select {
 	case <-ctx.Done():
 		slog.Info("Stopping main")
+		// Wait for the application to finish its graceful shutdown.
+		if err := <-errChan; err != nil {
+			slog.Error("Error during application shutdown", "error", err.Error())
+		}
 
 	case err := <-errChan:
 		if err != nil {
@@ -38,3 +72,78 @@ func main() {
 
 	slog.Info("Shutdown completed")
 }
+
+// runCommand runs an admin command against the database of the configured environment.
+func runCommand(ctx context.Context, args []string) error {
+	switch args[0] {
+	case "help", "-h", "--help":
+		fmt.Print(cli.Usage)
+		return nil
+	}
+
+	if args[0] == "loadgen" {
+		return runLoadgen(ctx, args[1:])
+	}
+
+	if args[0] != "migrate" && !cli.Known(args[0]) {
+		fmt.Fprint(os.Stderr, cli.Usage)
+		return fmt.Errorf("%w: unknown command %q", cli.ErrUsage, args[0])
+	}
+
+	cfg := config.GetConfig()
+
+	// NewConnection applies the schema before returning, the demo data is only seeded by serve.
+	cfg.Client = storage.NewConnection(ctx, cfg)
+	defer cfg.Client.Close()
+
+	if args[0] == "migrate" {
+		slog.Info("Database schema is up to date")
+		return nil
+	}
+
+	walletService := service.NewWalletService(repository.NewWalletRepository(cfg.Client))
+
+	ctx = audit.WithOrigin(ctx, audit.Origin{Principal: cliPrincipal(), RequestID: uuid.NewString()})
+
+	return cli.New(walletService, service.NewAuditService(repository.NewAuditRepository(cfg.Client)), os.Stdout, os.Stderr).Run(ctx, args)
+}
+
+// cliPrincipal names the operating system user running an admin command for the audit log.
+func cliPrincipal() string {
+	if current, err := user.Current(); err == nil {
+		return "cli:" + current.Username
+	}
+	return "cli"
+}
+
+// runLoadgen benchmarks a running service. The database is only needed to create wallets.
+func runLoadgen(ctx context.Context, args []string) error {
+	loadgenCfg, err := loadgen.ParseFlags(args, os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	var creator loadgen.WalletCreator
+	if len(loadgenCfg.Wallets) == 0 {
+		cfg := config.GetConfig()
+		cfg.Client = storage.NewConnection(ctx, cfg)
+		defer cfg.Client.Close()
+
+		creator = service.NewWalletService(repository.NewWalletRepository(cfg.Client))
+		ctx = audit.WithOrigin(ctx, audit.Origin{Principal: "loadgen", RequestID: uuid.NewString()})
+	}
+
+	report, err := loadgen.New(loadgenCfg, creator).Run(ctx)
+	if err != nil {
+		return err
+	}
+
+	if loadgenCfg.JSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	report.WriteText(os.Stdout)
+
+	return nil
+}
@@ -0,0 +1,506 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+	"wallet_controller/cmd/cli"
+	"wallet_controller/internal/audit"
+	"wallet_controller/internal/entity"
+	"wallet_controller/internal/handler"
+	"wallet_controller/internal/repository"
+	"wallet_controller/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryAuditLog appends and chains entries like AuditRepository does and lets tests
+// tamper with them. The transaction passed to Append is ignored.
+type memoryAuditLog struct {
+	mu      sync.Mutex
+	pending []entity.AuditEntry
+	entries []entity.AuditEntry
+	head    entity.AuditHead
+}
+
+func newMemoryAuditLog() *memoryAuditLog {
+	return &memoryAuditLog{head: entity.AuditHead{Hash: audit.GenesisHash}}
+}
+
+func (l *memoryAuditLog) Append(ctx context.Context, tx pgx.Tx, entry entity.AuditEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	origin := audit.OriginFrom(ctx)
+	entry.Principal, entry.ClaimedActor = origin.Principal, origin.ClaimedActor
+	entry.RequestID, entry.ClientIP = origin.RequestID, origin.ClientIP
+	entry.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+
+	l.pending = append(l.pending, entry)
+	return nil
+}
+
+func (l *memoryAuditLog) Chain(ctx context.Context, limit int) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := min(limit, len(l.pending))
+	for _, entry := range l.pending[:n] {
+		entry.Seq = l.head.Seq + 1
+		entry.PrevHash = l.head.Hash
+		entry.Hash = audit.Hash(entry)
+
+		l.entries = append(l.entries, entry)
+		l.head = entity.AuditHead{Seq: entry.Seq, Hash: entry.Hash}
+	}
+	l.pending = l.pending[n:]
+	return n, nil
+}
+
+func (l *memoryAuditLog) ListEntries(ctx context.Context, afterSeq int64, limit int) ([]entity.AuditEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var entries []entity.AuditEntry
+	for _, entry := range l.entries {
+		if entry.Seq > afterSeq && len(entries) < limit {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (l *memoryAuditLog) GetHead(ctx context.Context) (entity.AuditHead, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.head, nil
+}
+
+func (l *memoryAuditLog) CountPending(ctx context.Context) (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int64(len(l.pending)), nil
+}
+
+// appendAuditEntries appends count deposits made by admin in tx, they are not chained yet.
+func appendAuditEntries(t *testing.T, log repository.AuditRepositoryInterface, tx pgx.Tx, count int) {
+	t.Helper()
+
+	ctx := audit.WithOrigin(context.Background(), audit.Origin{Principal: "cli:admin"})
+	walletID := uuid.New()
+	for i := range count {
+		before, after := i*100, (i+1)*100
+		err := log.Append(ctx, tx, entity.AuditEntry{
+			Action:        entity.AuditOperationAdded,
+			WalletID:      walletID,
+			BalanceBefore: &before,
+			BalanceAfter:  &after,
+			Details:       json.RawMessage(`{"operation_type":"DEPOSIT","amount":100}`),
+		})
+		require.NoError(t, err)
+	}
+}
+
+// newChainedAuditLog returns a log of count chained entries.
+func newChainedAuditLog(t *testing.T, count int) *memoryAuditLog {
+	t.Helper()
+
+	log := newMemoryAuditLog()
+	appendAuditEntries(t, log, nil, count)
+	_, err := log.Chain(context.Background(), count)
+	require.NoError(t, err)
+	return log
+}
+
+func TestAuditHash(t *testing.T) {
+	balance := 100
+	entry := entity.AuditEntry{
+		Seq:          1,
+		Principal:    "cli:admin",
+		Action:       entity.AuditWalletCreated,
+		WalletID:     uuid.New(),
+		BalanceAfter: &balance,
+		CreatedAt:    time.Now(),
+		PrevHash:     audit.GenesisHash,
+	}
+
+	hash := audit.Hash(entry)
+	assert.Len(t, hash, 64)
+	assert.Equal(t, hash, audit.Hash(entry))
+
+	// the hash covers what the database keeps, microseconds in UTC
+	moved := entry
+	moved.CreatedAt = entry.CreatedAt.In(time.FixedZone("MSK", 3*60*60)).Truncate(time.Microsecond)
+	assert.Equal(t, hash, audit.Hash(moved))
+
+	changed := 200
+	tampered := entry
+	tampered.BalanceAfter = &changed
+	assert.NotEqual(t, hash, audit.Hash(tampered))
+
+	tampered = entry
+	tampered.Principal = "someone else"
+	assert.NotEqual(t, hash, audit.Hash(tampered))
+
+	tampered = entry
+	tampered.ClaimedActor = "someone else"
+	assert.NotEqual(t, hash, audit.Hash(tampered))
+}
+
+func TestAuditService_Verify(t *testing.T) {
+	ctx := context.Background()
+
+	log := newChainedAuditLog(t, 5)
+
+	report, err := service.NewAuditService(log).Verify(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), report.Entries)
+	assert.Equal(t, log.head, report.Head)
+
+	// entries written since the last chaining are counted and left to the chainer
+	appendAuditEntries(t, log, nil, 2)
+	report, err = service.NewAuditService(log).Verify(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), report.Entries)
+	assert.Equal(t, int64(2), report.Unchained)
+	assert.Len(t, log.pending, 2)
+
+	report, err = service.NewAuditService(newMemoryAuditLog()).Verify(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, entity.AuditReport{Head: entity.AuditHead{Hash: audit.GenesisHash}}, report)
+}
+
+func TestAuditService_VerifyDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name    string
+		tamper  func(log *memoryAuditLog)
+		message string
+	}{
+		{
+			name: "changed balance",
+			tamper: func(log *memoryAuditLog) {
+				balance := 1_000_000
+				log.entries[2].BalanceAfter = &balance
+			},
+			message: "entry 3 was changed",
+		},
+		{
+			name: "changed entry with recomputed hash",
+			tamper: func(log *memoryAuditLog) {
+				log.entries[2].ClaimedActor = "someone else"
+				log.entries[2].Hash = audit.Hash(log.entries[2])
+			},
+			message: "entry 4 does not link to entry 3",
+		},
+		{
+			name: "removed entry",
+			tamper: func(log *memoryAuditLog) {
+				log.entries = append(log.entries[:1], log.entries[2:]...)
+			},
+			message: "entry 3 follows entry 1",
+		},
+		{
+			name: "cut off tail",
+			tamper: func(log *memoryAuditLog) {
+				log.entries = log.entries[:3]
+			},
+			message: "the log ends at entry 3, the head is entry 5",
+		},
+		{
+			name: "moved head",
+			tamper: func(log *memoryAuditLog) {
+				log.entries = log.entries[:3]
+				log.head.Seq = 3
+			},
+			message: "the head does not match entry 3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log := newChainedAuditLog(t, 5)
+			tt.tamper(log)
+
+			_, err := service.NewAuditService(log).Verify(context.Background())
+			require.ErrorIs(t, err, service.ErrAuditChainBroken)
+			assert.Contains(t, err.Error(), tt.message)
+		})
+	}
+}
+
+func TestAuditChainer(t *testing.T) {
+	ctx := context.Background()
+
+	log := newMemoryAuditLog()
+	appendAuditEntries(t, log, nil, 5)
+
+	// batches are taken until the log runs dry
+	require.NoError(t, audit.NewChainer(log, time.Second, 2).ChainAll(ctx))
+	assert.Empty(t, log.pending)
+	require.Len(t, log.entries, 5)
+	for i, entry := range log.entries {
+		assert.Equal(t, int64(i+1), entry.Seq)
+		assert.Equal(t, "cli:admin", entry.Principal)
+	}
+
+	report, err := service.NewAuditService(log).Verify(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), report.Entries)
+}
+
+func TestAuditOrigin(t *testing.T) {
+	var origin audit.Origin
+
+	router := setupGinRouter()
+	router.Use(handler.AuditOrigin())
+	router.POST("/change", func(c *gin.Context) {
+		origin = audit.OriginFrom(c.Request.Context())
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/change", nil)
+	req.Header.Set("X-Actor", "support")
+	req.Header.Set("X-Request-ID", "req-1")
+	req.RemoteAddr = "10.0.0.7:52000"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// the service does not know the caller, the actor header is only its claim
+	assert.Equal(t, audit.Origin{
+		Principal:    audit.AnonymousPrincipal,
+		ClaimedActor: "support",
+		RequestID:    "req-1",
+		ClientIP:     "10.0.0.7",
+	}, origin)
+	assert.Equal(t, "req-1", w.Header().Get("X-Request-ID"))
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/change", nil))
+
+	assert.Equal(t, audit.AnonymousPrincipal, origin.Principal)
+	assert.Empty(t, origin.ClaimedActor)
+	assert.NotEmpty(t, origin.RequestID)
+	assert.Equal(t, origin.RequestID, w.Header().Get("X-Request-ID"))
+
+	assert.Equal(t, audit.SystemPrincipal, audit.OriginFrom(context.Background()).Principal)
+}
+
+func TestCLIAuditVerify(t *testing.T) {
+	log := newChainedAuditLog(t, 3)
+	auditService := service.NewAuditService(log)
+
+	var stdout bytes.Buffer
+	err := cli.New(nil, auditService, &stdout, io.Discard).Run(context.Background(), []string{"audit", "verify"})
+	require.NoError(t, err)
+
+	var report entity.AuditReport
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &report))
+	assert.Equal(t, int64(3), report.Entries)
+	assert.Equal(t, log.head, report.Head)
+
+	log.entries[1].Action = entity.AuditWalletUnfrozen
+	err = cli.New(nil, auditService, io.Discard, io.Discard).Run(context.Background(), []string{"audit", "verify"})
+	require.ErrorIs(t, err, service.ErrAuditChainBroken)
+	assert.False(t, errors.Is(err, cli.ErrUsage))
+}
+
+func TestAuditRepository_AppendAndVerify(t *testing.T) {
+	pool := setupTestDB(t)
+	defer teardownTestDB(t, pool)
+	ctx := context.Background()
+
+	auditRepo := repository.NewAuditRepository(pool)
+
+	tx, err := pool.Begin(ctx)
+	require.NoError(t, err)
+	appendAuditEntries(t, auditRepo, tx, 3)
+	err = auditRepo.Append(audit.WithOrigin(ctx, audit.Origin{Principal: "cli:root"}), tx, entity.AuditEntry{
+		Action:   entity.AuditWalletUpdated,
+		WalletID: uuid.New(),
+		Details:  json.RawMessage(`{"owner_id": "user-2", "display_name": null}`),
+	})
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit(ctx))
+
+	// entries of a rolled back change are gone with it
+	tx, err = pool.Begin(ctx)
+	require.NoError(t, err)
+	appendAuditEntries(t, auditRepo, tx, 2)
+	require.NoError(t, tx.Rollback(ctx))
+
+	// appending does not touch the chain
+	head, err := auditRepo.GetHead(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), head.Seq)
+
+	// entries waiting to be chained can only be removed by chaining them
+	_, err = pool.Exec(ctx, `UPDATE audit_pending SET balance_after = 0`)
+	assert.ErrorContains(t, err, "only be removed by chaining")
+	_, err = pool.Exec(ctx, `DELETE FROM audit_pending`)
+	assert.ErrorContains(t, err, "only be removed by chaining")
+	_, err = pool.Exec(ctx, `TRUNCATE audit_pending`)
+	assert.ErrorContains(t, err, "only be removed by chaining")
+
+	n, err := auditRepo.Chain(ctx, 3)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	report, err := service.NewAuditService(auditRepo).Verify(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), report.Entries)
+	assert.Equal(t, int64(1), report.Unchained)
+
+	n, err = auditRepo.Chain(ctx, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	entries, err := auditRepo.ListEntries(ctx, 3, 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "cli:root", entries[0].Principal)
+	assert.Empty(t, entries[0].ClaimedActor)
+	assert.Equal(t, `{"owner_id": "user-2", "display_name": null}`, string(entries[0].Details))
+	assert.Empty(t, entries[0].RequestID)
+	assert.Nil(t, entries[0].BalanceBefore)
+
+	// entries can only be added
+	_, err = pool.Exec(ctx, `UPDATE audit_log SET balance_after = 0 WHERE seq = 2`)
+	assert.ErrorContains(t, err, "append-only")
+	_, err = pool.Exec(ctx, `DELETE FROM audit_log WHERE seq = 2`)
+	assert.ErrorContains(t, err, "append-only")
+	_, err = pool.Exec(ctx, `TRUNCATE audit_log`)
+	assert.ErrorContains(t, err, "append-only")
+
+	// with the trigger out of the way the chain still tells
+	_, err = pool.Exec(ctx, `ALTER TABLE audit_log DISABLE TRIGGER audit_log_append_only`)
+	require.NoError(t, err)
+	_, err = pool.Exec(ctx, `UPDATE audit_log SET balance_after = 0 WHERE seq = 2`)
+	require.NoError(t, err)
+
+	_, err = service.NewAuditService(auditRepo).Verify(ctx)
+	require.ErrorIs(t, err, service.ErrAuditChainBroken)
+	assert.Contains(t, err.Error(), "entry 2 was changed")
+}
+
+func TestWalletRepository_AuditsChanges(t *testing.T) {
+	pool := setupTestDB(t)
+	defer teardownTestDB(t, pool)
+
+	ctx := audit.WithOrigin(context.Background(), audit.Origin{Principal: audit.AnonymousPrincipal, ClaimedActor: "support", RequestID: "req-1", ClientIP: "10.0.0.7"})
+	repo := repository.NewWalletRepository(pool)
+	auditRepo := repository.NewAuditRepository(pool)
+
+	wallet, err := repo.CreateWallet(ctx, entity.WalletCreate{})
+	require.NoError(t, err)
+	feeWallet, err := repo.CreateWallet(ctx, entity.WalletCreate{})
+	require.NoError(t, err)
+	require.NoError(t, repository.NewFeeRepository(pool).CreateRule(ctx, &entity.FeeRule{
+		OperationType: "DEPOSIT",
+		Kind:          entity.FeeFlat,
+		FlatAmount:    100,
+		FeeWalletID:   feeWallet.ID,
+	}))
+
+	result, err := repo.AddOperation(ctx, wallet.ID, "DEPOSIT", 5000, entity.OperationDetails{}, 0)
+	require.NoError(t, err)
+	_, err = repo.AddOperation(ctx, wallet.ID, "WITHDRAW", 1_000_000, entity.OperationDetails{}, 0)
+	require.ErrorIs(t, err, repository.ErrInsufficientFunds)
+
+	require.NoError(t, audit.NewChainer(auditRepo, time.Second, 10).ChainAll(ctx))
+	report, err := service.NewAuditService(auditRepo).Verify(ctx)
+	require.NoError(t, err)
+	entries, err := auditRepo.ListEntries(ctx, 0, 10)
+	require.NoError(t, err)
+
+	// failed changes are not recorded, the fee is recorded on both wallets
+	require.Len(t, entries, 5)
+	assert.Equal(t, int64(5), report.Entries)
+	actions := make([]string, len(entries))
+	for i, entry := range entries {
+		actions[i] = entry.Action
+		assert.Equal(t, audit.AnonymousPrincipal, entry.Principal)
+		assert.Equal(t, "support", entry.ClaimedActor)
+		assert.Equal(t, "req-1", entry.RequestID)
+		assert.Equal(t, "10.0.0.7", entry.ClientIP)
+	}
+	assert.Equal(t, []string{
+		entity.AuditWalletCreated,
+		entity.AuditWalletCreated,
+		entity.AuditOperationAdded,
+		entity.AuditFeeCharged,
+		entity.AuditFeeCredited,
+	}, actions)
+
+	deposit := entries[2]
+	assert.Equal(t, result.Operation.ID, *deposit.OperationID)
+	assert.Equal(t, 0, *deposit.BalanceBefore)
+	assert.Equal(t, 5000, *deposit.BalanceAfter)
+	assert.JSONEq(t, `{"operation_type":"DEPOSIT","amount":5000}`, string(deposit.Details))
+
+	credit := entries[4]
+	assert.Equal(t, feeWallet.ID, credit.WalletID)
+	assert.Equal(t, result.Fee.FeeWalletOperationID, *credit.OperationID)
+	assert.Equal(t, 100, *credit.BalanceAfter)
+
+	// a change whose entry can not be written is not made
+	_, err = pool.Exec(ctx, `ALTER TABLE audit_pending ADD CONSTRAINT audit_pending_closed CHECK (false) NOT VALID`)
+	require.NoError(t, err)
+	_, err = repo.AddOperation(ctx, wallet.ID, "DEPOSIT", 5000, entity.OperationDetails{}, 0)
+	require.Error(t, err)
+	stored, err := repo.GetByID(ctx, wallet.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 4900, stored.Balance)
+}
+
+func TestOperationQueueRepository_AuditsApplied(t *testing.T) {
+	pool := setupTestDB(t)
+	defer teardownTestDB(t, pool)
+
+	ctx := context.Background()
+	walletID := uuid.New()
+	_, err := pool.Exec(ctx, `INSERT INTO wallets (id_wallet, balance) VALUES ($1, 100)`, walletID)
+	require.NoError(t, err)
+
+	queueRepo := repository.NewOperationQueueRepository(pool)
+	auditRepo := repository.NewAuditRepository(pool)
+
+	origin := audit.Origin{Principal: audit.AnonymousPrincipal, ClaimedActor: "support", RequestID: "req-1", ClientIP: "10.0.0.7"}
+	deposit, err := queueRepo.Enqueue(audit.WithOrigin(ctx, origin), walletID, "DEPOSIT", 500, entity.OperationDetails{})
+	require.NoError(t, err)
+	_, err = queueRepo.Enqueue(audit.WithOrigin(ctx, origin), walletID, "WITHDRAW", 5000, entity.OperationDetails{})
+	require.NoError(t, err)
+
+	// the worker has no origin of its own
+	batch, err := queueRepo.ApplyPending(ctx, walletID, 10)
+	require.NoError(t, err)
+	assert.Equal(t, entity.QueueBatch{Applied: 1, Failed: 1}, batch)
+
+	require.NoError(t, audit.NewChainer(auditRepo, time.Second, 10).ChainAll(ctx))
+	_, err = service.NewAuditService(auditRepo).Verify(ctx)
+	require.NoError(t, err)
+	entries, err := auditRepo.ListEntries(ctx, 0, 10)
+	require.NoError(t, err)
+
+	// the failed operation is not recorded
+	require.Len(t, entries, 1)
+	entry := entries[0]
+	assert.Equal(t, entity.AuditOperationAdded, entry.Action)
+	assert.Equal(t, deposit.ID, *entry.OperationID)
+	assert.Equal(t, 100, *entry.BalanceBefore)
+	assert.Equal(t, 600, *entry.BalanceAfter)
+	assert.Equal(t, origin.Principal, entry.Principal)
+	assert.Equal(t, origin.ClaimedActor, entry.ClaimedActor)
+	assert.Equal(t, origin.RequestID, entry.RequestID)
+	assert.Equal(t, origin.ClientIP, entry.ClientIP)
+}
@@ -0,0 +1,176 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"wallet_controller/internal/cache"
+	"wallet_controller/internal/entity"
+	"wallet_controller/internal/handler"
+	"wallet_controller/internal/repository"
+	"wallet_controller/internal/service"
+	"wallet_controller/internal/storage"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRU_HitMissAndEviction(t *testing.T) {
+	ctx := context.Background()
+	lru := cache.NewLRU(2, time.Minute)
+	first, second, third := uuid.New(), uuid.New(), uuid.New()
+
+	_, ok := lru.Get(ctx, first)
+	assert.False(t, ok)
+
+	lru.Set(ctx, &entity.Wallet{ID: first, Balance: 100, Labels: map[string]string{"tier": "gold"}}, time.Now())
+	lru.Set(ctx, &entity.Wallet{ID: second}, time.Now())
+
+	wallet, ok := lru.Get(ctx, first)
+	require.True(t, ok)
+	assert.Equal(t, 100, wallet.Balance)
+
+	// callers get a copy
+	wallet.Labels["tier"] = "silver"
+	wallet, _ = lru.Get(ctx, first)
+	assert.Equal(t, "gold", wallet.Labels["tier"])
+
+	// second is the least recently used
+	lru.Set(ctx, &entity.Wallet{ID: third}, time.Now())
+	_, ok = lru.Get(ctx, second)
+	assert.False(t, ok)
+	_, ok = lru.Get(ctx, first)
+	assert.True(t, ok)
+
+	assert.Equal(t, cache.Stats{Hits: 3, Misses: 2, Evictions: 1, Size: 2}, lru.Stats())
+}
+
+func TestLRU_Expires(t *testing.T) {
+	ctx := context.Background()
+	lru := cache.NewLRU(10, 20*time.Millisecond)
+	walletID := uuid.New()
+
+	lru.Set(ctx, &entity.Wallet{ID: walletID}, time.Now())
+	_, ok := lru.Get(ctx, walletID)
+	assert.True(t, ok)
+
+	time.Sleep(40 * time.Millisecond)
+	_, ok = lru.Get(ctx, walletID)
+	assert.False(t, ok)
+	assert.Equal(t, 0, lru.Stats().Size)
+}
+
+func TestLRU_InvalidateDropsEarlierReads(t *testing.T) {
+	ctx := context.Background()
+	lru := cache.NewLRU(10, time.Minute)
+	walletID := uuid.New()
+
+	lru.Set(ctx, &entity.Wallet{ID: walletID, Balance: 100}, time.Now())
+	readAt := time.Now()
+	lru.Invalidate(ctx, walletID)
+
+	_, ok := lru.Get(ctx, walletID)
+	assert.False(t, ok)
+
+	// a read that started before the change may have seen the old balance
+	lru.Set(ctx, &entity.Wallet{ID: walletID, Balance: 100}, readAt)
+	_, ok = lru.Get(ctx, walletID)
+	assert.False(t, ok)
+
+	lru.Set(ctx, &entity.Wallet{ID: walletID, Balance: 200}, time.Now())
+	wallet, ok := lru.Get(ctx, walletID)
+	require.True(t, ok)
+	assert.Equal(t, 200, wallet.Balance)
+
+	readAt = time.Now()
+	lru.Purge(ctx)
+	lru.Set(ctx, &entity.Wallet{ID: walletID, Balance: 200}, readAt)
+	_, ok = lru.Get(ctx, walletID)
+	assert.False(t, ok)
+}
+
+func TestCachedWalletRepository(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockWalletRepository)
+	walletID := uuid.New()
+
+	mockRepo.On("GetByID", mock.Anything, walletID).Return(&entity.Wallet{ID: walletID, Balance: 100}, nil).Twice()
+	mockRepo.On("AddOperation", mock.Anything, walletID, "DEPOSIT", 100, entity.OperationDetails{}, int64(0)).
+		Return(entity.OperationResult{Wallet: entity.Wallet{ID: walletID, Balance: 200}}, nil)
+
+	repo := repository.NewCachedWalletRepository(mockRepo, cache.NewLRU(10, time.Minute), nil)
+
+	readCtx, outcome := cache.WithOutcome(ctx)
+	_, err := repo.GetByID(readCtx, walletID)
+	require.NoError(t, err)
+	assert.Equal(t, cache.Outcome{Cached: true, Hit: false}, *outcome)
+
+	readCtx, outcome = cache.WithOutcome(ctx)
+	_, err = repo.GetByID(readCtx, walletID)
+	require.NoError(t, err)
+	assert.Equal(t, cache.Outcome{Cached: true, Hit: true}, *outcome)
+
+	// the committed operation drops the wallet, the next read goes to the repository
+	_, err = repo.AddOperation(ctx, walletID, "DEPOSIT", 100, entity.OperationDetails{}, 0)
+	require.NoError(t, err)
+	_, err = repo.GetByID(ctx, walletID)
+	require.NoError(t, err)
+
+	mockRepo.AssertExpectations(t)
+	assert.Same(t, mockRepo, repository.NewCachedWalletRepository(mockRepo, nil, nil))
+}
+
+func TestCachedWalletRepository_ReplicaMiss(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockWalletRepository)
+	walletID := uuid.New()
+
+	reads := storage.NewReadRouter(nil, nil, storage.ReadRouterConfig{MaxLag: time.Second, CheckInterval: time.Second})
+	lru := cache.NewLRU(10, time.Minute)
+	repo := repository.NewCachedWalletRepository(mockRepo, lru, reads)
+
+	mockRepo.On("GetByID", mock.Anything, walletID).Return(&entity.Wallet{ID: walletID, Balance: 100}, nil).Twice()
+
+	// the wallet changed a moment ago, a replica read may predate the change
+	lru.Invalidate(ctx, walletID)
+	_, err := repo.GetByID(ctx, walletID)
+	require.NoError(t, err)
+	_, ok := lru.Get(ctx, walletID)
+	assert.False(t, ok)
+
+	_, err = repo.GetByID(ctx, walletID)
+	require.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestHandlerGetWallet_CacheHeaders(t *testing.T) {
+	walletRepo := repository.NewMemoryWalletRepository()
+	wallet, err := walletRepo.CreateWallet(context.Background(), entity.WalletCreate{})
+	require.NoError(t, err)
+
+	get := func(repo repository.WalletRepositoryInterface) *httptest.ResponseRecorder {
+		router := setupValidatedRouter()
+		router.GET("/api/v1/wallets/:id", handler.NewWalletHandler(service.NewWalletService(repo)).GetWallet)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/wallets/"+wallet.ID.String(), nil))
+		return w
+	}
+
+	cached := repository.NewCachedWalletRepository(walletRepo, cache.NewLRU(10, time.Minute), nil)
+
+	w := get(cached)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.Equal(t, "private, no-cache", w.Header().Get("Cache-Control"))
+
+	w = get(cached)
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+
+	w = get(walletRepo)
+	assert.Empty(t, w.Header().Get("X-Cache"))
+}
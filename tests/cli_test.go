@@ -0,0 +1,169 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+	"wallet_controller/cmd/cli"
+	"wallet_controller/internal/entity"
+	"wallet_controller/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCLIWalletCreate(t *testing.T) {
+	walletID := uuid.New()
+
+	mockService := new(MockWalletService)
+	mockService.On("CreateWallet", mock.Anything, entity.WalletCreate{
+		ID:          walletID,
+		OwnerID:     "user-1",
+		Labels:      map[string]string{"tier": "gold", "region": "eu"},
+		CreditLimit: 50000,
+	}).Return(&entity.Wallet{ID: walletID, CreditLimit: 50000, Available: 50000}, nil)
+
+	var stdout bytes.Buffer
+	err := cli.New(mockService, nil, &stdout, io.Discard).Run(context.Background(), []string{
+		"wallet", "create", "-id", walletID.String(), "-owner", "user-1",
+		"-label", "tier:gold", "-label", "region:eu", "-credit-limit", "50000",
+	})
+	require.NoError(t, err)
+
+	var wallet entity.Wallet
+	require.NoError(t, json.Unmarshal(stdout.Bytes(), &wallet))
+	assert.Equal(t, walletID, wallet.ID)
+	assert.Equal(t, 50000, wallet.Available)
+	mockService.AssertExpectations(t)
+}
+
+func TestCLIOpDeposit(t *testing.T) {
+	walletID := uuid.New()
+
+	mockService := new(MockWalletService)
+	mockService.On("AddOperation", mock.Anything, &entity.OperationRequest{
+		WalletID:      walletID,
+		OperationType: "DEPOSIT",
+		Amount:        250,
+		OperationDetails: entity.OperationDetails{
+			Description:       "Manual top-up",
+			ExternalReference: "ticket-42",
+		},
+	}).Return(entity.OperationResult{Wallet: entity.Wallet{ID: walletID, Balance: 25000}}, nil)
+
+	var stdout bytes.Buffer
+	err := cli.New(mockService, nil, &stdout, io.Discard).Run(context.Background(), []string{
+		"op", "deposit", "-description", "Manual top-up", "-reference", "ticket-42", walletID.String(), "250",
+	})
+	require.NoError(t, err)
+	assert.Contains(t, stdout.String(), `"balance": 25000`)
+	mockService.AssertExpectations(t)
+}
+
+func TestCLIOpReverse_AlreadyReversed(t *testing.T) {
+	operationID := uuid.New()
+
+	mockService := new(MockWalletService)
+	mockService.On("ReverseOperation", mock.Anything, operationID, entity.OperationDetails{}).
+		Return(entity.OperationResult{}, repository.ErrAlreadyReversed)
+
+	err := cli.New(mockService, nil, io.Discard, io.Discard).Run(context.Background(), []string{"op", "reverse", operationID.String()})
+	assert.ErrorIs(t, err, repository.ErrAlreadyReversed)
+}
+
+func TestCLIReconcile(t *testing.T) {
+	mockService := new(MockWalletService)
+	mockService.On("Reconcile", mock.Anything).Return([]entity.Discrepancy{
+		{WalletID: uuid.New(), Expected: 1000, Actual: 900},
+	}, nil).Once()
+	mockService.On("Reconcile", mock.Anything).Return([]entity.Discrepancy{}, nil).Once()
+
+	var stdout bytes.Buffer
+	command := cli.New(mockService, nil, &stdout, io.Discard)
+
+	assert.ErrorIs(t, command.Run(context.Background(), []string{"reconcile"}), cli.ErrDiscrepancies)
+	assert.Contains(t, stdout.String(), `"expected": 1000`)
+
+	assert.NoError(t, command.Run(context.Background(), []string{"reconcile"}))
+}
+
+func TestCLIInvalidUsage(t *testing.T) {
+	mockService := new(MockWalletService)
+	command := cli.New(mockService, nil, io.Discard, io.Discard)
+
+	for _, args := range [][]string{
+		{},
+		{"wallet"},
+		{"wallet", "delete"},
+		{"wallet", "show"},
+		{"wallet", "show", "not-a-uuid"},
+		{"wallet", "create", "-label", "tier"},
+		{"op", "withdraw", uuid.New().String(), "-5"},
+		{"op", "withdraw", uuid.New().String(), "1.5"},
+		{"export", "-wallet", uuid.New().String(), "-from", "yesterday"},
+		{"export", "-wallet", uuid.New().String(), "-from", "2024-01-01T00:00:00Z", "-format", "xml"},
+		{"wallet", "freeze", uuid.New().String()},
+		{"wallet", "freeze", "-reason", "AML", "-until", "tomorrow", uuid.New().String()},
+	} {
+		assert.ErrorIs(t, command.Run(context.Background(), args), cli.ErrUsage, args)
+	}
+
+	mockService.AssertNotCalled(t, "AddOperation", mock.Anything, mock.Anything)
+}
+
+func TestCLIWalletShards(t *testing.T) {
+	walletID := uuid.New()
+
+	mockService := new(MockWalletService)
+	mockService.On("SetBalanceShards", mock.Anything, walletID, 8).
+		Return(&entity.Wallet{ID: walletID, BalanceShards: 8}, nil)
+
+	var stdout bytes.Buffer
+	err := cli.New(mockService, nil, &stdout, io.Discard).Run(context.Background(), []string{
+		"wallet", "shards", "-count", "8", walletID.String(),
+	})
+	require.NoError(t, err)
+	assert.Contains(t, stdout.String(), `"balance_shards": 8`)
+
+	err = cli.New(mockService, nil, io.Discard, io.Discard).Run(context.Background(), []string{
+		"wallet", "shards", walletID.String(),
+	})
+	assert.ErrorIs(t, err, cli.ErrUsage)
+	mockService.AssertNumberOfCalls(t, "SetBalanceShards", 1)
+}
+
+func TestCLIWalletFreeze(t *testing.T) {
+	walletID := uuid.New()
+	until := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	freeze := entity.Freeze{
+		Mode:       entity.FreezeDepositOnly,
+		Reason:     entity.FreezeReasonCourtOrder,
+		Until:      &until,
+		HoldAmount: 5000,
+	}
+
+	mockService := new(MockWalletService)
+	mockService.On("FreezeWallet", mock.Anything, walletID, freeze).
+		Return(&entity.Wallet{ID: walletID, Frozen: true, Freeze: &freeze}, nil)
+	mockService.On("UnfreezeWallet", mock.Anything, walletID).
+		Return(&entity.Wallet{ID: walletID}, nil)
+
+	var stdout bytes.Buffer
+	err := cli.New(mockService, nil, &stdout, io.Discard).Run(context.Background(), []string{
+		"wallet", "freeze", "-mode", "DEPOSIT_ONLY", "-reason", "COURT_ORDER",
+		"-until", "2030-01-01T00:00:00Z", "-hold", "5000", walletID.String(),
+	})
+	require.NoError(t, err)
+	assert.Contains(t, stdout.String(), `"hold_amount": 5000`)
+
+	err = cli.New(mockService, nil, io.Discard, io.Discard).Run(context.Background(), []string{
+		"wallet", "unfreeze", walletID.String(),
+	})
+	require.NoError(t, err)
+	mockService.AssertExpectations(t)
+}
@@ -0,0 +1,187 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"wallet_controller/internal/entity"
+	"wallet_controller/internal/fee"
+	"wallet_controller/internal/handler"
+	"wallet_controller/internal/repository"
+	"wallet_controller/internal/service"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockFeeRepository struct {
+	mock.Mock
+}
+
+func (m *MockFeeRepository) CreateRule(ctx context.Context, rule *entity.FeeRule) error {
+	args := m.Called(ctx, rule)
+	return args.Error(0)
+}
+
+func (m *MockFeeRepository) GetRule(ctx context.Context, ruleID uuid.UUID) (*entity.FeeRule, error) {
+	args := m.Called(ctx, ruleID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*entity.FeeRule), args.Error(1)
+}
+
+func (m *MockFeeRepository) ListRules(ctx context.Context) ([]entity.FeeRule, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]entity.FeeRule), args.Error(1)
+}
+
+func (m *MockFeeRepository) DeleteRule(ctx context.Context, ruleID uuid.UUID) error {
+	args := m.Called(ctx, ruleID)
+	return args.Error(0)
+}
+
+func intPtr(value int) *int {
+	return &value
+}
+
+func TestFeeCalculate(t *testing.T) {
+	tiers := []entity.FeeTier{
+		{FromAmount: 100000, BasisPoints: 100},
+		{FromAmount: 0, FlatAmount: 1000},
+		{FromAmount: 1000000, BasisPoints: 50},
+	}
+
+	cases := []struct {
+		name       string
+		rule       entity.FeeRule
+		amount     int
+		flat       int
+		percentage int
+		total      int
+	}{
+		{"flat", entity.FeeRule{Kind: entity.FeeFlat, FlatAmount: 3000}, 50000, 3000, 0, 3000},
+		{"percentage rounds half up", entity.FeeRule{Kind: entity.FeePercentage, BasisPoints: 150}, 12345, 0, 185, 185},
+		{"percentage plus flat", entity.FeeRule{Kind: entity.FeePercentage, FlatAmount: 3000, BasisPoints: 100}, 100000, 3000, 1000, 4000},
+		{"min cap", entity.FeeRule{Kind: entity.FeePercentage, BasisPoints: 100, MinFee: intPtr(5000)}, 10000, 0, 100, 5000},
+		{"max cap", entity.FeeRule{Kind: entity.FeePercentage, BasisPoints: 100, MaxFee: intPtr(5000)}, 10000000, 0, 100000, 5000},
+		{"lowest tier", entity.FeeRule{Kind: entity.FeeTiered, Tiers: tiers}, 99999, 1000, 0, 1000},
+		{"middle tier", entity.FeeRule{Kind: entity.FeeTiered, Tiers: tiers}, 100000, 0, 1000, 1000},
+		{"highest tier", entity.FeeRule{Kind: entity.FeeTiered, Tiers: tiers}, 2000000, 0, 10000, 10000},
+		{"below every tier", entity.FeeRule{Kind: entity.FeeTiered, Tiers: tiers[:1]}, 500, 0, 0, 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := fee.Calculate(tc.rule, tc.amount)
+
+			assert.Equal(t, tc.flat, result.Flat)
+			assert.Equal(t, tc.percentage, result.Percentage)
+			assert.Equal(t, tc.total, result.Amount)
+		})
+	}
+}
+
+func TestHandlerCreateFeeRule_Success(t *testing.T) {
+	feeWalletID := uuid.New()
+
+	repo := new(MockFeeRepository)
+	repo.On("CreateRule", mock.Anything, mock.MatchedBy(func(rule *entity.FeeRule) bool {
+		return rule.Kind == entity.FeeTiered && len(rule.Tiers) == 2 && rule.WalletTier == "gold" &&
+			rule.MaxFee != nil && *rule.MaxFee == 50000 && rule.FeeWalletID == feeWalletID
+	})).Run(func(args mock.Arguments) {
+		args.Get(1).(*entity.FeeRule).ID = uuid.New()
+	}).Return(nil)
+
+	router := setupValidatedRouter()
+	router.POST("/api/v1/fee-rules", handler.NewFeeHandler(service.NewFeeService(repo)).CreateRule)
+
+	body, _ := json.Marshal(map[string]any{
+		"operation_type": "WITHDRAW",
+		"wallet_tier":    "gold",
+		"kind":           "TIERED",
+		"tiers": []map[string]int{
+			{"from_amount": 0, "flat_amount": 1000},
+			{"from_amount": 100000, "basis_points": 100},
+		},
+		"max_fee":       50000,
+		"fee_wallet_id": feeWalletID,
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/fee-rules", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var rule entity.FeeRule
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rule))
+	assert.NotEqual(t, uuid.Nil, rule.ID)
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerCreateFeeRule_InvalidRequest(t *testing.T) {
+	repo := new(MockFeeRepository)
+
+	router := setupValidatedRouter()
+	router.POST("/api/v1/fee-rules", handler.NewFeeHandler(service.NewFeeService(repo)).CreateRule)
+
+	feeWalletID := uuid.New().String()
+	for _, body := range []string{
+		`{"operation_type":"WITHDRAW","kind":"MONTHLY","fee_wallet_id":"` + feeWalletID + `"}`,
+		`{"operation_type":"WITHDRAW","kind":"PERCENTAGE","basis_points":20000,"fee_wallet_id":"` + feeWalletID + `"}`,
+		`{"operation_type":"WITHDRAW","kind":"TIERED","fee_wallet_id":"` + feeWalletID + `"}`,
+		`{"operation_type":"WITHDRAW","kind":"FLAT","flat_amount":100,"basis_points":5,"fee_wallet_id":"` + feeWalletID + `"}`,
+		`{"operation_type":"WITHDRAW","kind":"FLAT","flat_amount":100,"min_fee":500,"max_fee":100,"fee_wallet_id":"` + feeWalletID + `"}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/fee-rules", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+
+	repo.AssertNotCalled(t, "CreateRule", mock.Anything, mock.Anything)
+}
+
+func TestHandlerCreateFeeRule_Duplicate(t *testing.T) {
+	repo := new(MockFeeRepository)
+	repo.On("CreateRule", mock.Anything, mock.Anything).Return(repository.ErrDuplicateFeeRule)
+
+	router := setupValidatedRouter()
+	router.POST("/api/v1/fee-rules", handler.NewFeeHandler(service.NewFeeService(repo)).CreateRule)
+
+	body := `{"operation_type":"DEPOSIT","kind":"FLAT","flat_amount":100,"fee_wallet_id":"` + uuid.New().String() + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/fee-rules", bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestHandlerGetFeeRule_NotFound(t *testing.T) {
+	ruleID := uuid.New()
+
+	repo := new(MockFeeRepository)
+	repo.On("GetRule", mock.Anything, ruleID).Return(nil, repository.ErrFeeRuleNotFound)
+
+	router := setupValidatedRouter()
+	router.GET("/api/v1/fee-rules/:id", handler.NewFeeHandler(service.NewFeeService(repo)).GetRule)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/fee-rules/"+ruleID.String(), nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	repo.AssertExpectations(t)
+}
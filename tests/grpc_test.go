@@ -0,0 +1,222 @@
+package tests
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+	walletv1 "wallet_controller/api/wallet/v1"
+	"wallet_controller/internal/grpcserver"
+	"wallet_controller/internal/notify"
+	"wallet_controller/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"wallet_controller/internal/entity"
+)
+
+func setupGrpcClient(t *testing.T, walletService *MockWalletService, broker *notify.Broker) walletv1.WalletServiceClient {
+	t.Helper()
+
+	listener := bufconn.Listen(1 << 20)
+	done := make(chan struct{})
+	server := grpcserver.NewServer(grpcserver.NewWalletServer(walletService, broker, done))
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		conn.Close()
+		close(done)
+		server.Stop()
+	})
+
+	return walletv1.NewWalletServiceClient(conn)
+}
+
+func TestGrpcGetWallet_Success(t *testing.T) {
+	mockService := new(MockWalletService)
+	walletID := uuid.New()
+
+	mockService.On("GetWallet", mock.Anything, walletID).Return(&entity.Wallet{ID: walletID, Balance: 5000}, nil)
+
+	client := setupGrpcClient(t, mockService, notify.NewBroker())
+
+	resp, err := client.GetWallet(context.Background(), &walletv1.GetWalletRequest{WalletId: walletID.String()})
+
+	require.NoError(t, err)
+	assert.Equal(t, walletID.String(), resp.GetWallet().GetId())
+	assert.Equal(t, int64(5000), resp.GetWallet().GetBalance())
+	mockService.AssertExpectations(t)
+}
+
+func TestGrpcGetWallet_ErrorCodes(t *testing.T) {
+	cases := []struct {
+		err  error
+		code codes.Code
+	}{
+		{repository.ErrWalletNotFound, codes.NotFound},
+		{assert.AnError, codes.Internal},
+	}
+
+	for _, tc := range cases {
+		mockService := new(MockWalletService)
+		walletID := uuid.New()
+		mockService.On("GetWallet", mock.Anything, walletID).Return(nil, tc.err)
+
+		client := setupGrpcClient(t, mockService, notify.NewBroker())
+
+		_, err := client.GetWallet(context.Background(), &walletv1.GetWalletRequest{WalletId: walletID.String()})
+		assert.Equal(t, tc.code, status.Code(err))
+	}
+
+	client := setupGrpcClient(t, new(MockWalletService), notify.NewBroker())
+	_, err := client.GetWallet(context.Background(), &walletv1.GetWalletRequest{WalletId: "invalid-uuid"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGrpcAddOperation_Success(t *testing.T) {
+	mockService := new(MockWalletService)
+	walletID := uuid.New()
+
+	mockService.On("AddOperation", mock.Anything, mock.MatchedBy(func(r *entity.OperationRequest) bool {
+		return r.WalletID == walletID && r.OperationType == "WITHDRAW" && r.Amount == 50
+	})).Return(entity.OperationResult{
+		Wallet:    entity.Wallet{ID: walletID, Balance: 5000},
+		Operation: entity.Operation{ID: uuid.New(), WalletID: walletID, OperationType: "WITHDRAW", Amount: 5000},
+	}, nil)
+
+	client := setupGrpcClient(t, mockService, notify.NewBroker())
+
+	resp, err := client.AddOperation(context.Background(), &walletv1.AddOperationRequest{
+		WalletId:      walletID.String(),
+		OperationType: walletv1.OperationType_OPERATION_TYPE_WITHDRAW,
+		Amount:        50,
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(5000), resp.GetWallet().GetBalance())
+	assert.Equal(t, int64(5000), resp.GetOperation().GetAmount())
+	mockService.AssertExpectations(t)
+}
+
+func TestGrpcAddOperation_Errors(t *testing.T) {
+	walletID := uuid.New()
+
+	client := setupGrpcClient(t, new(MockWalletService), notify.NewBroker())
+	_, err := client.AddOperation(context.Background(), &walletv1.AddOperationRequest{
+		WalletId: walletID.String(),
+		Amount:   50,
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.AddOperation(context.Background(), &walletv1.AddOperationRequest{
+		WalletId:      walletID.String(),
+		OperationType: walletv1.OperationType_OPERATION_TYPE_DEPOSIT,
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	cases := []struct {
+		err  error
+		code codes.Code
+	}{
+		{repository.ErrInsufficientFunds, codes.FailedPrecondition},
+		{repository.ErrWalletLocked, codes.Aborted},
+		{repository.ErrWalletNotFound, codes.NotFound},
+		{repository.ErrDuplicateOperation, codes.AlreadyExists},
+		{repository.ErrVersionMismatch, codes.Aborted},
+	}
+	for _, tc := range cases {
+		mockService := new(MockWalletService)
+		mockService.On("AddOperation", mock.Anything, mock.Anything).Return(entity.OperationResult{}, tc.err)
+
+		client := setupGrpcClient(t, mockService, notify.NewBroker())
+		_, err := client.AddOperation(context.Background(), &walletv1.AddOperationRequest{
+			WalletId:      walletID.String(),
+			OperationType: walletv1.OperationType_OPERATION_TYPE_WITHDRAW,
+			Amount:        50,
+		})
+		assert.Equal(t, tc.code, status.Code(err), tc.err.Error())
+	}
+}
+
+func TestGrpcListOperations_Pagination(t *testing.T) {
+	mockService := new(MockWalletService)
+	walletID := uuid.New()
+
+	mockService.On("ListOperations", mock.Anything, entity.OperationFilter{WalletID: walletID, Limit: 2}).Return([]entity.Operation{
+		{ID: uuid.New(), WalletID: walletID, Seq: 9, OperationType: "DEPOSIT", Amount: 100},
+		{ID: uuid.New(), WalletID: walletID, Seq: 4, OperationType: "WITHDRAW", Amount: 50},
+	}, nil)
+	mockService.On("ListOperations", mock.Anything, entity.OperationFilter{WalletID: walletID, BeforeSeq: 4, Limit: 2}).Return([]entity.Operation{
+		{ID: uuid.New(), WalletID: walletID, Seq: 1, OperationType: "DEPOSIT", Amount: 100},
+	}, nil)
+
+	client := setupGrpcClient(t, mockService, notify.NewBroker())
+
+	resp, err := client.ListOperations(context.Background(), &walletv1.ListOperationsRequest{
+		WalletId: walletID.String(),
+		PageSize: 2,
+	})
+	require.NoError(t, err)
+	require.Len(t, resp.GetOperations(), 2)
+	assert.Equal(t, walletv1.OperationType_OPERATION_TYPE_WITHDRAW, resp.GetOperations()[1].GetOperationType())
+	assert.Equal(t, "4", resp.GetNextPageToken())
+
+	resp, err = client.ListOperations(context.Background(), &walletv1.ListOperationsRequest{
+		WalletId:  walletID.String(),
+		PageSize:  2,
+		PageToken: resp.GetNextPageToken(),
+	})
+	require.NoError(t, err)
+	assert.Len(t, resp.GetOperations(), 1)
+	assert.Empty(t, resp.GetNextPageToken())
+
+	mockService.AssertExpectations(t)
+}
+
+func TestGrpcWatchWallet_ReplaysAndStreams(t *testing.T) {
+	mockService := new(MockWalletService)
+	walletID := uuid.New()
+	broker := notify.NewBroker()
+
+	mockService.On("GetWallet", mock.Anything, walletID).Return(&entity.Wallet{ID: walletID, Balance: 300}, nil)
+	mockService.On("GetBalanceEvents", mock.Anything, walletID, int64(1), mock.Anything).Return([]entity.BalanceEvent{
+		{Seq: 2, WalletID: walletID, OperationType: "DEPOSIT", Amount: 100, Balance: 300},
+	}, nil)
+
+	client := setupGrpcClient(t, mockService, broker)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.WatchWallet(ctx, &walletv1.WatchWalletRequest{WalletId: walletID.String(), AfterSeq: 1})
+	require.NoError(t, err)
+
+	event, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), event.GetSeq())
+
+	broker.Publish(entity.BalanceEvent{Seq: 3, WalletID: walletID, OperationType: "WITHDRAW", Amount: 50, Balance: 250})
+
+	event, err = stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), event.GetSeq())
+	assert.Equal(t, int64(250), event.GetBalance())
+	assert.Equal(t, walletv1.OperationType_OPERATION_TYPE_WITHDRAW, event.GetOperationType())
+}
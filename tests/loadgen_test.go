@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"wallet_controller/cmd/cli"
+	"wallet_controller/cmd/loadgen"
+	"wallet_controller/internal/entity"
+	"wallet_controller/internal/handler"
+	"wallet_controller/internal/repository"
+	"wallet_controller/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadgenParseMix(t *testing.T) {
+	mix, err := loadgen.ParseMix("read=20, deposit=30,transfer=5")
+	require.NoError(t, err)
+	assert.Equal(t, loadgen.Mix{Read: 20, Deposit: 30, Transfer: 5}, mix)
+
+	for _, value := range []string{"read", "read=x", "read=-1", "refund=10", "read=0,deposit=0"} {
+		_, err := loadgen.ParseMix(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestLoadgenParseFlags_Invalid(t *testing.T) {
+	for _, args := range [][]string{
+		{"-rps", "0"},
+		{"-hot-share", "1.5"},
+		{"-wallets", "2", "-hot-wallets", "3"},
+		{"-wallet", "not-a-uuid"},
+		{"extra"},
+	} {
+		_, err := loadgen.ParseFlags(args, io.Discard)
+		assert.ErrorIs(t, err, cli.ErrUsage, args)
+	}
+}
+
+func TestLoadgenRun(t *testing.T) {
+	repo := repository.NewMemoryWalletRepository()
+	walletService := service.NewWalletService(repo)
+	walletHandler := handler.NewWalletHandler(walletService)
+
+	router := setupValidatedRouter()
+	router.GET("/api/v1/wallets/:id", walletHandler.GetWallet)
+	router.POST("/api/v1/wallet", walletHandler.AddOperation)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	cfg, err := loadgen.ParseFlags([]string{
+		"-url", server.URL,
+		"-rps", "200",
+		"-duration", "300ms",
+		"-wallets", "3",
+		"-fund", "100",
+		"-hot-wallets", "1",
+		"-hot-share", "0.9",
+		"-mix", "read=1,deposit=1,withdraw=1,transfer=1",
+	}, io.Discard)
+	require.NoError(t, err)
+
+	report, err := loadgen.New(cfg, walletService).Run(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, 60, report.Requests+report.Dropped)
+	assert.Greater(t, report.Requests, 0)
+	for status := range report.Statuses {
+		// 409 is a withdrawal over the balance, 503 a locked wallet
+		assert.Contains(t, []string{"200", "409", "503"}, status)
+	}
+	assert.Positive(t, report.Statuses["200"])
+	assert.LessOrEqual(t, report.Latency.P50, report.Latency.P99)
+	assert.LessOrEqual(t, report.Latency.P99, report.Latency.Max)
+
+	total := 0
+	for _, kind := range report.Kinds {
+		total += kind.Requests
+	}
+	assert.Equal(t, report.Requests, total)
+
+	wallets, err := repo.SearchWallets(context.Background(), entity.WalletFilter{Labels: map[string]string{"source": "loadgen"}, Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, wallets, 3)
+
+	discrepancies, err := repo.Reconcile(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, discrepancies)
+
+	var out bytes.Buffer
+	report.WriteText(&out)
+	assert.Contains(t, out.String(), "total")
+	assert.Contains(t, out.String(), "contention")
+}
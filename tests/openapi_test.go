@@ -0,0 +1,123 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"wallet_controller/config"
+	"wallet_controller/internal/notify"
+	"wallet_controller/internal/openapi"
+	"wallet_controller/internal/router"
+	"wallet_controller/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenAPI_DocumentParses(t *testing.T) {
+	doc, err := openapi.Parse(openapi.Spec())
+	require.NoError(t, err)
+	assert.Equal(t, "3.1.0", doc.OpenAPI)
+}
+
+func TestOpenAPI_DescribesEveryRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := router.SetupRouter(context.Background(), &config.Config{}, new(MockWalletService), notify.NewBroker(), storage.NewReadRouter(nil, nil, storage.ReadRouterConfig{}))
+	validator := openapi.NewValidator()
+
+	for _, route := range r.Routes() {
+		assert.True(t, validator.HasRoute(route.Method, route.Path), "%s %s is not in openapi.json", route.Method, route.Path)
+	}
+}
+
+func TestOpenAPI_ServesDocument(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := router.SetupRouter(context.Background(), &config.Config{}, new(MockWalletService), notify.NewBroker(), nil)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, json.Valid(w.Body.Bytes()))
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "/openapi.json")
+}
+
+func TestOpenAPI_ValidatesRequests(t *testing.T) {
+	r := setupValidatedRouter()
+	reached := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	r.GET("/api/v1/wallets/:id", reached)
+	r.GET("/api/v1/wallets/:id/statement", reached)
+	r.POST("/api/v1/webhooks", reached)
+	r.GET("/api/v1/webhooks/:id/deliveries", reached)
+
+	walletID := uuid.New().String()
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		code    int
+		message string
+	}{
+		{"valid path", http.MethodGet, "/api/v1/wallets/" + walletID, "", http.StatusNoContent, ""},
+		{"invalid uuid", http.MethodGet, "/api/v1/wallets/not-a-uuid", "", http.StatusBadRequest, "id must be a UUID"},
+		{"missing query", http.MethodGet, "/api/v1/wallets/" + walletID + "/statement?from=2026-09-01T00:00:00Z", "", http.StatusBadRequest, "to is required"},
+		{"bad enum query", http.MethodGet, "/api/v1/wallets/" + walletID + "/statement?from=2026-09-01T00:00:00Z&to=2026-10-01T00:00:00Z&format=xml", "", http.StatusBadRequest, "format must be one of 'csv', 'jsonl', 'pdf'"},
+		{"integer query", http.MethodGet, "/api/v1/webhooks/" + walletID + "/deliveries?limit=ten", "", http.StatusBadRequest, "limit must be an integer"},
+		{"query maximum", http.MethodGet, "/api/v1/webhooks/" + walletID + "/deliveries?limit=501", "", http.StatusBadRequest, "limit must be at most 500"},
+		{"valid body", http.MethodPost, "/api/v1/webhooks", `{"url":"https://example.com/hook","event_types":["BalanceChanged"]}`, http.StatusNoContent, ""},
+		{"missing body", http.MethodPost, "/api/v1/webhooks", "", http.StatusBadRequest, "request body is required"},
+		{"array item enum", http.MethodPost, "/api/v1/webhooks", `{"url":"https://example.com/hook","event_types":["Deleted"]}`, http.StatusBadRequest, "event_types[0] must be one of"},
+		{"wrong type", http.MethodPost, "/api/v1/webhooks", `{"url":"https://example.com/hook","active":"yes"}`, http.StatusBadRequest, "active must be a boolean or null"},
+		{"not an object", http.MethodPost, "/api/v1/webhooks", `[]`, http.StatusBadRequest, "request body must be an object"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewReader([]byte(tt.body)))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+			if tt.message != "" {
+				var errResp map[string]string
+				require.NoError(t, json.Unmarshal(w.Body.Bytes(), &errResp))
+				assert.True(t, strings.Contains(errResp["error"], tt.message), errResp["error"])
+			}
+		})
+	}
+}
+
+func TestOpenAPI_BodyIsAvailableToHandler(t *testing.T) {
+	r := setupValidatedRouter()
+
+	var received map[string]any
+	r.POST("/api/v1/wallet", func(c *gin.Context) {
+		_ = c.ShouldBindJSON(&received)
+		c.Status(http.StatusNoContent)
+	})
+
+	body := `{"wallet_id":"` + uuid.New().String() + `","operation_type":"DEPOSIT","amount":100}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/wallet", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "DEPOSIT", received["operation_type"])
+}
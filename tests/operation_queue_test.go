@@ -0,0 +1,194 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"wallet_controller/internal/entity"
+	"wallet_controller/internal/handler"
+	"wallet_controller/internal/queue"
+	"wallet_controller/internal/repository"
+	"wallet_controller/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockOperationQueueRepository struct {
+	mock.Mock
+}
+
+func (m *MockOperationQueueRepository) Enqueue(ctx context.Context, walletID uuid.UUID, operationType string, amount int, details entity.OperationDetails) (*entity.QueuedOperation, error) {
+	args := m.Called(ctx, walletID, operationType, amount, details)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*entity.QueuedOperation), args.Error(1)
+}
+
+func (m *MockOperationQueueRepository) GetQueued(ctx context.Context, operationID uuid.UUID) (*entity.QueuedOperation, error) {
+	args := m.Called(ctx, operationID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*entity.QueuedOperation), args.Error(1)
+}
+
+func (m *MockOperationQueueRepository) PendingWallets(ctx context.Context, limit int) ([]uuid.UUID, error) {
+	args := m.Called(ctx, limit)
+	return args.Get(0).([]uuid.UUID), args.Error(1)
+}
+
+func (m *MockOperationQueueRepository) ApplyPending(ctx context.Context, walletID uuid.UUID, limit int) (entity.QueueBatch, error) {
+	args := m.Called(ctx, walletID, limit)
+	return args.Get(0).(entity.QueueBatch), args.Error(1)
+}
+
+// setupQueueRouter serves operations through the queue handler in front of a memory repository.
+func setupQueueRouter(queueRepo repository.OperationQueueRepositoryInterface, walletRepo repository.WalletRepositoryInterface) *gin.Engine {
+	queueHandler := handler.NewOperationQueueHandler(
+		service.NewOperationQueueService(queueRepo),
+		handler.NewWalletHandler(service.NewWalletService(walletRepo)),
+	)
+
+	router := setupValidatedRouter()
+	router.POST("/api/v1/wallet", queueHandler.AddOperation)
+	router.GET("/api/v1/operations/:id", queueHandler.GetOperation)
+	return router
+}
+
+func TestOperationQueueWorker_ProcessPending(t *testing.T) {
+	repo := new(MockOperationQueueRepository)
+	busy, idle := uuid.New(), uuid.New()
+
+	repo.On("PendingWallets", mock.Anything, 10).Return([]uuid.UUID{busy, idle}, nil)
+	repo.On("ApplyPending", mock.Anything, busy, 100).Return(entity.QueueBatch{}, repository.ErrWalletLocked)
+	repo.On("ApplyPending", mock.Anything, idle, 100).Return(entity.QueueBatch{Applied: 3, Failed: 1}, nil)
+
+	worker := queue.NewWorker(repo, queue.WorkerConfig{Wallets: 10, BatchSize: 100})
+
+	assert.Equal(t, 4, worker.ProcessPending(context.Background()))
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerAddOperation_Async(t *testing.T) {
+	queueRepo := new(MockOperationQueueRepository)
+	walletRepo := repository.NewMemoryWalletRepository()
+	router := setupQueueRouter(queueRepo, walletRepo)
+
+	wallet, err := walletRepo.CreateWallet(context.Background(), entity.WalletCreate{})
+	require.NoError(t, err)
+
+	queued := &entity.QueuedOperation{
+		ID:            uuid.New(),
+		WalletID:      wallet.ID,
+		OperationType: "DEPOSIT",
+		Amount:        10000,
+		Status:        entity.QueuedPending,
+	}
+	queueRepo.On("Enqueue", mock.Anything, wallet.ID, "DEPOSIT", 10000, entity.OperationDetails{}).Return(queued, nil)
+
+	send := func(headers map[string]string) *httptest.ResponseRecorder {
+		body := `{"wallet_id":"` + wallet.ID.String() + `","operation_type":"DEPOSIT","amount":100}`
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/wallet", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(map[string]string{"Prefer": "wait=5, Respond-Async"})
+	require.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, "/api/v1/operations/"+queued.ID.String(), w.Header().Get("Location"))
+	assert.Equal(t, "respond-async", w.Header().Get("Preference-Applied"))
+
+	var response entity.QueuedOperation
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, queued.ID, response.ID)
+	assert.Equal(t, entity.QueuedPending, response.Status)
+
+	// without the preference, and with a precondition, the operation is made right away
+	w = send(nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = send(map[string]string{"Prefer": "respond-async", "If-Match": `"2"`})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	queueRepo.AssertNumberOfCalls(t, "Enqueue", 1)
+}
+
+func TestHandlerAddOperation_AsyncRejected(t *testing.T) {
+	queueRepo := new(MockOperationQueueRepository)
+	router := setupQueueRouter(queueRepo, repository.NewMemoryWalletRepository())
+
+	missing, duplicate := uuid.New(), uuid.New()
+	queueRepo.On("Enqueue", mock.Anything, missing, mock.Anything, mock.Anything, mock.Anything).Return(nil, repository.ErrWalletNotFound)
+	queueRepo.On("Enqueue", mock.Anything, duplicate, mock.Anything, mock.Anything, mock.Anything).Return(nil, repository.ErrDuplicateOperation)
+
+	for walletID, wantStatus := range map[uuid.UUID]int{missing: http.StatusNotFound, duplicate: http.StatusConflict} {
+		body := `{"wallet_id":"` + walletID.String() + `","operation_type":"DEPOSIT","amount":100}`
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/wallet", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Prefer", "respond-async")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, wantStatus, w.Code)
+	}
+}
+
+func TestHandlerGetOperation_Queued(t *testing.T) {
+	queueRepo := new(MockOperationQueueRepository)
+	walletRepo := repository.NewMemoryWalletRepository()
+	router := setupQueueRouter(queueRepo, walletRepo)
+	ctx := context.Background()
+
+	wallet, err := walletRepo.CreateWallet(ctx, entity.WalletCreate{})
+	require.NoError(t, err)
+	applied, err := walletRepo.AddOperation(ctx, wallet.ID, "DEPOSIT", 10000, entity.OperationDetails{}, 0)
+	require.NoError(t, err)
+
+	pending := &entity.QueuedOperation{ID: uuid.New(), WalletID: wallet.ID, Status: entity.QueuedPending}
+	failed := &entity.QueuedOperation{ID: uuid.New(), WalletID: wallet.ID, Status: entity.QueuedFailed, Error: repository.ErrInsufficientFunds.Error()}
+	missing := uuid.New()
+
+	queueRepo.On("GetQueued", mock.Anything, pending.ID).Return(pending, nil)
+	queueRepo.On("GetQueued", mock.Anything, failed.ID).Return(failed, nil)
+	queueRepo.On("GetQueued", mock.Anything, applied.Operation.ID).
+		Return(&entity.QueuedOperation{ID: applied.Operation.ID, Status: entity.QueuedApplied}, nil)
+	queueRepo.On("GetQueued", mock.Anything, missing).Return(nil, repository.ErrQueuedOperationNotFound)
+
+	get := func(operationID uuid.UUID) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/operations/"+operationID.String(), nil))
+		return w
+	}
+
+	w := get(pending.ID)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"PENDING"`)
+
+	w = get(failed.ID)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"FAILED"`)
+	assert.Contains(t, w.Body.String(), repository.ErrInsufficientFunds.Error())
+
+	// an applied operation is served from the history of the wallet
+	w = get(applied.Operation.ID)
+	require.Equal(t, http.StatusOK, w.Code)
+	var operation entity.Operation
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &operation))
+	assert.Equal(t, applied.Operation.ID, operation.ID)
+	assert.NotNil(t, operation.BalanceAfter)
+
+	w = get(missing)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,179 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"wallet_controller/internal/outbox"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"wallet_controller/internal/entity"
+)
+
+type MockOutboxRepository struct {
+	mock.Mock
+	events []entity.Event
+}
+
+func (m *MockOutboxRepository) ProcessPending(ctx context.Context, limit int, handle func(event entity.Event) error) (int, error) {
+	m.Called(ctx, limit)
+
+	processed := 0
+	for _, event := range m.events {
+		if processed == limit {
+			break
+		}
+		if err := handle(event); err != nil {
+			break
+		}
+		processed++
+	}
+	m.events = m.events[processed:]
+
+	return processed, nil
+}
+
+type recordingPublisher struct {
+	published []entity.Event
+	failOn    int64
+}
+
+func (p *recordingPublisher) Publish(_ context.Context, event entity.Event) error {
+	if event.ID == p.failOn {
+		return errors.New("publish failed")
+	}
+	p.published = append(p.published, event)
+	return nil
+}
+
+func newTestEvent(id int64) entity.Event {
+	return entity.Event{
+		ID:        id,
+		Type:      entity.EventBalanceChanged,
+		WalletID:  uuid.New(),
+		Payload:   json.RawMessage(`{"balance_after":100}`),
+		CreatedAt: time.Now(),
+	}
+}
+
+func TestWriterPublisher_WritesJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	publisher := outbox.NewWriterPublisher(&buf)
+
+	require.NoError(t, publisher.Publish(context.Background(), newTestEvent(1)))
+	require.NoError(t, publisher.Publish(context.Background(), newTestEvent(2)))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var event entity.Event
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &event))
+	assert.Equal(t, int64(2), event.ID)
+	assert.JSONEq(t, `{"balance_after":100}`, string(event.Payload))
+}
+
+func TestFilePublisher_AppendsEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+
+	publisher, err := outbox.NewFilePublisher(path)
+	require.NoError(t, err)
+	require.NoError(t, publisher.Publish(context.Background(), newTestEvent(1)))
+	require.NoError(t, publisher.Close())
+
+	publisher, err = outbox.NewFilePublisher(path)
+	require.NoError(t, err)
+	require.NoError(t, publisher.Publish(context.Background(), newTestEvent(2)))
+	require.NoError(t, publisher.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(data), "\n"))
+}
+
+func TestHTTPPublisher_PostsEvent(t *testing.T) {
+	var received entity.Event
+	var eventID string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		eventID = r.Header.Get("X-Event-ID")
+		body, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(body, &received)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	publisher := outbox.NewHTTPPublisher(server.URL, nil)
+	event := newTestEvent(42)
+
+	require.NoError(t, publisher.Publish(context.Background(), event))
+	assert.Equal(t, "42", eventID)
+	assert.Equal(t, event.WalletID, received.WalletID)
+}
+
+func TestHTTPPublisher_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	publisher := outbox.NewHTTPPublisher(server.URL, nil)
+
+	err := publisher.Publish(context.Background(), newTestEvent(1))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "503")
+}
+
+func TestNewPublisher_UnknownKind(t *testing.T) {
+	_, err := outbox.NewPublisher("kafka", "", "")
+	assert.Error(t, err)
+
+	publisher, err := outbox.NewPublisher("none", "", "")
+	assert.NoError(t, err)
+	assert.Nil(t, publisher)
+}
+
+func TestRelay_DrainPublishesAllEvents(t *testing.T) {
+	repo := &MockOutboxRepository{events: []entity.Event{newTestEvent(1), newTestEvent(2), newTestEvent(3)}}
+	repo.On("ProcessPending", mock.Anything, 2)
+
+	publisher := &recordingPublisher{}
+	relay := outbox.NewRelay(repo, publisher, time.Second, 2)
+
+	n := relay.Drain(context.Background())
+
+	assert.Equal(t, 3, n)
+	require.Len(t, publisher.published, 3)
+	assert.Equal(t, int64(3), publisher.published[2].ID)
+	repo.AssertNumberOfCalls(t, "ProcessPending", 2)
+}
+
+func TestRelay_DrainStopsOnPublishError(t *testing.T) {
+	repo := &MockOutboxRepository{events: []entity.Event{newTestEvent(1), newTestEvent(2), newTestEvent(3)}}
+	repo.On("ProcessPending", mock.Anything, 10)
+
+	publisher := &recordingPublisher{failOn: 2}
+	relay := outbox.NewRelay(repo, publisher, time.Second, 10)
+
+	n := relay.Drain(context.Background())
+
+	assert.Equal(t, 1, n)
+	require.Len(t, publisher.published, 1)
+
+	publisher.failOn = 0
+	n = relay.Drain(context.Background())
+
+	assert.Equal(t, 2, n)
+	assert.Len(t, publisher.published, 3)
+}
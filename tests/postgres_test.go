@@ -0,0 +1,213 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"wallet_controller/internal/storage"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+// testDatabaseURLEnv points the repository tests at an existing server instead of
+// a throwaway one started from the Postgres binaries.
+const testDatabaseURLEnv = "WALLET_TEST_DATABASE_URL"
+
+// errNoPostgres means there is nothing to run the repository tests against.
+var errNoPostgres = errors.New("postgres is not available")
+
+var testPostgres struct {
+	once       sync.Once
+	connString string
+	err        error
+	stop       func()
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if testPostgres.stop != nil {
+		testPostgres.stop()
+	}
+	os.Exit(code)
+}
+
+// setupTestDB returns a pool bound to a fresh migrated schema, the schema is dropped
+// when the test ends. The test is skipped when no Postgres is available.
+func setupTestDB(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	connString := testDatabase(t)
+	ctx := context.Background()
+
+	schema := "test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	execAdmin(t, connString, "CREATE SCHEMA "+schema)
+	t.Cleanup(func() {
+		execAdmin(t, connString, "DROP SCHEMA IF EXISTS "+schema+" CASCADE")
+	})
+
+	config, err := pgxpool.ParseConfig(connString)
+	require.NoError(t, err, "Failed to parse connection config")
+	config.ConnConfig.RuntimeParams["timezone"] = "UTC"
+	// extensions stay in public, so it follows the test schema
+	config.ConnConfig.RuntimeParams["search_path"] = schema + ", public"
+
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	require.NoError(t, err, "Failed to create connection pool")
+
+	err = storage.Migrate(pool)
+	require.NoError(t, err, "Failed to create schema")
+
+	return pool
+}
+
+// teardownTestDB closes the pool, setupTestDB drops its schema afterwards.
+func teardownTestDB(t *testing.T, pool *pgxpool.Pool) {
+	pool.Close()
+}
+
+// testDatabase returns the connection string of the test server, starting it on first use.
+func testDatabase(t *testing.T) string {
+	t.Helper()
+
+	testPostgres.once.Do(func() {
+		if connString := os.Getenv(testDatabaseURLEnv); connString != "" {
+			testPostgres.connString = connString
+		} else {
+			testPostgres.connString, testPostgres.stop, testPostgres.err = startPostgres()
+		}
+		if testPostgres.err == nil {
+			// the migration creates the extension in the first schema of search_path
+			testPostgres.err = execConn(testPostgres.connString, `CREATE EXTENSION IF NOT EXISTS "uuid-ossp" SCHEMA public`)
+		}
+	})
+
+	if errors.Is(testPostgres.err, errNoPostgres) {
+		t.Skipf("%s, set %s or put initdb and pg_ctl on PATH", testPostgres.err.Error(), testDatabaseURLEnv)
+	}
+	require.NoError(t, testPostgres.err, "Failed to start postgres")
+
+	return testPostgres.connString
+}
+
+// startPostgres runs a throwaway server with its data and socket in a temporary directory.
+func startPostgres() (connString string, stop func(), err error) {
+	initdb, err := findPostgresBinary("initdb")
+	if err != nil {
+		return "", nil, err
+	}
+	pgCtl, err := findPostgresBinary("pg_ctl")
+	if err != nil {
+		return "", nil, err
+	}
+	if os.Geteuid() == 0 {
+		return "", nil, fmt.Errorf("%w: initdb refuses to run as root", errNoPostgres)
+	}
+
+	dir, err := os.MkdirTemp("", "wallet-pg-")
+	if err != nil {
+		return "", nil, err
+	}
+	dataDir := filepath.Join(dir, "data")
+	logFile := filepath.Join(dir, "postgres.log")
+
+	port, err := freePort()
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", nil, err
+	}
+
+	if out, err := exec.Command(initdb, "-D", dataDir, "-U", "postgres", "-A", "trust", "-E", "UTF8", "--no-sync").CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("initdb: %w: %s", err, out)
+	}
+
+	options := fmt.Sprintf("-p %d -k %s -c listen_addresses=localhost -c fsync=off -c full_page_writes=off", port, dir)
+	if out, err := exec.Command(pgCtl, "-D", dataDir, "-l", logFile, "-o", options, "-w", "start").CombinedOutput(); err != nil {
+		log, _ := os.ReadFile(logFile)
+		os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("pg_ctl start: %w: %s%s", err, out, log)
+	}
+
+	stop = func() {
+		exec.Command(pgCtl, "-D", dataDir, "-m", "immediate", "-w", "stop").Run()
+		os.RemoveAll(dir)
+	}
+
+	return fmt.Sprintf("postgresql://postgres@localhost:%d/postgres?sslmode=disable", port), stop, nil
+}
+
+// findPostgresBinary looks on PATH and then in the usual install directories.
+func findPostgresBinary(name string) (string, error) {
+	if path, err := exec.LookPath(name); err == nil {
+		return path, nil
+	}
+
+	for _, pattern := range []string{
+		"/usr/lib/postgresql/*/bin/",
+		"/usr/pgsql-*/bin/",
+		"/usr/local/pgsql/bin/",
+		"/opt/homebrew/opt/postgresql*/bin/",
+	} {
+		matches, _ := filepath.Glob(pattern + name)
+		if len(matches) == 0 {
+			continue
+		}
+		// prefer the newest major version
+		sort.Slice(matches, func(i, j int) bool {
+			return majorVersion(matches[i]) > majorVersion(matches[j])
+		})
+		return matches[0], nil
+	}
+
+	return "", fmt.Errorf("%w: %s not found", errNoPostgres, name)
+}
+
+func majorVersion(path string) int {
+	for _, part := range strings.Split(path, string(filepath.Separator)) {
+		digits := strings.TrimLeft(part, "abcdefghijklmnopqrstuvwxyz@-")
+		if version, err := strconv.Atoi(digits); err == nil {
+			return version
+		}
+	}
+	return 0
+}
+
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+func execAdmin(t *testing.T, connString, sql string) {
+	t.Helper()
+	require.NoError(t, execConn(connString, sql), "Failed to run %q", sql)
+}
+
+func execConn(connString, sql string) error {
+	ctx := context.Background()
+
+	conn, err := pgx.Connect(ctx, connString)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+
+	_, err = conn.Exec(ctx, sql)
+	return err
+}
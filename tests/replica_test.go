@@ -0,0 +1,150 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"wallet_controller/internal/handler"
+	"wallet_controller/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePool answers the replica lag query with lag seconds, or fails with err.
+type fakePool struct {
+	name string
+	lag  *float64
+	err  error
+}
+
+type fakeRow struct {
+	pool *fakePool
+}
+
+func (r fakeRow) Scan(dest ...any) error {
+	if r.pool.err != nil {
+		return r.pool.err
+	}
+	*(dest[0].(**float64)) = r.pool.lag
+	return nil
+}
+
+func (p *fakePool) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (p *fakePool) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return fakeRow{pool: p}
+}
+
+func (p *fakePool) BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error) {
+	return nil, errors.New("not implemented")
+}
+
+func floatPtr(value float64) *float64 {
+	return &value
+}
+
+func TestReadRouter_LagGuard(t *testing.T) {
+	ctx := context.Background()
+	primary := &fakePool{name: "primary"}
+	replica := &fakePool{name: "replica"}
+	reads := storage.NewReadRouter(primary, replica, storage.ReadRouterConfig{MaxLag: time.Second, CheckInterval: time.Minute})
+
+	// nothing is known about the replica before the first check
+	assert.Same(t, primary, reads.Reader(ctx))
+
+	replica.lag = floatPtr(0.2)
+	reads.CheckLag(ctx)
+	assert.Same(t, replica, reads.Reader(ctx))
+	assert.Same(t, primary, reads.Reader(storage.WithPrimary(ctx)))
+
+	replica.lag = floatPtr(5)
+	reads.CheckLag(ctx)
+	assert.Same(t, primary, reads.Reader(ctx))
+	assert.Equal(t, 5.0, reads.Stats().LagSeconds)
+
+	replica.lag = nil
+	reads.CheckLag(ctx)
+	assert.Same(t, primary, reads.Reader(ctx))
+
+	replica.lag = floatPtr(0)
+	reads.CheckLag(ctx)
+	assert.Same(t, replica, reads.Reader(ctx))
+
+	replica.err = errors.New("connection refused")
+	reads.CheckLag(ctx)
+	assert.Same(t, primary, reads.Reader(ctx))
+
+	stats := reads.Stats()
+	assert.False(t, stats.Healthy)
+	assert.Equal(t, int64(2), stats.ReplicaReads)
+	assert.Equal(t, int64(5), stats.PrimaryReads)
+}
+
+func TestReadRouter_SingleReader(t *testing.T) {
+	ctx := context.Background()
+	primary := &fakePool{name: "primary"}
+	replica := &fakePool{name: "replica", lag: floatPtr(0)}
+	reads := storage.NewReadRouter(primary, replica, storage.ReadRouterConfig{MaxLag: time.Second, CheckInterval: time.Minute})
+	reads.CheckLag(ctx)
+
+	statementCtx := storage.WithSingleReader(ctx)
+	assert.Same(t, replica, reads.Reader(statementCtx))
+
+	// the replica falls behind in the middle of the statement, the statement stays on it
+	replica.lag = floatPtr(5)
+	reads.CheckLag(ctx)
+	assert.Same(t, primary, reads.Reader(ctx))
+	assert.Same(t, replica, reads.Reader(statementCtx))
+
+	// and a statement started on the primary stays there
+	statementCtx = storage.WithSingleReader(ctx)
+	assert.Same(t, primary, reads.Reader(statementCtx))
+	replica.lag = floatPtr(0)
+	reads.CheckLag(ctx)
+	assert.Same(t, primary, reads.Reader(statementCtx))
+}
+
+func TestReadYourWrites(t *testing.T) {
+	primary := &fakePool{name: "primary"}
+	replica := &fakePool{name: "replica", lag: floatPtr(0)}
+	reads := storage.NewReadRouter(primary, replica, storage.ReadRouterConfig{CheckInterval: time.Minute, Window: 50 * time.Millisecond})
+	reads.CheckLag(context.Background())
+
+	router := setupGinRouter()
+	router.Use(handler.ReadYourWrites(reads))
+	router.GET("/read", func(c *gin.Context) {
+		c.String(http.StatusOK, reads.Reader(c.Request.Context()).(*fakePool).name)
+	})
+	router.POST("/write", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	router.POST("/rejected", func(c *gin.Context) {
+		c.Status(http.StatusConflict)
+	})
+
+	send := func(method, path, client string) string {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-Client-ID", client)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	assert.Equal(t, "replica", send(http.MethodGet, "/read", "a"))
+
+	send(http.MethodPost, "/write", "a")
+	send(http.MethodPost, "/rejected", "b")
+	assert.Equal(t, "primary", send(http.MethodGet, "/read", "a"))
+	assert.Equal(t, "replica", send(http.MethodGet, "/read", "b"))
+	assert.Equal(t, "replica", send(http.MethodGet, "/read", "c"))
+
+	time.Sleep(80 * time.Millisecond)
+	assert.Equal(t, "replica", send(http.MethodGet, "/read", "a"))
+}
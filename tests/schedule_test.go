@@ -0,0 +1,282 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"wallet_controller/internal/cron"
+	"wallet_controller/internal/entity"
+	"wallet_controller/internal/handler"
+	"wallet_controller/internal/repository"
+	"wallet_controller/internal/schedule"
+	"wallet_controller/internal/service"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockScheduleRepository struct {
+	mock.Mock
+}
+
+func (m *MockScheduleRepository) CreateSchedule(ctx context.Context, scheduled *entity.ScheduledOperation) error {
+	args := m.Called(ctx, scheduled)
+	return args.Error(0)
+}
+
+func (m *MockScheduleRepository) GetSchedule(ctx context.Context, scheduleID uuid.UUID) (*entity.ScheduledOperation, error) {
+	args := m.Called(ctx, scheduleID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*entity.ScheduledOperation), args.Error(1)
+}
+
+func (m *MockScheduleRepository) ListSchedules(ctx context.Context, walletID *uuid.UUID) ([]entity.ScheduledOperation, error) {
+	args := m.Called(ctx, walletID)
+	return args.Get(0).([]entity.ScheduledOperation), args.Error(1)
+}
+
+func (m *MockScheduleRepository) UpdateSchedule(ctx context.Context, scheduled *entity.ScheduledOperation) error {
+	args := m.Called(ctx, scheduled)
+	return args.Error(0)
+}
+
+func (m *MockScheduleRepository) CancelSchedule(ctx context.Context, scheduleID uuid.UUID) error {
+	args := m.Called(ctx, scheduleID)
+	return args.Error(0)
+}
+
+func (m *MockScheduleRepository) ListRuns(ctx context.Context, scheduleID uuid.UUID, limit int) ([]entity.ScheduledRun, error) {
+	args := m.Called(ctx, scheduleID, limit)
+	return args.Get(0).([]entity.ScheduledRun), args.Error(1)
+}
+
+func (m *MockScheduleRepository) ClaimDueSchedules(ctx context.Context, limit int, lease time.Duration) ([]entity.ScheduledOperation, error) {
+	args := m.Called(ctx, limit, lease)
+	return args.Get(0).([]entity.ScheduledOperation), args.Error(1)
+}
+
+func (m *MockScheduleRepository) FinishRun(ctx context.Context, run entity.ScheduledRun, nextRunAt *time.Time) error {
+	args := m.Called(ctx, run, nextRunAt)
+	return args.Error(0)
+}
+
+func (m *MockScheduleRepository) RetryRun(ctx context.Context, run entity.ScheduledRun, retryAfter time.Duration) error {
+	args := m.Called(ctx, run, retryAfter)
+	return args.Error(0)
+}
+
+func TestCronNext(t *testing.T) {
+	from := time.Date(2024, time.January, 31, 10, 30, 0, 0, time.UTC)
+
+	cases := []struct {
+		expr string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2024, time.January, 31, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, time.January, 31, 10, 45, 0, 0, time.UTC)},
+		{"0 9 * * *", time.Date(2024, time.February, 1, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 29 2 *", time.Date(2024, time.February, 29, 12, 0, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2024, time.February, 1, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", time.Date(2024, time.February, 4, 9, 0, 0, 0, time.UTC)},
+		// with both day fields set a day matching either of them is taken
+		{"0 0 15 * 6", time.Date(2024, time.February, 3, 0, 0, 0, 0, time.UTC)},
+		{"30,45 10 * * *", time.Date(2024, time.January, 31, 10, 45, 0, 0, time.UTC)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			expr, err := cron.Parse(tc.expr)
+			require.NoError(t, err)
+
+			next, ok := expr.Next(from)
+			require.True(t, ok)
+			assert.Equal(t, tc.next, next)
+		})
+	}
+}
+
+func TestCronParse_Invalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "a * * * *"} {
+		_, err := cron.Parse(expr)
+		assert.Error(t, err, expr)
+	}
+
+	expr, err := cron.Parse("0 0 30 2 *")
+	require.NoError(t, err)
+	_, ok := expr.Next(time.Now())
+	assert.False(t, ok)
+}
+
+func newDueSchedule(cronExpr string, attempts int) entity.ScheduledOperation {
+	return entity.ScheduledOperation{
+		ID:            uuid.New(),
+		WalletID:      uuid.New(),
+		OperationType: "WITHDRAW",
+		Amount:        100,
+		Cron:          cronExpr,
+		NextRunAt:     time.Now().UTC().Add(-time.Minute).Truncate(time.Minute),
+		Status:        entity.ScheduleActive,
+		Attempts:      attempts,
+	}
+}
+
+func TestScheduleWorker_RunsOperation(t *testing.T) {
+	scheduled := newDueSchedule("0 9 * * *", 0)
+	operationID := uuid.New()
+
+	walletService := new(MockWalletService)
+	walletService.On("AddOperation", mock.Anything, mock.MatchedBy(func(req *entity.OperationRequest) bool {
+		return req.WalletID == scheduled.WalletID && req.Amount == 100 &&
+			req.ExternalReference == schedule.RunReference(scheduled)
+	})).Return(entity.OperationResult{Operation: entity.Operation{ID: operationID}}, nil)
+
+	repo := new(MockScheduleRepository)
+	repo.On("ClaimDueSchedules", mock.Anything, 50, mock.Anything).Return([]entity.ScheduledOperation{scheduled}, nil)
+	repo.On("FinishRun", mock.Anything, mock.MatchedBy(func(run entity.ScheduledRun) bool {
+		return run.Status == entity.RunSucceeded && run.Attempt == 1 && *run.OperationID == operationID
+	}), mock.MatchedBy(func(next *time.Time) bool {
+		return next != nil && next.After(time.Now()) && next.Hour() == 9 && next.Minute() == 0
+	})).Return(nil)
+
+	worker := schedule.NewWorker(repo, walletService, schedule.WorkerConfig{})
+
+	assert.Equal(t, 1, worker.ProcessDue(context.Background()))
+	repo.AssertExpectations(t)
+	walletService.AssertExpectations(t)
+}
+
+func TestScheduleWorker_RetriesTransientFailure(t *testing.T) {
+	scheduled := newDueSchedule("", 1)
+
+	walletService := new(MockWalletService)
+	walletService.On("AddOperation", mock.Anything, mock.Anything).Return(entity.OperationResult{}, repository.ErrWalletLocked)
+
+	repo := new(MockScheduleRepository)
+	repo.On("ClaimDueSchedules", mock.Anything, 50, mock.Anything).Return([]entity.ScheduledOperation{scheduled}, nil)
+	repo.On("RetryRun", mock.Anything, mock.MatchedBy(func(run entity.ScheduledRun) bool {
+		return run.Status == entity.RunFailed && run.Attempt == 2 && run.Error != ""
+	}), 2*time.Second).Return(nil)
+
+	worker := schedule.NewWorker(repo, walletService, schedule.WorkerConfig{RetryBase: time.Second})
+
+	assert.Equal(t, 0, worker.ProcessDue(context.Background()))
+	repo.AssertExpectations(t)
+	repo.AssertNotCalled(t, "FinishRun", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestScheduleWorker_FailsOneOffRun(t *testing.T) {
+	for name, tc := range map[string]struct {
+		err      error
+		attempts int
+	}{
+		"insufficient funds":       {repository.ErrInsufficientFunds, 0},
+		"out of attempts":          {repository.ErrWalletLocked, 4},
+		"wallet deleted meanwhile": {repository.ErrWalletNotFound, 0},
+	} {
+		t.Run(name, func(t *testing.T) {
+			scheduled := newDueSchedule("", tc.attempts)
+
+			walletService := new(MockWalletService)
+			walletService.On("AddOperation", mock.Anything, mock.Anything).Return(entity.OperationResult{}, tc.err)
+
+			repo := new(MockScheduleRepository)
+			repo.On("ClaimDueSchedules", mock.Anything, 50, mock.Anything).Return([]entity.ScheduledOperation{scheduled}, nil)
+			repo.On("FinishRun", mock.Anything, mock.MatchedBy(func(run entity.ScheduledRun) bool {
+				return run.Status == entity.RunFailed && run.Attempt == tc.attempts+1
+			}), (*time.Time)(nil)).Return(nil)
+
+			worker := schedule.NewWorker(repo, walletService, schedule.WorkerConfig{MaxAttempts: 5})
+
+			assert.Equal(t, 0, worker.ProcessDue(context.Background()))
+			repo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestHandlerCreateSchedule_Success(t *testing.T) {
+	walletID := uuid.New()
+
+	repo := new(MockScheduleRepository)
+	repo.On("CreateSchedule", mock.Anything, mock.MatchedBy(func(scheduled *entity.ScheduledOperation) bool {
+		return scheduled.WalletID == walletID && scheduled.Cron == "0 9 1 * *" &&
+			scheduled.NextRunAt.Day() == 1 && scheduled.NextRunAt.Hour() == 9
+	})).Run(func(args mock.Arguments) {
+		args.Get(1).(*entity.ScheduledOperation).ID = uuid.New()
+	}).Return(nil)
+
+	router := setupValidatedRouter()
+	router.POST("/api/v1/scheduled-operations", handler.NewScheduleHandler(service.NewScheduleService(repo)).CreateSchedule)
+
+	body, _ := json.Marshal(map[string]any{
+		"wallet_id":      walletID,
+		"operation_type": "DEPOSIT",
+		"amount":         500,
+		"description":    "Monthly allowance",
+		"cron":           "0 9 1 * *",
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/scheduled-operations", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var scheduled entity.ScheduledOperation
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &scheduled))
+	assert.Equal(t, entity.ScheduleActive, scheduled.Status)
+	assert.Equal(t, "Monthly allowance", scheduled.Description)
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerCreateSchedule_InvalidRequest(t *testing.T) {
+	repo := new(MockScheduleRepository)
+
+	router := setupValidatedRouter()
+	router.POST("/api/v1/scheduled-operations", handler.NewScheduleHandler(service.NewScheduleService(repo)).CreateSchedule)
+
+	walletID := uuid.New().String()
+	for _, body := range []string{
+		`{"wallet_id":"` + walletID + `","operation_type":"DEPOSIT","amount":100}`,
+		`{"wallet_id":"` + walletID + `","operation_type":"DEPOSIT","amount":100,"cron":"every day"}`,
+		`{"wallet_id":"` + walletID + `","operation_type":"DEPOSIT","amount":100,"cron":"0 0 30 2 *"}`,
+		`{"wallet_id":"` + walletID + `","operation_type":"DEPOSIT","amount":0,"run_at":"2030-01-01T00:00:00Z"}`,
+		`{"wallet_id":"` + walletID + `","operation_type":"DEPOSIT","amount":100,"run_at":"tomorrow"}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/scheduled-operations", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+
+	repo.AssertNotCalled(t, "CreateSchedule", mock.Anything, mock.Anything)
+}
+
+func TestHandlerListScheduleRuns_NotFound(t *testing.T) {
+	scheduleID := uuid.New()
+
+	repo := new(MockScheduleRepository)
+	repo.On("GetSchedule", mock.Anything, scheduleID).Return(nil, repository.ErrScheduleNotFound)
+
+	router := setupValidatedRouter()
+	router.GET("/api/v1/scheduled-operations/:id/runs", handler.NewScheduleHandler(service.NewScheduleService(repo)).ListRuns)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/scheduled-operations/"+scheduleID.String()+"/runs", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	repo.AssertNotCalled(t, "ListRuns", mock.Anything, mock.Anything, mock.Anything)
+}
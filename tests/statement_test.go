@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+	"wallet_controller/internal/entity"
+	"wallet_controller/internal/statement"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestStatement(t *testing.T, format string, operations int) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w, err := statement.NewWriter(format, &buf)
+	require.NoError(t, err)
+
+	walletID := uuid.New()
+	from := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+
+	require.NoError(t, w.Begin(entity.StatementPeriod{
+		WalletID:       walletID,
+		From:           from,
+		To:             from.AddDate(0, 1, 0),
+		OpeningBalance: 1000,
+	}))
+
+	balance := 1000
+	for i := 0; i < operations; i++ {
+		operation := entity.Operation{
+			ID:            uuid.New(),
+			WalletID:      walletID,
+			Seq:           int64(i + 1),
+			OperationType: "DEPOSIT",
+			Amount:        150,
+			CreatedAt:     from.Add(time.Duration(i) * time.Minute),
+		}
+		balance += operation.SignedAmount()
+		require.NoError(t, w.Row(entity.StatementRow{Operation: operation, Balance: balance}))
+	}
+
+	require.NoError(t, w.End(balance))
+
+	return buf.Bytes()
+}
+
+func TestStatementCSV(t *testing.T) {
+	records, err := csv.NewReader(bytes.NewReader(writeTestStatement(t, statement.FormatCSV, 2))).ReadAll()
+	require.NoError(t, err)
+
+	require.Len(t, records, 5)
+	assert.Equal(t, []string{"date", "operation_id", "operation_type", "amount", "balance", "description", "external_reference"}, records[0])
+	assert.Equal(t, "OPENING_BALANCE", records[1][2])
+	assert.Equal(t, "1000", records[1][4])
+	assert.Equal(t, "1150", records[2][4])
+	assert.Equal(t, "1300", records[3][4])
+	assert.Equal(t, "CLOSING_BALANCE", records[4][2])
+	assert.Equal(t, "1300", records[4][4])
+}
+
+func TestStatementJSONL(t *testing.T) {
+	scanner := bufio.NewScanner(bytes.NewReader(writeTestStatement(t, statement.FormatJSONL, 2)))
+
+	var types []string
+	var last map[string]any
+	for scanner.Scan() {
+		var line map[string]any
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		types = append(types, line["type"].(string))
+		last = line
+	}
+
+	assert.Equal(t, []string{"opening_balance", "operation", "operation", "closing_balance"}, types)
+	assert.Equal(t, float64(1300), last["balance"])
+}
+
+func TestStatementPDF(t *testing.T) {
+	// Enough rows to span several pages.
+	data := writeTestStatement(t, statement.FormatPDF, 150)
+
+	assert.True(t, bytes.HasPrefix(data, []byte("%PDF-1.4")))
+	assert.True(t, bytes.HasSuffix(data, []byte("%%EOF\n")))
+	assert.Contains(t, string(data), "(Closing balance: 235.00) Tj")
+
+	pages := regexp.MustCompile(`/Count (\d+)`).FindSubmatch(data)
+	require.NotNil(t, pages)
+	count, _ := strconv.Atoi(string(pages[1]))
+	assert.Equal(t, 3, count)
+
+	// startxref must point at the cross-reference table.
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(data)
+	require.NotNil(t, startxref)
+	offset, _ := strconv.Atoi(string(startxref[1]))
+	assert.True(t, bytes.HasPrefix(data[offset:], []byte("xref\n")))
+}
+
+func TestStatementUnknownFormat(t *testing.T) {
+	_, err := statement.NewWriter("xlsx", &bytes.Buffer{})
+	assert.Error(t, err)
+}
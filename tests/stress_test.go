@@ -0,0 +1,249 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+	"wallet_controller/internal/entity"
+	"wallet_controller/internal/handler"
+	"wallet_controller/internal/repository"
+	"wallet_controller/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stressOperation makes one operation on a wallet. It returns repository errors as they
+// are, so ErrWalletLocked can be retried and ErrInsufficientFunds counted as a rejection.
+type stressOperation func(ctx context.Context, walletID uuid.UUID, operationType string, amount int) error
+
+// stressLedger is what the workers expect the wallets to hold after the run.
+type stressLedger struct {
+	mu         sync.Mutex
+	balances   map[uuid.UUID]int
+	operations map[uuid.UUID]int
+	rejected   int
+	locked     int
+}
+
+func (l *stressLedger) record(walletID uuid.UUID, amount int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.balances[walletID] += amount
+	l.operations[walletID]++
+}
+
+func (l *stressLedger) reject() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rejected++
+}
+
+func (l *stressLedger) lock() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.locked++
+}
+
+// stressLockHold keeps wallets of the memory repository held long enough for the
+// workers to run into ErrWalletLocked, as they do against Postgres.
+const stressLockHold = 50 * time.Microsecond
+
+func TestMemoryWalletRepository_Stress(t *testing.T) {
+	repo := repository.NewMemoryWalletRepository()
+	repo.SetLockHold(stressLockHold)
+	locked := runWalletStress(t, repo, repositoryStressOperation(repo))
+	assert.Positive(t, locked, "no operation ran into a locked wallet, the retry path was not exercised")
+}
+
+func TestHTTP_Stress(t *testing.T) {
+	repo := repository.NewMemoryWalletRepository()
+	repo.SetLockHold(stressLockHold)
+	locked := runWalletStress(t, repo, httpStressOperation(repo))
+	assert.Positive(t, locked, "no request ran into a locked wallet, the 503 path was not exercised")
+}
+
+// stressSize is the number of wallets, workers and operations per worker, scaled down under -short.
+func stressSize() (wallets, workers, operations int) {
+	if testing.Short() {
+		return 3, 8, 50
+	}
+	return 4, 16, 250
+}
+
+func repositoryStressOperation(repo repository.WalletRepositoryInterface) stressOperation {
+	return func(ctx context.Context, walletID uuid.UUID, operationType string, amount int) error {
+		_, err := repo.AddOperation(ctx, walletID, operationType, amount*100, entity.OperationDetails{}, 0)
+		return err
+	}
+}
+
+// httpStressOperation goes through the validator, handler and service in front of repo.
+func httpStressOperation(repo repository.WalletRepositoryInterface) stressOperation {
+	gin.SetMode(gin.TestMode)
+	router := setupValidatedRouter()
+	router.POST("/api/v1/wallet", handler.NewWalletHandler(service.NewWalletService(repo)).AddOperation)
+
+	return func(ctx context.Context, walletID uuid.UUID, operationType string, amount int) error {
+		body, err := json.Marshal(entity.OperationRequest{
+			WalletID:      walletID,
+			OperationType: operationType,
+			Amount:        amount,
+		})
+		if err != nil {
+			return err
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/wallet", bytes.NewReader(body)).WithContext(ctx)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code == http.StatusOK {
+			return nil
+		}
+
+		var response struct {
+			Error string `json:"error"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &response)
+		if w.Code == http.StatusServiceUnavailable && response.Error == repository.ErrWalletLocked.Error() {
+			return repository.ErrWalletLocked
+		}
+		if w.Code == http.StatusConflict && response.Error == repository.ErrInsufficientFunds.Error() {
+			return repository.ErrInsufficientFunds
+		}
+		return fmt.Errorf("unexpected response %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// runWalletStress fires random deposits, withdrawals and transfers at a few wallets from many
+// goroutines, then checks that the wallets agree with what the workers saw succeed. It
+// returns how many times an operation found its wallet locked and was retried.
+func runWalletStress(t *testing.T, repo repository.WalletRepositoryInterface, operate stressOperation) int {
+	ctx := context.Background()
+	walletsCount, workers, operations := stressSize()
+
+	seed := time.Now().UnixNano()
+	t.Logf("seed %d", seed)
+
+	ledger := &stressLedger{
+		balances:   make(map[uuid.UUID]int),
+		operations: make(map[uuid.UUID]int),
+	}
+	wallets := make([]uuid.UUID, walletsCount)
+	for i := range wallets {
+		wallet, err := repo.CreateWallet(ctx, entity.WalletCreate{})
+		require.NoError(t, err)
+		wallets[i] = wallet.ID
+	}
+
+	// retry waits out the row lock the way a client of the API has to
+	retry := func(walletID uuid.UUID, operationType string, amount int) error {
+		for {
+			err := operate(ctx, walletID, operationType, amount)
+			if !errors.Is(err, repository.ErrWalletLocked) {
+				return err
+			}
+			ledger.lock()
+			time.Sleep(time.Duration(rand.Intn(500)) * time.Microsecond)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func(random *rand.Rand) {
+			defer wg.Done()
+
+			for i := 0; i < operations; i++ {
+				from := wallets[random.Intn(len(wallets))]
+				amount := 1 + random.Intn(50)
+
+				switch random.Intn(3) {
+				case 0:
+					if assert.NoError(t, retry(from, "DEPOSIT", amount)) {
+						ledger.record(from, amount*100)
+					}
+
+				case 1:
+					err := retry(from, "WITHDRAW", amount)
+					if errors.Is(err, repository.ErrInsufficientFunds) {
+						ledger.reject()
+					} else if assert.NoError(t, err) {
+						ledger.record(from, -amount*100)
+					}
+
+				case 2:
+					to := wallets[random.Intn(len(wallets))]
+					err := retry(from, "WITHDRAW", amount)
+					if errors.Is(err, repository.ErrInsufficientFunds) {
+						ledger.reject()
+						continue
+					}
+					if !assert.NoError(t, err) {
+						continue
+					}
+					ledger.record(from, -amount*100)
+					if assert.NoError(t, retry(to, "DEPOSIT", amount)) {
+						ledger.record(to, amount*100)
+					}
+				}
+			}
+		}(rand.New(rand.NewSource(seed + int64(worker))))
+	}
+	wg.Wait()
+
+	t.Logf("%d operations rejected for insufficient funds, %d retried on a locked wallet", ledger.rejected, ledger.locked)
+
+	for _, walletID := range wallets {
+		wallet, err := repo.GetByID(ctx, walletID)
+		require.NoError(t, err)
+
+		// no lost updates: every acknowledged operation is in the balance exactly once
+		assert.Equal(t, ledger.balances[walletID], wallet.Balance, "balance of %s", walletID)
+		assert.GreaterOrEqual(t, wallet.Balance, 0, "balance of %s", walletID)
+		assert.Equal(t, int64(ledger.operations[walletID]+1), wallet.Version, "version of %s", walletID)
+
+		history := allOperations(t, repo, walletID)
+		assert.Len(t, history, ledger.operations[walletID], "operations of %s", walletID)
+
+		sum := 0
+		for _, operation := range history {
+			sum += operation.SignedAmount()
+			assert.GreaterOrEqual(t, *operation.BalanceAfter, 0, "operation %s", operation.ID)
+		}
+		assert.Equal(t, wallet.Balance, sum, "sum of operations of %s", walletID)
+	}
+
+	discrepancies, err := repo.Reconcile(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, discrepancies)
+
+	return ledger.locked
+}
+
+// allOperations pages through the whole history of a wallet, newest first.
+func allOperations(t *testing.T, repo repository.WalletRepositoryInterface, walletID uuid.UUID) []entity.Operation {
+	var history []entity.Operation
+	filter := entity.OperationFilter{WalletID: walletID, Limit: 500}
+	for {
+		page, err := repo.ListOperations(context.Background(), filter)
+		require.NoError(t, err)
+		history = append(history, page...)
+		if len(page) < filter.Limit {
+			return history
+		}
+		filter.BeforeSeq = page[len(page)-1].Seq
+	}
+}
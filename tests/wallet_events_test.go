@@ -0,0 +1,174 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"wallet_controller/internal/handler"
+	"wallet_controller/internal/notify"
+	"wallet_controller/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"wallet_controller/internal/entity"
+)
+
+type sseMessage struct {
+	id    string
+	event string
+	data  string
+}
+
+func readSSEMessage(t *testing.T, reader *bufio.Reader) sseMessage {
+	t.Helper()
+
+	var msg sseMessage
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			if msg.data != "" {
+				return msg
+			}
+		case strings.HasPrefix(line, "id:"):
+			msg.id = strings.TrimSpace(strings.TrimPrefix(line, "id:"))
+		case strings.HasPrefix(line, "event:"):
+			msg.event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			msg.data = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+	}
+}
+
+func TestBroker_PublishesToWalletSubscribers(t *testing.T) {
+	broker := notify.NewBroker()
+	walletID := uuid.New()
+
+	events, cancel := broker.Subscribe(walletID)
+	defer cancel()
+	other, cancelOther := broker.Subscribe(uuid.New())
+	defer cancelOther()
+
+	broker.Publish(entity.BalanceEvent{Seq: 1, WalletID: walletID, Balance: 100})
+
+	event := <-events
+	assert.Equal(t, int64(1), event.Seq)
+	assert.Len(t, other, 0)
+}
+
+func TestBroker_DropsSlowSubscriber(t *testing.T) {
+	broker := notify.NewBroker()
+	walletID := uuid.New()
+
+	events, cancel := broker.Subscribe(walletID)
+	defer cancel()
+
+	for i := 0; i < 100; i++ {
+		broker.Publish(entity.BalanceEvent{Seq: int64(i + 1), WalletID: walletID})
+	}
+
+	count := 0
+	for range events {
+		count++
+	}
+	assert.Less(t, count, 100)
+}
+
+func TestHandlerStreamEvents_ResumesAndStreamsLive(t *testing.T) {
+	mockService := new(MockWalletService)
+	walletID := uuid.New()
+	broker := notify.NewBroker()
+
+	mockService.On("GetWallet", mock.Anything, walletID).Return(&entity.Wallet{ID: walletID, Balance: 300}, nil)
+	mockService.On("GetBalanceEvents", mock.Anything, walletID, int64(5), mock.Anything).Return([]entity.BalanceEvent{
+		{Seq: 6, WalletID: walletID, OperationType: "DEPOSIT", Amount: 100, Balance: 200},
+		{Seq: 7, WalletID: walletID, OperationType: "DEPOSIT", Amount: 100, Balance: 300},
+	}, nil)
+
+	mHandler := handler.NewWalletEventsHandler(mockService, broker)
+
+	router := setupGinRouter()
+	router.GET("/wallets/:id/events", mHandler.StreamEvents)
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/wallets/"+walletID.String()+"/events", nil)
+	require.NoError(t, err)
+	req.Header.Set("Last-Event-ID", "5")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+	assert.Equal(t, "6", readSSEMessage(t, reader).id)
+	assert.Equal(t, "7", readSSEMessage(t, reader).id)
+
+	// Already replayed events are not sent twice.
+	broker.Publish(entity.BalanceEvent{Seq: 7, WalletID: walletID, Balance: 300})
+	broker.Publish(entity.BalanceEvent{Seq: 8, WalletID: walletID, OperationType: "WITHDRAW", Amount: 50, Balance: 250})
+
+	msg := readSSEMessage(t, reader)
+	assert.Equal(t, "8", msg.id)
+	assert.Equal(t, "balance", msg.event)
+
+	var event entity.BalanceEvent
+	require.NoError(t, json.Unmarshal([]byte(msg.data), &event))
+	assert.Equal(t, 250, event.Balance)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestHandlerStreamEvents_InvalidLastEventID(t *testing.T) {
+	mockService := new(MockWalletService)
+
+	mHandler := handler.NewWalletEventsHandler(mockService, notify.NewBroker())
+
+	router := setupGinRouter()
+	router.GET("/wallets/:id/events", mHandler.StreamEvents)
+
+	req := httptest.NewRequest(http.MethodGet, "/wallets/"+uuid.New().String()+"/events", nil)
+	req.Header.Set("Last-Event-ID", "abc")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandlerStreamEvents_UnknownWallet(t *testing.T) {
+	walletID := uuid.New()
+	mockService := new(MockWalletService)
+	mockService.On("GetWallet", mock.Anything, walletID).
+		Return(nil, fmt.Errorf("failed to get wallet: %w", repository.ErrWalletNotFound))
+
+	mHandler := handler.NewWalletEventsHandler(mockService, notify.NewBroker())
+
+	router := setupGinRouter()
+	router.GET("/wallets/:id/events", mHandler.StreamEvents)
+
+	req := httptest.NewRequest(http.MethodGet, "/wallets/"+walletID.String()+"/events", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -4,15 +4,21 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 	"wallet_controller/internal/handler"
+	"wallet_controller/internal/openapi"
+	"wallet_controller/internal/repository"
+	"wallet_controller/internal/statement"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"wallet_controller/internal/entity"
 )
 
@@ -28,9 +34,109 @@ func (m *MockWalletService) GetWallet(ctx context.Context, walletID uuid.UUID) (
 	return args.Get(0).(*entity.Wallet), args.Error(1)
 }
 
-func (m *MockWalletService) AddOperation(ctx context.Context, operation *entity.OperationRequest) (entity.Wallet, error) {
+func (m *MockWalletService) UpdateWallet(ctx context.Context, walletID uuid.UUID, update entity.WalletUpdate) (*entity.Wallet, error) {
+	args := m.Called(ctx, walletID, update)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*entity.Wallet), args.Error(1)
+}
+
+func (m *MockWalletService) SearchWallets(ctx context.Context, filter entity.WalletFilter) ([]entity.Wallet, error) {
+	args := m.Called(ctx, filter)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]entity.Wallet), args.Error(1)
+}
+
+func (m *MockWalletService) AddOperation(ctx context.Context, operation *entity.OperationRequest) (entity.OperationResult, error) {
 	args := m.Called(ctx, operation)
-	return args.Get(0).(entity.Wallet), args.Error(1)
+	return args.Get(0).(entity.OperationResult), args.Error(1)
+}
+
+func (m *MockWalletService) GetOperation(ctx context.Context, operationID uuid.UUID) (*entity.Operation, error) {
+	args := m.Called(ctx, operationID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*entity.Operation), args.Error(1)
+}
+
+func (m *MockWalletService) GetBalanceEvents(ctx context.Context, walletID uuid.UUID, afterSeq int64, limit int) ([]entity.BalanceEvent, error) {
+	args := m.Called(ctx, walletID, afterSeq, limit)
+	return args.Get(0).([]entity.BalanceEvent), args.Error(1)
+}
+
+func (m *MockWalletService) ListOperations(ctx context.Context, filter entity.OperationFilter) ([]entity.Operation, error) {
+	args := m.Called(ctx, filter)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]entity.Operation), args.Error(1)
+}
+
+func (m *MockWalletService) GetBalanceAt(ctx context.Context, walletID uuid.UUID, at time.Time) (*entity.WalletBalance, error) {
+	args := m.Called(ctx, walletID, at)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*entity.WalletBalance), args.Error(1)
+}
+
+func (m *MockWalletService) WriteStatement(ctx context.Context, walletID uuid.UUID, from, to time.Time, w statement.Writer) error {
+	args := m.Called(ctx, walletID, from, to, w)
+	return args.Error(0)
+}
+
+func (m *MockWalletService) CreateWallet(ctx context.Context, create entity.WalletCreate) (*entity.Wallet, error) {
+	args := m.Called(ctx, create)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*entity.Wallet), args.Error(1)
+}
+
+func (m *MockWalletService) FreezeWallet(ctx context.Context, walletID uuid.UUID, freeze entity.Freeze) (*entity.Wallet, error) {
+	args := m.Called(ctx, walletID, freeze)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*entity.Wallet), args.Error(1)
+}
+
+func (m *MockWalletService) UnfreezeWallet(ctx context.Context, walletID uuid.UUID) (*entity.Wallet, error) {
+	args := m.Called(ctx, walletID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*entity.Wallet), args.Error(1)
+}
+
+func (m *MockWalletService) GetFreezeHistory(ctx context.Context, walletID uuid.UUID) ([]entity.FreezeEvent, error) {
+	args := m.Called(ctx, walletID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]entity.FreezeEvent), args.Error(1)
+}
+
+func (m *MockWalletService) SetBalanceShards(ctx context.Context, walletID uuid.UUID, shards int) (*entity.Wallet, error) {
+	args := m.Called(ctx, walletID, shards)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*entity.Wallet), args.Error(1)
+}
+
+func (m *MockWalletService) ReverseOperation(ctx context.Context, operationID uuid.UUID, details entity.OperationDetails) (entity.OperationResult, error) {
+	args := m.Called(ctx, operationID, details)
+	return args.Get(0).(entity.OperationResult), args.Error(1)
+}
+
+func (m *MockWalletService) Reconcile(ctx context.Context) ([]entity.Discrepancy, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]entity.Discrepancy), args.Error(1)
 }
 
 func setupGinRouter() *gin.Engine {
@@ -38,6 +144,14 @@ func setupGinRouter() *gin.Engine {
 	return gin.New()
 }
 
+// setupValidatedRouter mounts the OpenAPI request validator like router.SetupRouter does,
+// routes must be registered with their full /api/v1 paths to be matched against the document.
+func setupValidatedRouter() *gin.Engine {
+	r := setupGinRouter()
+	r.Use(openapi.NewValidator().Middleware())
+	return r
+}
+
 func TestHandlerGetWallet_Success(t *testing.T) {
 	mockService := new(MockWalletService)
 	walletID := uuid.New()
@@ -148,7 +262,7 @@ func TestHandlerAddOperation_Success_Deposit(t *testing.T) {
 
 	mockService.On("AddOperation", mock.Anything, mock.MatchedBy(func(r *entity.OperationRequest) bool {
 		return r.WalletID == walletID && r.OperationType == "DEPOSIT" && r.Amount == 100
-	})).Return(expectedWallet, nil)
+	})).Return(entity.OperationResult{Wallet: expectedWallet}, nil)
 
 	mHandler := handler.NewWalletHandler(mockService)
 
@@ -189,7 +303,7 @@ func TestHandlerAddOperation_Success_Withdraw(t *testing.T) {
 
 	mockService.On("AddOperation", mock.Anything, mock.MatchedBy(func(r *entity.OperationRequest) bool {
 		return r.WalletID == walletID && r.OperationType == "WITHDRAW" && r.Amount == 50
-	})).Return(expectedWallet, nil)
+	})).Return(entity.OperationResult{Wallet: expectedWallet}, nil)
 
 	mHandler := handler.NewWalletHandler(mockService)
 
@@ -225,11 +339,11 @@ func TestHandlerAddOperation_InvalidOperationType(t *testing.T) {
 
 	mHandler := handler.NewWalletHandler(mockService)
 
-	router := setupGinRouter()
-	router.POST("/wallet", mHandler.AddOperation)
+	router := setupValidatedRouter()
+	router.POST("/api/v1/wallet", mHandler.AddOperation)
 
 	body, _ := json.Marshal(req)
-	httpReq := httptest.NewRequest(http.MethodPost, "/wallet", bytes.NewReader(body))
+	httpReq := httptest.NewRequest(http.MethodPost, "/api/v1/wallet", bytes.NewReader(body))
 	httpReq.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
@@ -254,11 +368,11 @@ func TestHandlerAddOperation_NegativeAmount(t *testing.T) {
 
 	mHandler := handler.NewWalletHandler(mockService)
 
-	router := setupGinRouter()
-	router.POST("/wallet", mHandler.AddOperation)
+	router := setupValidatedRouter()
+	router.POST("/api/v1/wallet", mHandler.AddOperation)
 
 	body, _ := json.Marshal(req)
-	httpReq := httptest.NewRequest(http.MethodPost, "/wallet", bytes.NewReader(body))
+	httpReq := httptest.NewRequest(http.MethodPost, "/api/v1/wallet", bytes.NewReader(body))
 	httpReq.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
@@ -279,11 +393,11 @@ func TestHandlerAddOperation_ZeroAmount(t *testing.T) {
 
 	mHandler := handler.NewWalletHandler(mockService)
 
-	router := setupGinRouter()
-	router.POST("/wallet", mHandler.AddOperation)
+	router := setupValidatedRouter()
+	router.POST("/api/v1/wallet", mHandler.AddOperation)
 
 	body, _ := json.Marshal(req)
-	httpReq := httptest.NewRequest(http.MethodPost, "/wallet", bytes.NewReader(body))
+	httpReq := httptest.NewRequest(http.MethodPost, "/api/v1/wallet", bytes.NewReader(body))
 	httpReq.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
@@ -302,11 +416,11 @@ func TestHandlerAddOperation_MissingWalletID(t *testing.T) {
 
 	mHandler := handler.NewWalletHandler(mockService)
 
-	router := setupGinRouter()
-	router.POST("/wallet", mHandler.AddOperation)
+	router := setupValidatedRouter()
+	router.POST("/api/v1/wallet", mHandler.AddOperation)
 
 	body, _ := json.Marshal(req)
-	httpReq := httptest.NewRequest(http.MethodPost, "/wallet", bytes.NewReader(body))
+	httpReq := httptest.NewRequest(http.MethodPost, "/api/v1/wallet", bytes.NewReader(body))
 	httpReq.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
@@ -320,10 +434,10 @@ func TestHandlerAddOperation_InvalidJSON(t *testing.T) {
 
 	mHandler := handler.NewWalletHandler(mockService)
 
-	router := setupGinRouter()
-	router.POST("/wallet", mHandler.AddOperation)
+	router := setupValidatedRouter()
+	router.POST("/api/v1/wallet", mHandler.AddOperation)
 
-	httpReq := httptest.NewRequest(http.MethodPost, "/wallet", bytes.NewReader([]byte("invalid json")))
+	httpReq := httptest.NewRequest(http.MethodPost, "/api/v1/wallet", bytes.NewReader([]byte("invalid json")))
 	httpReq.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
@@ -343,7 +457,7 @@ func TestHandlerAddOperation_ServiceError(t *testing.T) {
 	}
 
 	mockService.On("AddOperation", mock.Anything, mock.Anything).
-		Return(entity.Wallet{}, assert.AnError)
+		Return(entity.OperationResult{}, assert.AnError)
 
 	mHandler := handler.NewWalletHandler(mockService)
 
@@ -361,3 +475,711 @@ func TestHandlerAddOperation_ServiceError(t *testing.T) {
 
 	mockService.AssertExpectations(t)
 }
+
+func TestHandlerGetBalanceAt_Success(t *testing.T) {
+	mockService := new(MockWalletService)
+	walletID := uuid.New()
+	at := time.Date(2026, 9, 30, 23, 59, 59, 0, time.UTC)
+
+	mockService.On("GetBalanceAt", mock.Anything, walletID, mock.MatchedBy(func(value time.Time) bool {
+		return value.Equal(at)
+	})).Return(&entity.WalletBalance{WalletID: walletID, Balance: 4200, At: at}, nil)
+
+	mHandler := handler.NewWalletHandler(mockService)
+
+	router := setupGinRouter()
+	router.GET("/wallets/:id/balance", mHandler.GetBalanceAt)
+
+	req := httptest.NewRequest(http.MethodGet, "/wallets/"+walletID.String()+"/balance?at=2026-09-30T23:59:59Z", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var balance entity.WalletBalance
+	err := json.Unmarshal(w.Body.Bytes(), &balance)
+	assert.NoError(t, err)
+	assert.Equal(t, 4200, balance.Balance)
+	assert.True(t, balance.At.Equal(at))
+
+	mockService.AssertExpectations(t)
+}
+
+func TestHandlerGetBalanceAt_NotFound(t *testing.T) {
+	mockService := new(MockWalletService)
+	walletID := uuid.New()
+
+	mockService.On("GetBalanceAt", mock.Anything, walletID, mock.Anything).
+		Return(nil, fmt.Errorf("failed to get balance: %w", repository.ErrWalletNotFound))
+
+	mHandler := handler.NewWalletHandler(mockService)
+
+	router := setupGinRouter()
+	router.GET("/wallets/:id/balance", mHandler.GetBalanceAt)
+
+	req := httptest.NewRequest(http.MethodGet, "/wallets/"+walletID.String()+"/balance", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandlerGetBalanceAt_InvalidTimestamp(t *testing.T) {
+	mockService := new(MockWalletService)
+
+	mHandler := handler.NewWalletHandler(mockService)
+
+	router := setupGinRouter()
+	router.GET("/wallets/:id/balance", mHandler.GetBalanceAt)
+
+	req := httptest.NewRequest(http.MethodGet, "/wallets/"+uuid.New().String()+"/balance?at=yesterday", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandlerGetStatement_CSV(t *testing.T) {
+	mockService := new(MockWalletService)
+	walletID := uuid.New()
+	from := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	mockService.On("WriteStatement", mock.Anything, walletID, mock.MatchedBy(func(value time.Time) bool {
+		return value.Equal(from)
+	}), mock.MatchedBy(func(value time.Time) bool {
+		return value.Equal(to)
+	}), mock.Anything).Run(func(args mock.Arguments) {
+		w := args.Get(4).(statement.Writer)
+		_ = w.Begin(entity.StatementPeriod{WalletID: walletID, From: from, To: to, OpeningBalance: 1000})
+		_ = w.End(1000)
+	}).Return(nil)
+
+	mHandler := handler.NewWalletHandler(mockService)
+
+	router := setupGinRouter()
+	router.GET("/wallets/:id/statement", mHandler.GetStatement)
+
+	req := httptest.NewRequest(http.MethodGet,
+		"/wallets/"+walletID.String()+"/statement?from=2026-09-01T00:00:00Z&to=2026-10-01T00:00:00Z", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+	assert.Contains(t, w.Body.String(), "OPENING_BALANCE")
+	assert.Contains(t, w.Body.String(), "CLOSING_BALANCE")
+
+	mockService.AssertExpectations(t)
+}
+
+func TestHandlerGetStatement_NotFound(t *testing.T) {
+	mockService := new(MockWalletService)
+	walletID := uuid.New()
+
+	mockService.On("WriteStatement", mock.Anything, walletID, mock.Anything, mock.Anything, mock.Anything).
+		Return(repository.ErrWalletNotFound)
+
+	mHandler := handler.NewWalletHandler(mockService)
+
+	router := setupGinRouter()
+	router.GET("/wallets/:id/statement", mHandler.GetStatement)
+
+	req := httptest.NewRequest(http.MethodGet,
+		"/wallets/"+walletID.String()+"/statement?from=2026-09-01T00:00:00Z&to=2026-10-01T00:00:00Z&format=pdf", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+	assert.Empty(t, w.Header().Get("Content-Disposition"))
+
+	mockService.AssertExpectations(t)
+}
+
+func TestHandlerGetStatement_InvalidParams(t *testing.T) {
+	mockService := new(MockWalletService)
+	walletID := uuid.New().String()
+
+	mHandler := handler.NewWalletHandler(mockService)
+
+	router := setupGinRouter()
+	router.GET("/wallets/:id/statement", mHandler.GetStatement)
+
+	queries := []string{
+		"",
+		"?from=2026-09-01T00:00:00Z",
+		"?from=2026-10-01T00:00:00Z&to=2026-09-01T00:00:00Z",
+		"?from=2026-09-01T00:00:00Z&to=2026-10-01T00:00:00Z&format=xlsx",
+	}
+	for _, query := range queries {
+		req := httptest.NewRequest(http.MethodGet, "/wallets/"+walletID+"/statement"+query, nil)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+
+	mockService.AssertNotCalled(t, "WriteStatement")
+}
+
+func TestHandlerUpdateWallet_Success(t *testing.T) {
+	mockService := new(MockWalletService)
+	walletID := uuid.New()
+
+	expectedWallet := &entity.Wallet{
+		ID:          walletID,
+		Balance:     1000,
+		OwnerID:     "customer-42",
+		DisplayName: "Savings",
+		Labels:      map[string]string{"tier": "gold"},
+	}
+
+	mockService.On("UpdateWallet", mock.Anything, walletID, mock.MatchedBy(func(update entity.WalletUpdate) bool {
+		return update.OwnerID != nil && *update.OwnerID == "customer-42" &&
+			update.DisplayName != nil && *update.DisplayName == "Savings" &&
+			update.Labels != nil && (*update.Labels)["tier"] == "gold" &&
+			update.ExternalReference == nil
+	})).Return(expectedWallet, nil)
+
+	mHandler := handler.NewWalletHandler(mockService)
+
+	router := setupValidatedRouter()
+	router.PATCH("/api/v1/wallets/:id", mHandler.UpdateWallet)
+
+	body := `{"owner_id":"customer-42","display_name":"Savings","labels":{"tier":"gold"}}`
+	req := httptest.NewRequest(http.MethodPatch, "/api/v1/wallets/"+walletID.String(), bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var wallet entity.Wallet
+	err := json.Unmarshal(w.Body.Bytes(), &wallet)
+	assert.NoError(t, err)
+	assert.Equal(t, *expectedWallet, wallet)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestHandlerUpdateWallet_NotFound(t *testing.T) {
+	mockService := new(MockWalletService)
+	walletID := uuid.New()
+
+	mockService.On("UpdateWallet", mock.Anything, walletID, mock.Anything).Return(nil, repository.ErrWalletNotFound)
+
+	mHandler := handler.NewWalletHandler(mockService)
+
+	router := setupValidatedRouter()
+	router.PATCH("/api/v1/wallets/:id", mHandler.UpdateWallet)
+
+	req := httptest.NewRequest(http.MethodPatch, "/api/v1/wallets/"+walletID.String(), bytes.NewReader([]byte(`{"display_name":"x"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestHandlerUpdateWallet_InvalidBody(t *testing.T) {
+	mockService := new(MockWalletService)
+
+	mHandler := handler.NewWalletHandler(mockService)
+
+	router := setupValidatedRouter()
+	router.PATCH("/api/v1/wallets/:id", mHandler.UpdateWallet)
+
+	for _, body := range []string{`{"balance":100}`, `{"labels":{"tier":1}}`, `{"credit_limit":-100}`} {
+		req := httptest.NewRequest(http.MethodPatch, "/api/v1/wallets/"+uuid.New().String(), bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+
+	mockService.AssertNotCalled(t, "UpdateWallet")
+}
+
+func TestHandlerSearchWallets(t *testing.T) {
+	mockService := new(MockWalletService)
+	after := uuid.New()
+
+	wallets := []entity.Wallet{{ID: uuid.New(), OwnerID: "customer-42", Labels: map[string]string{"tier": "gold", "region": "eu"}}}
+
+	mockService.On("SearchWallets", mock.Anything, entity.WalletFilter{
+		OwnerID: "customer-42",
+		Labels:  map[string]string{"tier": "gold", "region": "eu"},
+		After:   after,
+		Limit:   10,
+	}).Return(wallets, nil)
+
+	mHandler := handler.NewWalletHandler(mockService)
+
+	router := setupValidatedRouter()
+	router.GET("/api/v1/wallets", mHandler.SearchWallets)
+
+	req := httptest.NewRequest(http.MethodGet,
+		"/api/v1/wallets?owner_id=customer-42&label=tier:gold&label=region:eu&limit=10&after="+after.String(), nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp map[string][]entity.Wallet
+	err := json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.NoError(t, err)
+	assert.Equal(t, wallets, resp["wallets"])
+
+	mockService.AssertExpectations(t)
+}
+
+func TestHandlerSearchWallets_InvalidLabel(t *testing.T) {
+	mockService := new(MockWalletService)
+
+	mHandler := handler.NewWalletHandler(mockService)
+
+	router := setupValidatedRouter()
+	router.GET("/api/v1/wallets", mHandler.SearchWallets)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/wallets?label=tier:gold&label=region", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	mockService.AssertNotCalled(t, "SearchWallets")
+}
+
+func TestHandlerAddOperation_WithDetails(t *testing.T) {
+	mockService := new(MockWalletService)
+	walletID := uuid.New()
+
+	mockService.On("AddOperation", mock.Anything, mock.MatchedBy(func(r *entity.OperationRequest) bool {
+		return r.Description == "Salary" && r.ExternalReference == "payroll-2026-09" && r.Metadata["source"] == "payroll"
+	})).Return(entity.OperationResult{Wallet: entity.Wallet{ID: walletID, Balance: 10000}}, nil)
+
+	mHandler := handler.NewWalletHandler(mockService)
+
+	router := setupValidatedRouter()
+	router.POST("/api/v1/wallet", mHandler.AddOperation)
+
+	body := `{"wallet_id":"` + walletID.String() + `","operation_type":"DEPOSIT","amount":100,` +
+		`"description":"Salary","external_reference":"payroll-2026-09","metadata":{"source":"payroll"}}`
+	httpReq := httptest.NewRequest(http.MethodPost, "/api/v1/wallet", bytes.NewReader([]byte(body)))
+	httpReq.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, httpReq)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestHandlerAddOperation_DuplicateReference(t *testing.T) {
+	mockService := new(MockWalletService)
+	walletID := uuid.New()
+
+	mockService.On("AddOperation", mock.Anything, mock.Anything).
+		Return(entity.OperationResult{}, repository.ErrDuplicateOperation)
+
+	mHandler := handler.NewWalletHandler(mockService)
+
+	router := setupValidatedRouter()
+	router.POST("/api/v1/wallet", mHandler.AddOperation)
+
+	body := `{"wallet_id":"` + walletID.String() + `","operation_type":"DEPOSIT","amount":100,"external_reference":"payroll-2026-09"}`
+	httpReq := httptest.NewRequest(http.MethodPost, "/api/v1/wallet", bytes.NewReader([]byte(body)))
+	httpReq.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, httpReq)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestHandlerAddOperation_FrozenWallet(t *testing.T) {
+	mockService := new(MockWalletService)
+	walletID := uuid.New()
+
+	mockService.On("AddOperation", mock.Anything, mock.Anything).
+		Return(entity.OperationResult{}, repository.ErrWalletFrozen)
+
+	router := setupValidatedRouter()
+	router.POST("/api/v1/wallet", handler.NewWalletHandler(mockService).AddOperation)
+
+	body := `{"wallet_id":"` + walletID.String() + `","operation_type":"WITHDRAW","amount":100}`
+	httpReq := httptest.NewRequest(http.MethodPost, "/api/v1/wallet", bytes.NewReader([]byte(body)))
+	httpReq.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, httpReq)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "wallet is frozen")
+}
+
+func TestHandlerAddOperation_UnknownWallet(t *testing.T) {
+	mockService := new(MockWalletService)
+
+	mockService.On("AddOperation", mock.Anything, mock.Anything).
+		Return(entity.OperationResult{}, repository.ErrWalletNotFound)
+
+	router := setupValidatedRouter()
+	router.POST("/api/v1/wallet", handler.NewWalletHandler(mockService).AddOperation)
+
+	body := `{"wallet_id":"` + uuid.New().String() + `","operation_type":"DEPOSIT","amount":100}`
+	httpReq := httptest.NewRequest(http.MethodPost, "/api/v1/wallet", bytes.NewReader([]byte(body)))
+	httpReq.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, httpReq)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "wallet not found")
+}
+
+func TestHandlerAddOperation_WalletLocked(t *testing.T) {
+	mockService := new(MockWalletService)
+	mockService.On("AddOperation", mock.Anything, mock.Anything).
+		Return(entity.OperationResult{}, repository.ErrWalletLocked)
+
+	router := setupValidatedRouter()
+	router.POST("/api/v1/wallet", handler.NewWalletHandler(mockService).AddOperation)
+
+	body := `{"wallet_id":"` + uuid.New().String() + `","operation_type":"WITHDRAW","amount":100}`
+	httpReq := httptest.NewRequest(http.MethodPost, "/api/v1/wallet", bytes.NewReader([]byte(body)))
+	httpReq.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, httpReq)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), repository.ErrWalletLocked.Error())
+}
+
+func TestHandlerListOperations_Filters(t *testing.T) {
+	mockService := new(MockWalletService)
+	walletID := uuid.New()
+
+	operations := []entity.Operation{{
+		ID:            uuid.New(),
+		WalletID:      walletID,
+		Seq:           7,
+		OperationType: "DEPOSIT",
+		Amount:        10000,
+		OperationDetails: entity.OperationDetails{
+			Description: "Salary for September",
+			Metadata:    map[string]any{"source": "payroll"},
+		},
+	}}
+
+	mockService.On("ListOperations", mock.Anything, entity.OperationFilter{
+		WalletID:      walletID,
+		BeforeSeq:     10,
+		Limit:         20,
+		OperationType: "DEPOSIT",
+		Description:   "salary",
+		Metadata:      map[string]string{"source": "payroll"},
+	}).Return(operations, nil)
+
+	mHandler := handler.NewWalletHandler(mockService)
+
+	router := setupValidatedRouter()
+	router.GET("/api/v1/wallets/:id/operations", mHandler.ListOperations)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/wallets/"+walletID.String()+
+		"/operations?operation_type=DEPOSIT&description=salary&metadata=source:payroll&before_seq=10&limit=20", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp map[string][]entity.Operation
+	err := json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.NoError(t, err)
+	require.Len(t, resp["operations"], 1)
+	assert.Equal(t, "Salary for September", resp["operations"][0].Description)
+	assert.Equal(t, "payroll", resp["operations"][0].Metadata["source"])
+
+	mockService.AssertExpectations(t)
+}
+
+func TestHandlerListOperations_NotFound(t *testing.T) {
+	mockService := new(MockWalletService)
+	walletID := uuid.New()
+
+	mockService.On("ListOperations", mock.Anything, mock.Anything).Return(nil, repository.ErrWalletNotFound)
+
+	mHandler := handler.NewWalletHandler(mockService)
+
+	router := setupValidatedRouter()
+	router.GET("/api/v1/wallets/:id/operations", mHandler.ListOperations)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/wallets/"+walletID.String()+"/operations", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandlerAddOperation_ReturnsOperation(t *testing.T) {
+	mockService := new(MockWalletService)
+	walletID := uuid.New()
+	operationID := uuid.New()
+	before, after := 5000, 15000
+
+	mockService.On("AddOperation", mock.Anything, mock.Anything).Return(entity.OperationResult{
+		Wallet: entity.Wallet{ID: walletID, Balance: after},
+		Operation: entity.Operation{
+			ID:            operationID,
+			WalletID:      walletID,
+			Seq:           3,
+			OperationType: "DEPOSIT",
+			Amount:        10000,
+			BalanceBefore: &before,
+			BalanceAfter:  &after,
+			CreatedAt:     time.Date(2026, 9, 30, 12, 0, 0, 0, time.UTC),
+		},
+	}, nil)
+
+	mHandler := handler.NewWalletHandler(mockService)
+
+	router := setupValidatedRouter()
+	router.POST("/api/v1/wallet", mHandler.AddOperation)
+
+	body := `{"wallet_id":"` + walletID.String() + `","operation_type":"DEPOSIT","amount":100}`
+	httpReq := httptest.NewRequest(http.MethodPost, "/api/v1/wallet", bytes.NewReader([]byte(body)))
+	httpReq.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, httpReq)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var result entity.OperationResult
+	err := json.Unmarshal(w.Body.Bytes(), &result)
+	assert.NoError(t, err)
+	assert.Equal(t, after, result.Wallet.Balance)
+	assert.Equal(t, operationID, result.Operation.ID)
+	require.NotNil(t, result.Operation.BalanceBefore)
+	assert.Equal(t, before, *result.Operation.BalanceBefore)
+	require.NotNil(t, result.Operation.BalanceAfter)
+	assert.Equal(t, after, *result.Operation.BalanceAfter)
+}
+
+func TestHandlerGetOperation_Success(t *testing.T) {
+	mockService := new(MockWalletService)
+	operationID := uuid.New()
+	after := 4200
+
+	expected := &entity.Operation{
+		ID:            operationID,
+		WalletID:      uuid.New(),
+		Seq:           12,
+		OperationType: "WITHDRAW",
+		Amount:        800,
+		BalanceAfter:  &after,
+		CreatedAt:     time.Date(2026, 9, 30, 12, 0, 0, 0, time.UTC),
+	}
+	mockService.On("GetOperation", mock.Anything, operationID).Return(expected, nil)
+
+	mHandler := handler.NewWalletHandler(mockService)
+
+	router := setupValidatedRouter()
+	router.GET("/api/v1/operations/:id", mHandler.GetOperation)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/operations/"+operationID.String(), nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var operation entity.Operation
+	err := json.Unmarshal(w.Body.Bytes(), &operation)
+	assert.NoError(t, err)
+	assert.Equal(t, *expected, operation)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestHandlerGetOperation_NotFound(t *testing.T) {
+	mockService := new(MockWalletService)
+	operationID := uuid.New()
+
+	mockService.On("GetOperation", mock.Anything, operationID).Return(nil, repository.ErrOperationNotFound)
+
+	mHandler := handler.NewWalletHandler(mockService)
+
+	router := setupValidatedRouter()
+	router.GET("/api/v1/operations/:id", mHandler.GetOperation)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/operations/"+operationID.String(), nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestHandlerGetWallet_ETag(t *testing.T) {
+	mockService := new(MockWalletService)
+	walletID := uuid.New()
+
+	mockService.On("GetWallet", mock.Anything, walletID).Return(&entity.Wallet{ID: walletID, Balance: 5000, Version: 7}, nil)
+
+	mHandler := handler.NewWalletHandler(mockService)
+
+	router := setupGinRouter()
+	router.GET("/wallets/:id", mHandler.GetWallet)
+
+	req := httptest.NewRequest(http.MethodGet, "/wallets/"+walletID.String(), nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"7"`, w.Header().Get("ETag"))
+}
+
+func TestHandlerAddOperation_IfMatch(t *testing.T) {
+	walletID := uuid.New()
+	body := `{"wallet_id":"` + walletID.String() + `","operation_type":"WITHDRAW","amount":10}`
+
+	t.Run("passes the version", func(t *testing.T) {
+		mockService := new(MockWalletService)
+		mockService.On("AddOperation", mock.Anything, mock.MatchedBy(func(r *entity.OperationRequest) bool {
+			return r.ExpectedVersion == 7
+		})).Return(entity.OperationResult{Wallet: entity.Wallet{ID: walletID, Balance: 4000, Version: 8}}, nil)
+
+		router := setupValidatedRouter()
+		router.POST("/api/v1/wallet", handler.NewWalletHandler(mockService).AddOperation)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/wallet", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", `"7"`)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"8"`, w.Header().Get("ETag"))
+		mockService.AssertExpectations(t)
+	})
+
+	t.Run("wallet has changed", func(t *testing.T) {
+		mockService := new(MockWalletService)
+		mockService.On("AddOperation", mock.Anything, mock.Anything).Return(entity.OperationResult{}, repository.ErrVersionMismatch)
+
+		router := setupValidatedRouter()
+		router.POST("/api/v1/wallet", handler.NewWalletHandler(mockService).AddOperation)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/wallet", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", `"6"`)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	})
+
+	t.Run("tag never matches", func(t *testing.T) {
+		mockService := new(MockWalletService)
+
+		router := setupValidatedRouter()
+		router.POST("/api/v1/wallet", handler.NewWalletHandler(mockService).AddOperation)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/wallet", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", `W/"7"`)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+		mockService.AssertNotCalled(t, "AddOperation", mock.Anything, mock.Anything)
+	})
+}
+
+func TestHandlerUpdateWallet_CreditLimit(t *testing.T) {
+	mockService := new(MockWalletService)
+	walletID := uuid.New()
+
+	expectedWallet := &entity.Wallet{
+		ID:          walletID,
+		Balance:     -20000,
+		CreditLimit: 100000,
+		Available:   80000,
+		Overdraft:   20000,
+		Version:     3,
+	}
+
+	mockService.On("UpdateWallet", mock.Anything, walletID, mock.MatchedBy(func(update entity.WalletUpdate) bool {
+		return update.CreditLimit != nil && *update.CreditLimit == 100000 && update.MinBalance == nil
+	})).Return(expectedWallet, nil)
+
+	mHandler := handler.NewWalletHandler(mockService)
+
+	router := setupValidatedRouter()
+	router.PATCH("/api/v1/wallets/:id", mHandler.UpdateWallet)
+
+	req := httptest.NewRequest(http.MethodPatch, "/api/v1/wallets/"+walletID.String(), bytes.NewReader([]byte(`{"credit_limit":100000}`)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var wallet entity.Wallet
+	err := json.Unmarshal(w.Body.Bytes(), &wallet)
+	assert.NoError(t, err)
+	assert.Equal(t, *expectedWallet, wallet)
+
+	mockService.AssertExpectations(t)
+}
+
+func TestHandlerAddOperation_BelowFloor(t *testing.T) {
+	mockService := new(MockWalletService)
+
+	mockService.On("AddOperation", mock.Anything, mock.Anything).
+		Return(entity.OperationResult{}, repository.ErrInsufficientFunds)
+
+	router := setupValidatedRouter()
+	router.POST("/api/v1/wallet", handler.NewWalletHandler(mockService).AddOperation)
+
+	body := `{"wallet_id":"` + uuid.New().String() + `","operation_type":"WITHDRAW","amount":100}`
+	httpReq := httptest.NewRequest(http.MethodPost, "/api/v1/wallet", bytes.NewReader([]byte(body)))
+	httpReq.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, httpReq)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), repository.ErrInsufficientFunds.Error())
+}
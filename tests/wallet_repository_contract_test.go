@@ -0,0 +1,659 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+	"wallet_controller/internal/audit"
+	"wallet_controller/internal/entity"
+	"wallet_controller/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// walletRepositoryHarness is a repository under the contract together with a way to
+// hold one of its wallets the way a concurrent transaction does.
+type walletRepositoryHarness struct {
+	repo       repository.WalletRepositoryInterface
+	lockWallet func(t *testing.T, walletID uuid.UUID) (unlock func())
+}
+
+func TestMemoryWalletRepository_Contract(t *testing.T) {
+	runWalletRepositoryContract(t, func(t *testing.T) walletRepositoryHarness {
+		repo := repository.NewMemoryWalletRepository()
+		return walletRepositoryHarness{
+			repo: repo,
+			lockWallet: func(t *testing.T, walletID uuid.UUID) func() {
+				return repo.LockWallet(walletID)
+			},
+		}
+	})
+}
+
+// runWalletRepositoryContract checks the behaviour every WalletRepositoryInterface
+// implementation has to share. newHarness returns an empty repository for each case.
+func runWalletRepositoryContract(t *testing.T, newHarness func(t *testing.T) walletRepositoryHarness) {
+	ctx := context.Background()
+
+	newWallet := func(t *testing.T, repo repository.WalletRepositoryInterface, balance int) *entity.Wallet {
+		wallet, err := repo.CreateWallet(ctx, entity.WalletCreate{})
+		require.NoError(t, err)
+		if balance > 0 {
+			result, err := repo.AddOperation(ctx, wallet.ID, "DEPOSIT", balance, entity.OperationDetails{}, 0)
+			require.NoError(t, err)
+			wallet = &result.Wallet
+		}
+		return wallet
+	}
+
+	t.Run("CreateAndGet", func(t *testing.T) {
+		repo := newHarness(t).repo
+
+		created, err := repo.CreateWallet(ctx, entity.WalletCreate{
+			OwnerID:     "user-1",
+			DisplayName: "Savings",
+			Labels:      map[string]string{"tier": "gold"},
+			MinBalance:  100,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 0, created.Balance)
+		assert.Equal(t, int64(1), created.Version)
+		assert.False(t, created.Frozen)
+
+		wallet, err := repo.GetByID(ctx, created.ID)
+		require.NoError(t, err)
+		assert.Equal(t, created, wallet)
+		assert.Equal(t, map[string]string{"tier": "gold"}, wallet.Labels)
+
+		_, err = repo.CreateWallet(ctx, entity.WalletCreate{ID: created.ID})
+		assert.ErrorIs(t, err, repository.ErrWalletExists)
+
+		_, err = repo.GetByID(ctx, uuid.New())
+		assert.ErrorIs(t, err, repository.ErrWalletNotFound)
+	})
+
+	t.Run("DepositAndWithdraw", func(t *testing.T) {
+		repo := newHarness(t).repo
+		wallet := newWallet(t, repo, 0)
+
+		deposit, err := repo.AddOperation(ctx, wallet.ID, "DEPOSIT", 10000, entity.OperationDetails{Description: "Salary"}, 0)
+		require.NoError(t, err)
+		assert.Equal(t, 10000, deposit.Wallet.Balance)
+		assert.Equal(t, wallet.Version+1, deposit.Wallet.Version)
+		assert.Equal(t, 0, *deposit.Operation.BalanceBefore)
+		assert.Equal(t, 10000, *deposit.Operation.BalanceAfter)
+
+		withdrawal, err := repo.AddOperation(ctx, wallet.ID, "WITHDRAW", 10000, entity.OperationDetails{}, 0)
+		require.NoError(t, err)
+		assert.Equal(t, 0, withdrawal.Wallet.Balance)
+		assert.Greater(t, withdrawal.Operation.Seq, deposit.Operation.Seq)
+
+		operation, err := repo.GetOperation(ctx, deposit.Operation.ID)
+		require.NoError(t, err)
+		assert.Equal(t, wallet.ID, operation.WalletID)
+		assert.Equal(t, "DEPOSIT", operation.OperationType)
+		assert.Equal(t, 10000, operation.Amount)
+		assert.Equal(t, "Salary", operation.Description)
+		assert.Equal(t, deposit.Operation.Seq, operation.Seq)
+
+		_, err = repo.GetOperation(ctx, uuid.New())
+		assert.ErrorIs(t, err, repository.ErrOperationNotFound)
+	})
+
+	t.Run("InsufficientFunds", func(t *testing.T) {
+		repo := newHarness(t).repo
+		wallet := newWallet(t, repo, 5000)
+
+		_, err := repo.AddOperation(ctx, wallet.ID, "WITHDRAW", 5001, entity.OperationDetails{}, 0)
+		assert.ErrorIs(t, err, repository.ErrInsufficientFunds)
+
+		unchanged, err := repo.GetByID(ctx, wallet.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 5000, unchanged.Balance)
+		assert.Equal(t, wallet.Version, unchanged.Version)
+
+		operations, err := repo.ListOperations(ctx, entity.OperationFilter{WalletID: wallet.ID, Limit: 10})
+		require.NoError(t, err)
+		assert.Len(t, operations, 1)
+	})
+
+	t.Run("CreditLimitAndMinBalance", func(t *testing.T) {
+		repo := newHarness(t).repo
+		wallet := newWallet(t, repo, 1000)
+
+		_, err := repo.UpdateWallet(ctx, wallet.ID, entity.WalletUpdate{CreditLimit: intPtr(500)})
+		require.NoError(t, err)
+
+		result, err := repo.AddOperation(ctx, wallet.ID, "WITHDRAW", 1500, entity.OperationDetails{}, 0)
+		require.NoError(t, err)
+		assert.Equal(t, -500, result.Wallet.Balance)
+		assert.Equal(t, 500, result.Wallet.Overdraft)
+		assert.Equal(t, 0, result.Wallet.Available)
+
+		_, err = repo.AddOperation(ctx, wallet.ID, "WITHDRAW", 1, entity.OperationDetails{}, 0)
+		assert.ErrorIs(t, err, repository.ErrInsufficientFunds)
+
+		// deposits are allowed below the floor
+		_, err = repo.UpdateWallet(ctx, wallet.ID, entity.WalletUpdate{CreditLimit: intPtr(0), MinBalance: intPtr(1000)})
+		require.NoError(t, err)
+		result, err = repo.AddOperation(ctx, wallet.ID, "DEPOSIT", 100, entity.OperationDetails{}, 0)
+		require.NoError(t, err)
+		assert.Equal(t, -400, result.Wallet.Balance)
+	})
+
+	t.Run("NegativeLimits", func(t *testing.T) {
+		repo := newHarness(t).repo
+		wallet := newWallet(t, repo, 1000)
+
+		_, err := repo.CreateWallet(ctx, entity.WalletCreate{CreditLimit: -1})
+		assert.ErrorIs(t, err, repository.ErrInvalidLimits)
+		_, err = repo.CreateWallet(ctx, entity.WalletCreate{MinBalance: -1})
+		assert.ErrorIs(t, err, repository.ErrInvalidLimits)
+
+		_, err = repo.UpdateWallet(ctx, wallet.ID, entity.WalletUpdate{CreditLimit: intPtr(-1)})
+		assert.ErrorIs(t, err, repository.ErrInvalidLimits)
+		_, err = repo.UpdateWallet(ctx, wallet.ID, entity.WalletUpdate{MinBalance: intPtr(-1)})
+		assert.ErrorIs(t, err, repository.ErrInvalidLimits)
+
+		// a rejected update changes nothing
+		current, err := repo.GetByID(ctx, wallet.ID)
+		require.NoError(t, err)
+		assert.Equal(t, wallet.Version, current.Version)
+		assert.Equal(t, 0, current.CreditLimit)
+	})
+
+	t.Run("MissingWallet", func(t *testing.T) {
+		repo := newHarness(t).repo
+		missing := uuid.New()
+
+		_, err := repo.AddOperation(ctx, missing, "DEPOSIT", 100, entity.OperationDetails{}, 0)
+		assert.ErrorIs(t, err, repository.ErrWalletNotFound)
+
+		_, err = repo.UpdateWallet(ctx, missing, entity.WalletUpdate{})
+		assert.ErrorIs(t, err, repository.ErrWalletNotFound)
+
+		_, err = repo.SetFreeze(ctx, missing, fullFreeze())
+		assert.ErrorIs(t, err, repository.ErrWalletNotFound)
+
+		_, err = repo.GetBalanceAt(ctx, missing, time.Now())
+		assert.ErrorIs(t, err, repository.ErrWalletNotFound)
+
+		_, err = repo.ReverseOperation(ctx, uuid.New(), entity.OperationDetails{})
+		assert.ErrorIs(t, err, repository.ErrOperationNotFound)
+
+		operations, err := repo.ListOperations(ctx, entity.OperationFilter{WalletID: missing, Limit: 10})
+		require.NoError(t, err)
+		assert.Empty(t, operations)
+	})
+
+	t.Run("ExpectedVersion", func(t *testing.T) {
+		repo := newHarness(t).repo
+		wallet := newWallet(t, repo, 0)
+
+		_, err := repo.AddOperation(ctx, wallet.ID, "DEPOSIT", 100, entity.OperationDetails{}, wallet.Version+1)
+		assert.ErrorIs(t, err, repository.ErrVersionMismatch)
+
+		result, err := repo.AddOperation(ctx, wallet.ID, "DEPOSIT", 100, entity.OperationDetails{}, wallet.Version)
+		require.NoError(t, err)
+
+		_, err = repo.AddOperation(ctx, wallet.ID, "DEPOSIT", 100, entity.OperationDetails{}, wallet.Version)
+		assert.ErrorIs(t, err, repository.ErrVersionMismatch)
+
+		_, err = repo.AddOperation(ctx, wallet.ID, "DEPOSIT", 100, entity.OperationDetails{}, result.Wallet.Version)
+		assert.NoError(t, err)
+	})
+
+	t.Run("DuplicateExternalReference", func(t *testing.T) {
+		repo := newHarness(t).repo
+		wallet := newWallet(t, repo, 0)
+		other := newWallet(t, repo, 0)
+
+		details := entity.OperationDetails{ExternalReference: "payroll-2026-09"}
+		_, err := repo.AddOperation(ctx, wallet.ID, "DEPOSIT", 100, details, 0)
+		require.NoError(t, err)
+
+		_, err = repo.AddOperation(ctx, wallet.ID, "DEPOSIT", 100, details, 0)
+		assert.ErrorIs(t, err, repository.ErrDuplicateOperation)
+
+		// references are unique within a wallet
+		_, err = repo.AddOperation(ctx, other.ID, "DEPOSIT", 100, details, 0)
+		assert.NoError(t, err)
+	})
+
+	t.Run("LockedWallet", func(t *testing.T) {
+		harness := newHarness(t)
+		wallet := newWallet(t, harness.repo, 1000)
+
+		unlock := harness.lockWallet(t, wallet.ID)
+		_, err := harness.repo.AddOperation(ctx, wallet.ID, "WITHDRAW", 100, entity.OperationDetails{}, 0)
+		assert.ErrorIs(t, err, repository.ErrWalletLocked)
+
+		// reads do not wait for the lock
+		locked, err := harness.repo.GetByID(ctx, wallet.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 1000, locked.Balance)
+		unlock()
+
+		result, err := harness.repo.AddOperation(ctx, wallet.ID, "WITHDRAW", 100, entity.OperationDetails{}, 0)
+		require.NoError(t, err)
+		assert.Equal(t, 900, result.Wallet.Balance)
+	})
+
+	t.Run("FreezeAndReverse", func(t *testing.T) {
+		repo := newHarness(t).repo
+		wallet := newWallet(t, repo, 0)
+
+		deposit, err := repo.AddOperation(ctx, wallet.ID, "DEPOSIT", 3000, entity.OperationDetails{}, 0)
+		require.NoError(t, err)
+
+		frozen, err := repo.SetFreeze(ctx, wallet.ID, fullFreeze())
+		require.NoError(t, err)
+		assert.True(t, frozen.Frozen)
+		assert.Equal(t, deposit.Wallet.Version+1, frozen.Version)
+
+		_, err = repo.AddOperation(ctx, wallet.ID, "DEPOSIT", 100, entity.OperationDetails{}, 0)
+		assert.ErrorIs(t, err, repository.ErrWalletFrozen)
+		_, err = repo.ReverseOperation(ctx, deposit.Operation.ID, entity.OperationDetails{})
+		assert.ErrorIs(t, err, repository.ErrWalletFrozen)
+
+		_, err = repo.SetFreeze(ctx, wallet.ID, nil)
+		require.NoError(t, err)
+
+		reversal, err := repo.ReverseOperation(ctx, deposit.Operation.ID, entity.OperationDetails{})
+		require.NoError(t, err)
+		assert.Equal(t, "WITHDRAW", reversal.Operation.OperationType)
+		assert.Equal(t, 3000, reversal.Operation.Amount)
+		assert.Equal(t, &deposit.Operation.ID, reversal.Operation.ParentOperationID)
+		assert.Equal(t, "reversal:"+deposit.Operation.ID.String(), reversal.Operation.ExternalReference)
+		assert.Equal(t, 0, reversal.Wallet.Balance)
+
+		// a second reversal is reported as such although the balance could not cover it
+		_, err = repo.ReverseOperation(ctx, deposit.Operation.ID, entity.OperationDetails{})
+		assert.ErrorIs(t, err, repository.ErrAlreadyReversed)
+		_, err = repo.AddOperation(ctx, wallet.ID, "DEPOSIT", 3000, entity.OperationDetails{}, 0)
+		require.NoError(t, err)
+
+		withdrawal, err := repo.AddOperation(ctx, wallet.ID, "WITHDRAW", 100, entity.OperationDetails{}, 0)
+		require.NoError(t, err)
+		refund, err := repo.ReverseOperation(ctx, withdrawal.Operation.ID, entity.OperationDetails{Description: "Refund"})
+		require.NoError(t, err)
+		assert.Equal(t, "DEPOSIT", refund.Operation.OperationType)
+		assert.Equal(t, "Refund", refund.Operation.Description)
+		assert.Equal(t, 3000, refund.Wallet.Balance)
+
+		// a reversal can not be reversed itself
+		_, err = repo.ReverseOperation(ctx, reversal.Operation.ID, entity.OperationDetails{})
+		assert.ErrorIs(t, err, repository.ErrNotReversible)
+	})
+
+	t.Run("DepositOnlyFreeze", func(t *testing.T) {
+		repo := newHarness(t).repo
+		wallet := newWallet(t, repo, 0)
+
+		deposit, err := repo.AddOperation(ctx, wallet.ID, "DEPOSIT", 3000, entity.OperationDetails{}, 0)
+		require.NoError(t, err)
+
+		frozen, err := repo.SetFreeze(ctx, wallet.ID, &entity.Freeze{Mode: entity.FreezeDepositOnly, Reason: entity.FreezeReasonAML})
+		require.NoError(t, err)
+		assert.True(t, frozen.Frozen)
+		assert.Equal(t, &entity.Freeze{Mode: entity.FreezeDepositOnly, Reason: entity.FreezeReasonAML}, frozen.Freeze)
+
+		_, err = repo.AddOperation(ctx, wallet.ID, "DEPOSIT", 100, entity.OperationDetails{}, 0)
+		assert.NoError(t, err)
+		_, err = repo.AddOperation(ctx, wallet.ID, "WITHDRAW", 100, entity.OperationDetails{}, 0)
+		assert.ErrorIs(t, err, repository.ErrWalletFrozen)
+		// reversing a deposit withdraws the money
+		_, err = repo.ReverseOperation(ctx, deposit.Operation.ID, entity.OperationDetails{})
+		assert.ErrorIs(t, err, repository.ErrWalletFrozen)
+	})
+
+	t.Run("ExpiredFreeze", func(t *testing.T) {
+		repo := newHarness(t).repo
+		wallet := newWallet(t, repo, 1000)
+
+		until := time.Now().Add(-time.Minute)
+		frozen, err := repo.SetFreeze(ctx, wallet.ID, &entity.Freeze{Mode: entity.FreezeFull, Reason: entity.FreezeReasonCustomerRequest, Until: &until})
+		require.NoError(t, err)
+		assert.False(t, frozen.Frozen)
+		require.NotNil(t, frozen.Freeze)
+
+		_, err = repo.AddOperation(ctx, wallet.ID, "WITHDRAW", 100, entity.OperationDetails{}, 0)
+		assert.NoError(t, err)
+	})
+
+	t.Run("LegalHold", func(t *testing.T) {
+		repo := newHarness(t).repo
+		wallet, err := repo.CreateWallet(ctx, entity.WalletCreate{CreditLimit: 5000, MinBalance: 100})
+		require.NoError(t, err)
+		_, err = repo.AddOperation(ctx, wallet.ID, "DEPOSIT", 1000, entity.OperationDetails{}, 0)
+		require.NoError(t, err)
+
+		held, err := repo.SetFreeze(ctx, wallet.ID, &entity.Freeze{Reason: entity.FreezeReasonCourtOrder, HoldAmount: 600})
+		require.NoError(t, err)
+		assert.False(t, held.Frozen)
+		assert.Equal(t, 300, held.Available)
+
+		// the credit line does not cover money on hold
+		_, err = repo.AddOperation(ctx, wallet.ID, "WITHDRAW", 301, entity.OperationDetails{}, 0)
+		assert.ErrorIs(t, err, repository.ErrInsufficientFunds)
+		result, err := repo.AddOperation(ctx, wallet.ID, "WITHDRAW", 300, entity.OperationDetails{}, 0)
+		require.NoError(t, err)
+		assert.Equal(t, 700, result.Wallet.Balance)
+		assert.Equal(t, 0, result.Wallet.Available)
+
+		lifted, err := repo.SetFreeze(ctx, wallet.ID, nil)
+		require.NoError(t, err)
+		assert.Nil(t, lifted.Freeze)
+		assert.Equal(t, 5600, lifted.Available)
+	})
+
+	t.Run("FreezeHistory", func(t *testing.T) {
+		repo := newHarness(t).repo
+		wallet := newWallet(t, repo, 0)
+		ctx := audit.WithOrigin(ctx, audit.Origin{Principal: "cli:compliance", ClaimedActor: "officer-1", RequestID: "req-7"})
+
+		freeze := &entity.Freeze{Mode: entity.FreezeFull, Reason: entity.FreezeReasonSanctions, HoldAmount: 50}
+		_, err := repo.SetFreeze(ctx, wallet.ID, freeze)
+		require.NoError(t, err)
+		_, err = repo.SetFreeze(ctx, wallet.ID, nil)
+		require.NoError(t, err)
+
+		events, err := repo.ListFreezeHistory(ctx, wallet.ID)
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		assert.Equal(t, entity.FreezeActionFreeze, events[0].Action)
+		assert.Equal(t, freeze, events[0].Freeze)
+		assert.Equal(t, "cli:compliance", events[0].Principal)
+		assert.Equal(t, "officer-1", events[0].ClaimedActor)
+		assert.Equal(t, "req-7", events[0].RequestID)
+		assert.Equal(t, entity.FreezeActionUnfreeze, events[1].Action)
+		assert.Nil(t, events[1].Freeze)
+		assert.Less(t, events[0].ID, events[1].ID)
+
+		_, err = repo.ListFreezeHistory(ctx, uuid.New())
+		assert.ErrorIs(t, err, repository.ErrWalletNotFound)
+	})
+
+	t.Run("UpdateWallet", func(t *testing.T) {
+		repo := newHarness(t).repo
+
+		wallet, err := repo.CreateWallet(ctx, entity.WalletCreate{
+			OwnerID:     "user-1",
+			DisplayName: "Savings",
+			Labels:      map[string]string{"tier": "gold", "region": "eu"},
+		})
+		require.NoError(t, err)
+
+		empty := ""
+		labels := map[string]string{"tier": "silver"}
+		updated, err := repo.UpdateWallet(ctx, wallet.ID, entity.WalletUpdate{
+			DisplayName: &empty,
+			Labels:      &labels,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "user-1", updated.OwnerID)
+		assert.Equal(t, "", updated.DisplayName)
+		assert.Equal(t, map[string]string{"tier": "silver"}, updated.Labels)
+		assert.Equal(t, wallet.Version+1, updated.Version)
+
+		var cleared map[string]string
+		updated, err = repo.UpdateWallet(ctx, wallet.ID, entity.WalletUpdate{Labels: &cleared})
+		require.NoError(t, err)
+		assert.Empty(t, updated.Labels)
+	})
+
+	t.Run("SearchWallets", func(t *testing.T) {
+		repo := newHarness(t).repo
+
+		var owned []uuid.UUID
+		for i := 0; i < 3; i++ {
+			wallet, err := repo.CreateWallet(ctx, entity.WalletCreate{
+				OwnerID: "user-1",
+				Labels:  map[string]string{"tier": "gold", "index": string(rune('a' + i))},
+			})
+			require.NoError(t, err)
+			owned = append(owned, wallet.ID)
+		}
+		_, err := repo.CreateWallet(ctx, entity.WalletCreate{OwnerID: "user-2", Labels: map[string]string{"tier": "gold"}})
+		require.NoError(t, err)
+
+		wallets, err := repo.SearchWallets(ctx, entity.WalletFilter{OwnerID: "user-1", Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, wallets, 3)
+		assert.Less(t, wallets[0].ID.String(), wallets[1].ID.String())
+
+		wallets, err = repo.SearchWallets(ctx, entity.WalletFilter{Labels: map[string]string{"tier": "gold"}, Limit: 10})
+		require.NoError(t, err)
+		assert.Len(t, wallets, 4)
+
+		wallets, err = repo.SearchWallets(ctx, entity.WalletFilter{Labels: map[string]string{"tier": "gold", "index": "b"}, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, wallets, 1)
+		assert.Equal(t, owned[1], wallets[0].ID)
+
+		page, err := repo.SearchWallets(ctx, entity.WalletFilter{OwnerID: "user-1", Limit: 2})
+		require.NoError(t, err)
+		require.Len(t, page, 2)
+		rest, err := repo.SearchWallets(ctx, entity.WalletFilter{OwnerID: "user-1", After: page[1].ID, Limit: 2})
+		require.NoError(t, err)
+		require.Len(t, rest, 1)
+		assert.NotContains(t, []uuid.UUID{page[0].ID, page[1].ID}, rest[0].ID)
+	})
+
+	t.Run("ListOperations", func(t *testing.T) {
+		repo := newHarness(t).repo
+		wallet := newWallet(t, repo, 0)
+
+		for i, details := range []entity.OperationDetails{
+			{Description: "Salary for August", Metadata: map[string]any{"source": "payroll"}},
+			{Description: "Coffee", ExternalReference: "pos-1"},
+			{Description: "Salary for September", Metadata: map[string]any{"source": "payroll", "month": 9}},
+		} {
+			operationType := "DEPOSIT"
+			if i == 1 {
+				operationType = "WITHDRAW"
+			}
+			_, err := repo.AddOperation(ctx, wallet.ID, operationType, 100, details, 0)
+			require.NoError(t, err)
+		}
+
+		operations, err := repo.ListOperations(ctx, entity.OperationFilter{WalletID: wallet.ID, Limit: 2})
+		require.NoError(t, err)
+		require.Len(t, operations, 2)
+		assert.Equal(t, "Salary for September", operations[0].Description)
+
+		older, err := repo.ListOperations(ctx, entity.OperationFilter{WalletID: wallet.ID, BeforeSeq: operations[1].Seq, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, older, 1)
+		assert.Equal(t, "Salary for August", older[0].Description)
+
+		for name, tc := range map[string]struct {
+			filter entity.OperationFilter
+			count  int
+		}{
+			"type":        {entity.OperationFilter{OperationType: "WITHDRAW"}, 1},
+			"reference":   {entity.OperationFilter{ExternalReference: "pos-1"}, 1},
+			"description": {entity.OperationFilter{Description: "salary"}, 2},
+			"metadata":    {entity.OperationFilter{Metadata: map[string]string{"source": "payroll"}}, 2},
+			"number":      {entity.OperationFilter{Metadata: map[string]string{"month": "9"}}, 1},
+			"no match":    {entity.OperationFilter{Description: "rent"}, 0},
+		} {
+			tc.filter.WalletID = wallet.ID
+			tc.filter.Limit = 10
+			operations, err := repo.ListOperations(ctx, tc.filter)
+			require.NoError(t, err, name)
+			assert.Len(t, operations, tc.count, name)
+		}
+	})
+
+	t.Run("History", func(t *testing.T) {
+		repo := newHarness(t).repo
+		wallet := newWallet(t, repo, 0)
+
+		first, err := repo.AddOperation(ctx, wallet.ID, "DEPOSIT", 1000, entity.OperationDetails{}, 0)
+		require.NoError(t, err)
+		time.Sleep(10 * time.Millisecond)
+		second, err := repo.AddOperation(ctx, wallet.ID, "WITHDRAW", 300, entity.OperationDetails{}, 0)
+		require.NoError(t, err)
+
+		events, err := repo.GetBalanceEvents(ctx, wallet.ID, first.Operation.Seq, 10)
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		assert.Equal(t, second.Operation.ID, events[0].OperationID)
+		assert.Equal(t, 700, events[0].Balance)
+
+		balance, err := repo.GetBalanceAt(ctx, wallet.ID, first.Operation.CreatedAt)
+		require.NoError(t, err)
+		assert.Equal(t, 1000, balance)
+
+		balance, err = repo.GetBalanceAt(ctx, wallet.ID, first.Operation.CreatedAt.Add(-time.Microsecond))
+		require.NoError(t, err)
+		assert.Equal(t, 0, balance)
+
+		var streamed []uuid.UUID
+		err = repo.StreamOperations(ctx, wallet.ID, first.Operation.CreatedAt, second.Operation.CreatedAt, func(operation entity.Operation) error {
+			streamed = append(streamed, operation.ID)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{first.Operation.ID}, streamed)
+
+		stop := errors.New("stop")
+		err = repo.StreamOperations(ctx, wallet.ID, first.Operation.CreatedAt, time.Now().Add(time.Hour), func(entity.Operation) error {
+			return stop
+		})
+		assert.ErrorIs(t, err, stop)
+	})
+
+	t.Run("BalanceShards", func(t *testing.T) {
+		repo := newHarness(t).repo
+		wallet := newWallet(t, repo, 1000)
+
+		_, err := repo.SetBalanceShards(ctx, uuid.New(), 4)
+		assert.ErrorIs(t, err, repository.ErrWalletNotFound)
+
+		sharded, err := repo.SetBalanceShards(ctx, wallet.ID, 4)
+		require.NoError(t, err)
+		assert.Equal(t, 4, sharded.BalanceShards)
+		assert.Equal(t, 1000, sharded.Balance)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				result, err := repo.AddOperation(ctx, wallet.ID, "DEPOSIT", 100, entity.OperationDetails{}, 0)
+				if assert.NoError(t, err) {
+					// sharded deposits do not know the total until the shards are swept
+					assert.Nil(t, result.Operation.BalanceBefore)
+					assert.Nil(t, result.Operation.BalanceAfter)
+				}
+			}()
+		}
+		wg.Wait()
+
+		current, err := repo.GetByID(ctx, wallet.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 2000, current.Balance)
+		assert.Equal(t, sharded.Version+10, current.Version)
+
+		// the version seen before the deposits is stale
+		_, err = repo.AddOperation(ctx, wallet.ID, "WITHDRAW", 1, entity.OperationDetails{}, sharded.Version)
+		assert.ErrorIs(t, err, repository.ErrVersionMismatch)
+
+		_, err = repo.AddOperation(ctx, wallet.ID, "WITHDRAW", 2001, entity.OperationDetails{}, current.Version)
+		assert.ErrorIs(t, err, repository.ErrInsufficientFunds)
+
+		withdrawal, err := repo.AddOperation(ctx, wallet.ID, "WITHDRAW", 1500, entity.OperationDetails{}, 0)
+		require.NoError(t, err)
+		assert.Equal(t, 2000, *withdrawal.Operation.BalanceBefore)
+		assert.Equal(t, 500, *withdrawal.Operation.BalanceAfter)
+		assert.Equal(t, 500, withdrawal.Wallet.Balance)
+
+		late, err := repo.AddOperation(ctx, wallet.ID, "DEPOSIT", 300, entity.OperationDetails{}, 0)
+		require.NoError(t, err)
+		assert.Equal(t, withdrawal.Wallet.Version+1, late.Wallet.Version)
+
+		balance, err := repo.GetBalanceAt(ctx, wallet.ID, time.Now().Add(time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, 800, balance)
+
+		// the withdrawal swept the deposits and published their balances before its own
+		events, err := repo.GetBalanceEvents(ctx, wallet.ID, 0, 100)
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, len(events), 11)
+		last := len(events) - 1
+		assert.Equal(t, withdrawal.Operation.ID, events[last].OperationID)
+		for i, event := range events[last-10 : last] {
+			assert.Equal(t, 1100+100*i, event.Balance)
+		}
+
+		discrepancies, err := repo.Reconcile(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, discrepancies)
+
+		_, err = repo.SetFreeze(ctx, wallet.ID, fullFreeze())
+		require.NoError(t, err)
+		_, err = repo.AddOperation(ctx, wallet.ID, "DEPOSIT", 100, entity.OperationDetails{}, 0)
+		assert.ErrorIs(t, err, repository.ErrWalletFrozen)
+		_, err = repo.SetFreeze(ctx, wallet.ID, nil)
+		require.NoError(t, err)
+
+		unsharded, err := repo.SetBalanceShards(ctx, wallet.ID, 0)
+		require.NoError(t, err)
+		assert.Equal(t, 0, unsharded.BalanceShards)
+		assert.Equal(t, 800, unsharded.Balance)
+
+		swept, err := repo.GetOperation(ctx, late.Operation.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 500, *swept.BalanceBefore)
+		assert.Equal(t, 800, *swept.BalanceAfter)
+
+		deposit, err := repo.AddOperation(ctx, wallet.ID, "DEPOSIT", 200, entity.OperationDetails{}, 0)
+		require.NoError(t, err)
+		assert.Equal(t, 800, *deposit.Operation.BalanceBefore)
+
+		discrepancies, err = repo.Reconcile(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, discrepancies)
+	})
+
+	t.Run("ConcurrentOperations", func(t *testing.T) {
+		repo := newHarness(t).repo
+		wallet := newWallet(t, repo, 0)
+
+		const workers = 20
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					_, err := repo.AddOperation(ctx, wallet.ID, "DEPOSIT", 100, entity.OperationDetails{}, 0)
+					if !errors.Is(err, repository.ErrWalletLocked) {
+						assert.NoError(t, err)
+						return
+					}
+					time.Sleep(time.Millisecond)
+				}
+			}()
+		}
+		wg.Wait()
+
+		final, err := repo.GetByID(ctx, wallet.ID)
+		require.NoError(t, err)
+		assert.Equal(t, workers*100, final.Balance)
+
+		discrepancies, err := repo.Reconcile(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, discrepancies)
+	})
+}
+
+func fullFreeze() *entity.Freeze {
+	return &entity.Freeze{Mode: entity.FreezeFull, Reason: entity.FreezeReasonOther}
+}
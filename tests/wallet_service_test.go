@@ -3,6 +3,7 @@ package tests
 import (
 	"context"
 	"testing"
+	"time"
 	"wallet_controller/internal/service"
 
 	"github.com/google/uuid"
@@ -23,9 +24,98 @@ func (m *MockWalletRepository) GetByID(ctx context.Context, walletID uuid.UUID)
 	return args.Get(0).(*entity.Wallet), args.Error(1)
 }
 
-func (m *MockWalletRepository) AddOperation(ctx context.Context, walletID uuid.UUID, operationType string, amount int) (entity.Wallet, error) {
-	args := m.Called(ctx, walletID, operationType, amount)
-	return args.Get(0).(entity.Wallet), args.Error(1)
+func (m *MockWalletRepository) AddOperation(ctx context.Context, walletID uuid.UUID, operationType string, amount int, details entity.OperationDetails, expectedVersion int64) (entity.OperationResult, error) {
+	args := m.Called(ctx, walletID, operationType, amount, details, expectedVersion)
+	return args.Get(0).(entity.OperationResult), args.Error(1)
+}
+
+func (m *MockWalletRepository) GetOperation(ctx context.Context, operationID uuid.UUID) (*entity.Operation, error) {
+	args := m.Called(ctx, operationID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*entity.Operation), args.Error(1)
+}
+
+func (m *MockWalletRepository) GetBalanceEvents(ctx context.Context, walletID uuid.UUID, afterSeq int64, limit int) ([]entity.BalanceEvent, error) {
+	args := m.Called(ctx, walletID, afterSeq, limit)
+	return args.Get(0).([]entity.BalanceEvent), args.Error(1)
+}
+
+func (m *MockWalletRepository) ListOperations(ctx context.Context, filter entity.OperationFilter) ([]entity.Operation, error) {
+	args := m.Called(ctx, filter)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]entity.Operation), args.Error(1)
+}
+
+func (m *MockWalletRepository) GetBalanceAt(ctx context.Context, walletID uuid.UUID, at time.Time) (int, error) {
+	args := m.Called(ctx, walletID, at)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockWalletRepository) StreamOperations(ctx context.Context, walletID uuid.UUID, from, to time.Time, fn func(operation entity.Operation) error) error {
+	args := m.Called(ctx, walletID, from, to, fn)
+	return args.Error(0)
+}
+
+func (m *MockWalletRepository) UpdateWallet(ctx context.Context, walletID uuid.UUID, update entity.WalletUpdate) (*entity.Wallet, error) {
+	args := m.Called(ctx, walletID, update)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*entity.Wallet), args.Error(1)
+}
+
+func (m *MockWalletRepository) SearchWallets(ctx context.Context, filter entity.WalletFilter) ([]entity.Wallet, error) {
+	args := m.Called(ctx, filter)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]entity.Wallet), args.Error(1)
+}
+
+func (m *MockWalletRepository) CreateWallet(ctx context.Context, create entity.WalletCreate) (*entity.Wallet, error) {
+	args := m.Called(ctx, create)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*entity.Wallet), args.Error(1)
+}
+
+func (m *MockWalletRepository) SetFreeze(ctx context.Context, walletID uuid.UUID, freeze *entity.Freeze) (*entity.Wallet, error) {
+	args := m.Called(ctx, walletID, freeze)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*entity.Wallet), args.Error(1)
+}
+
+func (m *MockWalletRepository) ListFreezeHistory(ctx context.Context, walletID uuid.UUID) ([]entity.FreezeEvent, error) {
+	args := m.Called(ctx, walletID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]entity.FreezeEvent), args.Error(1)
+}
+
+func (m *MockWalletRepository) SetBalanceShards(ctx context.Context, walletID uuid.UUID, shards int) (*entity.Wallet, error) {
+	args := m.Called(ctx, walletID, shards)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*entity.Wallet), args.Error(1)
+}
+
+func (m *MockWalletRepository) ReverseOperation(ctx context.Context, operationID uuid.UUID, details entity.OperationDetails) (entity.OperationResult, error) {
+	args := m.Called(ctx, operationID, details)
+	return args.Get(0).(entity.OperationResult), args.Error(1)
+}
+
+func (m *MockWalletRepository) Reconcile(ctx context.Context) ([]entity.Discrepancy, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]entity.Discrepancy), args.Error(1)
 }
 
 func TestGetWallet_Success(t *testing.T) {
@@ -79,16 +169,16 @@ func TestAddOperation_Deposit_Success(t *testing.T) {
 		Balance: 10000, // было 0, добавили 100 * 100
 	}
 
-	mockRepo.On("AddOperation", mock.Anything, walletID, "DEPOSIT", 10000).
-		Return(expectedWallet, nil)
+	mockRepo.On("AddOperation", mock.Anything, walletID, "DEPOSIT", 10000, entity.OperationDetails{}, int64(0)).
+		Return(entity.OperationResult{Wallet: expectedWallet}, nil)
 
 	mService := service.NewWalletService(mockRepo)
 
 	ctx := context.Background()
-	wallet, err := mService.AddOperation(ctx, req)
+	result, err := mService.AddOperation(ctx, req)
 
 	assert.NoError(t, err)
-	assert.Equal(t, expectedWallet, wallet)
+	assert.Equal(t, expectedWallet, result.Wallet)
 	mockRepo.AssertExpectations(t)
 }
 
@@ -107,16 +197,16 @@ func TestAddOperation_Withdraw_Success(t *testing.T) {
 		Balance: 5000,
 	}
 
-	mockRepo.On("AddOperation", mock.Anything, walletID, "WITHDRAW", 5000).
-		Return(expectedWallet, nil)
+	mockRepo.On("AddOperation", mock.Anything, walletID, "WITHDRAW", 5000, entity.OperationDetails{}, int64(0)).
+		Return(entity.OperationResult{Wallet: expectedWallet}, nil)
 
 	mService := service.NewWalletService(mockRepo)
 
 	ctx := context.Background()
-	wallet, err := mService.AddOperation(ctx, req)
+	result, err := mService.AddOperation(ctx, req)
 
 	assert.NoError(t, err)
-	assert.Equal(t, expectedWallet, wallet)
+	assert.Equal(t, expectedWallet, result.Wallet)
 	mockRepo.AssertExpectations(t)
 }
 
@@ -130,16 +220,16 @@ func TestAddOperation_InsufficientFunds(t *testing.T) {
 		Amount:        500,
 	}
 
-	mockRepo.On("AddOperation", mock.Anything, walletID, "WITHDRAW", 50000).
-		Return(entity.Wallet{}, assert.AnError)
+	mockRepo.On("AddOperation", mock.Anything, walletID, "WITHDRAW", 50000, entity.OperationDetails{}, int64(0)).
+		Return(entity.OperationResult{}, assert.AnError)
 
 	mService := service.NewWalletService(mockRepo)
 
 	ctx := context.Background()
-	wallet, err := mService.AddOperation(ctx, req)
+	result, err := mService.AddOperation(ctx, req)
 
 	assert.Error(t, err)
-	assert.Equal(t, entity.Wallet{}, wallet)
+	assert.Equal(t, entity.OperationResult{}, result)
 	mockRepo.AssertExpectations(t)
 }
 
@@ -158,15 +248,15 @@ func TestAddOperation_MultipleOperations(t *testing.T) {
 		Balance: 10000,
 	}
 
-	mockRepo.On("AddOperation", mock.Anything, walletID, "DEPOSIT", 10000).
-		Return(wallet1, nil)
+	mockRepo.On("AddOperation", mock.Anything, walletID, "DEPOSIT", 10000, entity.OperationDetails{}, int64(0)).
+		Return(entity.OperationResult{Wallet: wallet1}, nil)
 
 	mService := service.NewWalletService(mockRepo)
 
 	ctx := context.Background()
 	w1, err := mService.AddOperation(ctx, req1)
 	assert.NoError(t, err)
-	assert.Equal(t, wallet1, w1)
+	assert.Equal(t, wallet1, w1.Wallet)
 
 	req2 := &entity.OperationRequest{
 		WalletID:      walletID,
@@ -179,12 +269,96 @@ func TestAddOperation_MultipleOperations(t *testing.T) {
 		Balance: 5000,
 	}
 
-	mockRepo.On("AddOperation", mock.Anything, walletID, "WITHDRAW", 5000).
-		Return(wallet2, nil)
+	mockRepo.On("AddOperation", mock.Anything, walletID, "WITHDRAW", 5000, entity.OperationDetails{}, int64(0)).
+		Return(entity.OperationResult{Wallet: wallet2}, nil)
 
 	w2, err := mService.AddOperation(ctx, req2)
 	assert.NoError(t, err)
-	assert.Equal(t, wallet2, w2)
+	assert.Equal(t, wallet2, w2.Wallet)
 
 	mockRepo.AssertNumberOfCalls(t, "AddOperation", 2)
 }
+
+type recordingStatementWriter struct {
+	period  entity.StatementPeriod
+	rows    []entity.StatementRow
+	closing int
+}
+
+func (w *recordingStatementWriter) Begin(period entity.StatementPeriod) error {
+	w.period = period
+	return nil
+}
+
+func (w *recordingStatementWriter) Row(row entity.StatementRow) error {
+	w.rows = append(w.rows, row)
+	return nil
+}
+
+func (w *recordingStatementWriter) End(closingBalance int) error {
+	w.closing = closingBalance
+	return nil
+}
+
+func TestWriteStatement_RunningBalance(t *testing.T) {
+	mockRepo := new(MockWalletRepository)
+	walletID := uuid.New()
+	from := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	mockRepo.On("GetBalanceAt", mock.Anything, walletID, from.Add(-time.Microsecond)).Return(10000, nil)
+	mockRepo.On("StreamOperations", mock.Anything, walletID, from, to, mock.Anything).
+		Run(func(args mock.Arguments) {
+			fn := args.Get(4).(func(operation entity.Operation) error)
+			_ = fn(entity.Operation{ID: uuid.New(), WalletID: walletID, OperationType: "DEPOSIT", Amount: 5000})
+			_ = fn(entity.Operation{ID: uuid.New(), WalletID: walletID, OperationType: "WITHDRAW", Amount: 3000})
+		}).Return(nil)
+
+	walletService := service.NewWalletService(mockRepo)
+	writer := &recordingStatementWriter{}
+
+	err := walletService.WriteStatement(context.Background(), walletID, from, to, writer)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 10000, writer.period.OpeningBalance)
+	assert.Len(t, writer.rows, 2)
+	assert.Equal(t, 15000, writer.rows[0].Balance)
+	assert.Equal(t, 12000, writer.rows[1].Balance)
+	assert.Equal(t, 12000, writer.closing)
+
+	mockRepo.AssertExpectations(t)
+}
+
+func TestSetBalanceShards_Invalid(t *testing.T) {
+	mockRepo := new(MockWalletRepository)
+	walletService := service.NewWalletService(mockRepo)
+
+	for _, shards := range []int{-1, service.MaxBalanceShards + 1} {
+		wallet, err := walletService.SetBalanceShards(context.Background(), uuid.New(), shards)
+
+		assert.ErrorIs(t, err, service.ErrInvalidBalanceShards)
+		assert.Nil(t, wallet)
+	}
+	mockRepo.AssertNotCalled(t, "SetBalanceShards", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestFreezeWallet_Invalid(t *testing.T) {
+	mockRepo := new(MockWalletRepository)
+	walletService := service.NewWalletService(mockRepo)
+
+	past := time.Now().Add(-time.Hour)
+	for _, freeze := range []entity.Freeze{
+		{Mode: "PARTIAL", Reason: entity.FreezeReasonFraud},
+		{Mode: entity.FreezeFull},
+		{Mode: entity.FreezeFull, Reason: "BORED"},
+		{Reason: entity.FreezeReasonCourtOrder},
+		{Reason: entity.FreezeReasonCourtOrder, HoldAmount: -1},
+		{Mode: entity.FreezeDepositOnly, Reason: entity.FreezeReasonAML, Until: &past},
+	} {
+		wallet, err := walletService.FreezeWallet(context.Background(), uuid.New(), freeze)
+
+		assert.ErrorIs(t, err, service.ErrInvalidFreeze, freeze)
+		assert.Nil(t, wallet)
+	}
+	mockRepo.AssertNotCalled(t, "SetFreeze", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,296 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"wallet_controller/internal/handler"
+	"wallet_controller/internal/repository"
+	"wallet_controller/internal/service"
+	"wallet_controller/internal/webhook"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"wallet_controller/internal/entity"
+)
+
+type MockWebhookRepository struct {
+	mock.Mock
+}
+
+func (m *MockWebhookRepository) CreateSubscription(ctx context.Context, subscription *entity.WebhookSubscription) error {
+	args := m.Called(ctx, subscription)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepository) GetSubscription(ctx context.Context, subscriptionID uuid.UUID) (*entity.WebhookSubscription, error) {
+	args := m.Called(ctx, subscriptionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*entity.WebhookSubscription), args.Error(1)
+}
+
+func (m *MockWebhookRepository) ListSubscriptions(ctx context.Context) ([]entity.WebhookSubscription, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]entity.WebhookSubscription), args.Error(1)
+}
+
+func (m *MockWebhookRepository) UpdateSubscription(ctx context.Context, subscription *entity.WebhookSubscription) error {
+	args := m.Called(ctx, subscription)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepository) DeleteSubscription(ctx context.Context, subscriptionID uuid.UUID) error {
+	args := m.Called(ctx, subscriptionID)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepository) ListDeliveries(ctx context.Context, subscriptionID uuid.UUID, limit int) ([]entity.WebhookDelivery, error) {
+	args := m.Called(ctx, subscriptionID, limit)
+	return args.Get(0).([]entity.WebhookDelivery), args.Error(1)
+}
+
+func (m *MockWebhookRepository) EnqueueDeliveries(ctx context.Context, event entity.Event) (int, error) {
+	args := m.Called(ctx, event)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockWebhookRepository) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]entity.WebhookDeliveryTask, error) {
+	args := m.Called(ctx, limit, lease)
+	return args.Get(0).([]entity.WebhookDeliveryTask), args.Error(1)
+}
+
+func (m *MockWebhookRepository) MarkDelivered(ctx context.Context, deliveryID uuid.UUID, statusCode int) error {
+	args := m.Called(ctx, deliveryID, statusCode)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepository) MarkFailed(ctx context.Context, deliveryID uuid.UUID, statusCode int, reason string, retryAfter time.Duration) error {
+	args := m.Called(ctx, deliveryID, statusCode, reason, retryAfter)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepository) MarkDead(ctx context.Context, deliveryID uuid.UUID, statusCode int, reason string) error {
+	args := m.Called(ctx, deliveryID, statusCode, reason)
+	return args.Error(0)
+}
+
+func newDeliveryTask(url string, attempts int) entity.WebhookDeliveryTask {
+	return entity.WebhookDeliveryTask{
+		Delivery: entity.WebhookDelivery{
+			ID:        uuid.New(),
+			EventID:   7,
+			EventType: entity.EventBalanceChanged,
+			Payload:   json.RawMessage(`{"id":7,"type":"BalanceChanged"}`),
+			Attempts:  attempts,
+		},
+		URL:    url,
+		Secret: "top-secret",
+	}
+}
+
+func TestWebhookSignature_RoundTrip(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	now := time.Now().Unix()
+	signature := webhook.Sign("secret", now, body)
+
+	assert.NoError(t, webhook.Verify("secret", strconv.FormatInt(now, 10), signature, body, time.Minute))
+	assert.ErrorIs(t, webhook.Verify("other", strconv.FormatInt(now, 10), signature, body, time.Minute), webhook.ErrInvalidSignature)
+	assert.ErrorIs(t, webhook.Verify("secret", strconv.FormatInt(now, 10), signature, []byte(`{"id":2}`), time.Minute), webhook.ErrInvalidSignature)
+
+	old := time.Now().Add(-time.Hour).Unix()
+	assert.ErrorIs(t, webhook.Verify("secret", strconv.FormatInt(old, 10), webhook.Sign("secret", old, body), body, time.Minute), webhook.ErrStaleTimestamp)
+}
+
+func TestWebhookWorker_Backoff(t *testing.T) {
+	worker := webhook.NewWorker(new(MockWebhookRepository), webhook.WorkerConfig{
+		RetryBase: time.Second,
+		RetryMax:  10 * time.Second,
+	})
+
+	assert.Equal(t, time.Second, worker.Backoff(1))
+	assert.Equal(t, 2*time.Second, worker.Backoff(2))
+	assert.Equal(t, 8*time.Second, worker.Backoff(4))
+	assert.Equal(t, 10*time.Second, worker.Backoff(5))
+	assert.Equal(t, 10*time.Second, worker.Backoff(30))
+}
+
+func TestWebhookWorker_DeliversSignedPayload(t *testing.T) {
+	var verifyErr error
+	var received []byte
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+		verifyErr = webhook.Verify("top-secret",
+			r.Header.Get(webhook.HeaderTimestamp),
+			r.Header.Get(webhook.HeaderSignature),
+			received,
+			time.Minute,
+		)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	task := newDeliveryTask(server.URL, 0)
+
+	// the lease outlasts a whole batch of deliveries timing out one after another
+	repo := new(MockWebhookRepository)
+	repo.On("ClaimDueDeliveries", mock.Anything, 50, 51*10*time.Second).Return([]entity.WebhookDeliveryTask{task}, nil)
+	repo.On("MarkDelivered", mock.Anything, task.Delivery.ID, http.StatusOK).Return(nil)
+
+	worker := webhook.NewWorker(repo, webhook.WorkerConfig{})
+
+	assert.Equal(t, 1, worker.ProcessDue(context.Background()))
+	assert.NoError(t, verifyErr)
+	assert.JSONEq(t, string(task.Delivery.Payload), string(received))
+	repo.AssertExpectations(t)
+}
+
+func TestWebhookWorker_SchedulesRetryOnFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	task := newDeliveryTask(server.URL, 2)
+
+	repo := new(MockWebhookRepository)
+	repo.On("ClaimDueDeliveries", mock.Anything, 50, mock.Anything).Return([]entity.WebhookDeliveryTask{task}, nil)
+	repo.On("MarkFailed", mock.Anything, task.Delivery.ID, http.StatusInternalServerError, mock.Anything, 4*time.Second).Return(nil)
+
+	worker := webhook.NewWorker(repo, webhook.WorkerConfig{RetryBase: time.Second})
+
+	assert.Equal(t, 0, worker.ProcessDue(context.Background()))
+	repo.AssertExpectations(t)
+}
+
+func TestWebhookWorker_DeadLettersAfterMaxAttempts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	task := newDeliveryTask(server.URL, 2)
+
+	repo := new(MockWebhookRepository)
+	repo.On("ClaimDueDeliveries", mock.Anything, 50, mock.Anything).Return([]entity.WebhookDeliveryTask{task}, nil)
+	repo.On("MarkDead", mock.Anything, task.Delivery.ID, http.StatusBadGateway, mock.Anything).Return(nil)
+
+	worker := webhook.NewWorker(repo, webhook.WorkerConfig{MaxAttempts: 3})
+
+	assert.Equal(t, 0, worker.ProcessDue(context.Background()))
+	repo.AssertExpectations(t)
+	repo.AssertNotCalled(t, "MarkFailed", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestWebhookDispatcher_EnqueuesEvent(t *testing.T) {
+	event := newTestEvent(3)
+
+	repo := new(MockWebhookRepository)
+	repo.On("EnqueueDeliveries", mock.Anything, event).Return(2, nil)
+
+	require.NoError(t, webhook.NewDispatcher(repo).Publish(context.Background(), event))
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerCreateWebhook_Success(t *testing.T) {
+	repo := new(MockWebhookRepository)
+	repo.On("CreateSubscription", mock.Anything, mock.MatchedBy(func(s *entity.WebhookSubscription) bool {
+		return s.URL == "https://partner.example/hook" && s.Active && len(s.Secret) == 64
+	})).Return(nil)
+
+	mHandler := handler.NewWebhookHandler(service.NewWebhookService(repo))
+
+	router := setupGinRouter()
+	router.POST("/webhooks", mHandler.CreateSubscription)
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"url":         "https://partner.example/hook",
+		"event_types": []string{entity.EventBalanceChanged},
+	})
+	httpReq := httptest.NewRequest(http.MethodPost, "/webhooks", bytes.NewReader(body))
+	httpReq.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, httpReq)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var subscription entity.WebhookSubscription
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &subscription))
+	assert.NotEmpty(t, subscription.Secret)
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerCreateWebhook_InvalidRequest(t *testing.T) {
+	mHandler := handler.NewWebhookHandler(service.NewWebhookService(new(MockWebhookRepository)))
+
+	router := setupGinRouter()
+	router.POST("/webhooks", mHandler.CreateSubscription)
+
+	for _, body := range []string{
+		`{"url":"ftp://partner.example/hook"}`,
+		`{"url":"/relative"}`,
+		`{"url":"https://partner.example/hook","event_types":["WalletDeleted"]}`,
+	} {
+		httpReq := httptest.NewRequest(http.MethodPost, "/webhooks", bytes.NewReader([]byte(body)))
+		httpReq.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, httpReq)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+}
+
+func TestHandlerCreateWebhook_UnknownWallet(t *testing.T) {
+	repo := new(MockWebhookRepository)
+	repo.On("CreateSubscription", mock.Anything, mock.Anything).Return(repository.ErrWalletNotFound)
+
+	mHandler := handler.NewWebhookHandler(service.NewWebhookService(repo))
+
+	router := setupGinRouter()
+	router.POST("/webhooks", mHandler.CreateSubscription)
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"url":       "https://partner.example/hook",
+		"wallet_id": uuid.New(),
+	})
+	httpReq := httptest.NewRequest(http.MethodPost, "/webhooks", bytes.NewReader(body))
+	httpReq.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, httpReq)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	repo.AssertExpectations(t)
+}
+
+func TestHandlerGetWebhook_NotFound(t *testing.T) {
+	subscriptionID := uuid.New()
+
+	repo := new(MockWebhookRepository)
+	repo.On("GetSubscription", mock.Anything, subscriptionID).Return(nil, repository.ErrSubscriptionNotFound)
+
+	mHandler := handler.NewWebhookHandler(service.NewWebhookService(repo))
+
+	router := setupGinRouter()
+	router.GET("/webhooks/:id/deliveries", mHandler.ListDeliveries)
+
+	req := httptest.NewRequest(http.MethodGet, "/webhooks/"+subscriptionID.String()+"/deliveries", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	repo.AssertExpectations(t)
+}